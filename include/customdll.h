@@ -0,0 +1,42 @@
+#ifndef CUSTOMDLL_H
+#define CUSTOMDLL_H
+
+/*
+ * Interface of the CustomDLL called by OpenScape Contact Center.
+ *
+ * The Go bindings in tools/shared/dllclient are generated from this header
+ * (go generate ./... in tools/shared), so keep it in sync with the exports.
+ */
+
+#ifdef _WIN32
+#define CUSTOMDLL_API __declspec(dllexport)
+#else
+#define CUSTOMDLL_API
+#endif
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Return codes of CustomFunctionExample. Any non-zero code is a failure. */
+enum CustomDLLErrorCode {
+    SUCCESS = 0,              /* Success */
+    INVALID_INPUT = 1,        /* Invalid input parameters */
+    TOO_MANY_PARAMETERS = 2,  /* Too many parameters */
+    CURL_INIT_FAILED = 3,     /* CURL initialization failed */
+    CURL_REQUEST_FAILED = 4,  /* CURL request failed */
+    HTTP_ERROR = 5,           /* HTTP error */
+    UNEXPECTED_EXCEPTION = 6  /* Unexpected exception */
+};
+
+/* Processes the key/value pairs of dataIn and writes the output pairs to dataOut */
+CUSTOMDLL_API long CustomFunctionExample(const char* dataIn, char* dataOut);
+
+/* Returns the message describing the last failure of the calling thread */
+CUSTOMDLL_API const char* GetLastErrorMessage(void);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* CUSTOMDLL_H */
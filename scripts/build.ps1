@@ -14,6 +14,7 @@ param(
     [switch]$BuildTools = $true,
     [switch]$BuildGoServer = $false,
     [switch]$BuildContactCenterSimulator = $false,
+    [switch]$BuildMockDll = $false,
     [switch]$GenerateTestCertificate = $false
 )
 
@@ -43,6 +44,7 @@ Write-Host "Configuration Type: $ConfigType (Runtime = config.ini support, Stati
 Write-Host "Build Tools: $BuildTools"
 Write-Host "Build Go Server: $BuildGoServer"
 Write-Host "Build Contact Center Simulator: $BuildContactCenterSimulator"
+Write-Host "Build Mock DLL: $BuildMockDll"
 Write-Host "Generate Test Certificate: $GenerateTestCertificate"
 
 # Check if CMake is installed
@@ -1019,6 +1021,26 @@ if ($BuildContactCenterSimulator) {
     }
 }
 
+# Build the Go mock DLL if requested (needs cgo and a C compiler such as MinGW-w64)
+if ($BuildMockDll) {
+    Write-Host "Building mock DLL..."
+    if (Get-Command "go" -ErrorAction SilentlyContinue) {
+        Set-Location "tools\mock_dll"
+        $env:CGO_ENABLED = "1"
+        & go build -buildmode=c-shared -o "..\..\build\bin\mock\CustomDLL.dll" .
+        $buildSuccess = $LASTEXITCODE -eq 0
+        Set-Location $rootDir
+
+        if ($buildSuccess) {
+            Write-Host "Mock DLL built successfully." -ForegroundColor Green
+        } else {
+            Write-Host "Error: Mock DLL build failed. It needs a C compiler (e.g. MinGW-w64 gcc) in PATH." -ForegroundColor Red
+        }
+    } else {
+        Write-Host "Go is not installed. Skipping mock DLL build."
+    }
+}
+
 # Create subdirectories for distribution
 if (-not (Test-Path "dist\tools")) {
     New-Item -ItemType Directory -Path "dist\tools" | Out-Null
@@ -1206,4 +1228,18 @@ if ($BuildContactCenterSimulator) {
     }
 }
 
+# Copy the mock DLL if built, next to the simulator's DLLs
+if ($BuildMockDll -and (Test-Path "build\bin\mock\CustomDLL.dll")) {
+    foreach ($mockDir in @("dist\mock", "dist\tools\dist\mock")) {
+        if (-not (Test-Path $mockDir)) {
+            New-Item -ItemType Directory -Path $mockDir -Force | Out-Null
+        }
+        Copy-Item "build\bin\mock\CustomDLL.dll" -Destination "$mockDir\" -Force
+        if (-not (Test-Path "$mockDir\config.ini")) {
+            Copy-Item "config\config.ini" -Destination "$mockDir\" -Force
+        }
+    }
+    Write-Host "Mock DLL copied to dist\mock and dist\tools\dist\mock" -ForegroundColor Green
+}
+
 Write-Host "Build completed successfully."
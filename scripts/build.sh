@@ -20,6 +20,7 @@ CONFIG_TYPE="both"  # Options: runtime, static, both
 BUILD_TOOLS=true
 BUILD_GO_SERVER=false
 BUILD_CONTACT_CENTER_SIMULATOR=false
+BUILD_MOCK_DLL=false
 
 # Parse command line arguments
 while [[ $# -gt 0 ]]; do
@@ -64,6 +65,10 @@ while [[ $# -gt 0 ]]; do
       BUILD_CONTACT_CENTER_SIMULATOR=true
       shift
       ;;
+    --build-mock-dll)
+      BUILD_MOCK_DLL=true
+      shift
+      ;;
     *)
       echo "Unknown option: $1"
       exit 1
@@ -81,6 +86,7 @@ echo "Configuration Type: $CONFIG_TYPE (runtime = config.ini support, static = c
 echo "Build Tools: $BUILD_TOOLS"
 echo "Build Go Server: $BUILD_GO_SERVER"
 echo "Build Contact Center Simulator: $BUILD_CONTACT_CENTER_SIMULATOR"
+echo "Build Mock DLL: $BUILD_MOCK_DLL"
 
 # Configure CMake
 cmake -S . -B build -DCMAKE_BUILD_TYPE=$BUILD_TYPE -DDEFAULT_API_URL="$API_URL" -DDEFAULT_TIMEOUT=$TIMEOUT -DDEFAULT_CONNECT_TIMEOUT=$CONNECT_TIMEOUT -DDEFAULT_SERVER_PORT=$SERVER_PORT
@@ -129,6 +135,23 @@ if [[ "$BUILD_CONTACT_CENTER_SIMULATOR" == true ]]; then
   fi
 fi
 
+# Build the Go mock DLL if requested (needs cgo and a C compiler)
+if [[ "$BUILD_MOCK_DLL" == true ]]; then
+  echo "Building mock DLL..."
+  if command -v go &> /dev/null; then
+    MOCK_DLL_NAME="CustomDLL.so"
+    if [[ "$(go env GOOS)" == "windows" ]]; then
+      MOCK_DLL_NAME="CustomDLL.dll"
+    fi
+    cd "tools/mock_dll"
+    CGO_ENABLED=1 go build -buildmode=c-shared -o "../../build/bin/mock/$MOCK_DLL_NAME" .
+    cd "$ROOT_DIR"
+    echo "Mock DLL built successfully."
+  else
+    echo "Go is not installed. Skipping mock DLL build."
+  fi
+fi
+
 # Create subdirectories for distribution
 mkdir -p dist/tools
 
@@ -192,4 +215,14 @@ if [[ "$BUILD_CONTACT_CENTER_SIMULATOR" == true ]] && [[ -f "build/bin/ContactCe
   echo "Contact Center simulator copied to dist/tools/"
 fi
 
+# Copy the mock DLL if built, next to the simulator's DLLs
+if [[ "$BUILD_MOCK_DLL" == true ]] && [[ -f "build/bin/mock/$MOCK_DLL_NAME" ]]; then
+  for MOCK_DIR in dist/mock dist/tools/dist/mock; do
+    mkdir -p "$MOCK_DIR"
+    cp "build/bin/mock/$MOCK_DLL_NAME" "$MOCK_DIR/"
+    [[ -f "$MOCK_DIR/config.ini" ]] || cp config/config.ini "$MOCK_DIR/"
+  done
+  echo "Mock DLL copied to dist/mock and dist/tools/dist/mock"
+fi
+
 echo "Build completed successfully."
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertCheckInterval is how often the alert rules of a long run are evaluated
+const alertCheckInterval = 10 * time.Second
+
+// AlertRule fires when a metric of the calls in the last Window is above a threshold
+type AlertRule struct {
+	Name string `json:"name"`
+	// Metric is error_rate (in percent) or p95_ms
+	Metric string  `json:"metric"`
+	Above  float64 `json:"above"`
+	// Window is the duration the metric is computed over, such as "5m"
+	Window string `json:"window"`
+	// MinCalls is the number of calls the window needs before the rule is
+	// evaluated (default 1)
+	MinCalls int `json:"min_calls,omitempty"`
+
+	window time.Duration
+}
+
+// EmailNotifier sends alerts by mail through an SMTP server
+type EmailNotifier struct {
+	// SMTP is the host:port of the server
+	SMTP     string   `json:"smtp"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// AlertNotifiers are the destinations of alerts
+type AlertNotifiers struct {
+	// Webhook receives the AlertEvent as JSON
+	Webhook string `json:"webhook,omitempty"`
+	// Slack is the URL of a Slack incoming webhook
+	Slack string         `json:"slack,omitempty"`
+	Email *EmailNotifier `json:"email,omitempty"`
+}
+
+// AlertConfig is the alerts file of a long run
+type AlertConfig struct {
+	Rules  []AlertRule    `json:"rules"`
+	Notify AlertNotifiers `json:"notify"`
+}
+
+// AlertEvent is an alert that fired or resolved during a run
+type AlertEvent struct {
+	Time  time.Time `json:"time"`
+	Rule  string    `json:"rule"`
+	State string    `json:"state"`
+	// Value is the metric over the rule's window when the state changed
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Calls     int     `json:"calls"`
+	Message   string  `json:"message"`
+	// Run names the run, such as the soak test's report directory
+	Run string `json:"run"`
+}
+
+// Alert states
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// Metrics alert rules can test, computed over the calls of a window
+var alertMetrics = map[string]func(latencies []float64, errors int) float64{
+	"error_rate": func(latencies []float64, errors int) float64 {
+		return float64(errors) / float64(len(latencies)) * 100
+	},
+	"p95_ms": func(latencies []float64, errors int) float64 {
+		return latencyStats(latencies).P95
+	},
+}
+
+// loadAlertConfig reads and checks an alerts file
+func loadAlertConfig(path string) (*AlertConfig, error) {
+	var config AlertConfig
+	if err := readJSONFile(path, &config); err != nil {
+		return nil, fmt.Errorf("failed to read alerts file %s: %v", path, err)
+	}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s > %g", rule.Metric, rule.Above)
+		}
+		if alertMetrics[rule.Metric] == nil {
+			return nil, fmt.Errorf("alert '%s': unknown metric '%s' (valid metrics: error_rate, p95_ms)", rule.Name, rule.Metric)
+		}
+		window, err := time.ParseDuration(rule.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("alert '%s': invalid window '%s'", rule.Name, rule.Window)
+		}
+		rule.window = window
+		if rule.MinCalls <= 0 {
+			rule.MinCalls = 1
+		}
+	}
+	if email := config.Notify.Email; email != nil && (email.SMTP == "" || email.From == "" || len(email.To) == 0) {
+		return nil, fmt.Errorf("email notifier needs smtp, from and to")
+	}
+	return &config, nil
+}
+
+// alertSample is a call seen by the alert rules
+type alertSample struct {
+	at      time.Time
+	latency float64
+	failed  bool
+}
+
+// alertMonitor evaluates the alert rules of a run over its recent calls and
+// notifies when a rule fires or resolves
+type alertMonitor struct {
+	config *AlertConfig
+	run    string
+	// longest window of the rules, how long samples are kept
+	keep time.Duration
+
+	mu      sync.Mutex
+	samples []alertSample
+	firing  map[string]bool
+	events  []AlertEvent
+}
+
+// newAlertMonitor creates the monitor of a run
+func newAlertMonitor(config *AlertConfig, run string) *alertMonitor {
+	m := &alertMonitor{config: config, run: run, firing: make(map[string]bool)}
+	for _, rule := range config.Rules {
+		m.keep = max(m.keep, rule.window)
+	}
+	return m
+}
+
+// add records a call that ended now
+func (m *alertMonitor) add(latency float64, ret int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.samples = append(m.samples, alertSample{at: time.Now(), latency: latency, failed: ret != 0})
+}
+
+// check evaluates every rule at now, returning the alerts that changed state
+func (m *alertMonitor) check(now time.Time) []AlertEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop the calls older than every window
+	drop := 0
+	for drop < len(m.samples) && now.Sub(m.samples[drop].at) > m.keep {
+		drop++
+	}
+	m.samples = m.samples[drop:]
+
+	var changed []AlertEvent
+	for _, rule := range m.config.Rules {
+		var latencies []float64
+		errors := 0
+		for _, s := range m.samples {
+			if now.Sub(s.at) <= rule.window {
+				latencies = append(latencies, s.latency)
+				if s.failed {
+					errors++
+				}
+			}
+		}
+		if len(latencies) < rule.MinCalls {
+			continue
+		}
+		value := alertMetrics[rule.Metric](latencies, errors)
+		firing := value > rule.Above
+		if firing == m.firing[rule.Name] {
+			continue
+		}
+		m.firing[rule.Name] = firing
+
+		event := AlertEvent{Time: now, Rule: rule.Name, Value: value, Threshold: rule.Above, Calls: len(latencies), Run: m.run}
+		if firing {
+			event.State = alertFiring
+			event.Message = fmt.Sprintf("%s: %s is %.3f over the last %v (%d calls), above %g", rule.Name, rule.Metric, value, rule.window, len(latencies), rule.Above)
+		} else {
+			event.State = alertResolved
+			event.Message = fmt.Sprintf("%s resolved: %s is %.3f over the last %v (%d calls)", rule.Name, rule.Metric, value, rule.window, len(latencies))
+		}
+		changed = append(changed, event)
+		m.events = append(m.events, event)
+	}
+	return changed
+}
+
+// notify sends an alert to every configured notifier, logging failures
+func (n AlertNotifiers) notify(event AlertEvent) {
+	log.Printf("Alert %s: %s", event.State, event.Message)
+	if n.Webhook != "" {
+		if err := postJSON(n.Webhook, event); err != nil {
+			log.Printf("Failed to send alert to webhook: %v", err)
+		}
+	}
+	if n.Slack != "" {
+		text := fmt.Sprintf("[%s] %s (%s)", strings.ToUpper(event.State), event.Message, event.Run)
+		if err := postJSON(n.Slack, map[string]string{"text": text}); err != nil {
+			log.Printf("Failed to send alert to Slack: %v", err)
+		}
+	}
+	if n.Email != nil {
+		if err := n.Email.send(event); err != nil {
+			log.Printf("Failed to send alert email: %v", err)
+		}
+	}
+}
+
+// postJSON posts v as JSON and fails on a non-2xx status
+func postJSON(url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// send mails an alert
+func (e *EmailNotifier) send(event AlertEvent) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := strings.Cut(e.SMTP, ":")
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	subject := fmt.Sprintf("[%s] %s", strings.ToUpper(event.State), event.Rule)
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\nRun: %s\r\nTime: %s\r\n",
+		e.From, strings.Join(e.To, ", "), subject, event.Message, event.Run, event.Time.Format(time.RFC3339))
+	return smtp.SendMail(e.SMTP, auth, e.From, e.To, []byte(message))
+}
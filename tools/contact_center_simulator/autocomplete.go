@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// Limits of the autocomplete API
+const (
+	// Recently used values remembered per parameter key
+	MaxRecentValues = 20
+	// Suggestions returned when the request does not set a limit
+	DefaultAutocompleteLimit = 20
+)
+
+// Sources of autocomplete suggestions
+const (
+	suggestionDictionary = "dictionary"
+	suggestionEnum       = "enum"
+	suggestionRecent     = "recent"
+	suggestionExample    = "example"
+)
+
+// Suggestion is a parameter key or value offered by the autocomplete API
+type Suggestion struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	// Source is where the suggestion comes from: the parameter dictionary (keys),
+	// the accepted values of the catalog, the values of recent passing runs, or
+	// the examples of the dictionary
+	Source string `json:"source"`
+}
+
+// Suggestions is the response of the autocomplete API: the keys when no key is
+// asked for, or the values of Key
+type Suggestions struct {
+	Key         string       `json:"key,omitempty"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// recentParameters remembers the keys and values of recent passing runs, most
+// recent first. Only passing runs count, so a mistyped value that failed is not
+// offered again.
+type recentParameters struct {
+	mu     sync.Mutex
+	values map[string][]string
+}
+
+// Values of recent passing runs, for the autocomplete API
+var recent = &recentParameters{values: make(map[string][]string)}
+
+// add records the parameters of a run
+func (p *recentParameters) add(testCase TestCase, result TestResult) {
+	if !result.Success {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, param := range testCase.Parameters {
+		if param.Key == "" || param.Key == buffer.ChecksumKey {
+			continue
+		}
+		values := slices.DeleteFunc(p.values[param.Key], func(v string) bool { return v == param.Value })
+		if param.Value != "" {
+			values = append([]string{param.Value}, values...)
+		}
+		p.values[param.Key] = values[:min(len(values), MaxRecentValues)]
+	}
+}
+
+// keys returns the keys of recent passing runs
+func (p *recentParameters) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]string, 0, len(p.values))
+	for key := range p.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// recentValues returns the values of a key in recent passing runs, most recent first
+func (p *recentParameters) recentValues(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.values[key])
+}
+
+// keySuggestions returns the dictionary keys used by the endpoint (all if empty),
+// then the other keys of recent passing runs
+func keySuggestions(endpoint string) []Suggestion {
+	var suggestions []Suggestion
+	for _, key := range dictionaryKeys() {
+		def := parameterDictionary[key]
+		if endpoint != "" && len(def.Endpoints) > 0 && !slices.Contains(def.Endpoints, endpoint) {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{Value: key, Description: def.Description, Source: suggestionDictionary})
+	}
+	for _, key := range recent.keys() {
+		if _, ok := parameterDictionary[key]; !ok {
+			suggestions = append(suggestions, Suggestion{Value: key, Source: suggestionRecent})
+		}
+	}
+	return suggestions
+}
+
+// valueSuggestions returns the values of a key: the accepted values of the
+// catalog, then the values of recent passing runs, then the dictionary examples
+func valueSuggestions(key string) []Suggestion {
+	var suggestions []Suggestion
+	seen := make(map[string]bool)
+	add := func(values []string, source string) {
+		for _, v := range values {
+			if v != "" && !seen[v] {
+				seen[v] = true
+				suggestions = append(suggestions, Suggestion{Value: v, Source: source})
+			}
+		}
+	}
+	def, known := parameterDictionary[key]
+	if known {
+		add(def.Values, suggestionEnum)
+	}
+	add(recent.recentValues(key), suggestionRecent)
+	if known {
+		add(def.Examples, suggestionExample)
+	}
+	return suggestions
+}
+
+// handleAutocomplete suggests parameter keys (GET /api/autocomplete) or the values
+// of a key (GET /api/autocomplete?key=...) for the test form. prefix keeps the
+// suggestions starting with it, ignoring case; endpoint keeps the keys the
+// endpoint uses; limit caps the number of suggestions.
+func handleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit := DefaultAutocompleteLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	response := Suggestions{Key: query.Get("key")}
+	var all []Suggestion
+	if response.Key == "" {
+		all = keySuggestions(query.Get("endpoint"))
+	} else {
+		all = valueSuggestions(response.Key)
+	}
+	prefix := strings.ToLower(query.Get("prefix"))
+	response.Suggestions = []Suggestion{}
+	for _, s := range all {
+		if len(response.Suggestions) == limit {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(s.Value), prefix) {
+			response.Suggestions = append(response.Suggestions, s)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
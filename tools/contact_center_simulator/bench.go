@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the bench subcommand
+const (
+	DefaultBenchWarmup   = 10
+	DefaultBenchDuration = 10 * time.Second
+)
+
+// LatencyStats summarizes the call latencies of a benchmark, in milliseconds
+type LatencyStats struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// BenchResult is the outcome of a benchmark, written as JSON or CSV
+type BenchResult struct {
+	Profile     string    `json:"profile"`
+	DLL         string    `json:"dll"`
+	Endpoint    string    `json:"endpoint"`
+	Started     time.Time `json:"started"`
+	Warmup      int       `json:"warmup"`
+	Concurrency int       `json:"concurrency"`
+	Calls       int       `json:"calls"`
+	Errors      int       `json:"errors"`
+	ErrorRate   float64   `json:"error_rate"`
+	DurationMs  float64   `json:"duration_ms"`
+	// Throughput is the number of calls per second
+	Throughput  float64        `json:"throughput"`
+	LatencyMs   LatencyStats   `json:"latency_ms"`
+	ReturnCodes map[string]int `json:"return_codes"`
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// latencyStats summarizes latencies in milliseconds
+func latencyStats(latencies []float64) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]float64{}, latencies...)
+	sort.Float64s(sorted)
+	total := 0.0
+	for _, l := range sorted {
+		total += l
+	}
+	return LatencyStats{
+		Min:  sorted[0],
+		Mean: total / float64(len(sorted)),
+		P50:  percentile(sorted, 50),
+		P90:  percentile(sorted, 90),
+		P95:  percentile(sorted, 95),
+		P99:  percentile(sorted, 99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// benchCall is the DLL call a benchmark repeats, with the input buffer built once
+type benchCall struct {
+	dll        *loadedDLL
+	input      []byte
+	outputSize int
+	// env holds the environment variables of the worker hosting the DLL
+	env map[string]string
+}
+
+// newBenchCall prepares the call of a test case to the DLL of its profile
+func newBenchCall(testCase TestCase) (*benchCall, *DLLProfile, error) {
+	profile, err := profileFor(testCase)
+	if err != nil {
+		return nil, nil, err
+	}
+	dll, err := loadDLL(profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load DLL %s for profile '%s': %v", profile.DLL, profile.name, err)
+	}
+	parameters, _ := normalizeParameters(profile, testCase.Parameters)
+	encoded, err := encodeParameters(profile, parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	input, err := createInputBuffer(profile.version, encoded, profile.Checksum)
+	if err != nil {
+		return nil, nil, err
+	}
+	outputPairs := 1
+	if profile.Checksum {
+		outputPairs = 2
+	}
+	return &benchCall{dll: dll, input: input, outputSize: profile.version.Size(outputPairs), env: dllEnvironment(profile, testCase)}, profile, nil
+}
+
+// invoke calls the DLL once, returning the latency in milliseconds and the return code
+// (-1 when the call itself failed)
+func (c *benchCall) invoke() (float64, int) {
+	output := make([]byte, c.outputSize)
+	start := time.Now()
+	ret, _, err := c.dll.invoker.Invoke(withCallEnv(context.Background(), c.env), c.input, output)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		return latency, -1
+	}
+	return latency, ret
+}
+
+// runBenchmark calls the DLL warmup times unmeasured, then from concurrency workers
+// until count calls were made or duration has elapsed
+func runBenchmark(call *benchCall, warmup, count int, duration time.Duration, concurrency int) BenchResult {
+	for i := 0; i < warmup; i++ {
+		call.invoke()
+	}
+
+	var (
+		mu        sync.Mutex
+		latencies []float64
+		codes     = make(map[string]int)
+		errors    int
+		issued    atomic.Int64
+		wg        sync.WaitGroup
+	)
+	started := time.Now()
+	deadline := started.Add(duration)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if count > 0 && issued.Add(1) > int64(count) {
+					return
+				}
+				if count == 0 && time.Now().After(deadline) {
+					return
+				}
+				latency, ret := call.invoke()
+
+				mu.Lock()
+				latencies = append(latencies, latency)
+				codes[strconv.Itoa(ret)]++
+				if ret != 0 {
+					errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	result := BenchResult{
+		Started:     started,
+		Warmup:      warmup,
+		Concurrency: concurrency,
+		Calls:       len(latencies),
+		Errors:      errors,
+		DurationMs:  float64(elapsed.Microseconds()) / 1000,
+		LatencyMs:   latencyStats(latencies),
+		ReturnCodes: codes,
+	}
+	if result.Calls > 0 {
+		result.ErrorRate = float64(errors) / float64(result.Calls)
+		result.Throughput = float64(result.Calls) / elapsed.Seconds()
+	}
+	return result
+}
+
+// writeCSV writes the result as a header row and a value row
+func (b BenchResult) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	cw.Write([]string{"profile", "dll", "endpoint", "started", "warmup", "concurrency", "calls", "errors", "error_rate",
+		"duration_ms", "throughput", "min_ms", "mean_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "max_ms"})
+	cw.Write([]string{b.Profile, b.DLL, b.Endpoint, b.Started.Format(time.RFC3339), strconv.Itoa(b.Warmup),
+		strconv.Itoa(b.Concurrency), strconv.Itoa(b.Calls), strconv.Itoa(b.Errors), f(b.ErrorRate),
+		f(b.DurationMs), f(b.Throughput), f(b.LatencyMs.Min), f(b.LatencyMs.Mean), f(b.LatencyMs.P50),
+		f(b.LatencyMs.P90), f(b.LatencyMs.P95), f(b.LatencyMs.P99), f(b.LatencyMs.Max)})
+	cw.Flush()
+	return cw.Error()
+}
+
+// readTestCase reads a test case from a JSON file in the /run-test format
+func readTestCase(path string) (TestCase, error) {
+	var testCase TestCase
+	if err := readJSONFile(path, &testCase); err != nil {
+		return testCase, fmt.Errorf("failed to read test case %s: %v", path, err)
+	}
+	return testCase, nil
+}
+
+// callFlags are the flags of the subcommands that repeat a DLL call: the DLL,
+// profiles and the test case to call
+type callFlags struct {
+	dll      *string
+	profiles *string
+	profile  *string
+	caseFile *string
+	params   []Parameter
+}
+
+// addCallFlags registers the call flags of a subcommand
+func addCallFlags(fs *flag.FlagSet) *callFlags {
+	f := &callFlags{
+		dll:      fs.String("dll", DefaultDllPath, "Path to the DLL"),
+		profiles: fs.String("profiles", "", "JSON file defining DLL profiles"),
+		profile:  fs.String("profile", "", "DLL profile to call (default profile if empty)"),
+		caseFile: fs.String("case", "", "JSON test case to call, in the /run-test format"),
+	}
+	fs.BoolVar(&simulate, "simulate", false, "Call the canned simulation behaviors instead of the DLL")
+	fs.Func("param", "Parameter as Key=Value (repeatable, added to -case)", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected Key=Value, got '%s'", s)
+		}
+		f.params = append(f.params, Parameter{Key: key, Value: value})
+		return nil
+	})
+	return f
+}
+
+// prepare reads the test case, loads the profiles and prepares the call. The
+// returned exit code is 2 for usage errors and 1 for load failures.
+func (f *callFlags) prepare() (*benchCall, *DLLProfile, TestCase, int, error) {
+	var testCase TestCase
+	if *f.caseFile != "" {
+		var err error
+		if testCase, err = readTestCase(*f.caseFile); err != nil {
+			return nil, nil, testCase, 2, err
+		}
+	}
+	testCase.Parameters = append(testCase.Parameters, f.params...)
+	if *f.profile != "" {
+		testCase.Profile = *f.profile
+	}
+	if len(testCase.Parameters) == 0 {
+		return nil, nil, testCase, 2, fmt.Errorf("no parameters (use -case or -param)")
+	}
+
+	// Progress goes to standard error, results to standard output
+	log.SetOutput(os.Stderr)
+	dllPath = resolveDllPath(*f.dll)
+	if err := loadProfiles(*f.profiles, dllPath); err != nil {
+		return nil, nil, testCase, 1, fmt.Errorf("failed to load profiles: %v", err)
+	}
+	call, profile, err := newBenchCall(testCase)
+	if err != nil {
+		return nil, nil, testCase, 1, err
+	}
+	if call.dll.note != "" {
+		log.Printf("Warning: %s", call.dll.note)
+	}
+	return call, profile, testCase, 0, nil
+}
+
+// endpointOf returns the Endpoint parameter of a test case
+func endpointOf(testCase TestCase) string {
+	endpoint := ""
+	for _, param := range testCase.Parameters {
+		if param.Key == "Endpoint" {
+			endpoint = param.Value
+		}
+	}
+	return endpoint
+}
+
+// runBench implements the bench subcommand and returns the exit code:
+//
+//	ContactCenterSimulator bench -param Endpoint=getInfo -param ID=12345 -duration 30s -concurrency 4
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	callFlags := addCallFlags(fs)
+	warmup := fs.Int("warmup", DefaultBenchWarmup, "Unmeasured calls before the benchmark")
+	count := fs.Int("count", 0, "Number of measured calls (0 to run for -duration)")
+	duration := fs.Duration("duration", DefaultBenchDuration, "Measurement duration when -count is 0")
+	concurrency := fs.Int("concurrency", 1, "Number of concurrent callers")
+	format := fs.String("format", "json", "Output format: json or csv")
+	out := fs.String("out", "", "Output file (default standard output)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "bench: unknown format '%s' (valid formats: csv, json)\n", *format)
+		return 2
+	}
+	if *warmup < 0 || *count < 0 || *concurrency < 1 || (*count == 0 && *duration <= 0) {
+		fmt.Fprintln(os.Stderr, "bench: -warmup and -count must not be negative, -concurrency and -duration must be positive")
+		return 2
+	}
+
+	call, profile, testCase, code, err := callFlags.prepare()
+	defer unloadDLLs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+		return code
+	}
+
+	log.Printf("Benchmarking profile '%s' (%d warmup calls, %d callers)", profile.name, *warmup, *concurrency)
+	result := runBenchmark(call, *warmup, *count, *duration, *concurrency)
+	result.Profile, result.DLL, result.Endpoint = profile.name, call.dll.path, endpointOf(testCase)
+	log.Printf("%d calls, %d errors, p50 %.3f ms, p95 %.3f ms, p99 %.3f ms, %.1f calls/s",
+		result.Calls, result.Errors, result.LatencyMs.P50, result.LatencyMs.P95, result.LatencyMs.P99, result.Throughput)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bench: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "csv" {
+		err = result.writeCSV(w)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(result)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: failed to write the result: %v\n", err)
+		return 1
+	}
+	return 0
+}
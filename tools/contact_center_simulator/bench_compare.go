@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// Default regression thresholds of bench-compare
+const (
+	// DefaultMaxP95Regression is the largest accepted p95 latency increase, in percent
+	DefaultMaxP95Regression = 10.0
+	// DefaultMaxErrorRateIncrease is the largest accepted error rate increase, in percentage points
+	DefaultMaxErrorRateIncrease = 1.0
+)
+
+// benchMetric is a metric compared between two benchmark results. Gated metrics
+// fail the comparison when they regress beyond their limit.
+type benchMetric struct {
+	name     string
+	old, new float64
+	unit     string
+	// relative limits are in percent of the old value, absolute ones in the metric's unit
+	limit    float64
+	relative bool
+	gated    bool
+}
+
+// change returns the increase from old to new, in percent for relative metrics
+func (m benchMetric) change() float64 {
+	if m.relative {
+		if m.old == 0 {
+			if m.new == 0 {
+				return 0
+			}
+			return 100
+		}
+		return (m.new - m.old) / m.old * 100
+	}
+	return m.new - m.old
+}
+
+// regressed reports whether a gated metric increased beyond its limit
+func (m benchMetric) regressed() bool {
+	return m.gated && m.change() > m.limit
+}
+
+// compareBench lists the metrics of two benchmark results, with p95 latency and
+// error rate gated by the given thresholds
+func compareBench(old, cur BenchResult, maxP95, maxErrorRate float64) []benchMetric {
+	return []benchMetric{
+		{name: "p50 latency", old: old.LatencyMs.P50, new: cur.LatencyMs.P50, unit: "ms", relative: true},
+		{name: "p95 latency", old: old.LatencyMs.P95, new: cur.LatencyMs.P95, unit: "ms", relative: true, limit: maxP95, gated: true},
+		{name: "p99 latency", old: old.LatencyMs.P99, new: cur.LatencyMs.P99, unit: "ms", relative: true},
+		{name: "error rate", old: old.ErrorRate * 100, new: cur.ErrorRate * 100, unit: "%", limit: maxErrorRate, gated: true},
+		{name: "throughput", old: old.Throughput, new: cur.Throughput, unit: "calls/s", relative: true},
+	}
+}
+
+// writeComparison writes the comparison report and returns whether any gated metric regressed
+func writeComparison(w io.Writer, oldPath, newPath string, old, cur BenchResult, metrics []benchMetric) bool {
+	fmt.Fprintf(w, "Old: %s (%s, %d calls)\n", oldPath, old.DLL, old.Calls)
+	fmt.Fprintf(w, "New: %s (%s, %d calls)\n\n", newPath, cur.DLL, cur.Calls)
+
+	regressed := false
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tOLD\tNEW\tCHANGE\tLIMIT\tSTATUS")
+	for _, m := range metrics {
+		change := fmt.Sprintf("%+.3f %s", m.change(), m.unit)
+		limit := "-"
+		if m.relative {
+			change = fmt.Sprintf("%+.1f%%", m.change())
+		}
+		if m.gated {
+			limit = fmt.Sprintf("+%.3g %s", m.limit, m.unit)
+			if m.relative {
+				limit = fmt.Sprintf("+%.3g%%", m.limit)
+			}
+		}
+		status := ""
+		switch {
+		case m.regressed():
+			status = "REGRESSED"
+			regressed = true
+		case m.gated:
+			status = "ok"
+		}
+		fmt.Fprintf(tw, "%s\t%.3f %s\t%.3f %s\t%s\t%s\t%s\n", m.name, m.old, m.unit, m.new, m.unit, change, limit, status)
+	}
+	tw.Flush()
+
+	if old.Concurrency != cur.Concurrency || old.Endpoint != cur.Endpoint {
+		fmt.Fprintf(w, "\nWarning: the runs differ (endpoint %s vs %s, concurrency %d vs %d), so the numbers may not be comparable\n",
+			old.Endpoint, cur.Endpoint, old.Concurrency, cur.Concurrency)
+	}
+	if regressed {
+		fmt.Fprintln(w, "\nFAIL: the new build regressed beyond the thresholds")
+	} else {
+		fmt.Fprintln(w, "\nPASS: no regression beyond the thresholds")
+	}
+	return regressed
+}
+
+// runBenchCompare implements the bench-compare subcommand, comparing two bench
+// result files. It returns 1 when p95 latency or error rate regressed beyond the
+// thresholds, so it can gate DLL releases:
+//
+//	ContactCenterSimulator bench-compare -max-p95 5 bench-1.3.0.json bench-1.4.0.json
+func runBenchCompare(args []string) int {
+	fs := flag.NewFlagSet("bench-compare", flag.ContinueOnError)
+	maxP95 := fs.Float64("max-p95", DefaultMaxP95Regression, "Largest accepted p95 latency increase, in percent")
+	maxErrorRate := fs.Float64("max-error-rate", DefaultMaxErrorRateIncrease, "Largest accepted error rate increase, in percentage points")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: bench-compare [options] OLD.json NEW.json")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var results [2]BenchResult
+	for i, path := range fs.Args() {
+		if err := readJSONFile(path, &results[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "bench-compare: failed to read %s: %v\n", path, err)
+			return 2
+		}
+	}
+
+	metrics := compareBench(results[0], results[1], *maxP95, *maxErrorRate)
+	if writeComparison(os.Stdout, fs.Arg(0), fs.Arg(1), results[0], results[1], metrics) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of DLL builds of the trend API
+const (
+	DefaultTrendBuilds = 10
+	MaxTrendBuilds     = 100
+)
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// identifyBuild returns the file version and the SHA-256 of a DLL, which tag the
+// results it produces. Both are empty when the file cannot be read.
+func identifyBuild(path string) (string, string) {
+	hash, err := fileSHA256(path)
+	if err != nil {
+		return "", ""
+	}
+	version, _ := libraryVersion(path)
+	return version, hash
+}
+
+// verifyBuild identifies the DLL of a profile before it is loaded, and fails if
+// the profile expects another build
+func verifyBuild(profile *DLLProfile) (string, string, error) {
+	version, hash := identifyBuild(profile.DLL)
+	if profile.SHA256 == "" {
+		return version, hash, nil
+	}
+	if hash == "" {
+		return "", "", fmt.Errorf("cannot verify the SHA-256 of %s: the file cannot be read", profile.DLL)
+	}
+	if hash != profile.SHA256 {
+		return "", "", fmt.Errorf("refusing to load %s: its SHA-256 is %s, but profile '%s' expects %s", profile.DLL, hash, profile.name, profile.SHA256)
+	}
+	return version, hash, nil
+}
+
+// BuildTrend summarizes the stored runs of one DLL build
+type BuildTrend struct {
+	Version   string       `json:"version"`
+	Hash      string       `json:"hash"`
+	FirstRun  time.Time    `json:"firstRun"`
+	LastRun   time.Time    `json:"lastRun"`
+	Runs      int          `json:"runs"`
+	Errors    int          `json:"errors"`
+	ErrorRate float64      `json:"errorRate"`
+	LatencyMs LatencyStats `json:"latencyMs"`
+	// P95Change is the change of p95 latency since the previous build, in percent
+	P95Change *float64 `json:"p95Change,omitempty"`
+}
+
+// trends summarizes the stored runs of the last builds matching the filters, oldest
+// build first. Builds are ordered by their first run; runs without a build (stored
+// before builds were recorded, or of fake invokers) are left out.
+func (x *resultIndex) trends(profile, endpoint string, builds int) []BuildTrend {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	type build struct {
+		trend     BuildTrend
+		latencies []float64
+	}
+	byHash := make(map[string]*build)
+	for _, s := range x.results {
+		if s.DllHash == "" || (profile != "" && s.Profile != profile) ||
+			(endpoint != "" && !strings.EqualFold(s.Endpoint, endpoint)) {
+			continue
+		}
+		b := byHash[s.DllHash]
+		if b == nil {
+			b = &build{trend: BuildTrend{Version: s.DllVersion, Hash: s.DllHash, FirstRun: s.Time, LastRun: s.Time}}
+			byHash[s.DllHash] = b
+		}
+		if s.Time.Before(b.trend.FirstRun) {
+			b.trend.FirstRun = s.Time
+		}
+		if s.Time.After(b.trend.LastRun) {
+			b.trend.LastRun = s.Time
+		}
+		b.trend.Runs++
+		if !s.Success {
+			b.trend.Errors++
+		}
+		b.latencies = append(b.latencies, s.DurationMs)
+	}
+
+	list := []BuildTrend{}
+	for _, b := range byHash {
+		b.trend.ErrorRate = float64(b.trend.Errors) / float64(b.trend.Runs)
+		b.trend.LatencyMs = latencyStats(b.latencies)
+		list = append(list, b.trend)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].FirstRun.Equal(list[j].FirstRun) {
+			return list[i].FirstRun.Before(list[j].FirstRun)
+		}
+		return list[i].Hash < list[j].Hash
+	})
+	list = list[max(len(list)-builds, 0):]
+	for i := 1; i < len(list); i++ {
+		if previous := list[i-1].LatencyMs.P95; previous > 0 {
+			change := (list[i].LatencyMs.P95 - previous) / previous * 100
+			list[i].P95Change = &change
+		}
+	}
+	return list
+}
+
+// handleTrends returns the latency and error rate of the stored runs per DLL build
+// (GET /api/trends), for the last builds (default 10), filtered by profile and endpoint
+func handleTrends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if runs == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	values := r.URL.Query()
+	builds := DefaultTrendBuilds
+	if v := values.Get("builds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MaxTrendBuilds {
+			http.Error(w, fmt.Sprintf("invalid builds '%s' (1 to %d)", v, MaxTrendBuilds), http.StatusBadRequest)
+			return
+		}
+		builds = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results.trends(values.Get("profile"), values.Get("endpoint"), builds))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Defaults of the capacity subcommand
+const (
+	DefaultCapacityStart        = 10.0
+	DefaultCapacityStep         = 10.0
+	DefaultCapacityStepDuration = 30 * time.Second
+	DefaultCapacityConcurrency  = 16
+	// DefaultCapacityMaxP95 is the p95 latency objective, in milliseconds
+	DefaultCapacityMaxP95 = 500.0
+	// DefaultCapacityMaxErrorRate is the error rate objective, in percent
+	DefaultCapacityMaxErrorRate = 1.0
+	// DefaultCapacityMinDelivered is the share of the offered calls, in percent,
+	// that must be made for the DLL to keep up with a rate
+	DefaultCapacityMinDelivered = 95.0
+)
+
+// CapacitySLO is the objective every load step must meet
+type CapacitySLO struct {
+	MaxP95Ms     float64 `json:"max_p95_ms"`
+	MaxErrorRate float64 `json:"max_error_rate"`
+	MinDelivered float64 `json:"min_delivered"`
+}
+
+// CapacityStep is the outcome of one load step. Latencies are measured from the
+// moment a call was due, so they include the time it waited for a free caller.
+type CapacityStep struct {
+	Index int `json:"index"`
+	// Rate is the offered load, in calls per second
+	Rate float64 `json:"rate"`
+	// Throughput is the achieved load, in calls per second
+	Throughput float64 `json:"throughput"`
+	Offered    int     `json:"offered"`
+	Calls      int     `json:"calls"`
+	// Dropped are the calls that were due while every caller was busy
+	Dropped   int          `json:"dropped"`
+	Errors    int          `json:"errors"`
+	ErrorRate float64      `json:"error_rate"`
+	LatencyMs LatencyStats `json:"latency_ms"`
+	// Breach explains why the step missed the objective (empty if it met it)
+	Breach string `json:"breach,omitempty"`
+	// Counters are the peaks of the performance counters of the DLL host process
+	// during the step, with -counters
+	Counters map[string]float64 `json:"counters,omitempty"`
+}
+
+// CapacityReport is the result of the capacity subcommand
+type CapacityReport struct {
+	Profile      string         `json:"profile"`
+	DLL          string         `json:"dll"`
+	Endpoint     string         `json:"endpoint"`
+	Started      time.Time      `json:"started"`
+	Concurrency  int            `json:"concurrency"`
+	StepDuration string         `json:"step_duration"`
+	Pacing       string         `json:"pacing"`
+	SLO          CapacitySLO    `json:"slo"`
+	Steps        []CapacityStep `json:"steps"`
+	// Capacity is the highest offered rate that met the objective, in calls per
+	// second (0 if even the first step breached it)
+	Capacity float64 `json:"capacity"`
+	// Breached is false when the run ended at -max-rate or was interrupted
+	// before the objective was breached, so the capacity is a lower bound
+	Breached bool `json:"breached"`
+	// Counters is the file of the performance counter samples, with -counters
+	Counters string `json:"counters,omitempty"`
+}
+
+// check sets the breach of a step that missed the objective
+func (slo CapacitySLO) check(step *CapacityStep) {
+	switch {
+	case step.Calls == 0:
+		step.Breach = "no calls completed"
+	case step.ErrorRate*100 > slo.MaxErrorRate:
+		step.Breach = fmt.Sprintf("error rate %.2f%% above %.3g%%", step.ErrorRate*100, slo.MaxErrorRate)
+	case step.LatencyMs.P95 > slo.MaxP95Ms:
+		step.Breach = fmt.Sprintf("p95 latency %.3f ms above %.3g ms", step.LatencyMs.P95, slo.MaxP95Ms)
+	case float64(step.Calls)/float64(step.Offered)*100 < slo.MinDelivered:
+		step.Breach = fmt.Sprintf("only %d of %d offered calls made (%.1f calls/s)", step.Calls, step.Offered, step.Throughput)
+	}
+}
+
+// runCapacityStep offers calls at a fixed rate for duration to concurrency callers,
+// evenly spaced or as Poisson arrivals (pacing). A call that is due while every
+// caller is busy and the queue is full is dropped.
+func runCapacityStep(ctx context.Context, call *benchCall, rate float64, pacing string, duration time.Duration, concurrency int) CapacityStep {
+	var (
+		mu        sync.Mutex
+		latencies []float64
+		errors    int
+		wg        sync.WaitGroup
+	)
+	due := make(chan time.Time, concurrency)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for at := range due {
+				_, ret := call.invoke()
+				latency := float64(time.Since(at).Microseconds()) / 1000
+
+				mu.Lock()
+				latencies = append(latencies, latency)
+				if ret != 0 {
+					errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	step := CapacityStep{Rate: rate}
+	arrivals := newPacer(pacing, rate, nil, 24*time.Hour)
+	started := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+schedule:
+	for next := started; next.Sub(started) < duration; next = arrivals.next(next) {
+		timer.Reset(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			break schedule
+		}
+		step.Offered++
+		select {
+		case due <- next:
+		default:
+			step.Dropped++
+		}
+	}
+	close(due)
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	step.Calls, step.Errors, step.LatencyMs = len(latencies), errors, latencyStats(latencies)
+	if step.Calls > 0 {
+		step.ErrorRate = float64(errors) / float64(step.Calls)
+		step.Throughput = float64(step.Calls) / elapsed.Seconds()
+	}
+	return step
+}
+
+// runCapacity implements the capacity subcommand: it offers a stepped load to the
+// DLL, from -start calls per second up by -step every -step-duration, until a step
+// misses the objective, and reports the highest rate that met it. The exit code
+// is 0 when a capacity was found.
+//
+//	ContactCenterSimulator capacity -param Endpoint=getInfo -param ID=12345 -max-p95 300 -max-error-rate 0.5
+func runCapacity(args []string) int {
+	fs := flag.NewFlagSet("capacity", flag.ContinueOnError)
+	callFlags := addCallFlags(fs)
+	start := fs.Float64("start", DefaultCapacityStart, "Offered load of the first step, in calls per second")
+	stepRate := fs.Float64("step", DefaultCapacityStep, "Load increase per step, in calls per second")
+	maxRate := fs.Float64("max-rate", 0, "Highest offered load (0 for no limit)")
+	stepDuration := fs.Duration("step-duration", DefaultCapacityStepDuration, "Duration of each load step")
+	concurrency := fs.Int("concurrency", DefaultCapacityConcurrency, "Number of concurrent callers")
+	warmup := fs.Int("warmup", DefaultBenchWarmup, "Unmeasured calls before the first step")
+	maxP95 := fs.Float64("max-p95", DefaultCapacityMaxP95, "Objective: highest p95 latency, in milliseconds")
+	maxErrorRate := fs.Float64("max-error-rate", DefaultCapacityMaxErrorRate, "Objective: highest error rate, in percent")
+	minDelivered := fs.Float64("min-delivered", DefaultCapacityMinDelivered, "Objective: lowest share of the offered calls made, in percent")
+	pacing := fs.String("pacing", pacingUniform, "Arrivals of each step: uniform (evenly spaced) or poisson (random, at the step's average rate)")
+	out := fs.String("out", "", "JSON report file (default standard output)")
+	counterFlags := addCounterFlags(fs)
+	countersOut := fs.String("counters-out", "counters.jsonl", "File of the performance counter samples, with -counters")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	counterNames, err := counterFlags.selected()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capacity: %v\n", err)
+		return 2
+	}
+	if *pacing != pacingUniform && *pacing != pacingPoisson {
+		fmt.Fprintf(os.Stderr, "capacity: unknown -pacing '%s' (valid models: %s, %s)\n", *pacing, pacingUniform, pacingPoisson)
+		return 2
+	}
+	if *start <= 0 || *stepRate <= 0 || *maxRate < 0 || *stepDuration <= 0 || *concurrency < 1 || *warmup < 0 {
+		fmt.Fprintln(os.Stderr, "capacity: -start, -step, -step-duration and -concurrency must be positive, -max-rate and -warmup must not be negative")
+		return 2
+	}
+
+	call, profile, testCase, code, err := callFlags.prepare()
+	defer unloadDLLs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capacity: %v\n", err)
+		return code
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report := CapacityReport{
+		Profile:      profile.name,
+		DLL:          call.dll.path,
+		Endpoint:     endpointOf(testCase),
+		Started:      time.Now(),
+		Concurrency:  *concurrency,
+		StepDuration: stepDuration.String(),
+		Pacing:       *pacing,
+		SLO:          CapacitySLO{MaxP95Ms: *maxP95, MaxErrorRate: *maxErrorRate, MinDelivered: *minDelivered},
+	}
+	log.Printf("Measuring the capacity of profile '%s' (p95 <= %g ms, error rate <= %g%%, %d callers)",
+		profile.name, *maxP95, *maxErrorRate, *concurrency)
+
+	// Sample the performance counters of the DLL host process, tagged with the step
+	var counters *counterSampler
+	if len(counterNames) > 0 {
+		counters, err = newCounterSampler(*countersOut, counterNames, *counterFlags.interval, func() int { return hostPID(call.dll) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "capacity: %v\n", err)
+			return 1
+		}
+		defer counters.close()
+		report.Counters = *countersOut
+		counters.setPhase("warmup")
+		countersCtx, stopCounters := context.WithCancel(ctx)
+		var sampling sync.WaitGroup
+		sampling.Add(1)
+		go func() {
+			defer sampling.Done()
+			counters.run(countersCtx)
+		}()
+		defer sampling.Wait()
+		defer stopCounters()
+	}
+	for i := 0; i < *warmup; i++ {
+		call.invoke()
+	}
+	for rate := *start; *maxRate == 0 || rate <= *maxRate; rate += *stepRate {
+		if counters != nil {
+			counters.takePeaks()
+			counters.setPhase(fmt.Sprintf("step %d (%g calls/s)", len(report.Steps)+1, rate))
+		}
+		step := runCapacityStep(ctx, call, rate, *pacing, *stepDuration, *concurrency)
+		if counters != nil {
+			step.Counters = counters.takePeaks()
+		}
+		if ctx.Err() != nil {
+			log.Printf("Interrupted during the step at %.1f calls/s", rate)
+			break
+		}
+		step.Index = len(report.Steps) + 1
+		report.SLO.check(&step)
+		report.Steps = append(report.Steps, step)
+		log.Printf("Step %d: %.1f calls/s offered, %.1f achieved, error rate %.2f%%, p95 %.3f ms",
+			step.Index, step.Rate, step.Throughput, step.ErrorRate*100, step.LatencyMs.P95)
+		if step.Breach != "" {
+			log.Printf("Objective breached: %s", step.Breach)
+			report.Breached = true
+			break
+		}
+		report.Capacity = rate
+	}
+
+	if report.Breached {
+		log.Printf("Capacity: %.1f calls/s", report.Capacity)
+	} else {
+		log.Printf("Capacity: at least %.1f calls/s (objective not breached)", report.Capacity)
+	}
+	if *out == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = writeJSONFile(*out, report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capacity: failed to write the report: %v\n", err)
+		return 1
+	}
+	if report.Capacity == 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Buffer charsets, keyed by lower-case name. A nil encoding means UTF-8.
+var bufferCharsets = map[string]encoding.Encoding{
+	"utf-8":        nil,
+	"iso-8859-2":   charmap.ISO8859_2,
+	"windows-1250": charmap.Windows1250,
+}
+
+// Romanian letters with comma below, which the legacy Central European charsets
+// only have in their older cedilla form
+var commaBelowToCedilla = strings.NewReplacer("Ș", "Ş", "ș", "ş", "Ț", "Ţ", "ț", "ţ")
+
+// charsetNames lists the supported buffer charsets
+func charsetNames() []string {
+	names := make([]string, 0, len(bufferCharsets))
+	for name := range bufferCharsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeCharset converts a value to the bytes it has in the buffer charset
+func encodeCharset(charset, value string) (string, error) {
+	enc := bufferCharsets[charset]
+	if enc == nil {
+		return value, nil
+	}
+	data, err := enc.NewEncoder().String(commaBelowToCedilla.Replace(value))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", charset, err)
+	}
+	return data, nil
+}
+
+// decodeCharset converts a value read from the buffer from the buffer charset
+func decodeCharset(charset, value string) string {
+	enc := bufferCharsets[charset]
+	if enc == nil {
+		return value
+	}
+	// Single-byte charsets map every byte, so decoding cannot fail
+	decoded, _ := enc.NewDecoder().String(value)
+	return decoded
+}
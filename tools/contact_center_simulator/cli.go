@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Output formats of the command-line runner (-call and -stdin)
+const (
+	OutputJSON  = "json"
+	OutputTable = "table"
+	OutputQuiet = "quiet"
+)
+
+// Exit codes of the command-line runner, one per class of failure, so a pipeline
+// can tell a failing test from a broken setup. When cases fail for different
+// reasons, the highest code wins.
+const (
+	ExitOK          = 0
+	ExitTestFailure = 2 // a call returned an error or failed its checks
+	ExitDLLLoad     = 3 // a DLL could not be loaded
+	ExitCrash       = 4 // a DLL crashed its worker process (-isolate)
+	ExitConfig      = 5 // invalid options, profiles, configuration files or input
+)
+
+// cliMode is set when the simulator runs as the command-line runner (-call or
+// -stdin), whose fatal errors exit with the code of their class
+var cliMode bool
+
+// fatalf logs a fatal error and exits like log.Fatalf, with the given exit code
+// when running as the command-line runner
+func fatalf(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	if !cliMode {
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// exitCode returns the exit code of a test result
+func exitCode(result TestResult) int {
+	switch {
+	case result.Crash != nil:
+		return ExitCrash
+	case !result.Success:
+		return ExitTestFailure
+	default:
+		return ExitOK
+	}
+}
+
+// CLIResult is a result as the command-line runner writes it in json format, one
+// object per line. The schema is stable for scripts: every field is always
+// present, and fields are only ever added.
+type CLIResult struct {
+	Name           string            `json:"name"`
+	Profile        string            `json:"profile"`
+	Endpoint       string            `json:"endpoint"`
+	Success        bool              `json:"success"`
+	ReturnCode     int               `json:"returnCode"`
+	ReturnCodeName string            `json:"returnCodeName"`
+	DurationMs     float64           `json:"durationMs"`
+	Output         map[string]string `json:"output"`
+	Warnings       []string          `json:"warnings"`
+	Error          string            `json:"error"`
+	RunID          string            `json:"runId"`
+}
+
+// newCLIResult converts the result of a test case to the runner's json schema
+func newCLIResult(testCase TestCase, result TestResult) CLIResult {
+	r := CLIResult{
+		Name:           testCase.Name,
+		Profile:        result.Profile,
+		Endpoint:       endpointOf(testCase),
+		Success:        result.Success,
+		ReturnCode:     result.ReturnCode,
+		ReturnCodeName: dllclient.ErrorCode(result.ReturnCode).String(),
+		DurationMs:     result.DurationMs,
+		Output:         result.Output,
+		Warnings:       result.Warnings,
+		Error:          result.ErrorDetails,
+		RunID:          result.RunID,
+	}
+	if r.Output == nil {
+		r.Output = map[string]string{}
+	}
+	if r.Warnings == nil {
+		r.Warnings = []string{}
+	}
+	return r
+}
+
+// resultWriter writes the results of the command-line runner in one of the output
+// formats as they come, so a console or a pipeline sees each call when it ends
+type resultWriter struct {
+	format         string
+	w              io.Writer
+	passed, failed int
+}
+
+// newResultWriter creates a writer for an output format
+func newResultWriter(format string, w io.Writer) (*resultWriter, error) {
+	switch format {
+	case OutputJSON, OutputTable, OutputQuiet:
+		return &resultWriter{format: format, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format '%s' (valid formats: json, quiet, table)", format)
+	}
+}
+
+// write writes the result of a test case. In table format it is a row of fixed-width
+// columns (with a header before the first), followed by the decoded output values
+// and, for failures, the first line of the error details.
+func (rw *resultWriter) write(testCase TestCase, result TestResult) {
+	status := "PASS"
+	if result.Success {
+		rw.passed++
+	} else {
+		rw.failed++
+		status = "FAIL"
+	}
+
+	switch rw.format {
+	case OutputJSON:
+		json.NewEncoder(rw.w).Encode(newCLIResult(testCase, result))
+	case OutputTable:
+		if rw.passed+rw.failed == 1 {
+			fmt.Fprintf(rw.w, "%-6s %-20s %-16s %-12s %-18s %10s\n", "STATUS", "NAME", "ENDPOINT", "PROFILE", "RETURN CODE", "DURATION")
+		}
+		code := fmt.Sprintf("%d %s", result.ReturnCode, dllclient.ErrorCode(result.ReturnCode).String())
+		fmt.Fprintf(rw.w, "%-6s %-20s %-16s %-12s %-18s %7.1f ms\n", status, testCase.Name, endpointOf(testCase), result.Profile, code, result.DurationMs)
+
+		keys := make([]string, 0, len(result.Output))
+		for key := range result.Output {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(rw.w, "       %s = %s\n", key, escapeValue(result.Output[key]))
+		}
+		if !result.Success && result.ErrorDetails != "" {
+			fmt.Fprintf(rw.w, "       %s\n", firstLine(result.ErrorDetails))
+		}
+	}
+}
+
+// close ends the output, with the totals in table format
+func (rw *resultWriter) close() {
+	if rw.format == OutputTable && rw.passed+rw.failed > 1 {
+		fmt.Fprintf(rw.w, "\n%d passed, %d failed\n", rw.passed, rw.failed)
+	}
+}
+
+// parseCallParameters parses the parameters of -call, Key=Value pairs separated
+// by commas. A comma or backslash inside a value is escaped with a backslash.
+func parseCallParameters(spec string) ([]Parameter, error) {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(spec); i++ {
+		switch c := spec[i]; {
+		case c == '\\' && i+1 < len(spec):
+			i++
+			field.WriteByte(spec[i])
+		case c == ',':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	fields = append(fields, field.String())
+
+	var parameters []Parameter
+	for _, f := range fields {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("expected Key=Value, got '%s'", f)
+		}
+		parameters = append(parameters, Parameter{Key: strings.TrimSpace(key), Value: value})
+	}
+	if len(parameters) == 0 {
+		return nil, fmt.Errorf("no parameters")
+	}
+	return parameters, nil
+}
+
+// runCall performs the single call of -call with the loaded profiles, writes the
+// result to out and returns the exit code
+func runCall(parameters []Parameter, profileName string, out *resultWriter) int {
+	testCase := TestCase{Name: "call", Profile: profileName, Parameters: parameters}
+	profile, err := profileFor(testCase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "call: %v\n", err)
+		return ExitConfig
+	}
+	result := callWithHooks(profile, testCase, defaultLanguage, nil, 0, nil)
+	out.write(testCase, result)
+	out.close()
+	return exitCode(result)
+}
+
+// runStdin runs the test cases read from in, JSON objects in the /run-test format
+// one after another, and writes each result to out as soon as it is known, so the
+// simulator can be a stage of a pipeline. A case naming an unknown profile gets a
+// failed result. Returns the highest exit code of the cases, or ExitConfig when
+// the input is not valid JSON.
+func runStdin(in io.Reader, out *resultWriter) int {
+	defer out.close()
+	decoder := json.NewDecoder(in)
+	code := ExitOK
+	for {
+		var testCase TestCase
+		if err := decoder.Decode(&testCase); err == io.EOF {
+			return code
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "stdin: invalid test case: %v\n", err)
+			return ExitConfig
+		}
+
+		var result TestResult
+		profile, err := profileFor(testCase)
+		if err != nil {
+			result = TestResult{Name: testCase.Name, Profile: testCase.Profile, ReturnCode: -1, ErrorDetails: err.Error()}
+			code = max(code, ExitConfig)
+		} else {
+			result = callWithHooks(profile, testCase, defaultLanguage, nil, 0, nil)
+			code = max(code, exitCode(result))
+		}
+		out.write(testCase, result)
+	}
+}
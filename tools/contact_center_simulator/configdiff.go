@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Largest config.ini accepted by the diff endpoint
+const maxConfigSize = 1 << 20
+
+// iniFile is a parsed INI file. Section and key names are compared
+// case-insensitively, as the DLL reads them, so they are indexed in lower case
+// with the spelling of the file kept for display.
+type iniFile struct {
+	sections map[string]*iniSection
+}
+
+// iniSection is a section of an INI file
+type iniSection struct {
+	name   string
+	values map[string]iniEntry
+}
+
+// iniEntry is a key of an INI section and its value
+type iniEntry struct {
+	key, value string
+}
+
+// parseINI reads the sections and keys of an INI file. Keys before the first
+// section belong to the unnamed section "". Comments start with ; or #.
+func parseINI(data []byte) *iniFile {
+	f := &iniFile{sections: make(map[string]*iniSection)}
+	section := func(name string) *iniSection {
+		s := f.sections[strings.ToLower(name)]
+		if s == nil {
+			s = &iniSection{name: name, values: make(map[string]iniEntry)}
+			f.sections[strings.ToLower(name)] = s
+		}
+		return s
+	}
+	current := section("")
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = section(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			key := strings.TrimSpace(k)
+			current.values[strings.ToLower(key)] = iniEntry{key: key, value: strings.TrimSpace(v)}
+		}
+	}
+	if len(f.sections[""].values) == 0 {
+		delete(f.sections, "")
+	}
+	return f
+}
+
+// ConfigDifference is a key whose value differs between two config files, or that
+// only one of them sets
+type ConfigDifference struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	// Status is changed, only_left or only_right
+	Status string  `json:"status"`
+	Left   *string `json:"left,omitempty"`
+	Right  *string `json:"right,omitempty"`
+}
+
+// ConfigDiff compares two config files
+type ConfigDiff struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+	// Identical is true when both files set the same keys to the same values
+	Identical bool `json:"identical"`
+	// Sections only one of the files has
+	MissingFromLeft  []string           `json:"missingFromLeft"`
+	MissingFromRight []string           `json:"missingFromRight"`
+	Differences      []ConfigDifference `json:"differences"`
+}
+
+// diffINI compares two INI files, listing differences by section and key
+func diffINI(leftName string, left *iniFile, rightName string, right *iniFile) ConfigDiff {
+	diff := ConfigDiff{
+		Left:             leftName,
+		Right:            rightName,
+		MissingFromLeft:  []string{},
+		MissingFromRight: []string{},
+		Differences:      []ConfigDifference{},
+	}
+
+	names := make(map[string]bool)
+	for name := range left.sections {
+		names[name] = true
+	}
+	for name := range right.sections {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		l, r := left.sections[name], right.sections[name]
+		if l == nil {
+			diff.MissingFromLeft = append(diff.MissingFromLeft, r.name)
+			l = &iniSection{name: r.name}
+		}
+		if r == nil {
+			diff.MissingFromRight = append(diff.MissingFromRight, l.name)
+			r = &iniSection{name: l.name}
+		}
+
+		keys := make(map[string]bool)
+		for key := range l.values {
+			keys[key] = true
+		}
+		for key := range r.values {
+			keys[key] = true
+		}
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		for _, key := range sortedKeys {
+			lv, inLeft := l.values[key]
+			rv, inRight := r.values[key]
+			d := ConfigDifference{Section: l.name}
+			switch {
+			case inLeft && inRight:
+				if lv.value == rv.value {
+					continue
+				}
+				d.Key, d.Status, d.Left, d.Right = lv.key, "changed", &lv.value, &rv.value
+			case inLeft:
+				d.Key, d.Status, d.Left = lv.key, "only_left", &lv.value
+			default:
+				d.Key, d.Status, d.Right = rv.key, "only_right", &rv.value
+			}
+			diff.Differences = append(diff.Differences, d)
+		}
+	}
+	diff.Identical = len(diff.Differences) == 0 && len(diff.MissingFromLeft) == 0 && len(diff.MissingFromRight) == 0
+	return diff
+}
+
+// readConfigSide reads one side of a config diff: an uploaded file of the
+// multipart form, or the path of a query parameter, or else the config.ini of
+// the DLL. It returns the name of the side and the file's contents.
+func readConfigSide(r *http.Request, side string) (string, []byte, error) {
+	if r.MultipartForm != nil {
+		if files := r.MultipartForm.File[side]; len(files) > 0 {
+			f, err := files[0].Open()
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read the uploaded %s file: %v", side, err)
+			}
+			defer f.Close()
+			data, err := io.ReadAll(io.LimitReader(f, maxConfigSize+1))
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read the uploaded %s file: %v", side, err)
+			}
+			if len(data) > maxConfigSize {
+				return "", nil, fmt.Errorf("the uploaded %s file is larger than %d bytes", side, maxConfigSize)
+			}
+			return files[0].Filename, data, nil
+		}
+	}
+	path := r.FormValue(side)
+	if path == "" {
+		path = filepath.Join(filepath.Dir(dllPath), "config.ini")
+	}
+	data, err := readConfigFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the %s config file: %v", side, err)
+	}
+	return path, data, nil
+}
+
+// configDirs are the directories whose .ini files the diff endpoint reads: those
+// of the DLLs and the working directories of the profiles
+func configDirs() []string {
+	dirs := []string{filepath.Dir(dllPath)}
+	for _, p := range profiles {
+		dirs = append(dirs, filepath.Dir(p.DLL))
+		if p.WorkingDir != "" {
+			dirs = append(dirs, p.WorkingDir)
+		}
+	}
+	return dirs
+}
+
+// readConfigFile reads a .ini file of one of configDirs (or their subdirectories),
+// so the endpoint cannot read other files of the machine, refusing files larger
+// than maxConfigSize
+func readConfigFile(path string) ([]byte, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".ini") {
+		return nil, fmt.Errorf("%s is not a .ini file", path)
+	}
+	// Resolve links, which could point outside the directories
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, dir := range configDirs() {
+		if dir, err = filepath.EvalSymlinks(dir); err != nil {
+			continue
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%s is not in the directory of a DLL or the working directory of a profile", path)
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxConfigSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, maxConfigSize)
+	}
+	return data, nil
+}
+
+// handleConfigDiff compares two config.ini files (/debug/config-diff) and reports
+// the sections missing from either and the keys that differ. Each side (left and
+// right) is an uploaded file of a multipart POST, or the path of a .ini file in
+// the directory of a DLL or a profile, or by default the config.ini of the DLL.
+func handleConfigDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if err := r.ParseMultipartForm(2 * maxConfigSize); err != nil {
+			http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	leftName, left, err := readConfigSide(r, "left")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rightName, right, err := readConfigSide(r, "right")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffINI(leftName, parseINI(left), rightName, parseINI(right)))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default interval between samples of the performance counters
+const DefaultCounterInterval = 5 * time.Second
+
+// Performance counters of the process hosting the DLL
+const (
+	// CPU time used since the previous sample, in percent of one core
+	counterCPU = "cpu_percent"
+	// Open handles (file descriptors on Linux)
+	counterHandles = "handles"
+	// Memory private to the process (anonymous resident memory on Linux)
+	counterPrivateBytes = "private_bytes"
+	// TCP connections of the process, not counting listening sockets
+	counterTCP = "tcp_connections"
+)
+
+// counterNames are the counters that can be collected, in report order
+var counterNames = []string{counterCPU, counterHandles, counterPrivateBytes, counterTCP}
+
+// processCounters are the raw counters of a process
+type processCounters struct {
+	cpu          time.Duration
+	handles      int
+	privateBytes uint64
+	tcp          int
+}
+
+// CounterSample is one sample of the performance counters of the process hosting
+// the DLL, with the phase of the run it was taken in
+type CounterSample struct {
+	Time   time.Time          `json:"time"`
+	Phase  string             `json:"phase"`
+	PID    int                `json:"pid"`
+	Values map[string]float64 `json:"values"`
+}
+
+// counterFlags are the performance counter options of a load subcommand
+type counterFlags struct {
+	names    *string
+	interval *time.Duration
+}
+
+// addCounterFlags adds the performance counter options to fs
+func addCounterFlags(fs *flag.FlagSet) *counterFlags {
+	return &counterFlags{
+		names:    fs.String("counters", "", "Comma-separated performance counters of the process hosting the DLL to sample: "+strings.Join(counterNames, ", ")+", or all (default none)"),
+		interval: fs.Duration("counters-interval", DefaultCounterInterval, "Interval between samples of the performance counters"),
+	}
+}
+
+// selected returns the counters to collect, none without -counters
+func (f *counterFlags) selected() ([]string, error) {
+	if *f.names == "" {
+		return nil, nil
+	}
+	if *f.interval <= 0 {
+		return nil, fmt.Errorf("-counters-interval must be positive")
+	}
+	if *f.names == "all" {
+		return counterNames, nil
+	}
+	var names []string
+	for _, name := range strings.Split(*f.names, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(counterNames, name) {
+			return nil, fmt.Errorf("unknown counter '%s' (valid counters: %s, all)", name, strings.Join(counterNames, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// hostPID returns the process hosting a DLL: its worker for isolated profiles,
+// else the simulator. It is 0 while a crashed worker is not restarted.
+func hostPID(dll *loadedDLL) int {
+	if w, ok := dll.invoker.(*workerInvoker); ok {
+		return w.pid()
+	}
+	return os.Getpid()
+}
+
+// counterSampler samples performance counters of the process hosting the DLL,
+// appending each sample to a JSON lines file, and keeps the peak of each counter
+// in the current phase of the run
+type counterSampler struct {
+	names    []string
+	interval time.Duration
+	pid      func() int
+	file     *os.File
+	enc      *json.Encoder
+
+	mu    sync.Mutex
+	phase string
+	peaks map[string]float64
+
+	// Previous sample, for the CPU percentage
+	lastPID int
+	lastCPU time.Duration
+	lastAt  time.Time
+}
+
+// newCounterSampler creates a sampler of the counters names of the process pid
+// returns, writing the samples to path
+func newCounterSampler(path string, names []string, interval time.Duration, pid func() int) (*counterSampler, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create counters file: %v", err)
+	}
+	return &counterSampler{names: names, interval: interval, pid: pid, file: file, enc: json.NewEncoder(file),
+		peaks: make(map[string]float64)}, nil
+}
+
+// setPhase starts a phase of the run, such as a soak interval or a capacity step
+func (s *counterSampler) setPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phase = phase
+}
+
+// takePeaks returns the highest value of each counter since the previous call,
+// nil if nothing was sampled
+func (s *counterSampler) takePeaks() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.peaks) == 0 {
+		return nil
+	}
+	peaks := s.peaks
+	s.peaks = make(map[string]float64)
+	return peaks
+}
+
+// run samples the counters every interval until ctx is done
+func (s *counterSampler) run(ctx context.Context) {
+	s.sample(time.Now())
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sample(now)
+		}
+	}
+}
+
+// sample reads the counters once and records them
+func (s *counterSampler) sample(now time.Time) {
+	pid := s.pid()
+	if pid == 0 {
+		return
+	}
+	counters, err := readProcessCounters(pid)
+	if err != nil {
+		log.Printf("Failed to read the performance counters of process %d: %v", pid, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample := CounterSample{Time: now, Phase: s.phase, PID: pid, Values: make(map[string]float64, len(s.names))}
+	for _, name := range s.names {
+		switch name {
+		case counterCPU:
+			// The first sample of a process has nothing to compare with
+			if pid != s.lastPID || s.lastAt.IsZero() {
+				continue
+			}
+			sample.Values[name] = float64(counters.cpu-s.lastCPU) / float64(now.Sub(s.lastAt)) * 100
+		case counterHandles:
+			sample.Values[name] = float64(counters.handles)
+		case counterPrivateBytes:
+			sample.Values[name] = float64(counters.privateBytes)
+		case counterTCP:
+			sample.Values[name] = float64(counters.tcp)
+		}
+	}
+	s.lastPID, s.lastCPU, s.lastAt = pid, counters.cpu, now
+	for name, value := range sample.Values {
+		s.peaks[name] = max(s.peaks[name], value)
+	}
+	if err := s.enc.Encode(sample); err != nil {
+		log.Printf("Failed to write performance counters: %v", err)
+	}
+}
+
+// close closes the counters file
+func (s *counterSampler) close() error {
+	return s.file.Close()
+}
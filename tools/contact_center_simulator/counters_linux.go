@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clock ticks per second of the CPU times in /proc (USER_HZ)
+const clockTicks = 100
+
+// readProcessCounters reads the counters of a process from /proc
+func readProcessCounters(pid int) (processCounters, error) {
+	var c processCounters
+	proc := fmt.Sprintf("/proc/%d", pid)
+
+	// utime and stime are the 14th and 15th fields, after the command in parentheses
+	data, err := os.ReadFile(proc + "/stat")
+	if err != nil {
+		return c, err
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	if len(fields) < 13 {
+		return c, fmt.Errorf("unexpected format of %s/stat", proc)
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	c.cpu = time.Duration(utime+stime) * time.Second / clockTicks
+
+	// Open file descriptors, and the inodes of the sockets among them
+	fds, err := os.ReadDir(proc + "/fd")
+	if err != nil {
+		return c, err
+	}
+	c.handles = len(fds)
+	sockets := make(map[string]bool)
+	for _, fd := range fds {
+		if target, err := os.Readlink(proc + "/fd/" + fd.Name()); err == nil && strings.HasPrefix(target, "socket:[") {
+			sockets[strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")] = true
+		}
+	}
+
+	if status, err := os.Open(proc + "/status"); err == nil {
+		scanner := bufio.NewScanner(status)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "RssAnon:"); ok {
+				kb, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+				c.privateBytes = kb * 1024
+			}
+		}
+		status.Close()
+	}
+
+	// Connections whose socket the process holds, except listening ones (state 0A)
+	for _, table := range []string{"/net/tcp", "/net/tcp6"} {
+		f, err := os.Open(proc + table)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			row := strings.Fields(scanner.Text())
+			if len(row) > 9 && row[3] != "0A" && sockets[row[9]] {
+				c.tcp++
+			}
+		}
+		f.Close()
+	}
+	return c, nil
+}
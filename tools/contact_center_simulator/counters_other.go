@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+// readProcessCounters is not available on this platform
+func readProcessCounters(pid int) (processCounters, error) {
+	return processCounters{}, errors.New("performance counters are not available on this platform")
+}
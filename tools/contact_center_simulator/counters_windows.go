@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	iphlpapi                  = syscall.NewLazyDLL("iphlpapi.dll")
+	procGetExtendedTcpTable   = iphlpapi.NewProc("GetExtendedTcpTable")
+	procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+)
+
+// Access rights and constants of the counter queries
+const (
+	processQueryLimitedInformation = 0x1000
+	processVMRead                  = 0x0010
+	errorInsufficientBuffer        = 122
+	// TCP_TABLE_OWNER_PID_ALL of GetExtendedTcpTable
+	tcpTableOwnerPIDAll = 5
+	// MIB_TCP_STATE_LISTEN
+	tcpStateListen = 2
+)
+
+// processMemoryCountersEx is PROCESS_MEMORY_COUNTERS_EX
+type processMemoryCountersEx struct {
+	processMemoryCounters
+	privateUsage uintptr
+}
+
+// tcpTable describes a row of the TCP table of an address family: its size, and
+// the offsets of its state and owning process
+type tcpTable struct {
+	family          uint32
+	rowSize         int
+	state, ownerPID int
+}
+
+// MIB_TCPROW_OWNER_PID and MIB_TCP6ROW_OWNER_PID
+var tcpTables = []tcpTable{
+	{family: syscall.AF_INET, rowSize: 24, state: 0, ownerPID: 20},
+	{family: syscall.AF_INET6, rowSize: 56, state: 48, ownerPID: 52},
+}
+
+// readProcessCounters reads the counters of a process
+func readProcessCounters(pid int) (processCounters, error) {
+	var c processCounters
+	process, err := syscall.OpenProcess(processQueryLimitedInformation|processVMRead, false, uint32(pid))
+	if err != nil {
+		return c, err
+	}
+	defer syscall.CloseHandle(process)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(process, &creation, &exit, &kernel, &user); err != nil {
+		return c, err
+	}
+	ticks := func(t syscall.Filetime) int64 { return int64(t.HighDateTime)<<32 | int64(t.LowDateTime) }
+	c.cpu = time.Duration(ticks(kernel)+ticks(user)) * 100
+
+	var handles uint32
+	if ret, _, _ := procGetProcessHandleCount.Call(uintptr(process), uintptr(unsafe.Pointer(&handles))); ret != 0 {
+		c.handles = int(handles)
+	}
+
+	var memory processMemoryCountersEx
+	memory.cb = uint32(unsafe.Sizeof(memory))
+	if ret, _, _ := procGetProcessMemoryInfo.Call(uintptr(process), uintptr(unsafe.Pointer(&memory)), uintptr(memory.cb)); ret != 0 {
+		c.privateBytes = uint64(memory.privateUsage)
+	}
+
+	for _, table := range tcpTables {
+		c.tcp += tcpConnections(table, uint32(pid))
+	}
+	return c, nil
+}
+
+// tcpConnections counts the TCP connections of a process in the table of an
+// address family, except listening sockets
+func tcpConnections(table tcpTable, pid uint32) int {
+	size := uint32(4096)
+	for {
+		buf := make([]byte, size)
+		ret, _, _ := procGetExtendedTcpTable.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0,
+			uintptr(table.family), tcpTableOwnerPIDAll, 0)
+		if ret == errorInsufficientBuffer {
+			continue
+		}
+		if ret != 0 || len(buf) < 4 {
+			return 0
+		}
+		count := 0
+		rows := int(binary.LittleEndian.Uint32(buf))
+		for i := 0; i < rows; i++ {
+			row := buf[4+i*table.rowSize:]
+			if len(row) < table.rowSize {
+				break
+			}
+			if binary.LittleEndian.Uint32(row[table.ownerPID:]) == pid && binary.LittleEndian.Uint32(row[table.state:]) != tcpStateListen {
+				count++
+			}
+		}
+		return count
+	}
+}
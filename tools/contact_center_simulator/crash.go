@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Names of the Windows exception codes (NTSTATUS) a crashing DLL typically raises
+var exceptionNames = map[uint32]string{
+	0x80000002: "DATATYPE_MISALIGNMENT",
+	0x80000003: "BREAKPOINT",
+	0xC0000005: "ACCESS_VIOLATION",
+	0xC0000006: "IN_PAGE_ERROR",
+	0xC000001D: "ILLEGAL_INSTRUCTION",
+	0xC000008C: "ARRAY_BOUNDS_EXCEEDED",
+	0xC000008E: "FLT_DIVIDE_BY_ZERO",
+	0xC0000094: "INT_DIVIDE_BY_ZERO",
+	0xC0000095: "INT_OVERFLOW",
+	0xC0000096: "PRIV_INSTRUCTION",
+	0xC00000FD: "STACK_OVERFLOW",
+	0xC0000374: "HEAP_CORRUPTION",
+	0xC0000409: "STACK_BUFFER_OVERRUN",
+	0xE06D7363: "CPP_EXCEPTION (unhandled C++ exception)",
+}
+
+// Crash reports the Go runtime of a worker writes before it exits: "Exception
+// 0xc0000005 ..." on Windows, "[signal SIGSEGV: segmentation violation ...]" or
+// "SIGSEGV: segmentation violation" elsewhere, followed by the faulting PC
+var (
+	exceptionPattern = regexp.MustCompile(`Exception (0x[0-9a-fA-F]+)`)
+	signalPattern    = regexp.MustCompile(`(SIG[A-Z0-9]+): ([a-z][a-z -]*[a-z])`)
+	pcPattern        = regexp.MustCompile(`(?i)\bpc=(0x[0-9a-f]+)`)
+)
+
+// ModuleInfo is a module loaded in a worker, to locate a faulting address
+type ModuleInfo struct {
+	Path string `json:"path"`
+	Base uint64 `json:"base"`
+	Size uint64 `json:"size"`
+}
+
+// CrashInfo describes the crash of a worker in a test result
+type CrashInfo struct {
+	ExitCode int `json:"exitCode"`
+	// Code is the exception code ("0xC0000005") or signal ("SIGSEGV"), and
+	// Exception its name
+	Code      string `json:"code,omitempty"`
+	Exception string `json:"exception,omitempty"`
+	// Module and Offset locate the faulting instruction
+	Module  string `json:"module,omitempty"`
+	Offset  string `json:"offset,omitempty"`
+	Summary string `json:"summary"`
+	// Log is the URL of the worker output stored with the run artifacts
+	Log string `json:"log,omitempty"`
+
+	output string
+}
+
+// Names of the signals that end a worker without a report of the Go runtime
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// exitSignal returns the signal that killed a process, 0 if it exited
+func exitSignal(state *os.ProcessState) syscall.Signal {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return 0
+}
+
+// decodeCrash reads the exception and faulting location of a crashed worker from
+// its exit code, the signal that killed it (Linux and macOS) and its output
+func decodeCrash(exitCode int, signal syscall.Signal, output string, modules []ModuleInfo) *CrashInfo {
+	info := &CrashInfo{ExitCode: exitCode, output: output}
+
+	if m := exceptionPattern.FindStringSubmatch(output); m != nil {
+		if code, err := strconv.ParseUint(m[1][2:], 16, 32); err == nil {
+			info.setException(uint32(code))
+		}
+	} else if m := signalPattern.FindStringSubmatch(output); m != nil {
+		info.Code, info.Exception = m[1], m[2]
+	} else if code := uint32(exitCode); runtime.GOOS == "windows" && code >= 0x80000000 {
+		// A process killed by an exception the runtime did not report exits with its code
+		info.setException(code)
+	} else if signal != 0 {
+		// Such as SIGKILL from the out-of-memory killer, which leaves no report
+		info.Code, info.Exception = signalNames[signal], "killed by signal"
+		if info.Code == "" {
+			info.Code = fmt.Sprintf("signal %d", int(signal))
+		}
+	}
+
+	if m := pcPattern.FindStringSubmatch(output); m != nil {
+		if pc, err := strconv.ParseUint(m[1][2:], 16, 64); err == nil {
+			info.Module, info.Offset = locate(pc, modules)
+		}
+	}
+
+	info.Summary = info.summary()
+	return info
+}
+
+// setException sets a Windows exception code and its name
+func (c *CrashInfo) setException(code uint32) {
+	c.Code = fmt.Sprintf("0x%08X", code)
+	c.Exception = exceptionNames[code]
+	if c.Exception == "" {
+		c.Exception = "unknown exception"
+	}
+}
+
+// summary describes the crash in one line, such as
+// "ACCESS_VIOLATION (0xC0000005) at CustomDLL.dll+0x1a2b"
+func (c *CrashInfo) summary() string {
+	var b strings.Builder
+	if c.Code != "" {
+		fmt.Fprintf(&b, "%s (%s)", c.Exception, c.Code)
+	} else {
+		fmt.Fprintf(&b, "exit code %d", c.ExitCode)
+	}
+	if c.Module != "" {
+		fmt.Fprintf(&b, " at %s+%s", c.Module, c.Offset)
+	} else if c.Offset != "" {
+		fmt.Fprintf(&b, " at %s", c.Offset)
+	}
+	return b.String()
+}
+
+// locate returns the module holding the address and the offset in it, or no
+// module and the address itself if no module holds it
+func locate(pc uint64, modules []ModuleInfo) (string, string) {
+	for _, m := range modules {
+		if pc >= m.Base && pc < m.Base+m.Size {
+			return filepath.Base(m.Path), fmt.Sprintf("0x%x", pc-m.Base)
+		}
+	}
+	return "", fmt.Sprintf("0x%x", pc)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Defaults of the DLL for the config.ini settings the request depends on
+const (
+	defaultDLLTimeout        = "4"
+	defaultDLLConnectTimeout = "2"
+)
+
+// curlEscape percent-encodes a value as curl_easy_escape does for the DLL: every
+// byte but the unreserved characters of RFC 3986
+func curlEscape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// backendURL returns the URL the DLL requests for the given parameters: the
+// base_url of config.ini with every parameter but CFResp in the query, in key
+// order as the DLL sends them
+func backendURL(baseURL string, parameters []Parameter) string {
+	values := make(map[string]string)
+	for _, p := range parameters {
+		if p.Key != "CFResp" {
+			values[p.Key] = p.Value
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + curlEscape(values[key])
+	}
+	return baseURL + "?" + strings.Join(pairs, "&")
+}
+
+// curlCommand returns the curl command sending the request the DLL at dllPath
+// makes to the backend for the given parameters, as encoded for the buffer since
+// the DLL sends the bytes it reads. The timeouts and TLS settings come from its
+// config.ini (the original one while -intercept points base_url at the proxy).
+// Running it shows whether the backend or the DLL is at fault for a failing test.
+// The URL is fully encoded, so the double-quoted command works in cmd,
+// PowerShell and POSIX shells alike.
+func curlCommand(dllPath string, parameters []Parameter) string {
+	configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
+	config, err := os.ReadFile(configPath + configBackupSuffix)
+	if err != nil {
+		config, _ = os.ReadFile(configPath)
+	}
+	setting := func(key, fallback string) string {
+		if v, ok := iniValue(config, "api", key); ok && v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	args := []string{"curl", "-sS", "-i", "--http1.1", "-L", "--max-redirs", "3",
+		"--connect-timeout", setting("connect_timeout", defaultDLLConnectTimeout),
+		"--max-time", setting("timeout", defaultDLLTimeout)}
+	if setting("verify_ssl", "1") == "0" {
+		args = append(args, "-k")
+	} else if certFile := setting("ssl_cert_file", ""); certFile != "" {
+		args = append(args, "--cacert", `"`+certFile+`"`)
+	}
+	args = append(args, `"`+backendURL(setting("base_url", defaultBaseURL), parameters)+`"`)
+	return strings.Join(args, " ")
+}
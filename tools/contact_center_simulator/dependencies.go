@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Signature and structure version starting VS_FIXEDFILEINFO, the version
+// resource of PE files
+var fixedFileInfoSignature = []byte{0xBD, 0x04, 0xEF, 0xFE, 0x00, 0x00, 0x01, 0x00}
+
+// Directories searched for the dependencies of shared libraries, after the
+// library's own directory and LD_LIBRARY_PATH
+var libraryDirs = []string{
+	"/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib",
+	"/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu",
+	"/lib/aarch64-linux-gnu", "/usr/lib/aarch64-linux-gnu",
+}
+
+// DependencyInfo describes a library the DLL depends on, directly or through
+// another dependency
+type DependencyInfo struct {
+	Name string `json:"name"`
+	// Path is where the loader would find the library ("" if it was not found)
+	Path string `json:"path,omitempty"`
+	// Version is the file version of a DLL, or the version in the name of a shared library
+	Version        string `json:"version,omitempty"`
+	ProductVersion string `json:"productVersion,omitempty"`
+	// RequiredBy is the library importing it
+	RequiredBy string `json:"requiredBy"`
+	// System libraries are not inspected further
+	System bool   `json:"system,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importedLibraries lists the libraries a DLL or shared library imports
+func importedLibraries(path string) ([]string, error) {
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		return f.ImportedLibraries()
+	}
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		return f.ImportedLibraries()
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		return f.ImportedLibraries()
+	}
+	return nil, fmt.Errorf("%s is not a PE, ELF or Mach-O file", filepath.Base(path))
+}
+
+// searchDirs returns the directories the loader searches for the dependencies of
+// the library at path, and whether each holds system libraries
+func searchDirs(path string) ([]string, map[string]bool) {
+	dirs := []string{filepath.Dir(path)}
+	system := make(map[string]bool)
+	if runtime.GOOS == "windows" {
+		if root := os.Getenv("SystemRoot"); root != "" {
+			for _, dir := range []string{filepath.Join(root, "System32"), root} {
+				dirs = append(dirs, dir)
+				system[dir] = true
+			}
+		}
+		dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+		return dirs, system
+	}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))...)
+	for _, dir := range libraryDirs {
+		dirs = append(dirs, dir)
+		system[dir] = true
+	}
+	return dirs, system
+}
+
+// resolveLibrary finds a library in the search directories
+func resolveLibrary(name string, dirs []string) (string, string, bool) {
+	if filepath.IsAbs(name) {
+		if _, err := os.Stat(name); err == nil {
+			return name, filepath.Dir(name), true
+		}
+		return "", "", false
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, dir, true
+		}
+		// DLL names are case-insensitive
+		if runtime.GOOS != "windows" && strings.HasSuffix(strings.ToLower(name), ".dll") {
+			if entries, err := os.ReadDir(dir); err == nil {
+				for _, entry := range entries {
+					if strings.EqualFold(entry.Name(), name) {
+						return filepath.Join(dir, entry.Name()), dir, true
+					}
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// inspectDependencies lists the libraries the DLL at path depends on, with the
+// versions of those it finds. System libraries are listed but not followed.
+func inspectDependencies(path string) ([]DependencyInfo, error) {
+	imports, err := importedLibraries(path)
+	if err != nil {
+		return nil, err
+	}
+	dirs, system := searchDirs(path)
+
+	var deps []DependencyInfo
+	seen := make(map[string]bool)
+	type pending struct{ name, requiredBy string }
+	queue := make([]pending, 0, len(imports))
+	for _, name := range imports {
+		queue = append(queue, pending{name, filepath.Base(path)})
+	}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		key := strings.ToLower(next.name)
+		// API sets are virtual DLLs mapped onto system DLLs by Windows
+		if seen[key] || strings.HasPrefix(key, "api-ms-win-") || strings.HasPrefix(key, "ext-ms-") {
+			continue
+		}
+		seen[key] = true
+
+		dep := DependencyInfo{Name: next.name, RequiredBy: next.requiredBy}
+		resolved, dir, ok := resolveLibrary(next.name, dirs)
+		if !ok {
+			dep.Error = "not found"
+			deps = append(deps, dep)
+			continue
+		}
+		dep.Path, dep.System = resolved, system[dir]
+		dep.Version, dep.ProductVersion = libraryVersion(resolved)
+		deps = append(deps, dep)
+
+		if dep.System {
+			continue
+		}
+		more, err := importedLibraries(resolved)
+		if err != nil {
+			continue
+		}
+		for _, name := range more {
+			queue = append(queue, pending{name, next.name})
+		}
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool { return !deps[i].System && deps[j].System })
+	return deps, nil
+}
+
+// libraryVersion returns the file and product versions of a library: from the
+// version resource of a DLL, or from the file name of a shared library
+// (libcurl.so.4 -> libcurl.so.4.8.0 gives 4.8.0)
+func libraryVersion(path string) (string, string) {
+	if strings.HasSuffix(strings.ToLower(path), ".dll") {
+		return fixedFileVersion(path)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", ""
+	}
+	name := filepath.Base(real)
+	if i := strings.Index(name, ".so."); i >= 0 {
+		return name[i+len(".so."):], ""
+	}
+	if i := strings.Index(name, ".dylib"); i > 0 {
+		if j := strings.IndexByte(name[:i], '.'); j >= 0 {
+			return name[j+1 : i], ""
+		}
+	}
+	return "", ""
+}
+
+// fixedFileVersion reads the file and product versions of a DLL from its
+// VS_FIXEDFILEINFO, without loading it
+func fixedFileVersion(path string) (string, string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", ""
+	}
+
+	// Signature, structure version, then file version MS/LS and product version MS/LS
+	i := bytes.Index(data, fixedFileInfoSignature)
+	if i < 0 || len(data) < i+24 {
+		return "", ""
+	}
+	words := make([]uint32, 4)
+	for n := range words {
+		words[n] = binary.LittleEndian.Uint32(data[i+8+4*n:])
+	}
+	version := func(ms, ls uint32) string {
+		return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+	}
+	return version(words[0], words[1]), version(words[2], words[3])
+}
+
+// writeDependencies writes the dependencies as a table
+func writeDependencies(w io.Writer, deps []DependencyInfo) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tVERSION\tREQUIRED BY\tPATH")
+	for _, dep := range deps {
+		version := dep.Version
+		if version == "" {
+			version = "-"
+		}
+		location := dep.Path
+		if dep.Error != "" {
+			location = "NOT FOUND"
+		} else if dep.System {
+			location += " (system)"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", dep.Name, version, dep.RequiredBy, location)
+	}
+	tw.Flush()
+}
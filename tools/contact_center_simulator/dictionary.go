@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ParameterDefinition describes a known parameter key of the input buffer
+type ParameterDefinition struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	// Format describes the expected values, and Pattern is a regular expression
+	// the whole value must match (warnings only, the value is still sent)
+	Format  string `json:"format,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// Values lists the accepted values, when there is a fixed set
+	Values   []string `json:"values,omitempty"`
+	Examples []string `json:"examples,omitempty"`
+	// Endpoints lists the endpoints using the parameter (empty for all)
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Known parameters of the OSCC Data Link, keyed by parameter key
+var parameterDictionary = map[string]*ParameterDefinition{
+	"Endpoint": {
+		Description: "API endpoint the DLL calls",
+		Values:      []string{"procesareDate_1", "procesareDate_2", "getInfo", "getInfo_2", "saveCID", "getCID", "getDiacritics"},
+		Examples:    []string{"procesareDate_1", "getInfo"},
+	},
+	"CFResp": {
+		Description: "Whether the DLL writes the server response to the output buffer",
+		Values:      []string{"yes", "no"},
+		Examples:    []string{"yes"},
+	},
+	"Tel": {
+		Description: "Caller phone number",
+		Format:      "phone number (optional +, 6 to 15 digits)",
+		Pattern:     `\+?[0-9]{6,15}`,
+		Examples:    []string{"0744516456"},
+		Endpoints:   []string{"procesareDate_1", "procesareDate_2"},
+	},
+	"CIF": {
+		Description: "Customer identification code",
+		Format:      "alphanumeric",
+		Pattern:     `[A-Za-z0-9]+`,
+		Examples:    []string{"1234KTE"},
+		Endpoints:   []string{"procesareDate_1", "procesareDate_2"},
+	},
+	"CID": {
+		Description: "Call identifier assigned by OSCC",
+		Format:      "numeric",
+		Pattern:     `[0-9]+`,
+		Examples:    []string{"193691036401673"},
+		Endpoints:   []string{"procesareDate_1", "procesareDate_2", "saveCID", "getCID"},
+	},
+	"ID": {
+		Description: "Customer ID",
+		Format:      "numeric",
+		Pattern:     `[0-9]+`,
+		Examples:    []string{"12345"},
+		Endpoints:   []string{"getInfo", "getInfo_2"},
+	},
+}
+
+func init() {
+	for key, def := range parameterDictionary {
+		if err := def.prepare(key); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// prepare checks the definition and compiles its pattern
+func (d *ParameterDefinition) prepare(key string) error {
+	d.Key = key
+	if d.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + d.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("parameter '%s': invalid pattern: %v", key, err)
+		}
+		d.pattern = re
+	}
+	return nil
+}
+
+// loadDictionary reads parameter definitions from a JSON file of the form
+//
+//	{"Token_b64": {"description": "Session token", "examples": ["dG9rZW4="]}}
+//
+// Each key listed replaces its built-in definition.
+func loadDictionary(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read dictionary file: %v", err)
+	}
+	var config map[string]*ParameterDefinition
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse dictionary file %s: %v", path, err)
+	}
+	for key, def := range config {
+		if def == nil {
+			def = &ParameterDefinition{}
+		}
+		if err := def.prepare(key); err != nil {
+			return fmt.Errorf("dictionary file %s: %v", path, err)
+		}
+		parameterDictionary[key] = def
+	}
+	return nil
+}
+
+// dictionaryKeys lists the known parameter keys
+func dictionaryKeys() []string {
+	keys := make([]string, 0, len(parameterDictionary))
+	for key := range parameterDictionary {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkParameters warns about parameters missing from the dictionary and values
+// that do not match their definition
+func checkParameters(parameters []Parameter) []string {
+	var warnings []string
+	for _, param := range parameters {
+		def, ok := parameterDictionary[param.Key]
+		if !ok {
+			warning := fmt.Sprintf("Parameter '%s' is not in the parameter dictionary", param.Key)
+			for _, key := range dictionaryKeys() {
+				if strings.EqualFold(key, param.Key) {
+					warning += fmt.Sprintf(" (did you mean '%s'? keys are case-sensitive)", key)
+				}
+			}
+			warnings = append(warnings, warning)
+			continue
+		}
+		if param.Value == "" {
+			continue
+		}
+		if len(def.Values) > 0 && !slices.Contains(def.Values, param.Value) {
+			warnings = append(warnings, fmt.Sprintf("Value '%s' of '%s' is not one of: %s", param.Value, param.Key, strings.Join(def.Values, ", ")))
+		} else if def.pattern != nil && !def.pattern.MatchString(param.Value) {
+			warnings = append(warnings, fmt.Sprintf("Value '%s' of '%s' does not match the %s format (example: %s)", param.Value, param.Key, def.Format, strings.Join(def.Examples, ", ")))
+		}
+	}
+	return warnings
+}
+
+// handleParameters lists the parameter dictionary (GET /api/parameters), or the
+// definition of one key (GET /api/parameters?key=...)
+func handleParameters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var v interface{}
+	if key := r.URL.Query().Get("key"); key != "" {
+		def, ok := parameterDictionary[key]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown parameter '%s'", key), http.StatusNotFound)
+			return
+		}
+		v = def
+	} else {
+		list := []*ParameterDefinition{}
+		for _, key := range dictionaryKeys() {
+			list = append(list, parameterDictionary[key])
+		}
+		v = list
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// etwProvider is an ETW provider enabled in the trace of a call
+type etwProvider struct {
+	name string
+	guid string
+	// keywords selects the events of the provider (0 for all of them)
+	keywords uint64
+}
+
+// Providers of the ETW trace of a call: the network stack the DLL's requests go
+// through, and the images the DLL loads
+var etwProviders = []etwProvider{
+	{"Microsoft-Windows-TCPIP", "2F07E2EE-15DB-40F1-90EF-9D7BA282188A", 0},
+	{"Microsoft-Windows-Winsock-AFD", "E53C6823-7BB8-44BB-90DC-3F86090D48A6", 0},
+	{"Microsoft-Windows-DNS-Client", "1C95126E-7EEA-49A9-A3FE-A378B03DDB4D", 0},
+	// WINEVENT_KEYWORD_IMAGE: image load and unload events
+	{"Microsoft-Windows-Kernel-Process", "22FB2CD6-0E7B-422B-A0C7-2FAD1FD0E716", 0x40},
+}
+
+// TraceInfo describes the ETW trace captured around a call, to open in Windows
+// Performance Analyzer
+type TraceInfo struct {
+	// File is the .etl file: the run artifact once the run is stored, else its
+	// path in the temporary directory
+	File    string `json:"file"`
+	Session string `json:"session"`
+	// PID is the process the events were captured for (0 if the worker was not running)
+	PID       int      `json:"pid,omitempty"`
+	Providers []string `json:"providers"`
+	// Unfiltered are the providers that captured the events of every process,
+	// because Windows could not filter them by process
+	Unfiltered []string `json:"unfiltered,omitempty"`
+	EventsLost int      `json:"eventsLost,omitempty"`
+
+	// path of the .etl file until the run is stored
+	path string
+}
+
+// Sequence of the trace sessions started by this process, for unique session names
+var etwSessions atomic.Int64
+
+// etwTrace is an ETW session recording a call
+type etwTrace struct {
+	info    *TraceInfo
+	session *etwSession
+}
+
+// startTrace starts an ETW session capturing the network and loader events of
+// the process pid into a new .etl file in the temporary directory
+func startTrace(pid int) (*etwTrace, error) {
+	name := fmt.Sprintf("ContactCenterSimulator-%d-%d", os.Getpid(), etwSessions.Add(1))
+	path := filepath.Join(os.TempDir(), name+".etl")
+	session, unfiltered, err := startETWSession(name, path, pid, etwProviders)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	info := &TraceInfo{File: path, Session: name, PID: pid, Unfiltered: unfiltered, path: path}
+	for _, p := range etwProviders {
+		info.Providers = append(info.Providers, p.name)
+	}
+	return &etwTrace{info: info, session: session}, nil
+}
+
+// stop ends the session, flushing its events to the .etl file
+func (t *etwTrace) stop() (*TraceInfo, error) {
+	lost, err := t.session.stop()
+	if err != nil {
+		os.Remove(t.info.path)
+		return nil, err
+	}
+	t.info.EventsLost = lost
+	log.Printf("ETW trace of the call written to %s", t.info.path)
+	return t.info, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// etwSession is a running ETW trace session
+type etwSession struct{}
+
+// startETWSession is only available on Windows
+func startETWSession(name, path string, pid int, providers []etwProvider) (*etwSession, []string, error) {
+	return nil, nil, errors.New("ETW tracing needs Windows")
+}
+
+// stop does nothing: no session runs on this platform
+func (s *etwSession) stop() (int, error) {
+	return 0, nil
+}
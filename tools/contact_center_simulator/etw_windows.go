@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32           = syscall.NewLazyDLL("advapi32.dll")
+	procStartTraceW    = advapi32.NewProc("StartTraceW")
+	procControlTraceW  = advapi32.NewProc("ControlTraceW")
+	procEnableTraceEx2 = advapi32.NewProc("EnableTraceEx2")
+)
+
+// Constants of the ETW session API
+const (
+	// WNODE_FLAG_TRACED_GUID
+	wnodeFlagTracedGUID = 0x00020000
+	// EVENT_TRACE_FILE_MODE_SEQUENTIAL
+	eventTraceFileModeSequential = 0x1
+	// EVENT_TRACE_CONTROL_STOP
+	eventTraceControlStop = 1
+	// EVENT_CONTROL_CODE_ENABLE_PROVIDER
+	eventControlCodeEnableProvider = 1
+	// TRACE_LEVEL_VERBOSE
+	traceLevelVerbose = 5
+	// ENABLE_TRACE_PARAMETERS_VERSION_2
+	enableTraceParametersVersion2 = 2
+	// EVENT_FILTER_TYPE_PID
+	eventFilterTypePID = 0x80000004
+	// Buffer size of the session, in kilobytes
+	etwBufferSize     = 64
+	errorAccessDenied = 5
+)
+
+// wnodeHeader is WNODE_HEADER
+type wnodeHeader struct {
+	bufferSize        uint32
+	providerID        uint32
+	historicalContext uint64
+	timeStamp         int64
+	guid              syscall.GUID
+	clientContext     uint32
+	flags             uint32
+}
+
+// eventTraceProperties is EVENT_TRACE_PROPERTIES
+type eventTraceProperties struct {
+	wnode               wnodeHeader
+	bufferSize          uint32
+	minimumBuffers      uint32
+	maximumBuffers      uint32
+	maximumFileSize     uint32
+	logFileMode         uint32
+	flushTimer          uint32
+	enableFlags         uint32
+	ageLimit            int32
+	numberOfBuffers     uint32
+	freeBuffers         uint32
+	eventsLost          uint32
+	buffersWritten      uint32
+	logBuffersLost      uint32
+	realTimeBuffersLost uint32
+	loggerThreadID      syscall.Handle
+	logFileNameOffset   uint32
+	loggerNameOffset    uint32
+}
+
+// traceProperties is EVENT_TRACE_PROPERTIES followed by the session and file
+// names it points at
+type traceProperties struct {
+	eventTraceProperties
+	loggerName  [1024]uint16
+	logFileName [1024]uint16
+}
+
+// eventFilterDescriptor is EVENT_FILTER_DESCRIPTOR
+type eventFilterDescriptor struct {
+	ptr  uint64
+	size uint32
+	typ  uint32
+}
+
+// enableTraceParameters is ENABLE_TRACE_PARAMETERS
+type enableTraceParameters struct {
+	version          uint32
+	enableProperty   uint32
+	controlFlags     uint32
+	sourceID         syscall.GUID
+	enableFilterDesc *eventFilterDescriptor
+	filterDescCount  uint32
+}
+
+// etwSession is a running ETW trace session
+type etwSession struct {
+	handle uint64
+}
+
+// newTraceProperties returns the properties of a session writing to the file
+// path (empty to control a running session)
+func newTraceProperties(path string) (*traceProperties, error) {
+	p := &traceProperties{}
+	p.wnode.bufferSize = uint32(unsafe.Sizeof(*p))
+	p.wnode.flags = wnodeFlagTracedGUID
+	// Query performance counter timestamps
+	p.wnode.clientContext = 1
+	p.bufferSize = etwBufferSize
+	p.logFileMode = eventTraceFileModeSequential
+	p.loggerNameOffset = uint32(unsafe.Offsetof(p.loggerName))
+	p.logFileNameOffset = uint32(unsafe.Offsetof(p.logFileName))
+	if path != "" {
+		name, err := syscall.UTF16FromString(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) > len(p.logFileName) {
+			return nil, fmt.Errorf("trace file path too long: %s", path)
+		}
+		copy(p.logFileName[:], name)
+	}
+	return p, nil
+}
+
+// etwGUID parses the GUID of a provider
+func etwGUID(s string) (syscall.GUID, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return syscall.GUID{}, fmt.Errorf("invalid GUID %s", s)
+	}
+	g := syscall.GUID{
+		Data1: binary.BigEndian.Uint32(b[0:4]),
+		Data2: binary.BigEndian.Uint16(b[4:6]),
+		Data3: binary.BigEndian.Uint16(b[6:8]),
+	}
+	copy(g.Data4[:], b[8:])
+	return g, nil
+}
+
+// enableProvider enables a provider in the session, for the events of the
+// process pid only unless pid is 0
+func (s *etwSession) enableProvider(guid *syscall.GUID, keywords uint64, pid int) error {
+	params := enableTraceParameters{version: enableTraceParametersVersion2}
+	pids := []uint32{uint32(pid)}
+	filter := eventFilterDescriptor{ptr: uint64(uintptr(unsafe.Pointer(&pids[0]))), size: 4, typ: eventFilterTypePID}
+	if pid != 0 {
+		params.enableFilterDesc, params.filterDescCount = &filter, 1
+	}
+	ret, _, _ := procEnableTraceEx2.Call(uintptr(s.handle), uintptr(unsafe.Pointer(guid)), eventControlCodeEnableProvider,
+		traceLevelVerbose, uintptr(keywords), 0, 0, uintptr(unsafe.Pointer(&params)))
+	runtime.KeepAlive(pids)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+// startETWSession starts the session name writing the events of providers to
+// path, filtered to the process pid. A provider Windows cannot filter by process
+// captures every process; their names are returned.
+func startETWSession(name, path string, pid int, providers []etwProvider) (*etwSession, []string, error) {
+	if err := procStartTraceW.Find(); err != nil {
+		return nil, nil, err
+	}
+	props, err := newTraceProperties(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	sessionName, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &etwSession{}
+	ret, _, _ := procStartTraceW.Call(uintptr(unsafe.Pointer(&s.handle)), uintptr(unsafe.Pointer(sessionName)), uintptr(unsafe.Pointer(props)))
+	if ret == errorAccessDenied {
+		return nil, nil, fmt.Errorf("StartTrace failed: %v (ETW tracing needs administrator rights or membership of the Performance Log Users group)", syscall.Errno(ret))
+	}
+	if ret != 0 {
+		return nil, nil, fmt.Errorf("StartTrace failed: %v", syscall.Errno(ret))
+	}
+
+	var unfiltered []string
+	for _, p := range providers {
+		guid, err := etwGUID(p.guid)
+		if err != nil {
+			s.stop()
+			return nil, nil, err
+		}
+		err = s.enableProvider(&guid, p.keywords, pid)
+		if err != nil && pid != 0 {
+			// Older Windows versions and some kernel providers do not filter by process
+			if err = s.enableProvider(&guid, p.keywords, 0); err == nil {
+				unfiltered = append(unfiltered, p.name)
+			}
+		}
+		if err != nil {
+			s.stop()
+			return nil, nil, fmt.Errorf("failed to enable provider %s: %v", p.name, err)
+		}
+	}
+	return s, unfiltered, nil
+}
+
+// stop stops the session, which flushes its events to the file, and returns the
+// number of events it lost
+func (s *etwSession) stop() (int, error) {
+	props, err := newTraceProperties("")
+	if err != nil {
+		return 0, err
+	}
+	ret, _, _ := procControlTraceW.Call(uintptr(s.handle), 0, uintptr(unsafe.Pointer(props)), eventTraceControlStop)
+	if ret != 0 {
+		return 0, fmt.Errorf("ControlTrace failed to stop the session: %v", syscall.Errno(ret))
+	}
+	return int(props.eventsLost), nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// User recorded in the suite history for generated suites
+const genTestsUser = "(gen-tests)"
+
+// Default name of the generated suite
+const DefaultGeneratedSuite = "generated"
+
+// endpointCatalog returns the endpoints of the parameter dictionary
+func endpointCatalog() []string {
+	if def, ok := parameterDictionary["Endpoint"]; ok {
+		return def.Values
+	}
+	return nil
+}
+
+// endpointParameters returns the parameters an endpoint requires, as the test
+// server checks them, and those it can take besides, from the parameter dictionary.
+// Endpoints the test server does not know require the dictionary parameters that
+// list them.
+func endpointParameters(endpoint string) (required, optional []string) {
+	behavior, known := simulatedBehaviors[endpoint]
+	if known {
+		required = behavior.Require
+	}
+	for _, key := range dictionaryKeys() {
+		def := parameterDictionary[key]
+		if key == "Endpoint" || key == "CFResp" || !slices.Contains(def.Endpoints, endpoint) || slices.Contains(required, key) {
+			continue
+		}
+		if known {
+			optional = append(optional, key)
+		} else {
+			required = append(required, key)
+		}
+	}
+	return required, optional
+}
+
+// exampleValue returns a valid value of a parameter: its first example, value or "1"
+func exampleValue(key string) string {
+	if def, ok := parameterDictionary[key]; ok {
+		if len(def.Examples) > 0 && def.Examples[0] != "" {
+			return def.Examples[0]
+		}
+		if len(def.Values) > 0 && def.Values[0] != "" {
+			return def.Values[0]
+		}
+	}
+	return "1"
+}
+
+// valueOfLength repeats the example value of a parameter to the given length
+func valueOfLength(key string, length int) string {
+	example := exampleValue(key)
+	return strings.Repeat(example, length/len(example)+1)[:length]
+}
+
+// withValue returns parameters with the value of key replaced
+func withValue(parameters []Parameter, key, value string) []Parameter {
+	changed := slices.Clone(parameters)
+	for i := range changed {
+		if changed[i].Key == key {
+			changed[i].Value = value
+		}
+	}
+	return changed
+}
+
+// generateCases returns the starter cases of an endpoint: the happy path with an
+// example value for every parameter, each required parameter missing (expected
+// to fail), and each parameter at the longest value the DLL reads whole and at
+// the full width of the value field, which the DLL cuts by one character
+func generateCases(endpoint string) []TestCase {
+	required, optional := endpointParameters(endpoint)
+	happy := []Parameter{{Key: "Endpoint", Value: endpoint}, {Key: "CFResp", Value: "yes"}}
+	for _, key := range append(slices.Clone(required), optional...) {
+		happy = append(happy, Parameter{Key: key, Value: exampleValue(key)})
+	}
+
+	cases := []TestCase{{Name: endpoint + "-happy-path", Parameters: happy}}
+	for _, key := range required {
+		var parameters []Parameter
+		for _, p := range happy {
+			if p.Key != key {
+				parameters = append(parameters, p)
+			}
+		}
+		cases = append(cases, TestCase{Name: endpoint + "-missing-" + key, Parameters: parameters, ExpectError: true})
+	}
+	for _, p := range happy[2:] {
+		cases = append(cases,
+			TestCase{Name: fmt.Sprintf("%s-%s-length-%d", endpoint, p.Key, buffer.ValueSize-1), Parameters: withValue(happy, p.Key, valueOfLength(p.Key, buffer.ValueSize-1))},
+			TestCase{Name: fmt.Sprintf("%s-%s-length-%d", endpoint, p.Key, buffer.ValueSize), Parameters: withValue(happy, p.Key, valueOfLength(p.Key, buffer.ValueSize))})
+	}
+	return cases
+}
+
+// runGenTests implements the gen-tests subcommand: it writes a starter suite with
+// the generated cases of every endpoint of the catalog (or of -endpoints), so new
+// endpoints have baseline coverage at once. It returns 1 if the suite cannot be
+// written, and 2 for invalid options.
+//
+//	ContactCenterSimulator gen-tests -suite baseline -endpoints getInfo,saveCID
+func runGenTests(args []string) int {
+	fs := flag.NewFlagSet("gen-tests", flag.ContinueOnError)
+	fs.StringVar(&suitesDir, "suites", DefaultSuitesDir, "Directory of the test suites")
+	name := fs.String("suite", DefaultGeneratedSuite, "Name of the suite to write")
+	endpoints := fs.String("endpoints", "", "Comma-separated endpoints to generate cases for (default every endpoint of the catalog)")
+	dictionaryFile := fs.String("dictionary", "", "JSON file adding or replacing parameter dictionary definitions")
+	replace := fs.Bool("replace", false, "Replace the suite if it exists (recorded as a new version)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *dictionaryFile != "" {
+		if err := loadDictionary(*dictionaryFile); err != nil {
+			fmt.Fprintf(os.Stderr, "gen-tests: %v\n", err)
+			return 2
+		}
+	}
+	dir, err := suitePath(*name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gen-tests: %v\n", err)
+		return 2
+	}
+	if _, err := os.Stat(filepath.Join(dir, suiteFile)); err == nil {
+		if !*replace {
+			fmt.Fprintf(os.Stderr, "gen-tests: suite '%s' already exists (use -replace to overwrite it)\n", *name)
+			return 2
+		}
+		// Record edits made on disk first, so they are not attributed to gen-tests
+		if _, err := recordSuiteVersion(*name, fileEditUser); err != nil {
+			fmt.Fprintf(os.Stderr, "gen-tests: %v\n", err)
+			return 1
+		}
+	}
+
+	catalog := endpointCatalog()
+	selected := catalog
+	if *endpoints != "" {
+		selected = strings.Split(*endpoints, ",")
+		for i, endpoint := range selected {
+			selected[i] = strings.TrimSpace(endpoint)
+			if !slices.Contains(catalog, selected[i]) {
+				fmt.Fprintf(os.Stderr, "gen-tests: endpoint '%s' is not in the catalog (%s)\n", selected[i], strings.Join(catalog, ", "))
+				return 2
+			}
+		}
+	}
+
+	suite := Suite{Name: *name, Description: "Starter cases generated from the endpoint catalog: happy path, missing parameters and boundary lengths"}
+	for _, endpoint := range selected {
+		suite.Cases = append(suite.Cases, generateCases(endpoint)...)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "gen-tests: %v\n", err)
+		return 1
+	}
+	if err := writeJSONFile(filepath.Join(dir, suiteFile), suite); err != nil {
+		fmt.Fprintf(os.Stderr, "gen-tests: failed to write suite '%s': %v\n", *name, err)
+		return 1
+	}
+	version, err := recordSuiteVersion(*name, genTestsUser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gen-tests: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote suite '%s' version %d: %d cases for %d endpoints\n", *name, version, len(suite.Cases), len(selected))
+	return 0
+}
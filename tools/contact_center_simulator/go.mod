@@ -1,3 +1,10 @@
 module contact-center-simulator
 
 go 1.24.3
+
+require (
+	golang.org/x/text v0.23.0
+	github.com/cristiangirlea/OScapeDLCapture/tools/shared v0.0.0
+)
+
+replace github.com/cristiangirlea/OScapeDLCapture/tools/shared => ../shared
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Default interval of heartbeat calls
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// Heartbeat events kept in a soak report
+const maxHeartbeatEvents = 100
+
+// Outcomes of a heartbeat that did not succeed
+const (
+	// The DLL returned an error, or the call failed
+	heartbeatFailed = "failed"
+	// The DLL answered, but later than the heartbeat timeout
+	heartbeatLate = "late"
+	// The heartbeat was not sent because the previous one had not returned yet
+	heartbeatSkipped = "skipped"
+)
+
+// HeartbeatStats counts the heartbeats of a soak test or of one of its intervals.
+// Missed counts the heartbeats that did not answer in time: late and skipped ones.
+type HeartbeatStats struct {
+	Sent      int          `json:"sent"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Late      int          `json:"late"`
+	Skipped   int          `json:"skipped"`
+	Missed    int          `json:"missed"`
+	LatencyMs LatencyStats `json:"latency_ms"`
+}
+
+// HeartbeatEvent is a heartbeat that failed or was missed
+type HeartbeatEvent struct {
+	Time      time.Time `json:"time"`
+	Outcome   string    `json:"outcome"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+	Code      int       `json:"code,omitempty"`
+}
+
+// HeartbeatReport is the heartbeat part of a soak report
+type HeartbeatReport struct {
+	Parameters []Parameter `json:"parameters"`
+	Interval   string      `json:"interval"`
+	Timeout    string      `json:"timeout"`
+	HeartbeatStats
+	// LongestOutage is the longest time between two successful heartbeats
+	LongestOutage string `json:"longest_outage"`
+	// Events are the first heartbeats that failed or were missed
+	Events []HeartbeatEvent `json:"events,omitempty"`
+}
+
+// heartbeatFlags are the heartbeat options of the soak subcommand
+type heartbeatFlags struct {
+	spec     *string
+	interval *time.Duration
+	timeout  *time.Duration
+}
+
+// addHeartbeatFlags adds the heartbeat options to fs
+func addHeartbeatFlags(fs *flag.FlagSet) *heartbeatFlags {
+	return &heartbeatFlags{
+		spec:     fs.String("heartbeat", "", "Parameters of a lightweight call made in the background every -heartbeat-interval, as health checks are, e.g. Endpoint=ping,ID=0 (Key=Value pairs separated by commas)"),
+		interval: fs.Duration("heartbeat-interval", DefaultHeartbeatInterval, "Interval between heartbeat calls"),
+		timeout:  fs.Duration("heartbeat-timeout", 0, "Latency above which a heartbeat counts as missed (default the heartbeat interval)"),
+	}
+}
+
+// heartbeat makes the heartbeat calls of a soak test on a fixed interval, with
+// the same profile as the test's calls
+type heartbeat struct {
+	call       *benchCall
+	parameters []Parameter
+	interval   time.Duration
+	timeout    time.Duration
+
+	mu          sync.Mutex
+	inFlight    bool
+	current     HeartbeatStats
+	latencies   []float64
+	total       HeartbeatStats
+	all         []float64
+	events      []HeartbeatEvent
+	lastSuccess time.Time
+	outage      time.Duration
+}
+
+// heartbeat checks the heartbeat options and prepares the heartbeat call, nil
+// without -heartbeat
+func (f *heartbeatFlags) heartbeat(profile string) (*heartbeat, error) {
+	if *f.spec == "" {
+		return nil, nil
+	}
+	parameters, err := parseCallParameters(*f.spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -heartbeat: %v", err)
+	}
+	if *f.interval <= 0 || *f.timeout < 0 {
+		return nil, fmt.Errorf("-heartbeat-interval must be positive and -heartbeat-timeout at least 0")
+	}
+	call, _, err := newBenchCall(TestCase{Name: "heartbeat", Profile: profile, Parameters: parameters})
+	if err != nil {
+		return nil, fmt.Errorf("heartbeat: %v", err)
+	}
+	timeout := *f.timeout
+	if timeout == 0 {
+		timeout = *f.interval
+	}
+	return &heartbeat{call: call, parameters: parameters, interval: *f.interval, timeout: timeout}, nil
+}
+
+// run sends a heartbeat every interval until ctx is done, then waits for the
+// last one to return
+func (h *heartbeat) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	h.mu.Lock()
+	h.lastSuccess = time.Now()
+	h.mu.Unlock()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			if h.inFlight {
+				h.record(HeartbeatEvent{Time: now, Outcome: heartbeatSkipped})
+				h.mu.Unlock()
+				continue
+			}
+			h.inFlight = true
+			h.mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				latency, ret := h.call.invoke()
+				h.mu.Lock()
+				defer h.mu.Unlock()
+				h.inFlight = false
+				h.current.Sent++
+				h.latencies = append(h.latencies, latency)
+				event := HeartbeatEvent{Time: now, LatencyMs: latency, Code: ret}
+				switch {
+				case ret != 0:
+					event.Outcome = heartbeatFailed
+				case time.Duration(latency*float64(time.Millisecond)) > h.timeout:
+					event.Outcome = heartbeatLate
+				default:
+					h.current.Succeeded++
+					h.outage = max(h.outage, now.Sub(h.lastSuccess))
+					h.lastSuccess = now
+					return
+				}
+				h.record(event)
+			}()
+		}
+	}
+}
+
+// record counts a heartbeat that failed or was missed, with h.mu held
+func (h *heartbeat) record(event HeartbeatEvent) {
+	switch event.Outcome {
+	case heartbeatFailed:
+		h.current.Failed++
+	case heartbeatLate:
+		h.current.Late++
+		h.current.Missed++
+	case heartbeatSkipped:
+		h.current.Skipped++
+		h.current.Missed++
+	}
+	if len(h.events) < maxHeartbeatEvents {
+		h.events = append(h.events, event)
+	}
+	log.Printf("Heartbeat %s at %s (latency %.3f ms, code %d)", event.Outcome, event.Time.Format(time.TimeOnly), event.LatencyMs, event.Code)
+}
+
+// rotate closes the counts of the current interval and returns them
+func (h *heartbeat) rotate() *HeartbeatStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := h.current
+	stats.LatencyMs = latencyStats(h.latencies)
+	h.total.Sent += stats.Sent
+	h.total.Succeeded += stats.Succeeded
+	h.total.Failed += stats.Failed
+	h.total.Late += stats.Late
+	h.total.Skipped += stats.Skipped
+	h.total.Missed += stats.Missed
+	h.all = append(h.all, h.latencies...)
+	h.current, h.latencies = HeartbeatStats{}, nil
+	return &stats
+}
+
+// report returns the heartbeat part of the final report, after the last rotate
+func (h *heartbeat) report(finished time.Time) *HeartbeatReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := &HeartbeatReport{
+		Parameters:     h.parameters,
+		Interval:       h.interval.String(),
+		Timeout:        h.timeout.String(),
+		HeartbeatStats: h.total,
+		LongestOutage:  max(h.outage, finished.Sub(h.lastSuccess)).Round(time.Millisecond).String(),
+		Events:         h.events,
+	}
+	report.LatencyMs = latencyStats(h.all)
+	return report
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BackendRequest is a request the embedded mock backend received from the DLL
+type BackendRequest struct {
+	Time       time.Time         `json:"time"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Endpoint   string            `json:"endpoint"`
+	Parameters map[string]string `json:"parameters"`
+	StatusCode int               `json:"status_code"`
+
+	seq int64
+}
+
+// mockBackend answers the DLL like the go-server test server, with the endpoint
+// responses of simulation mode, and records every request
+type mockBackend struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	seq      int64
+	requests []BackendRequest
+}
+
+// startMockBackend starts the mock backend on a random local port
+func startMockBackend() (*mockBackend, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the mock backend: %v", err)
+	}
+	b := &mockBackend{listener: listener}
+	go http.Serve(listener, b)
+	return b, nil
+}
+
+// formValue returns a parameter of the request, matching its key case-insensitively
+// as the go-server does
+func formValue(params map[string]string, key string) string {
+	for k, v := range params {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (b *mockBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	params := make(map[string]string, len(r.Form))
+	for key, values := range r.Form {
+		params[key] = strings.Join(values, ", ")
+	}
+	endpoint := formValue(params, "endpoint")
+	request := BackendRequest{Time: time.Now(), Method: r.Method, Path: r.URL.Path, Endpoint: endpoint, Parameters: params}
+
+	status, body := http.StatusOK, ""
+	behavior, ok := simulatedBehaviors[endpoint]
+	switch {
+	case endpoint == "":
+		status, body = http.StatusBadRequest, "Error: Missing 'endpoint' parameter"
+	case !ok:
+		status, body = http.StatusNotFound, fmt.Sprintf("Error: Unknown endpoint '%s'", endpoint)
+	default:
+		var missing []string
+		for _, key := range behavior.Require {
+			if formValue(params, key) == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			status, body = http.StatusBadRequest, "Error: Missing required parameters: "+strings.Join(missing, ", ")
+		} else {
+			body = placeholder.ReplaceAllStringFunc(behavior.Output["CFResp"], func(m string) string {
+				return formValue(params, m[1:len(m)-1])
+			})
+		}
+	}
+
+	request.StatusCode = status
+	if r.Header.Get(probeHeader) == "" {
+		b.record(request)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
+
+// record keeps a request
+func (b *mockBackend) record(request BackendRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	request.seq = b.seq
+	b.requests = append(b.requests, request)
+}
+
+// position returns the sequence number of the last recorded request
+func (b *mockBackend) position() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq
+}
+
+// since returns the requests recorded after position
+func (b *mockBackend) since(position int64) []BackendRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var requests []BackendRequest
+	for _, request := range b.requests {
+		if request.seq > position {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// BackendExpectation describes requests a test case expects the DLL to send, such
+// as exactly one GET with endpoint getInfo and ID 12345:
+//
+//	{"method": "GET", "endpoint": "getInfo", "parameters": {"ID": "12345"}, "count": 1}
+//
+// Method, endpoint and parameter names match case-insensitively, parameter values
+// exactly. Parameters not listed may have any value.
+type BackendExpectation struct {
+	Method     string            `json:"method,omitempty"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Count is the exact number of matching requests (at least one if not set)
+	Count *int `json:"count,omitempty"`
+}
+
+// matches reports whether a request matches the expectation
+func (e BackendExpectation) matches(request BackendRequest) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, request.Method) {
+		return false
+	}
+	if e.Endpoint != "" && !strings.EqualFold(e.Endpoint, request.Endpoint) {
+		return false
+	}
+	for key, value := range e.Parameters {
+		if !hasParameter(request.Parameters, key) || formValue(request.Parameters, key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// hasParameter reports whether a request has a parameter, matching its key
+// case-insensitively
+func hasParameter(params map[string]string, key string) bool {
+	for k := range params {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the expectation, such as "exactly 1 GET with endpoint=getInfo ID=12345"
+func (e BackendExpectation) String() string {
+	var b strings.Builder
+	if e.Count != nil {
+		fmt.Fprintf(&b, "exactly %d", *e.Count)
+	} else {
+		b.WriteString("at least 1")
+	}
+	method := e.Method
+	if method == "" {
+		method = "request"
+	}
+	b.WriteString(" " + strings.ToUpper(method))
+	var conditions []string
+	if e.Endpoint != "" {
+		conditions = append(conditions, "endpoint="+e.Endpoint)
+	}
+	keys := make([]string, 0, len(e.Parameters))
+	for key := range e.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, key+"="+e.Parameters[key])
+	}
+	if len(conditions) > 0 {
+		b.WriteString(" with " + strings.Join(conditions, " "))
+	}
+	return b.String()
+}
+
+// closestRequest returns the request that differs least from the expectation,
+// with the parameters it is missing or has a different value for
+func closestRequest(e BackendExpectation, requests []BackendRequest) (*BackendRequest, []string) {
+	var best *BackendRequest
+	var bestDiffs []string
+	for i, request := range requests {
+		if e.Method != "" && !strings.EqualFold(e.Method, request.Method) {
+			continue
+		}
+		if e.Endpoint != "" && !strings.EqualFold(e.Endpoint, request.Endpoint) {
+			continue
+		}
+		var diffs []string
+		for key, value := range e.Parameters {
+			switch {
+			case !hasParameter(request.Parameters, key):
+				diffs = append(diffs, key+" missing")
+			case formValue(request.Parameters, key) != value:
+				diffs = append(diffs, fmt.Sprintf("%s=%q", key, formValue(request.Parameters, key)))
+			}
+		}
+		if best == nil || len(diffs) < len(bestDiffs) {
+			best, bestDiffs = &requests[i], diffs
+		}
+	}
+	sort.Strings(bestDiffs)
+	return best, bestDiffs
+}
+
+// checkBackendExpectations returns a failure for each expectation the requests do
+// not meet
+func checkBackendExpectations(expectations []BackendExpectation, requests []BackendRequest) []string {
+	var failures []string
+	for _, e := range expectations {
+		matched := 0
+		for _, request := range requests {
+			if e.matches(request) {
+				matched++
+			}
+		}
+		if (e.Count == nil && matched > 0) || (e.Count != nil && matched == *e.Count) {
+			continue
+		}
+		failure := fmt.Sprintf("expected %s, the backend received %d", e, matched)
+		if matched == 0 {
+			if closest, diffs := closestRequest(e, requests); closest != nil && len(diffs) > 0 {
+				failure += fmt.Sprintf(" (closest: %s with %s)", closest.Method, strings.Join(diffs, ", "))
+			}
+		}
+		failures = append(failures, failure)
+	}
+	return failures
+}
+
+// HermeticCase is the outcome of one test case of a hermetic run
+type HermeticCase struct {
+	Name       string           `json:"name"`
+	Profile    string           `json:"profile"`
+	Endpoint   string           `json:"endpoint"`
+	Passed     bool             `json:"passed"`
+	ReturnCode int              `json:"return_code"`
+	Response   string           `json:"response,omitempty"`
+	Failures   []string         `json:"failures,omitempty"`
+	Requests   []BackendRequest `json:"backend_requests"`
+}
+
+// HermeticReport is the report of a hermetic run
+type HermeticReport struct {
+	Suite    string         `json:"suite"`
+	Version  int            `json:"version"`
+	Backend  string         `json:"backend"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Passed   int            `json:"passed"`
+	Failed   int            `json:"failed"`
+	Cases    []HermeticCase `json:"cases"`
+}
+
+// checkHermeticCase fails a case whose DLL call failed, or whose requests do not
+// meet its backend expectations. A case without expectations must reach the
+// backend.
+func checkHermeticCase(result TestResult, testCase TestCase, requests []BackendRequest) []string {
+	var failures []string
+	if !result.Success {
+		failures = append(failures, fmt.Sprintf("DLL call failed (return code %d): %s", result.ReturnCode, firstLine(result.ErrorDetails)))
+	}
+	if len(testCase.Backend) == 0 && len(requests) == 0 {
+		failures = append(failures, "the backend received no request")
+	}
+	return append(failures, checkBackendExpectations(testCase.Backend, requests)...)
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// writeHermeticReport writes the outcome of each case and the totals
+func writeHermeticReport(w io.Writer, report HermeticReport) {
+	fmt.Fprintf(w, "Suite %s version %d against the mock backend on %s\n\n", report.Suite, report.Version, report.Backend)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tENDPOINT\tRETURN CODE\tBACKEND REQUESTS\tSTATUS")
+	for _, c := range report.Cases {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", c.Name, c.Endpoint, c.ReturnCode, len(c.Requests), status)
+	}
+	tw.Flush()
+	for _, c := range report.Cases {
+		for _, failure := range c.Failures {
+			fmt.Fprintf(w, "\n%s: %s", c.Name, failure)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed\n", report.Passed, report.Failed)
+}
+
+// runHermetic implements the hermetic subcommand, a self-contained end-to-end run
+// of a suite: it starts the mock backend on a random port, points the base_url of
+// each DLL's config.ini at it (restoring the files afterwards), runs the suite and
+// checks both the DLL results and the requests the backend received. It returns 1
+// if any case failed:
+//
+//	ContactCenterSimulator hermetic -suite smoke -dll dist/runtime/CustomDLL.dll
+func runHermetic(args []string) int {
+	fs := flag.NewFlagSet("hermetic", flag.ContinueOnError)
+	dll := fs.String("dll", DefaultDllPath, "Path to the DLL")
+	profilesFile := fs.String("profiles", "", "JSON file defining DLL profiles")
+	fs.StringVar(&suitesDir, "suites", DefaultSuitesDir, "Directory of the test suites")
+	name := fs.String("suite", "", "Suite to run")
+	version := fs.Int("version", 0, "Suite version to run (default the current one)")
+	fs.BoolVar(&isolate, "isolate", false, "Call the DLLs in worker processes")
+	reportFile := fs.String("report", "", "JSON file to write the report to")
+	fs.StringVar(&defaultLanguage, "lang", DefaultLanguage, "Language of error explanations (en, ro)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "hermetic: -suite is required")
+		return 2
+	}
+	if err := checkLanguage(defaultLanguage); err != nil {
+		fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+		return 2
+	}
+
+	// Progress goes to standard error, the report to standard output
+	log.SetOutput(os.Stderr)
+	current, err := recordSuiteVersion(*name, fileEditUser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+		return 2
+	}
+	if *version == 0 {
+		*version = current
+	}
+	suite, err := loadSuiteVersion(*name, *version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+		return 2
+	}
+	dllPath = resolveDllPath(*dll)
+	if err := loadProfiles(*profilesFile, dllPath); err != nil {
+		fmt.Fprintf(os.Stderr, "hermetic: failed to load profiles: %v\n", err)
+		return 1
+	}
+
+	backend, err := startMockBackend()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+		return 1
+	}
+	defer backend.listener.Close()
+
+	// Point the DLL of every profile the suite uses at the backend
+	configs := make(map[string]bool)
+	defer func() {
+		unloadDLLs()
+		for path := range configs {
+			if err := restoreConfig(path); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}()
+	for _, testCase := range suite.Cases {
+		profile, err := profileFor(testCase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hermetic: case '%s': %v\n", testCase.Name, err)
+			return 2
+		}
+		if profile.Fake != "" || !isRuntimeDLL(profile.DLL) {
+			fmt.Fprintf(os.Stderr, "hermetic: profile '%s' does not call a runtime DLL reading config.ini\n", profile.name)
+			return 2
+		}
+		configPath := filepath.Join(filepath.Dir(profile.DLL), "config.ini")
+		if configs[configPath] {
+			continue
+		}
+		original, upstream, err := readDLLConfig(configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+			return 1
+		}
+		redirected, err := redirectConfig(configPath, original, upstream, backend.listener.Addr().String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hermetic: %v\n", err)
+			return 1
+		}
+		configs[configPath] = true
+		log.Printf("Pointed %s at the mock backend (%s)", configPath, redirected)
+	}
+
+	// Stop between cases when interrupted, so the config files are restored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report := HermeticReport{Suite: suite.Name, Version: *version, Backend: backend.listener.Addr().String(), Started: time.Now()}
+	for _, testCase := range suite.Cases {
+		if ctx.Err() != nil {
+			log.Printf("Interrupted")
+			break
+		}
+		profile, _ := profileFor(testCase)
+		position := backend.position()
+		result := runTestCase(profile, testCase, defaultLanguage)
+		requests := backend.since(position)
+
+		c := HermeticCase{
+			Name:       testCase.Name,
+			Profile:    profile.name,
+			Endpoint:   endpointOf(testCase),
+			ReturnCode: result.ReturnCode,
+			Response:   result.Response,
+			Failures:   checkHermeticCase(result, testCase, requests),
+			Requests:   requests,
+		}
+		c.Passed = len(c.Failures) == 0
+		if c.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	report.Finished = time.Now()
+
+	writeHermeticReport(os.Stdout, report)
+	if *reportFile != "" {
+		if err := writeJSONFile(*reportFile, report); err != nil {
+			fmt.Fprintf(os.Stderr, "hermetic: failed to write the report: %v\n", err)
+			return 1
+		}
+	}
+	if report.Failed > 0 || ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Default time a hook command may take before it is killed
+const DefaultHookTimeout = time.Minute
+
+// Names of the hooks, also their keys in hook files and suite.json
+const (
+	hookPreSuite  = "pre_suite"
+	hookPostSuite = "post_suite"
+	hookPreCall   = "pre_call"
+	hookPostCall  = "post_call"
+)
+
+// Hooks are shell commands run before and after each DLL call and each suite run,
+// to prepare the environment of a test (reset a backend database, rotate a log)
+// or collect data around it (a performance counter snapshot). They come from the
+// -hooks file. The hooks of a suite's suite.json hold names of the commands of
+// the -hooks file instead, since suites can be uploaded over HTTP.
+type Hooks struct {
+	PreSuite  string `json:"pre_suite,omitempty"`
+	PostSuite string `json:"post_suite,omitempty"`
+	PreCall   string `json:"pre_call,omitempty"`
+	PostCall  string `json:"post_call,omitempty"`
+}
+
+// command returns the command of a hook, empty if it is not set
+func (h *Hooks) command(hook string) string {
+	if h == nil {
+		return ""
+	}
+	switch hook {
+	case hookPreSuite:
+		return h.PreSuite
+	case hookPostSuite:
+		return h.PostSuite
+	case hookPreCall:
+		return h.PreCall
+	case hookPostCall:
+		return h.PostCall
+	}
+	return ""
+}
+
+// HookResult is a hook command that ran, in the result of a test. Its output is
+// stored as a run artifact.
+type HookResult struct {
+	Hook       string  `json:"hook"`
+	Command    string  `json:"command"`
+	ExitCode   int     `json:"exitCode"`
+	DurationMs float64 `json:"durationMs"`
+	// Error is set when the command could not run, timed out or exited with
+	// another code than 0
+	Error string `json:"error,omitempty"`
+	// Artifact is the run artifact holding the output of the command
+	Artifact string `json:"artifact,omitempty"`
+
+	output []byte
+}
+
+// Hooks of every call and suite run, from -hooks, the commands suites may name
+// as their hooks, and how long each command may take
+var (
+	hooks        Hooks
+	hookCommands map[string]string
+	hookTimeout  = DefaultHookTimeout
+)
+
+// loadHooks reads the hooks and the named commands of a JSON file of the form
+//
+//	{"pre_suite": "psql -f reset.sql", "commands": {"reset-db": "psql -f reset.sql"}}
+func loadHooks(path string) error {
+	var file struct {
+		Hooks
+		Commands map[string]string `json:"commands,omitempty"`
+	}
+	if err := readJSONFile(path, &file); err != nil {
+		return fmt.Errorf("failed to read hooks file %s: %v", path, err)
+	}
+	hooks, hookCommands = file.Hooks, file.Commands
+	return nil
+}
+
+// checkSuiteHooks checks that the hooks of a suite name commands of the -hooks
+// file, so a suite cannot bring commands of its own
+func checkSuiteHooks(h *Hooks) error {
+	for _, hook := range []string{hookPreSuite, hookPostSuite, hookPreCall, hookPostCall} {
+		if name := h.command(hook); name != "" {
+			if _, ok := hookCommands[name]; !ok {
+				return fmt.Errorf("%s hook '%s' of the suite is not a command of the -hooks file", hook, name)
+			}
+		}
+	}
+	return nil
+}
+
+// shellCommand prepares a command line to run through the system shell (cmd on
+// Windows, sh elsewhere) with the environment of the simulator plus env
+func shellCommand(ctx context.Context, command string, env map[string]string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	// Do not wait for children of a killed shell that keep its output open
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// runHook runs the command of a hook through the system shell in dir
+func runHook(hook, command, dir string, env map[string]string) HookResult {
+	result := HookResult{Hook: hook, Command: command}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command, env)
+	cmd.Dir = dir
+	var output outputBuffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+
+	start := time.Now()
+	err := cmd.Run()
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	result.output = []byte(output.String())
+	result.ExitCode = cmd.ProcessState.ExitCode()
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		result.Error = fmt.Sprintf("timed out after %s", hookTimeout)
+	case errors.As(err, &exitErr):
+		result.Error = fmt.Sprintf("exited with code %d", result.ExitCode)
+	case err != nil:
+		result.Error = err.Error()
+	}
+	if result.Error != "" {
+		log.Printf("Hook %s failed: %s: %s", hook, command, result.Error)
+	} else {
+		log.Printf("Hook %s: %s (%.1f ms)", hook, command, result.DurationMs)
+	}
+	return result
+}
+
+// runHooks runs a hook of -hooks, then the command of the -hooks file the same
+// hook of the suite names, stopping at the first command that fails. Suite hooks
+// get the suite's directory in CCS_SUITE_DIR.
+func runHooks(hook string, suite *Suite, env map[string]string) ([]HookResult, error) {
+	env["CCS_HOOK"] = hook
+	var ran []HookResult
+	if command := hooks.command(hook); command != "" {
+		ran = append(ran, runHook(hook, command, "", env))
+	}
+	if name := suite.hooks().command(hook); name != "" && (len(ran) == 0 || ran[0].Error == "") {
+		if command, ok := hookCommands[name]; ok {
+			dir, _ := suitePath(suite.Name)
+			env["CCS_SUITE_DIR"] = dir
+			ran = append(ran, runHook(hook, command, "", env))
+		} else {
+			ran = append(ran, HookResult{Hook: hook, Command: name, ExitCode: -1,
+				Error: "is not a command of the -hooks file"})
+		}
+	}
+	for _, h := range ran {
+		if h.Error != "" {
+			return ran, fmt.Errorf("%s hook '%s' %s", hook, h.Command, h.Error)
+		}
+	}
+	return ran, nil
+}
+
+// hooks returns the hooks of a suite, nil for calls outside a suite
+func (s *Suite) hooks() *Hooks {
+	if s == nil {
+		return nil
+	}
+	return s.Hooks
+}
+
+// callEnv is the environment of the call hooks of a test case
+func callEnv(testCase TestCase, profile *DLLProfile, suite *Suite, version int) map[string]string {
+	env := map[string]string{
+		"CCS_CASE":     testCase.Name,
+		"CCS_PROFILE":  profile.name,
+		"CCS_DLL":      profile.DLL,
+		"CCS_ENDPOINT": endpointOf(testCase),
+	}
+	if suite != nil {
+		env["CCS_SUITE"] = suite.Name
+		env["CCS_SUITE_VERSION"] = strconv.Itoa(version)
+	}
+	return env
+}
+
+// callWithHooks runs a test case between its pre_call and post_call hooks and
+// stores the run with the output of the hooks, and of earlier hooks such as the
+// suite's pre_suite hooks. A failing pre_call hook fails the test without calling
+// the DLL, as the environment of the test is not what it expects; a failing
+// post_call hook adds a warning.
+func callWithHooks(profile *DLLProfile, testCase TestCase, lang string, suite *Suite, version int, earlier []HookResult) TestResult {
+	env := callEnv(testCase, profile, suite, version)
+	ran, err := runHooks(hookPreCall, suite, env)
+	ran = append(append([]HookResult(nil), earlier...), ran...)
+
+	var result TestResult
+	if err != nil {
+		result = TestResult{
+			Name:         testCase.Name,
+			Profile:      profile.name,
+			Protocol:     profile.Protocol,
+			ReturnCode:   -1,
+			ErrorDetails: fmt.Sprintf("The DLL was not called: the %v", err),
+		}
+	} else {
+		result = runTestCase(profile, testCase, lang)
+		if suite != nil {
+			checkSnapshot(suite, testCase, &result, lang)
+		}
+		env["CCS_SUCCESS"] = strconv.FormatBool(result.Success)
+		env["CCS_RETURN_CODE"] = strconv.Itoa(result.ReturnCode)
+		env["CCS_DURATION_MS"] = strconv.FormatFloat(result.DurationMs, 'f', 1, 64)
+		post, err := runHooks(hookPostCall, suite, env)
+		ran = append(ran, post...)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("The %v", err))
+		}
+	}
+	if suite != nil {
+		result.Suite, result.SuiteVersion = suite.Name, version
+	}
+	result.Hooks = ran
+	recordRun(testCase, profile, &result)
+	return result
+}
+
+// hookArtifacts names the run artifacts of the output of hooks: hook-<name>.log,
+// numbered when a hook ran twice (from -hooks and from the suite)
+func hookArtifacts(ran []HookResult) {
+	seen := make(map[string]int)
+	for i := range ran {
+		seen[ran[i].Hook]++
+		name := "hook-" + ran[i].Hook
+		if n := seen[ran[i].Hook]; n > 1 {
+			name += "-" + strconv.Itoa(n)
+		}
+		ran[i].Artifact = name + ".log"
+	}
+}
+
+// attachHooks stores the output of hooks that ran after a run was stored, such as
+// the post_suite hooks of the last case of a suite, with the run
+func attachHooks(id string, ran []HookResult) {
+	if runs == nil || id == "" {
+		return
+	}
+	hookArtifacts(ran)
+	for _, h := range ran {
+		if err := runs.addArtifact(id, h.Artifact, h.output); err != nil {
+			log.Printf("Failed to store the output of hook %s: %v", h.Hook, err)
+		}
+	}
+}
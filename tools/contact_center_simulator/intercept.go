@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default base_url of the DLL, used when config.ini has none
+const defaultBaseURL = "https://localhost/api/index.php"
+
+// Suffix of the copy of config.ini kept while base_url points at the proxy
+const configBackupSuffix = ".simulator-backup"
+
+// Exchanges kept per proxy, and the largest body recorded
+const (
+	maxExchanges    = 1000
+	maxExchangeBody = 64 << 10
+)
+
+// Exchange is an HTTP request the DLL sent to the backend and the response it got,
+// as recorded by the intercepting proxy
+type Exchange struct {
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"requestHeaders"`
+	RequestBody     string      `json:"requestBody,omitempty"`
+	StatusCode      int         `json:"statusCode,omitempty"`
+	ResponseHeaders http.Header `json:"responseHeaders,omitempty"`
+	ResponseBody    string      `json:"responseBody,omitempty"`
+	DurationMs      float64     `json:"durationMs"`
+	// Error is set when the backend could not be reached
+	Error string `json:"error,omitempty"`
+
+	seq int64
+}
+
+// interceptor is an HTTP proxy the DLL is pointed at by rewriting the base_url of
+// its config.ini. It forwards every request to the original base_url and records
+// the exchange.
+type interceptor struct {
+	configPath string
+	upstream   *url.URL
+	listener   net.Listener
+	client     *http.Client
+
+	mu        sync.Mutex
+	seq       int64
+	exchanges []Exchange
+}
+
+// Intercepting proxies by config.ini path
+var (
+	intercept    bool
+	interceptors = make(map[string]*interceptor)
+)
+
+// iniValue returns a value of an INI file, and whether it is set
+func iniValue(data []byte, section, key string) (string, bool) {
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && strings.EqualFold(current, section) && strings.EqualFold(strings.TrimSpace(k), key) {
+			return strings.TrimSpace(v), true
+		}
+	}
+	return "", false
+}
+
+// setINIValue sets a value of an INI file, keeping the rest of the file as it is
+func setINIValue(data []byte, section, key, value string) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	current, sectionEnd := "", -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if strings.EqualFold(current, section) {
+				sectionEnd = i + 1
+			}
+			continue
+		}
+		if !strings.EqualFold(current, section) {
+			continue
+		}
+		if k, _, ok := strings.Cut(trimmed, "="); ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			lines[i] = key + "=" + value
+			return []byte(strings.Join(lines, "\n"))
+		}
+		if trimmed != "" {
+			sectionEnd = i + 1
+		}
+	}
+
+	setting := key + "=" + value
+	if sectionEnd < 0 {
+		return []byte(strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n[" + section + "]\n" + setting + "\n")
+	}
+	lines = append(lines[:sectionEnd], append([]string{setting}, lines[sectionEnd:]...)...)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// restoreConfig puts back a config.ini left rewritten by a simulator that did not
+// stop cleanly. An empty backup means there was no config.ini.
+func restoreConfig(configPath string) error {
+	backup, err := os.ReadFile(configPath + configBackupSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(backup) == 0 {
+		err = os.Remove(configPath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = os.WriteFile(configPath, backup, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %v", configPath, err)
+	}
+	return os.Remove(configPath + configBackupSuffix)
+}
+
+// readDLLConfig reads a config.ini, first restoring it if a simulator that did not
+// stop cleanly left it rewritten, and returns it with its base URL
+func readDLLConfig(configPath string) ([]byte, *url.URL, error) {
+	if err := restoreConfig(configPath); err != nil {
+		return nil, nil, err
+	}
+	original, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+	baseURL, ok := iniValue(original, "api", "base_url")
+	if !ok || baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	upstream, err := url.Parse(baseURL)
+	if err != nil || upstream.Host == "" {
+		return nil, nil, fmt.Errorf("cannot redirect base_url '%s' of %s", baseURL, configPath)
+	}
+	return original, upstream, nil
+}
+
+// redirectConfig points the base_url of a config.ini at a local HTTP server,
+// keeping its path, and keeps the original file as a backup for restoreConfig.
+// It returns the new base URL.
+func redirectConfig(configPath string, original []byte, upstream *url.URL, addr string) (string, error) {
+	if err := os.WriteFile(configPath+configBackupSuffix, original, 0644); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", configPath, err)
+	}
+	redirected := *upstream
+	redirected.Scheme, redirected.Host = "http", addr
+	if err := os.WriteFile(configPath, setINIValue(original, "api", "base_url", redirected.String()), 0644); err != nil {
+		restoreConfig(configPath)
+		return "", fmt.Errorf("failed to rewrite %s: %v", configPath, err)
+	}
+	return redirected.String(), nil
+}
+
+// startInterceptor starts the proxy for the config.ini of the DLL at dllPath, or
+// returns the running one, and points base_url at it
+func startInterceptor(dllPath string) (*interceptor, error) {
+	configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
+	if p, ok := interceptors[configPath]; ok {
+		return p, nil
+	}
+	original, upstream, err := readDLLConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reach the backend as the DLL would
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+	if verify, ok := iniValue(original, "api", "verify_ssl"); ok && verify == "0" {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if certFile, ok := iniValue(original, "api", "ssl_cert_file"); ok && certFile != "" {
+		pem, err := os.ReadFile(certFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssl_cert_file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the intercepting proxy: %v", err)
+	}
+	p := &interceptor{
+		configPath: configPath,
+		upstream:   upstream,
+		listener:   listener,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+			// The DLL sees redirects, as it would from the backend
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+	go http.Serve(listener, p)
+
+	// Keep the original config.ini until the simulator stops
+	proxied, err := redirectConfig(configPath, original, upstream, listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	log.Printf("Intercepting the DLL's requests to %s on %s (base_url of %s rewritten until the simulator stops)",
+		upstream, proxied, configPath)
+	interceptors[configPath] = p
+	return p, nil
+}
+
+// stopInterceptors stops the proxies and restores the config.ini files
+func stopInterceptors() {
+	for path, p := range interceptors {
+		p.listener.Close()
+		if err := restoreConfig(path); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			log.Printf("Restored %s", path)
+		}
+		delete(interceptors, path)
+	}
+}
+
+// readBody reads a body, keeping at most maxExchangeBody bytes for the record
+func readBody(body io.ReadCloser) ([]byte, string) {
+	if body == nil {
+		return nil, ""
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if len(data) > maxExchangeBody {
+		return data, string(data[:maxExchangeBody]) + "... (truncated)"
+	}
+	return data, string(data)
+}
+
+// ServeHTTP forwards a request of the DLL to the backend and records the exchange
+func (p *interceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	target := *p.upstream
+	target.Path, target.RawPath, target.RawQuery = r.URL.Path, r.URL.RawPath, r.URL.RawQuery
+
+	body, recordedBody := readBody(r.Body)
+	exchange := Exchange{
+		Time:           start,
+		Method:         r.Method,
+		URL:            target.String(),
+		RequestHeaders: r.Header.Clone(),
+		RequestBody:    recordedBody,
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	var resp *http.Response
+	if err == nil {
+		req.Header = r.Header.Clone()
+		resp, err = p.client.Do(req)
+	}
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		p.record(exchange)
+		http.Error(w, "Intercepting proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	data, recordedResponse := readBody(resp.Body)
+	exchange.StatusCode = resp.StatusCode
+	exchange.ResponseHeaders = resp.Header.Clone()
+	exchange.ResponseBody = recordedResponse
+	exchange.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	// Record before answering, so the exchange is there when the DLL call returns
+	p.record(exchange)
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(data)
+}
+
+// record keeps an exchange
+func (p *interceptor) record(exchange Exchange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	exchange.seq = p.seq
+	p.exchanges = append(p.exchanges, exchange)
+	if len(p.exchanges) > maxExchanges {
+		p.exchanges = p.exchanges[len(p.exchanges)-maxExchanges:]
+	}
+}
+
+// position returns the sequence number of the last recorded exchange
+func (p *interceptor) position() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.seq
+}
+
+// since returns the exchanges recorded after position
+func (p *interceptor) since(position int64) []Exchange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var exchanges []Exchange
+	for _, exchange := range p.exchanges {
+		if exchange.seq > position {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	return exchanges
+}
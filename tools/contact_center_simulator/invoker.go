@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// DLLInvoker calls a DLL with raw buffers. The HTTP layer only reaches DLLs
+// through it, so handlers and suites can run against a fake instead.
+type DLLInvoker interface {
+	// Invoke calls the DLL function with the input and output buffers, returning
+	// its return code and the system error code
+	Invoke(ctx context.Context, input, output []byte) (int, uintptr, error)
+	// LastError returns the DLL's last error message, and false if it has none
+	LastError() (string, bool)
+	Close() error
+}
+
+// outputCapturer is implemented by invokers that capture what the DLL prints to
+// standard output and error, such as the worker invoker
+type outputCapturer interface {
+	// CallOutput returns the output of the last call
+	CallOutput() string
+}
+
+// A reference to an input parameter in a scripted output value
+var placeholder = regexp.MustCompile(`\{\w+\}`)
+
+// Endpoint key of the fake behavior used for endpoints without their own
+const FakeDefaultEndpoint = "*"
+
+// FakeBehavior is the scripted answer of the fake invoker to one endpoint
+type FakeBehavior struct {
+	// ReturnCode is returned by the call (0 for success)
+	ReturnCode int `json:"return_code"`
+	// Output holds the pairs written to the output buffer when the input has
+	// CFResp=yes, as the DLL does. "{Key}" in a value is replaced by the value of
+	// the input parameter Key (empty if there is none).
+	Output map[string]string `json:"output,omitempty"`
+	// LastError is the message GetLastErrorMessage returns after a failure
+	LastError string `json:"last_error,omitempty"`
+	// Require lists parameters the call fails without, with INVALID_INPUT
+	Require []string `json:"require,omitempty"`
+	// DelayMs delays the answer, as the DLL's HTTP request would
+	DelayMs int `json:"delay_ms,omitempty"`
+}
+
+// fakeInvoker answers calls with the scripted behavior of the input's Endpoint
+// parameter, in the buffer protocol version (and with the checksum) of the input
+type fakeInvoker struct {
+	behaviors map[string]FakeBehavior
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// newFakeInvoker creates a fake invoker with behaviors by endpoint
+func newFakeInvoker(behaviors map[string]FakeBehavior) *fakeInvoker {
+	return &fakeInvoker{behaviors: behaviors}
+}
+
+// loadFakeInvoker creates a fake invoker from a JSON file of behaviors by endpoint:
+//
+//	{"getInfo": {"return_code": 0, "output": {"CFResp": "name=Test"}},
+//	 "*": {"return_code": 5, "last_error": "HTTP error: received status code 404"}}
+func loadFakeInvoker(path string) (*fakeInvoker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fake behaviors file: %v", err)
+	}
+	var behaviors map[string]FakeBehavior
+	if err := json.Unmarshal(data, &behaviors); err != nil {
+		return nil, fmt.Errorf("failed to parse fake behaviors file %s: %v", path, err)
+	}
+	return newFakeInvoker(behaviors), nil
+}
+
+func (f *fakeInvoker) Invoke(ctx context.Context, input, output []byte) (int, uintptr, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	v := buffer.DetectVersion(input)
+	pairs, err := buffer.Decode(v, input)
+	if err != nil {
+		return f.fail(dllclient.InvalidInput, "Invalid input: %v", err), 0, nil
+	}
+	checksum := len(pairs) > 0 && pairs[len(pairs)-1].Key == buffer.ChecksumKey
+
+	params := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		params[p.Key] = p.Value
+	}
+	endpoint := params["Endpoint"]
+	b, ok := f.behaviors[endpoint]
+	if !ok {
+		b, ok = f.behaviors[FakeDefaultEndpoint]
+	}
+	if !ok {
+		return f.fail(dllclient.InvalidInput, "Fake invoker has no behavior for endpoint '%s'", endpoint), 0, nil
+	}
+	if b.DelayMs > 0 {
+		select {
+		case <-time.After(time.Duration(b.DelayMs) * time.Millisecond):
+		case <-ctx.Done():
+			return 0, 0, ctx.Err()
+		}
+	}
+
+	var missing []string
+	for _, key := range b.Require {
+		if params[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return f.fail(dllclient.InvalidInput, "Missing required parameters for endpoint '%s': %s", endpoint, strings.Join(missing, ", ")), 0, nil
+	}
+	if b.ReturnCode != 0 {
+		return f.fail(dllclient.ErrorCode(b.ReturnCode), "%s", b.LastError), 0, nil
+	}
+	if len(b.Output) == 0 || params["CFResp"] != "yes" {
+		return 0, 0, nil
+	}
+
+	// Fill in the input parameters referenced by the output values (empty if missing)
+	fill := func(value string) string {
+		return placeholder.ReplaceAllStringFunc(value, func(m string) string {
+			return params[m[1:len(m)-1]]
+		})
+	}
+
+	keys := make([]string, 0, len(b.Output))
+	for key := range b.Output {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]buffer.Pair, len(keys))
+	for i, key := range keys {
+		out[i] = buffer.Pair{Key: key, Value: fill(b.Output[key])}
+	}
+
+	var data []byte
+	if checksum {
+		data, err = buffer.EncodeWithChecksum(v, out)
+	} else {
+		data, err = buffer.Encode(v, out)
+	}
+	if err != nil {
+		return f.fail(dllclient.UnexpectedException, "Cannot encode the scripted output: %v", err), 0, nil
+	}
+	if len(data) > len(output) {
+		return f.fail(dllclient.UnexpectedException, "Scripted output needs %d bytes, the output buffer has %d", len(data), len(output)), 0, nil
+	}
+	copy(output, data)
+	return 0, 0, nil
+}
+
+// fail records the error message and returns the code
+func (f *fakeInvoker) fail(code dllclient.ErrorCode, format string, args ...any) int {
+	f.mu.Lock()
+	f.lastError = fmt.Sprintf(format, args...)
+	f.mu.Unlock()
+	return int(code)
+}
+
+func (f *fakeInvoker) LastError() (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastError, true
+}
+
+func (f *fakeInvoker) Close() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// pairs returns the buffer pairs of alternating keys and values
+func pairs(kv ...string) []buffer.Pair {
+	var p []buffer.Pair
+	for i := 0; i+1 < len(kv); i += 2 {
+		p = append(p, buffer.Pair{Key: kv[i], Value: kv[i+1]})
+	}
+	return p
+}
+
+func TestFakeInvoker(t *testing.T) {
+	fake := newFakeInvoker(testBehaviors)
+	tests := []struct {
+		name     string
+		version  buffer.Version
+		checksum bool
+		input    []buffer.Pair
+		// outputSize is the size of the output buffer in pairs
+		outputSize int
+		ret        int
+		output     []buffer.Pair
+		lastError  string
+	}{
+		{"v1 output", buffer.V1, false,
+			pairs("Endpoint", "getInfo", "ID", "42", "CFResp", "yes"), 5,
+			0, pairs("CFResp", "Info for ID=42"), ""},
+		{"v2 output with checksum", buffer.V2, true,
+			pairs("Endpoint", "getInfo", "ID", "42", "CFResp", "yes"), 5,
+			0, pairs("CFResp", "Info for ID=42", buffer.ChecksumKey, ""), ""},
+		{"no output requested", buffer.V1, false,
+			pairs("Endpoint", "getInfo", "ID", "42"), 5,
+			0, nil, ""},
+		{"missing parameter", buffer.V1, false,
+			pairs("Endpoint", "getInfo"), 5,
+			int(dllclient.InvalidInput), nil, "Missing required parameters for endpoint 'getInfo': ID"},
+		{"default behavior", buffer.V1, false,
+			pairs("Endpoint", "other"), 5,
+			5, nil, "received status code 404"},
+		{"output buffer too small", buffer.V1, false,
+			pairs("Endpoint", "getInfo", "ID", "42", "CFResp", "yes"), 0,
+			int(dllclient.UnexpectedException), nil, "Scripted output needs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input []byte
+			var err error
+			if tt.checksum {
+				input, err = buffer.EncodeWithChecksum(tt.version, tt.input)
+			} else {
+				input, err = buffer.Encode(tt.version, tt.input)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := make([]byte, tt.version.Size(tt.outputSize))
+
+			ret, _, err := fake.Invoke(context.Background(), input, output)
+			if err != nil || ret != tt.ret {
+				t.Fatalf("Invoke = %d, %v; want %d", ret, err, tt.ret)
+			}
+			if tt.lastError != "" {
+				if message, _ := fake.LastError(); !strings.Contains(message, tt.lastError) {
+					t.Errorf("last error %q, want %q", message, tt.lastError)
+				}
+				return
+			}
+
+			decoded, err := buffer.Decode(tt.version, output)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if tt.checksum {
+				if ok, err := buffer.VerifyChecksum(tt.version, output); !ok || err != nil {
+					t.Errorf("VerifyChecksum = %v, %v", ok, err)
+				}
+				// The checksum value is not compared
+				decoded[len(decoded)-1].Value = ""
+			}
+			if !reflect.DeepEqual(decoded, tt.output) {
+				t.Errorf("output %q, want %q", decoded, tt.output)
+			}
+		})
+	}
+}
+
+func TestFakeInvokerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	input, _ := buffer.Encode(buffer.V1, pairs("Endpoint", "getInfo"))
+	if _, _, err := newFakeInvoker(testBehaviors).Invoke(ctx, input, make([]byte, 100)); err == nil {
+		t.Error("Invoke with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Defaults of the retries of DLL loads that fail with network errors
+const (
+	DefaultLoadRetries = 3
+	DefaultLoadBackoff = 2 * time.Second
+	// maxLoadBackoff caps the doubling delay between attempts
+	maxLoadBackoff = 30 * time.Second
+)
+
+// Retries and first delay of DLL loads, which double after each attempt
+var (
+	loadRetries = DefaultLoadRetries
+	loadBackoff = DefaultLoadBackoff
+)
+
+// Kinds of DLL load failures
+const (
+	loadNotFound     = "not found"
+	loadAccessDenied = "access denied"
+	loadNetwork      = "network error"
+	loadLocked       = "file in use"
+)
+
+// Hints for each kind of load failure
+var loadHints = map[string]string{
+	loadNotFound:     "Check the path, and that the build was published to it.",
+	loadAccessDenied: "Check that the account running the simulator can read the file, and for a network share, that it is logged on to the share.",
+	loadNetwork:      "The file server or share could not be reached. Check the network connection and the server name.",
+	loadLocked:       "Another process has the file open without sharing it, such as a copy still in progress. Close it and retry.",
+}
+
+// LoadError is a DLL load failure with its diagnosis
+type LoadError struct {
+	Path     string
+	Kind     string
+	Attempts int
+	Err      error
+	// Holders are the processes holding a file in use open, if they could be found
+	Holders string
+}
+
+func (e *LoadError) Error() string {
+	attempts := "1 attempt"
+	if e.Attempts != 1 {
+		attempts = fmt.Sprintf("%d attempts", e.Attempts)
+	}
+	held := ""
+	if e.Holders != "" {
+		held = fmt.Sprintf(" It is held open by %s.", e.Holders)
+	}
+	return fmt.Sprintf("cannot load %s: %s after %s: %v.%s %s", e.Path, e.Kind, attempts, e.Err, held, loadHints[e.Kind])
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError returns the kind of a file access error, or "" if it is not one.
+// Network errors come first, as Windows reports an unknown server as not found too.
+func classifyError(err error) string {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno) && networkErrnos[errno]:
+		return loadNetwork
+	case errors.As(err, &errno) && lockedErrnos[errno]:
+		return loadLocked
+	case errors.Is(err, fs.ErrNotExist):
+		return loadNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return loadAccessDenied
+	}
+	return ""
+}
+
+// classifyLoadError diagnoses a failed DLL load. Loaders do not always report why
+// they failed, so if the error says nothing, the DLL file is looked up instead.
+func classifyLoadError(path string, err error) string {
+	if kind := classifyError(err); kind != "" {
+		return kind
+	}
+	if _, statErr := os.Stat(path); statErr != nil {
+		return classifyError(statErr)
+	}
+	return ""
+}
+
+// retryLoad loads a DLL, retrying with a doubling delay while the load fails with
+// a network error, as shares publishing DLL builds fail transiently, or because
+// the file is in use. A load that keeps failing, or fails because the DLL is
+// missing or cannot be read, returns a LoadError telling which, with the
+// processes holding a file in use; other errors are returned as they are.
+func retryLoad(path string, load func() error) error {
+	delay := loadBackoff
+	for attempt := 1; ; attempt++ {
+		err := load()
+		if err == nil {
+			return nil
+		}
+		kind := classifyLoadError(path, err)
+		if kind == "" {
+			return err
+		}
+		if (kind != loadNetwork && kind != loadLocked) || attempt > loadRetries {
+			loadErr := &LoadError{Path: path, Kind: kind, Attempts: attempt, Err: err}
+			if kind == loadLocked {
+				loadErr.Holders = holdersOf(path)
+			}
+			return loadErr
+		}
+		log.Printf("Loading %s failed: %s (attempt %d of %d), retrying in %v: %v", path, kind, attempt, loadRetries+1, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxLoadBackoff)
+	}
+}
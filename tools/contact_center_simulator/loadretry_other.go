@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// Errors of an unreachable or failing network file system (NFS, SMB mounts)
+var networkErrnos = map[syscall.Errno]bool{
+	syscall.EHOSTDOWN:    true,
+	syscall.EHOSTUNREACH: true,
+	syscall.ENETDOWN:     true,
+	syscall.ENETUNREACH:  true,
+	syscall.ETIMEDOUT:    true,
+	syscall.ESTALE:       true,
+	syscall.EIO:          true,
+}
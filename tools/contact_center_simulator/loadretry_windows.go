@@ -0,0 +1,17 @@
+package main
+
+import "syscall"
+
+// Windows errors of an unreachable or failing network share
+var networkErrnos = map[syscall.Errno]bool{
+	51:   true, // ERROR_REM_NOT_LIST
+	53:   true, // ERROR_BAD_NETPATH
+	54:   true, // ERROR_NETWORK_BUSY
+	59:   true, // ERROR_UNEXP_NET_ERR
+	64:   true, // ERROR_NETNAME_DELETED
+	67:   true, // ERROR_BAD_NET_NAME
+	121:  true, // ERROR_SEM_TIMEOUT
+	1222: true, // ERROR_NO_NETWORK
+	1231: true, // ERROR_NETWORK_UNREACHABLE
+	1232: true, // ERROR_HOST_UNREACHABLE
+}
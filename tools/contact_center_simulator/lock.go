@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileHolder is a process holding a file open
+type FileHolder struct {
+	PID  int
+	Name string
+}
+
+func (h FileHolder) String() string {
+	return fmt.Sprintf("%s (PID %d)", h.Name, h.PID)
+}
+
+// holdersOf describes the processes holding a file open, "" if they cannot be found
+func holdersOf(path string) string {
+	holders, err := fileHolders(path)
+	if err != nil || len(holders) == 0 {
+		return ""
+	}
+	names := make([]string, len(holders))
+	for i, h := range holders {
+		names[i] = h.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkLocked returns the error of opening a file that another process holds open
+// without sharing it, such as a DLL still being copied, and nil otherwise
+func checkLocked(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if classifyError(err) == loadLocked {
+			return err
+		}
+		return nil
+	}
+	return f.Close()
+}
+
+// checkConfigLock warns when the config.ini next to a DLL is locked, as the DLL
+// then cannot read it and silently falls back to its built-in settings
+func checkConfigLock(dllPath string) {
+	path := filepath.Join(filepath.Dir(dllPath), "config.ini")
+	if err := checkLocked(path); err == nil {
+		return
+	}
+	if holders := holdersOf(path); holders != "" {
+		log.Printf("Warning: %s is locked by %s; the DLL cannot read it and uses its built-in settings", path, holders)
+	} else {
+		log.Printf("Warning: %s is locked by another process; the DLL cannot read it and uses its built-in settings", path)
+	}
+}
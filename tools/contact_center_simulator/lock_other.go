@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Files are not locked against reading on this platform
+var lockedErrnos = map[syscall.Errno]bool{}
+
+// fileHolders is only available on Windows, through the Restart Manager
+func fileHolders(path string) ([]FileHolder, error) {
+	return nil, errors.New("finding the processes holding a file needs Windows")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	rstrtmgr                = syscall.NewLazyDLL("rstrtmgr.dll")
+	procRmStartSession      = rstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = rstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = rstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = rstrtmgr.NewProc("RmEndSession")
+)
+
+// Windows errors of a file another process holds open without sharing it
+var lockedErrnos = map[syscall.Errno]bool{
+	32: true, // ERROR_SHARING_VIOLATION
+	33: true, // ERROR_LOCK_VIOLATION
+}
+
+// Returned by RmGetList when more processes hold the file than were asked for
+const errorMoreData = 234
+
+// rmProcessInfo is RM_PROCESS_INFO
+type rmProcessInfo struct {
+	processID        uint32
+	startTime        syscall.Filetime
+	appName          [256]uint16
+	serviceShortName [64]uint16
+	applicationType  uint32
+	appStatus        uint32
+	tsSessionID      uint32
+	restartable      int32
+}
+
+// fileHolders lists the processes that have a file open, through the Restart
+// Manager, which finds them without administrator rights
+func fileHolders(path string) ([]FileHolder, error) {
+	if err := procRmStartSession.Find(); err != nil {
+		return nil, err
+	}
+	var session uint32
+	key := make([]uint16, 33)
+	if ret, _, _ := procRmStartSession.Call(uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&key[0]))); ret != 0 {
+		return nil, fmt.Errorf("RmStartSession failed: %v", syscall.Errno(ret))
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	if ret, _, _ := procRmRegisterResources.Call(uintptr(session), 1, uintptr(unsafe.Pointer(&name)), 0, 0, 0, 0); ret != 0 {
+		return nil, fmt.Errorf("RmRegisterResources failed: %v", syscall.Errno(ret))
+	}
+
+	infos := make([]rmProcessInfo, 8)
+	for {
+		var needed, count uint32
+		var reasons uint32
+		count = uint32(len(infos))
+		ret, _, _ := procRmGetList.Call(uintptr(session), uintptr(unsafe.Pointer(&needed)), uintptr(unsafe.Pointer(&count)),
+			uintptr(unsafe.Pointer(&infos[0])), uintptr(unsafe.Pointer(&reasons)))
+		if ret == errorMoreData {
+			infos = make([]rmProcessInfo, needed+4)
+			continue
+		}
+		if ret != 0 {
+			return nil, fmt.Errorf("RmGetList failed: %v", syscall.Errno(ret))
+		}
+		holders := make([]FileHolder, 0, count)
+		for _, info := range infos[:count] {
+			holders = append(holders, FileHolder{PID: int(info.processID), Name: syscall.UTF16ToString(info.appName[:])})
+		}
+		return holders, nil
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
@@ -9,37 +11,57 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
-	"unsafe"
-)
 
-// Constants for buffer sizes
-const (
-	HeaderSize = 2
-	KeySize    = 32
-	ValueSize  = 128
-	PairSize   = KeySize + ValueSize
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/config"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
 )
 
 // Default configuration
 var (
 	DefaultPort    = 8080
-	DefaultDllPath = "dist/runtime/CustomDLL.dll"
-	StaticDllPath  = "dist/static/CustomDLLStatic.dll"
+	DefaultDllPath = "dist/runtime/CustomDLL" + dllclient.Extension()
+	StaticDllPath  = "dist/static/CustomDLLStatic" + dllclient.Extension()
 )
 
 // Global variables
 var (
-	dllPath              string
-	dllInstance          syscall.Handle
-	dllFunction          uintptr
-	getLastErrorFunction uintptr
+	dllPath    string
+	loadedDLLs = make(map[string]*loadedDLL)
+	// inProcessLoads is the profile each DLL loaded in the simulator itself was loaded for
+	inProcessLoads = make(map[string]*DLLProfile)
+	// simulate answers every profile without a fake of its own with the canned behaviors
+	simulate bool
+	// isolate runs the DLL of every profile in a worker process
+	isolate bool
+	// moduleSnapshots attaches the modules loaded with the DLL of every profile to the results
+	moduleSnapshots bool
+	// etwTracing records every call of every profile in an ETW trace
+	etwTracing bool
+	// readOnly disables everything but running the stored suites and viewing
+	// results, to expose the simulator to people outside the team
+	readOnly bool
 )
 
+// loadedDLL is a DLL loaded into the simulator process, or the invoker standing in for it
+type loadedDLL struct {
+	path    string
+	invoker DLLInvoker
+	// note is added to every result as a warning by invokers that call no DLL
+	note string
+	// interceptor records the DLL's requests to the backend (with -intercept)
+	interceptor *interceptor
+	// version and hash identify the build of the DLL (see builds.go)
+	version, hash string
+}
+
 // Parameter represents a key/value pair
 type Parameter struct {
 	Key   string `json:"key"`
@@ -49,159 +71,367 @@ type Parameter struct {
 // TestCase represents a test case for the DLL
 type TestCase struct {
 	Name       string      `json:"name"`
+	Profile    string      `json:"profile,omitempty"`
 	Parameters []Parameter `json:"parameters"`
+	// Fuzz corrupts the input buffer after its checksum is computed, to confirm the DLL detects damage
+	Fuzz bool `json:"fuzz,omitempty"`
+	// MaxDurationMs is the latency budget of the DLL call; the test fails if the call takes longer
+	MaxDurationMs float64 `json:"maxDurationMs,omitempty"`
+	// Backend lists the requests the DLL must send, checked against the mock backend of hermetic runs
+	Backend []BackendExpectation `json:"backend,omitempty"`
+	// ExpectError makes the test pass when the DLL returns an error code, for
+	// negative cases such as a missing parameter
+	ExpectError bool `json:"expectError,omitempty"`
+	// Tags label the case; a case without a profile runs with the profile its tags
+	// are routed to
+	Tags []string `json:"tags,omitempty"`
+	// Env sets environment variables of the worker process hosting the DLL for
+	// this case, over those of the profile (isolated profiles only)
+	Env map[string]string `json:"env,omitempty"`
 }
 
 // TestResult represents the result of a test case
 type TestResult struct {
+	// Name is the name of the test case, if it has one
+	Name         string            `json:"name,omitempty"`
 	Success      bool              `json:"success"`
+	Profile      string            `json:"profile"`
+	Protocol     int               `json:"protocol"`
 	ReturnCode   int               `json:"returnCode"`
+	DurationMs   float64           `json:"durationMs"`
 	InputBuffer  string            `json:"inputBuffer"`
 	OutputBuffer string            `json:"outputBuffer"`
 	Parameters   map[string]string `json:"parameters"`
 	Response     string            `json:"response"`
 	ErrorDetails string            `json:"errorDetails"`
 	DllConfig    string            `json:"dllConfig"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	OutputError  *BufferError      `json:"outputError,omitempty"`
+	// MaxDurationMs is the latency budget of the test case, if it has one
+	MaxDurationMs float64 `json:"maxDurationMs,omitempty"`
+	// RunID identifies the stored artifacts of the run (see runs.go)
+	RunID string `json:"runId,omitempty"`
+	// Suite and SuiteVersion identify the suite version the test case belongs to
+	Suite        string `json:"suite,omitempty"`
+	SuiteVersion int    `json:"suiteVersion,omitempty"`
+	// Crash is set when the DLL crashed its worker process during the call
+	Crash *CrashInfo `json:"crash,omitempty"`
+	// Exchanges are the requests the DLL sent to the backend during the call, and
+	// the responses (with -intercept)
+	Exchanges []Exchange `json:"exchanges,omitempty"`
+	// DllOutput is what the DLL printed to standard output and error during the
+	// call (isolated profiles only)
+	DllOutput string `json:"dllOutput,omitempty"`
+	// Modules are the modules loaded in the process hosting the DLL after the
+	// call, for profiles with module snapshots
+	Modules []LoadedModule `json:"modules,omitempty"`
+	// Trace is the ETW trace of the call, for profiles with ETW tracing (see etw.go)
+	Trace *TraceInfo `json:"trace,omitempty"`
+	// DllVersion and DllHash (SHA-256) identify the build of the DLL that was called
+	DllVersion string `json:"dllVersion,omitempty"`
+	DllHash    string `json:"dllHash,omitempty"`
+	// Output holds the output values of the DLL, decoded as the profile requires
+	Output map[string]string `json:"output,omitempty"`
+	// CurlCommand sends the request the DLL makes to the backend for the test's
+	// parameters, to check the backend without the DLL (see curl.go)
+	CurlCommand string `json:"curlCommand,omitempty"`
+	// Hooks are the hook commands that ran for the test (see hooks.go)
+	Hooks []HookResult `json:"hooks,omitempty"`
+	// Validations are the verdicts of the validators that checked the result
+	// (see validators.go)
+	Validations []Validation `json:"validations,omitempty"`
+
+	// Raw buffers exchanged with the DLL, stored as run artifacts
+	input, output []byte
 }
 
-// loadDLL loads the DLL and gets the function pointers
-func loadDLL(dllPath string) error {
-	// Load the DLL
-	dll, err := syscall.LoadLibrary(dllPath)
-	if err != nil {
-		return fmt.Errorf("failed to load DLL: %v", err)
+// loadDLL loads the DLL of a profile and gets the function pointers, or the fake
+// invoker if the profile has one. Each DLL is loaded once, however many profiles use it.
+func loadDLL(profile *DLLProfile) (*loadedDLL, error) {
+	key := profile.loadKey()
+	if profile.Fake != "" {
+		key = "fake:" + profile.Fake
+	} else if simulate {
+		key = "simulate:"
+	} else if profile.isolated() {
+		key = "worker:" + key
+	}
+	if d, ok := loadedDLLs[key]; ok {
+		return d, nil
 	}
-	dllInstance = dll
 
-	// Get the main function pointer
-	proc, err := syscall.GetProcAddress(dll, "CustomFunctionExample")
-	if err != nil {
-		syscall.FreeLibrary(dll)
-		return fmt.Errorf("failed to get function pointer: %v", err)
+	// A process loads a DLL once, so the load options of the first profile would
+	// silently apply to every other profile loading it in the simulator
+	if profile.Fake == "" && !simulate && !profile.isolated() {
+		if other, ok := inProcessLoads[profile.DLL]; ok && other.loadKey() != key {
+			return nil, fmt.Errorf("profile '%s' loads %s with other load options than profile '%s'; isolate one of them (set \"isolate\")",
+				profile.name, profile.DLL, other.name)
+		}
+	}
+
+	if profile.Fake == "" && simulate {
+		d := &loadedDLL{path: profile.DLL, invoker: newFakeInvoker(simulatedBehaviors), note: simulateNote}
+		loadedDLLs[key] = d
+		return d, nil
+	}
+	if profile.Fake != "" {
+		fake, err := loadFakeInvoker(profile.Fake)
+		if err != nil {
+			return nil, err
+		}
+		d := &loadedDLL{path: profile.DLL, invoker: fake,
+			note: fmt.Sprintf("Fake invoker: results are scripted in %s, no DLL was called", profile.Fake)}
+		loadedDLLs[key] = d
+		return d, nil
 	}
-	dllFunction = proc
 
-	// Get the GetLastErrorMessage function pointer
-	errorProc, err := syscall.GetProcAddress(dll, "GetLastErrorMessage")
+	// Report a DLL or config.ini another process holds open, rather than the
+	// generic failure of reading or loading it
+	if err := retryLoad(profile.DLL, func() error { return checkLocked(profile.DLL) }); err != nil {
+		return nil, err
+	}
+	checkConfigLock(profile.DLL)
+
+	// Identify the build before loading it, refusing a DLL with an unexpected hash
+	version, hash, err := verifyBuild(profile)
 	if err != nil {
-		// This is not a fatal error, as older DLLs might not have this function
-		log.Printf("Warning: GetLastErrorMessage function not found in DLL. Detailed error messages will not be available.")
-	} else {
-		getLastErrorFunction = errorProc
-		log.Printf("GetLastErrorMessage function found in DLL. Detailed error messages will be available.")
+		return nil, err
+	}
+	if err := checkSignature(profile.DLL); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	if options := profile.loadOptions(); runtime.GOOS != "windows" && (options.LoadFlags != 0 || len(options.SearchDirs) > 0 || options.DllDirectory != "") {
+		log.Printf("Warning: the search directories and load flags of profile '%s' only apply on Windows", profile.name)
+	}
 
-// unloadDLL unloads the DLL
-func unloadDLL() {
-	if dllInstance != 0 {
-		syscall.FreeLibrary(dllInstance)
-		dllInstance = 0
+	// Load the DLL and get the function pointers, in a worker process for isolated
+	// profiles (the worker is restarted if the DLL crashes it)
+	var client interface {
+		DLLInvoker
+		HasLastError() bool
+	}
+	err = retryLoad(profile.DLL, func() error {
+		var err error
+		if profile.isolated() {
+			client, err = newWorkerInvoker(profile.DLL, profile.loadOptions(), profile.WorkingDir, profile.Env)
+		} else {
+			client, err = dllclient.Load(profile.DLL, profile.loadOptions())
+		}
+		return err
+	})
+	if err != nil {
+		// Real DLL calls only work on Windows; elsewhere the UI and APIs still run
+		// against the stub, for development
+		if runtime.GOOS == "windows" {
+			return nil, err
+		}
+		log.Printf("Warning: %v", err)
+		log.Printf("Warning: using the stub invoker for %s: tests check the buffers but call no DLL", profile.DLL)
+		d := &loadedDLL{path: profile.DLL, invoker: dllclient.NewStub(profile.DLL), version: version, hash: hash,
+			note: fmt.Sprintf("Stub invoker: %s could not be loaded, so no DLL was called", profile.DLL)}
+		loadedDLLs[key] = d
+		return d, nil
 	}
-}
 
-// getLastError gets the last error message from the DLL
-func getLastError() string {
-	if getLastErrorFunction == 0 {
-		return "Error details not available (GetLastErrorMessage function not found in DLL)"
+	// GetLastErrorMessage is optional, as older DLLs might not have this function
+	if client.HasLastError() {
+		log.Printf("GetLastErrorMessage function found in DLL. Detailed error messages will be available.")
+	} else {
+		log.Printf("Warning: GetLastErrorMessage function not found in DLL. Detailed error messages will not be available.")
 	}
 
-	// Call the GetLastErrorMessage function
-	ret, _, _ := syscall.Syscall(getLastErrorFunction, 0, 0, 0, 0)
+	d := &loadedDLL{path: profile.DLL, invoker: client, version: version, hash: hash}
 
-	// Convert the returned pointer to a Go string
-	if ret != 0 {
-		// The function returns a pointer to a null-terminated string
-		// We need to convert it to a Go string
-		var message string
-		ptr := ret
-		for {
-			b := *(*byte)(unsafe.Pointer(ptr))
-			if b == 0 {
-				break
-			}
-			message += string(b)
-			ptr++
+	// Point the DLL at the intercepting proxy; the static DLL has its base URL built in
+	if intercept && isRuntimeDLL(profile.DLL) {
+		d.interceptor, err = startInterceptor(profile.DLL)
+		if err != nil {
+			client.Close()
+			return nil, err
 		}
-		return message
+	} else if intercept {
+		log.Printf("Warning: cannot intercept the requests of %s, which does not read config.ini", profile.DLL)
 	}
 
-	return "Unknown error"
+	loadedDLLs[key] = d
+	if !profile.isolated() {
+		inProcessLoads[profile.DLL] = profile
+	}
+	return d, nil
 }
 
-// createInputBuffer creates an input buffer for the DLL function
-func createInputBuffer(parameters []Parameter) []byte {
-	// Calculate buffer size
-	bufferSize := HeaderSize + len(parameters)*PairSize
-	buffer := make([]byte, bufferSize)
+// unloadDLLs unloads every loaded DLL
+func unloadDLLs() {
+	for path, d := range loadedDLLs {
+		d.invoker.Close()
+		delete(loadedDLLs, path)
+	}
+	clear(inProcessLoads)
+}
 
-	// Set number of parameters
-	numParams := fmt.Sprintf("%02d", len(parameters))
-	buffer[0] = numParams[0]
-	buffer[1] = numParams[1]
+// getLastError gets the last error message from the DLL
+func (d *loadedDLL) getLastError() string {
+	message, ok := d.invoker.LastError()
+	if !ok {
+		return "Error details not available (GetLastErrorMessage function not found in DLL)"
+	}
+	if message == "" {
+		return "Unknown error"
+	}
+	return message
+}
 
-	// Set parameters
+// createInputBuffer creates an input buffer for the DLL function, with a trailing
+// checksum pair if requested
+func createInputBuffer(version buffer.Version, parameters []Parameter, checksum bool) ([]byte, error) {
+	pairs := make([]buffer.Pair, len(parameters))
 	for i, param := range parameters {
-		// Copy key (up to KeySize characters)
-		keyOffset := HeaderSize + i*PairSize
-		keyLength := min(len(param.Key), KeySize)
-		copy(buffer[keyOffset:keyOffset+keyLength], param.Key)
-
-		// Copy value (up to ValueSize characters)
-		valueOffset := keyOffset + KeySize
-		valueLength := min(len(param.Value), ValueSize)
-		copy(buffer[valueOffset:valueOffset+valueLength], param.Value)
+		pairs[i] = buffer.Pair{Key: param.Key, Value: param.Value}
 	}
-
-	return buffer
+	if checksum {
+		return buffer.EncodeWithChecksum(version, pairs)
+	}
+	return buffer.Encode(version, pairs)
 }
 
-// parseOutputBuffer parses the output buffer from the DLL function
-func parseOutputBuffer(buffer []byte) map[string]string {
+// parseOutputBuffer parses the output buffer from the DLL function. On malformed
+// buffers it returns the pairs read before the problem and a *buffer.ParseError.
+func parseOutputBuffer(version buffer.Version, outputBuffer []byte) (map[string]string, error) {
 	result := make(map[string]string)
+	pairs, err := buffer.Decode(version, outputBuffer)
+	for _, pair := range pairs {
+		result[pair.Key] = pair.Value
+	}
+	return result, err
+}
 
-	// Check if buffer is valid
-	if len(buffer) < HeaderSize {
-		return result
+// findTruncatedValues returns the keys of output values that fill the whole value
+// field. The DLL copies at most ValueSize-1 characters followed by a NUL, so a value
+// of that length was most likely cut off. Protocol version 2 values carry their
+// length, so only version 1 buffers are checked.
+func findTruncatedValues(version buffer.Version, outputBuffer []byte) []string {
+	var truncated []string
+	if version != buffer.V1 {
+		return truncated
 	}
+	pairs, _ := buffer.Decode(version, outputBuffer)
+	for _, pair := range pairs {
+		if len(pair.Value) >= buffer.ValueSize-1 {
+			truncated = append(truncated, pair.Key)
+		}
+	}
+	return truncated
+}
 
-	// Get number of parameters
-	numParamsStr := string(buffer[:HeaderSize])
-	numParams, err := strconv.Atoi(numParamsStr)
-	if err != nil || numParams <= 0 {
-		return result
+// runTestCase calls the DLL for a test case and fails the result if the call
+// exceeded the case's latency budget or a validator rejects it. A case expecting
+// an error passes when the DLL returns one. Error explanations are in the
+// language lang.
+func runTestCase(profile *DLLProfile, testCase TestCase, lang string) TestResult {
+	result := callDLL(profile, testCase.Parameters, dllEnvironment(profile, testCase), testCase.Fuzz, lang)
+	result.Name = testCase.Name
+	if testCase.ExpectError {
+		if result.ReturnCode == 0 {
+			failResult(&result, message(lang, "error.expected_error"))
+		} else if result.Crash == nil {
+			result.Success = true
+		}
 	}
+	if testCase.MaxDurationMs > 0 {
+		result.MaxDurationMs = testCase.MaxDurationMs
+		if result.DurationMs > testCase.MaxDurationMs {
+			over := result.DurationMs - testCase.MaxDurationMs
+			details := message(lang, "error.latency_budget",
+				result.DurationMs, over, over/testCase.MaxDurationMs*100, testCase.MaxDurationMs)
+			log.Printf("Test '%s': %s", testCase.Name, details)
+			if result.ErrorDetails != "" {
+				details += "\n" + result.ErrorDetails
+			}
+			result.Success, result.ErrorDetails = false, details
+		}
+	}
+	runValidators(testCase, &result, lang)
+	return result
+}
 
-	// Parse parameters
-	for i := 0; i < numParams && HeaderSize+i*PairSize+PairSize <= len(buffer); i++ {
-		// Extract key and value
-		keyStart := HeaderSize + i*PairSize
-		valueStart := keyStart + KeySize
+// callDLL calls the DLL of the profile with the given parameters, in a worker
+// process with the environment variables env, explaining failures in the
+// language lang
+func callDLL(profile *DLLProfile, parameters []Parameter, env map[string]string, fuzz bool, lang string) (result TestResult) {
+	version := profile.version
+	dll, err := loadDLL(profile)
+	if err != nil {
+		return TestResult{
+			Profile:      profile.name,
+			Protocol:     int(version),
+			ReturnCode:   -1,
+			ErrorDetails: fmt.Sprintf("Failed to load DLL %s for profile '%s': %v", profile.DLL, profile.name, err),
+		}
+	}
 
-		// Extract key (trim null characters)
-		key := string(buffer[keyStart : keyStart+KeySize])
-		key = strings.TrimRight(key, "\x00")
+	// Tag the result with the build of the DLL
+	defer func() { result.DllVersion, result.DllHash = dll.version, dll.hash }()
 
-		// Extract value (trim null characters)
-		value := string(buffer[valueStart : valueStart+ValueSize])
-		value = strings.TrimRight(value, "\x00")
+	// Normalize values as the profile requires, reporting what changed
+	inputWarnings := checkParameters(parameters)
+	parameters, normalizeWarnings := normalizeParameters(profile, parameters)
+	inputWarnings = append(inputWarnings, normalizeWarnings...)
 
-		// Store in map
-		result[key] = value
+	// Create input buffer, encoding values as the profile requires
+	var inputBuffer []byte
+	encoded, err := encodeParameters(profile, parameters)
+	if err == nil {
+		inputBuffer, err = createInputBuffer(version, encoded, profile.Checksum)
+	}
+	if err != nil {
+		return TestResult{
+			Profile:      profile.name,
+			Protocol:     int(version),
+			ReturnCode:   -1,
+			ErrorDetails: fmt.Sprintf("Cannot encode the parameters in buffer protocol version %d: %v", version, err),
+		}
 	}
 
-	return result
-}
+	// Environment variables are set in the worker process, a DLL loaded in the
+	// simulator itself would not see them
+	var envWarning string
+	if len(env) > 0 {
+		switch _, ok := dll.invoker.(*workerInvoker); {
+		case ok:
+		case dll.note != "":
+			envWarning = "The environment variables of the test were not set: no DLL was called"
+		default:
+			return TestResult{
+				Profile:      profile.name,
+				Protocol:     int(version),
+				ReturnCode:   -1,
+				ErrorDetails: fmt.Sprintf("Environment variables need an isolated profile (set \"isolate\" on profile '%s' or start with -isolate)", profile.name),
+			}
+		}
+	}
 
-// callDLL calls the DLL function with the given parameters
-func callDLL(parameters []Parameter) TestResult {
-	// Create input buffer
-	inputBuffer := createInputBuffer(parameters)
+	// Damage the input buffer in fuzz mode, so a DLL verifying checksums must reject it
+	var fuzzedOffset = -1
+	if fuzz {
+		if !profile.Checksum {
+			return TestResult{
+				Profile:      profile.name,
+				Protocol:     int(version),
+				ReturnCode:   -1,
+				ErrorDetails: fmt.Sprintf("Fuzz mode needs a profile with checksums enabled (profile '%s' has none)", profile.name),
+			}
+		}
+		fuzzedOffset = buffer.Corrupt(version, inputBuffer)
+		log.Printf("Fuzz mode: corrupted input buffer byte %d", fuzzedOffset)
+	}
 
-	// Create output buffer (initialized to zeros)
-	outputBuffer := make([]byte, HeaderSize+PairSize)
+	// Create output buffer (initialized to zeros), with room for the checksum pair
+	outputPairs := 1
+	if profile.Checksum {
+		outputPairs = 2
+	}
+	outputBuffer := make([]byte, version.Size(outputPairs))
 
 	// Log the parameters being passed to the DLL
 	log.Printf("Calling DLL with parameters:")
@@ -210,18 +440,112 @@ func callDLL(parameters []Parameter) TestResult {
 	}
 
 	// Call DLL function
-	ret, _, errNo := syscall.Syscall(dllFunction, 2,
-		uintptr(unsafe.Pointer(&inputBuffer[0])),
-		uintptr(unsafe.Pointer(&outputBuffer[0])),
-		0)
+	var exchangePosition int64
+	if dll.interceptor != nil {
+		exchangePosition = dll.interceptor.position()
+	}
+	// Record the call in an ETW trace, started before the clock so it does not
+	// count in the duration
+	var trace *etwTrace
+	var traceWarning string
+	if profile.traceETW() && dll.note == "" {
+		if trace, err = startTrace(hostPID(dll)); err != nil {
+			log.Printf("Failed to start the ETW trace: %v", err)
+			traceWarning = fmt.Sprintf("The call was not traced: %v", err)
+		}
+	}
+	start := time.Now()
+	ctx := withCallEnv(context.Background(), env)
+	if profile.snapshotModules() {
+		ctx = withCallModules(ctx)
+	}
+	ret, errNo, err := dll.invoker.Invoke(ctx, inputBuffer, outputBuffer)
+	durationMs := float64(time.Since(start).Microseconds()) / 1000
+	var traceInfo *TraceInfo
+	if trace != nil {
+		var traceErr error
+		if traceInfo, traceErr = trace.stop(); traceErr != nil {
+			log.Printf("Failed to stop the ETW trace: %v", traceErr)
+			traceWarning = fmt.Sprintf("The ETW trace of the call was lost: %v", traceErr)
+		}
+	}
+	var exchanges []Exchange
+	if dll.interceptor != nil {
+		exchanges = dll.interceptor.since(exchangePosition)
+	}
+	var crash *WorkerCrash
+	if errors.As(err, &crash) {
+		log.Printf("Test crashed: %v. Worker output:\n%s", crash, crash.Info.output)
+		return TestResult{
+			Profile:      profile.name,
+			Protocol:     int(version),
+			ReturnCode:   -1,
+			DurationMs:   durationMs,
+			InputBuffer:  formatBufferForDisplay(version, inputBuffer),
+			ErrorDetails: fmt.Sprintf("CRASHED: %v. The worker is restarted and the DLL reloaded for the next test.", crash),
+			Crash:        crash.Info,
+			Exchanges:    exchanges,
+			Trace:        traceInfo,
+			input:        inputBuffer,
+		}
+	}
+	if err != nil {
+		return TestResult{
+			Profile:      profile.name,
+			Protocol:     int(version),
+			ReturnCode:   -1,
+			ErrorDetails: fmt.Sprintf("Failed to call DLL %s: %v", dll.path, err),
+			Trace:        traceInfo,
+		}
+	}
 
 	// Parse output buffer
-	outputParams := parseOutputBuffer(outputBuffer)
+	outputParams, parseErr := parseOutputBuffer(version, outputBuffer)
+	if parseErr != nil {
+		log.Printf("Malformed output buffer: %v", parseErr)
+	}
+
+	// Verify the checksum of the output buffer
+	var checksumError error
+	if profile.Checksum && ret == 0 && parseErr == nil {
+		if len(outputParams) > 0 {
+			present, err := buffer.VerifyChecksum(version, outputBuffer)
+			if !present {
+				err = fmt.Errorf("output buffer has no %s checksum pair", buffer.ChecksumKey)
+			}
+			checksumError = err
+		}
+		delete(outputParams, buffer.ChecksumKey)
+	}
+
+	// Flag embedded NULs, which OSCC would read as the end of a version 1 value
+	warnings := append(inputWarnings, findEmbeddedNULs(version, outputParams)...)
+
+	// Decode output values as the profile requires
+	warnings = append(warnings, decodeOutput(profile, outputParams)...)
+
+	// In fuzz mode the DLL must have rejected the damaged input
+	if fuzz && fuzzedOffset >= 0 && ret != 0 {
+		log.Printf("Fuzz mode: the DLL rejected the corrupted input buffer (return code %d)", int(ret))
+	}
+	if fuzz && fuzzedOffset >= 0 && ret == 0 {
+		warnings = append(warnings, fmt.Sprintf("Fuzz mode: the DLL accepted an input buffer corrupted at byte %d without detecting the checksum mismatch", fuzzedOffset))
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: %s", warning)
+	}
+
+	// Flag values that were cut to fit the fixed-width output field
+	for _, key := range findTruncatedValues(version, outputBuffer) {
+		warning := fmt.Sprintf("Output value '%s' fills the %d-character value field and was probably truncated", key, buffer.ValueSize-1)
+		log.Printf("Warning: %s", warning)
+		warnings = append(warnings, warning)
+	}
 
 	// Create parameter map for display
 	paramMap := make(map[string]string)
 	for _, param := range parameters {
-		paramMap[param.Key] = param.Value
+		paramMap[escapeValue(param.Key)] = escapeValue(param.Value)
 	}
 
 	// Generate error details based on return code and parameters
@@ -260,36 +584,22 @@ func callDLL(parameters []Parameter) TestResult {
 
 	if ret != 0 {
 		// Get the error code name based on the return value
-		errorCodeName := "UNKNOWN_ERROR"
-		switch int(ret) {
-		case 1:
-			errorCodeName = "INVALID_INPUT"
-		case 2:
-			errorCodeName = "TOO_MANY_PARAMETERS"
-		case 3:
-			errorCodeName = "CURL_INIT_FAILED"
-		case 4:
-			errorCodeName = "CURL_REQUEST_FAILED"
-		case 5:
-			errorCodeName = "HTTP_ERROR"
-		case 6:
-			errorCodeName = "UNEXPECTED_EXCEPTION"
-		}
+		errorCodeName := dllclient.ErrorCode(ret).String()
 
 		// Get detailed error message from DLL if available
-		dllErrorMessage := getLastError()
+		dllErrorMessage := dll.getLastError()
 
 		// Construct error details
-		errorDetails = fmt.Sprintf("DLL function returned error code: %d (%s)", int(ret), errorCodeName)
+		errorDetails = message(lang, "error.code", int(ret), errorCodeName)
 
 		// Add detailed error message if available
 		if dllErrorMessage != "Unknown error" && dllErrorMessage != "Error details not available (GetLastErrorMessage function not found in DLL)" {
-			errorDetails += "\nDetailed error message: " + dllErrorMessage
+			errorDetails += "\n" + message(lang, "error.dll_message", dllErrorMessage)
 		}
 
 		// Check for missing required parameters
 		if !hasEndpoint {
-			errorDetails += "\nMissing 'Endpoint' parameter which is required"
+			errorDetails += "\n" + message(lang, "error.missing_endpoint")
 		} else {
 			log.Printf("Using endpoint: %s", endpointValue)
 
@@ -307,39 +617,41 @@ func callDLL(parameters []Parameter) TestResult {
 				}
 
 				if len(missingParams) > 0 {
-					errorDetails += fmt.Sprintf("\nMissing required parameters for endpoint '%s': %s", 
+					errorDetails += "\n" + message(lang, "error.missing_params",
 						endpointValue, strings.Join(missingParams, ", "))
 				}
 			} else if endpointValue == "getInfo" {
 				if _, hasID := paramValues["ID"]; !hasID {
-					errorDetails += fmt.Sprintf("\nMissing required parameter 'ID' for endpoint '%s'", endpointValue)
+					errorDetails += "\n" + message(lang, "error.missing_id", endpointValue)
 				}
 			}
 
 			// Check if the endpoint is valid
 			validEndpoints := map[string]bool{
 				"procesareDate_1": true,
+				"procesareDate_2": true,
 				"getInfo": true,
+				"getInfo_2": true,
 			}
 
 			if !validEndpoints[endpointValue] {
-				errorDetails += fmt.Sprintf("\nInvalid endpoint: '%s'. Valid endpoints are: procesareDate_1, getInfo", endpointValue)
+				errorDetails += "\n" + message(lang, "error.invalid_endpoint", endpointValue, "procesareDate_1, procesareDate_2, getInfo, getInfo_2")
 			}
 		}
 
 		// Check if we're using the correct DLL
-		log.Printf("Using DLL: %s", dllPath)
+		log.Printf("Using DLL: %s", dll.path)
 
 		// Check if the DLL file exists
-		if _, err := os.Stat(dllPath); os.IsNotExist(err) {
-			errorDetails += fmt.Sprintf("\nDLL file not found at path: %s", dllPath)
+		if _, err := os.Stat(dll.path); os.IsNotExist(err) {
+			errorDetails += "\n" + message(lang, "error.dll_not_found", dll.path)
 		}
 
 		// Check if config.ini exists (for runtime DLL)
-		if strings.Contains(strings.ToLower(dllPath), "customdll.dll") && !strings.Contains(strings.ToLower(dllPath), "static") {
-			configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
+		if isRuntimeDLL(dll.path) {
+			configPath := filepath.Join(filepath.Dir(dll.path), "config.ini")
 			if _, err := os.Stat(configPath); os.IsNotExist(err) {
-				errorDetails += fmt.Sprintf("\nWarning: config.ini not found at path: %s", configPath)
+				errorDetails += "\n" + message(lang, "error.config_not_found", configPath)
 				log.Printf("Warning: config.ini not found at path: %s", configPath)
 			} else {
 				log.Printf("Found config.ini at: %s", configPath)
@@ -351,17 +663,17 @@ func callDLL(parameters []Parameter) TestResult {
 
 		// Check if there was a syscall error
 		if errNo != 0 {
-			errorDetails += fmt.Sprintf("\nSystem error: %d", errNo)
+			errorDetails += "\n" + message(lang, "error.system", errNo)
 			log.Printf("System error code: %d", errNo)
 		}
 
 		// Check if the Go server is running
 		serverRunning := false
-		serverURL := "http://localhost:8080"
+		serverURL := config.DefaultServerURL
 
 		// Try to determine the server URL from config.ini if using runtime DLL
-		if strings.Contains(strings.ToLower(dllPath), "customdll.dll") && !strings.Contains(strings.ToLower(dllPath), "static") {
-			configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
+		if isRuntimeDLL(dll.path) {
+			configPath := filepath.Join(filepath.Dir(dll.path), "config.ini")
 			if _, err := os.Stat(configPath); err == nil {
 				// Read the config.ini file to get the server URL
 				configData, err := os.ReadFile(configPath)
@@ -387,9 +699,9 @@ func callDLL(parameters []Parameter) TestResult {
 		client := http.Client{
 			Timeout: 2 * time.Second,
 		}
-		resp, err := client.Get(serverURL)
+		resp, err := client.Do(newProbeRequest(serverURL))
 		if err != nil {
-			errorDetails += fmt.Sprintf("\nCould not connect to server at %s: %v", serverURL, err)
+			errorDetails += "\n" + message(lang, "error.server_unreachable", serverURL, err)
 			log.Printf("Server connection test failed: %v", err)
 		} else {
 			defer resp.Body.Close()
@@ -398,37 +710,78 @@ func callDLL(parameters []Parameter) TestResult {
 		}
 
 		// Add troubleshooting tips
-		errorDetails += "\n\nTroubleshooting tips:"
-		errorDetails += "\n- Make sure the DLL file exists and is accessible"
-		errorDetails += "\n- Check that all required parameters are provided"
-		errorDetails += "\n- Verify that the endpoint name is correct"
-		errorDetails += "\n- If using the runtime DLL, ensure config.ini exists in the same directory"
+		errorDetails += "\n\n" + message(lang, "tips.title")
+		errorDetails += "\n- " + message(lang, "tips.dll_exists")
+		errorDetails += "\n- " + message(lang, "tips.parameters")
+		errorDetails += "\n- " + message(lang, "tips.endpoint")
+		errorDetails += "\n- " + message(lang, "tips.config")
 
 		if !serverRunning {
-			errorDetails += fmt.Sprintf("\n- The server at %s appears to be unreachable. Make sure it's running.", serverURL)
-			errorDetails += "\n- Check your network connection and firewall settings"
+			errorDetails += "\n- " + message(lang, "tips.server_down", serverURL)
+			errorDetails += "\n- " + message(lang, "tips.network")
 		}
 
-		errorDetails += "\n- Check the server logs for more details"
+		errorDetails += "\n- " + message(lang, "tips.server_logs")
 	}
 
  // Get DLL configuration information
-	dllConfig := getDllConfigInfo(dllPath)
+	dllConfig := getDllConfigInfo(dll.path)
+
+	// A malformed or damaged output buffer fails the test even when the DLL reported success
+	if ret == 0 && parseErr != nil {
+		errorDetails = message(lang, "error.malformed_output", parseErr)
+		log.Printf("Test failed with error: %s", errorDetails)
+	}
+	if checksumError != nil {
+		errorDetails = message(lang, "error.checksum", checksumError)
+		log.Printf("Test failed with error: %s", errorDetails)
+	}
 
 	// Create result
-	result := TestResult{
-		Success:      ret == 0,
+	result = TestResult{
+		Success:      ret == 0 && parseErr == nil && checksumError == nil,
+		Profile:      profile.name,
+		Protocol:     int(version),
 		ReturnCode:   int(ret),
-		InputBuffer:  formatBufferForDisplay(inputBuffer),
-		OutputBuffer: formatBufferForDisplay(outputBuffer),
+		DurationMs:   durationMs,
+		InputBuffer:  formatBufferForDisplay(version, inputBuffer),
+		OutputBuffer: formatBufferForDisplay(version, outputBuffer),
 		Parameters:   paramMap,
-		Response:     outputParams["CFResp"],
+		Response:     escapeValue(outputParams["CFResp"]),
+		Output:       outputParams,
 		ErrorDetails: errorDetails,
 		DllConfig:    dllConfig,
+		Warnings:     warnings,
+		OutputError:  newBufferError(parseErr),
+		Exchanges:    exchanges,
+		Trace:        traceInfo,
+		CurlCommand:  curlCommand(dll.path, encoded),
+		input:        inputBuffer,
+		output:       outputBuffer,
+	}
+
+	if dll.note != "" {
+		result.Warnings = append(result.Warnings, dll.note)
+	}
+	if envWarning != "" {
+		result.Warnings = append(result.Warnings, envWarning)
+	}
+	if traceWarning != "" {
+		result.Warnings = append(result.Warnings, traceWarning)
+	}
+	if capturer, ok := dll.invoker.(outputCapturer); ok {
+		result.DllOutput = capturer.CallOutput()
+	}
+	if profile.snapshotModules() {
+		if lister, ok := dll.invoker.(moduleLister); ok {
+			result.Modules = snapshotModules(lister.CallModules())
+		} else if dll.note == "" {
+			result.Modules = snapshotModules(loadedModules())
+		}
 	}
 
 	// Log the result
-	if ret == 0 {
+	if result.Success {
 		log.Printf("Test succeeded")
 		if hasCFResp {
 			log.Printf("Response: %s", outputParams["CFResp"])
@@ -439,50 +792,31 @@ func callDLL(parameters []Parameter) TestResult {
 }
 
 // formatBufferForDisplay formats a buffer for display
-func formatBufferForDisplay(buffer []byte) string {
-	// Format header
-	if len(buffer) < HeaderSize {
-		return "Invalid buffer (too short)"
-	}
-
-	result := fmt.Sprintf("Header: %c%c (Number of parameters: %s)\n", 
-		buffer[0], buffer[1], string(buffer[:HeaderSize]))
+func formatBufferForDisplay(version buffer.Version, data []byte) string {
+	pairs, err := buffer.Decode(version, data)
 
-	// Parse number of parameters
-	numParamsStr := string(buffer[:HeaderSize])
-	numParams, err := strconv.Atoi(numParamsStr)
-	if err != nil {
-		return result + "Error parsing number of parameters"
+	// Format header, reporting exactly what was found if it cannot be read
+	if errors.Is(err, buffer.ErrBadHeader) {
+		return fmt.Sprintf("Invalid header: %v", err)
 	}
+	header := escapeValue(string(data[:version.HeaderLen()]))
+	result := fmt.Sprintf("Header: %s (Number of parameters: %s)\n", header, escapeValue(string(data[version.HeaderLen()-2:version.HeaderLen()])))
 
 	// Format parameters
-	for i := 0; i < numParams && HeaderSize+i*PairSize+PairSize <= len(buffer); i++ {
-		// Extract key and value
-		keyStart := HeaderSize + i*PairSize
-		valueStart := keyStart + KeySize
-
-		// Extract key (trim null characters)
-		key := string(buffer[keyStart : keyStart+KeySize])
-		key = strings.TrimRight(key, "\x00")
-
-		// Extract value (trim null characters)
-		value := string(buffer[valueStart : valueStart+ValueSize])
-		value = strings.TrimRight(value, "\x00")
-
-		result += fmt.Sprintf("Parameter %d: %s = %s\n", i+1, key, value)
+	for i, pair := range pairs {
+		if version == buffer.V2 {
+			result += fmt.Sprintf("Parameter %d: %s = %s (%d bytes)\n", i+1, escapeValue(pair.Key), escapeValue(pair.Value), len(pair.Value))
+		} else {
+			result += fmt.Sprintf("Parameter %d: %s = %s\n", i+1, escapeValue(pair.Key), escapeValue(pair.Value))
+		}
+	}
+	if err != nil {
+		result += fmt.Sprintf("Error: %v\n", err)
 	}
 
 	return result
 }
 
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // getDllConfigInfo reads and returns the DLL's configuration information
 func getDllConfigInfo(dllPath string) string {
 	var configInfo strings.Builder
@@ -495,14 +829,19 @@ func getDllConfigInfo(dllPath string) string {
 		configInfo.WriteString("DLL file not found!\n")
 		return configInfo.String()
 	}
+	if version, hash := identifyBuild(dllPath); hash != "" {
+		configInfo.WriteString(fmt.Sprintf("DLL SHA-256: %s\n", hash))
+		if version != "" {
+			configInfo.WriteString(fmt.Sprintf("DLL Version: %s\n", version))
+		}
+	}
 
 	// Determine if this is the runtime or static DLL
-	isRuntimeDLL := strings.Contains(strings.ToLower(dllPath), "customdll.dll") && 
-		!strings.Contains(strings.ToLower(dllPath), "static")
-	isStaticDLL := strings.Contains(strings.ToLower(dllPath), "customdllstatic.dll") || 
+	runtimeDLL := isRuntimeDLL(dllPath)
+	isStaticDLL := strings.Contains(strings.ToLower(dllPath), "customdllstatic") || 
 		strings.Contains(strings.ToLower(dllPath), "static")
 
-	if isRuntimeDLL {
+	if runtimeDLL {
 		configInfo.WriteString("DLL Type: Runtime (uses config.ini)\n")
 
 		// Check for config.ini
@@ -577,6 +916,18 @@ func getDllConfigInfo(dllPath string) string {
 	return configInfo.String()
 }
 
+// writable wraps a handler that runs ad-hoc calls or changes files, so that it is
+// refused in read-only mode
+func writable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly {
+			http.Error(w, "Forbidden: the simulator is in read-only mode", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // handleRoot handles requests to the root path
 func handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
@@ -659,6 +1010,9 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
         .error {
             color: red;
         }
+        .warning {
+            color: #b36b00;
+        }
         .error-details {
             margin: 10px 0;
             padding: 10px;
@@ -728,6 +1082,8 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 <body>
     <div class="container">
         <h1>OpenScape Contact Center Simulator</h1>
+        {{if .Simulate}}<p class="warning">Simulation mode: tests are answered with canned behaviors, no DLL is called.</p>{{end}}
+        {{if .ReadOnly}}<p class="warning">Read-only mode: only the stored suites can be run (POST /suites/run?name=...), and results viewed.</p>{{end}}
         <p>This simulator allows you to test the CustomDLL by simulating how OpenScape Contact Center would call it.</p>
 
         <div class="preset-buttons">
@@ -749,9 +1105,21 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
             <label for="testName">Test Name:</label>
             <input type="text" id="testName" placeholder="Enter a name for this test">
         </div>
+        <div class="form-group">
+            <label for="profile">DLL Profile:</label>
+            <select id="profile"></select>
+        </div>
+        <div class="form-group">
+            <label><input type="checkbox" id="fuzz"> Fuzz mode (corrupt the checksummed input buffer; the DLL must reject it)</label>
+        </div>
+        <div class="form-group">
+            <label for="maxDuration">Latency Budget (ms):</label>
+            <input type="number" id="maxDuration" min="0" placeholder="No budget">
+        </div>
 
         <div class="parameters">
             <h3>Parameters</h3>
+            <datalist id="parameterKeys"></datalist>
             <div id="parametersList"></div>
             <div class="add-parameter">
                 <button onclick="addParameter()">Add Parameter</button>
@@ -759,7 +1127,7 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
         </div>
 
         <div class="form-group" style="margin-top: 20px;">
-            <button onclick="runTest()">Run Test</button>
+            <button onclick="runTest()"{{if .ReadOnly}} disabled title="Disabled in read-only mode"{{end}}>Run Test</button>
         </div>
 
         <div id="result" class="result hidden">
@@ -773,6 +1141,8 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
         window.onload = function() {
             addParameter();
             addParameter();
+            loadProfiles();
+            loadDictionary();
 
             // Initialize the result div
             const resultDiv = document.getElementById('result');
@@ -788,6 +1158,83 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
             }
         };
 
+        // Load the DLL profiles into the profile selector
+        function loadProfiles() {
+            fetch('/profiles')
+            .then(response => response.json())
+            .then(profiles => {
+                const select = document.getElementById('profile');
+                // With routes, the profile can be left to the endpoint of the test
+                const routed = profiles.some(p => (p.endpoints || []).length > 0 || (p.tags || []).length > 0);
+                if (routed) {
+                    const option = document.createElement('option');
+                    option.value = '';
+                    option.textContent = 'automatic (routed by endpoint)';
+                    option.selected = true;
+                    select.appendChild(option);
+                }
+                for (const p of profiles) {
+                    const option = document.createElement('option');
+                    option.value = p.name;
+                    option.textContent = p.name + ' (protocol v' + p.protocol + ')';
+                    option.selected = !routed && p.name === 'default';
+                    select.appendChild(option);
+                }
+            });
+        }
+
+        // Fill a datalist with the suggestions of the autocomplete API
+        function suggest(list, query) {
+            fetch('/api/autocomplete?' + new URLSearchParams(query))
+            .then(response => response.json())
+            .then(data => {
+                list.innerHTML = '';
+                for (const s of data.suggestions) {
+                    const option = document.createElement('option');
+                    option.value = s.value;
+                    option.textContent = s.description || s.source;
+                    list.appendChild(option);
+                }
+            });
+        }
+
+        // Load the known parameter keys for autocompletion
+        function loadDictionary() {
+            suggest(document.getElementById('parameterKeys'), {});
+        }
+
+        // Value of the Endpoint parameter of the form, empty if there is none
+        function currentEndpoint() {
+            for (const div of document.getElementById('parametersList').children) {
+                const inputs = div.getElementsByTagName('input');
+                if (inputs[0].value === 'Endpoint') {
+                    return inputs[1].value;
+                }
+            }
+            return '';
+        }
+
+        // Offer the keys the endpoint uses, and the catalog values, recent values and
+        // examples of the selected key, fetched when a field gets the focus
+        let valueLists = 0;
+        function autocomplete(keyInput, valueInput) {
+            const keys = document.getElementById('parameterKeys');
+            keyInput.setAttribute('list', 'parameterKeys');
+            keyInput.addEventListener('focus', function() {
+                suggest(keys, {endpoint: currentEndpoint()});
+            });
+
+            const values = document.createElement('datalist');
+            values.id = 'parameterValues-' + (++valueLists);
+            keys.parentNode.appendChild(values);
+            valueInput.setAttribute('list', values.id);
+            valueInput.addEventListener('focus', function() {
+                if (keyInput.value) {
+                    suggest(values, {key: keyInput.value});
+                }
+            });
+        }
+
         // Add a parameter input
         function addParameter() {
             const parametersList = document.getElementById('parametersList');
@@ -812,6 +1259,7 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
                 parametersList.removeChild(paramDiv);
             };
 
+            autocomplete(keyInput, valueInput);
             paramDiv.appendChild(keyInput);
             paramDiv.appendChild(valueInput);
             paramDiv.appendChild(removeButton);
@@ -894,6 +1342,7 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
                     parametersList.removeChild(paramDiv);
                 };
 
+                autocomplete(keyInput, valueInput);
                 paramDiv.appendChild(keyInput);
                 paramDiv.appendChild(valueInput);
                 paramDiv.appendChild(removeButton);
@@ -968,10 +1417,9 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 
                     html += '<h4>Troubleshooting Tips:</h4>';
                     html += '<ul>';
-                    html += '<li>Make sure the server is running</li>';
-                    html += '<li>Check your network connection</li>';
-                    html += '<li>Verify the server URL in config.ini</li>';
-                    html += '<li>Check firewall settings</li>';
+                    for (const tip of (result.tips || [])) {
+                        html += '<li>' + escapeHtml(tip) + '</li>';
+                    }
                     html += '</ul>';
                 }
 
@@ -983,6 +1431,13 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
             });
         }
 
+        // escapeHtml escapes text for display, such as the DLL's own output
+        function escapeHtml(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
         function runTest() {
             const testName = document.getElementById('testName').value || 'Unnamed Test';
             const parametersList = document.getElementById('parametersList');
@@ -1005,7 +1460,10 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
             // Create test case
             const testCase = {
                 name: testName,
-                parameters: parameters
+                profile: document.getElementById('profile').value,
+                parameters: parameters,
+                fuzz: document.getElementById('fuzz').checked,
+                maxDurationMs: Number(document.getElementById('maxDuration').value) || 0
             };
 
             // Send to server
@@ -1039,6 +1497,84 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
                     }
                 }
 
+                // Add the location of a malformed output buffer
+                if (result.outputError) {
+                    html += '<p class="error">Malformed output buffer (' + result.outputError.kind + '): pair ' +
+                        result.outputError.pair + ', offset ' + result.outputError.offset + '</p>';
+                    if (result.outputError.head) {
+                        html += '<p class="error">First bytes: ' + result.outputError.head;
+                        if (result.outputError.expectedSize) {
+                            html += ' (expected ' + result.outputError.expectedSize + ' bytes, buffer is ' + result.outputError.actualSize + ')';
+                        }
+                        html += '</p>';
+                    }
+                }
+
+                // Add warnings, such as truncated output values
+                if (result.warnings) {
+                    for (const warning of result.warnings) {
+                        html += '<p class="warning">Warning: ' + warning + '</p>';
+                    }
+                }
+
+                html += '<p>DLL profile: ' + result.profile + ' (buffer protocol v' + result.protocol + ')</p>';
+                html += '<p>Duration: ' + result.durationMs + ' ms' +
+                    (result.maxDurationMs ? ' (budget ' + result.maxDurationMs + ' ms)' : '') + '</p>';
+
+                // Add the DLL's requests to the backend, recorded by the intercepting proxy
+                if (result.exchanges) {
+                    html += '<h3>Backend Traffic</h3>';
+                    for (const exchange of result.exchanges) {
+                        const status = exchange.error ? 'error: ' + exchange.error : exchange.statusCode;
+                        html += '<p><strong>' + exchange.method + '</strong> ' + escapeHtml(exchange.url) +
+                            ' &rarr; ' + escapeHtml(String(status)) + ' (' + exchange.durationMs + ' ms)</p>';
+                        if (exchange.requestBody) {
+                            html += '<pre>' + escapeHtml(exchange.requestBody) + '</pre>';
+                        }
+                        if (exchange.responseBody) {
+                            html += '<pre>' + escapeHtml(exchange.responseBody) + '</pre>';
+                        }
+                    }
+                }
+
+                // Offer a bundle reproducing a failed call outside the simulator
+                if (!result.success && result.runId) {
+                    html += '<p><a href="/runs/repro?id=' + encodeURIComponent(result.runId) + '">Download reproduction script</a> (for the DLL vendor)</p>';
+                }
+
+                // Add the curl command reproducing the DLL's request to the backend
+                if (result.curlCommand) {
+                    html += '<h3>Backend Request (curl)</h3>';
+                    html += '<pre>' + escapeHtml(result.curlCommand) + '</pre>';
+                }
+
+                // Add what the DLL printed during the call
+                if (result.dllOutput) {
+                    html += '<h3>DLL Output</h3>';
+                    html += '<pre>' + escapeHtml(result.dllOutput) + '</pre>';
+                }
+
+                // Add the modules loaded with the DLL
+                if (result.modules && result.modules.length > 0) {
+                    html += '<h3>Loaded Modules</h3>';
+                    html += '<details><summary>' + result.modules.length + ' modules</summary><table><tr><th>Name</th><th>Version</th><th>Path</th></tr>';
+                    for (const m of result.modules) {
+                        html += '<tr><td>' + escapeHtml(m.name) + '</td><td>' + escapeHtml(m.version || '') + '</td><td>' + escapeHtml(m.path) + '</td></tr>';
+                    }
+                    html += '</table></details>';
+                }
+
+                // Link the ETW trace of the call
+                if (result.trace) {
+                    html += '<h3>ETW Trace</h3>';
+                    const lost = result.trace.eventsLost ? ' (' + result.trace.eventsLost + ' events lost)' : '';
+                    if (result.trace.file.startsWith('/runs/')) {
+                        html += '<p><a href="' + result.trace.file + '">Download trace.etl</a>' + lost + ' (open in Windows Performance Analyzer)</p>';
+                    } else {
+                        html += '<p>' + escapeHtml(result.trace.file) + lost + '</p>';
+                    }
+                }
+
                 // Add parameters
                 html += '<h3>Parameters</h3>';
                 html += '<ul>';
@@ -1085,7 +1621,7 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 </html>
 `))
 
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, struct{ Simulate, ReadOnly bool }{simulate, readOnly})
 }
 
 // handleRunTest handles requests to run a test
@@ -1104,8 +1640,16 @@ func handleRunTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Call DLL
-	result := callDLL(testCase.Parameters)
+	// Call the DLL of the selected or routed profile
+	profile, err := profileFor(testCase)
+	if err == nil {
+		err = checkCaseEnv(testCase)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := callWithHooks(profile, testCase, requestLanguage(r), nil, 0, nil)
 
 	// Return result as JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -1123,11 +1667,49 @@ func handleDllConfig(w http.ResponseWriter, r *http.Request) {
 	// Get DLL configuration
 	dllConfig := getDllConfigInfo(dllPath)
 
+	// Add the libraries the DLL depends on, with their versions, as mismatched
+	// libcurl or OpenSSL builds break the DLL on some machines
+	var config strings.Builder
+	config.WriteString(dllConfig)
+	deps, err := inspectDependencies(dllPath)
+	if err != nil {
+		fmt.Fprintf(&config, "\nDependencies: cannot be inspected: %v\n", err)
+	} else {
+		config.WriteString("\nDependencies:\n")
+		writeDependencies(&config, deps)
+	}
+
+	// Add the signer of the DLL, so a build from an unknown source stands out
+	signature := inspectSignature(dllPath)
+	fmt.Fprintf(&config, "\nSignature: %s\n", signature.Status)
+	if signature.Subject != "" {
+		fmt.Fprintf(&config, "  Signer: %s\n  Issuer: %s\n  Serial: %s\n  Valid: %s to %s\n  Thumbprint: %s\n",
+			signature.Subject, signature.Issuer, signature.Serial,
+			signature.NotBefore.Format("2006-01-02"), signature.NotAfter.Format("2006-01-02"), signature.Thumbprint)
+	}
+
 	// Return result as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"dllConfig": dllConfig,
-	})
+	json.NewEncoder(w).Encode(struct {
+		DllConfig    string           `json:"dllConfig"`
+		Dependencies []DependencyInfo `json:"dependencies"`
+		Signature    SignatureInfo    `json:"signature"`
+	}{config.String(), deps, signature})
+}
+
+// Header marking the simulator's own server connection tests, which the mock
+// backend of hermetic runs does not count as DLL requests
+const probeHeader = "X-Simulator-Probe"
+
+// newProbeRequest creates a server connection test request
+func newProbeRequest(serverURL string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, serverURL, nil)
+	if err != nil {
+		// Invalid URLs fail when the request is sent
+		return &http.Request{Method: http.MethodGet, URL: &url.URL{Opaque: serverURL}, Header: http.Header{}}
+	}
+	req.Header.Set(probeHeader, "1")
+	return req
 }
 
 // ServerConnectionResult represents the result of a server connection test
@@ -1139,6 +1721,8 @@ type ServerConnectionResult struct {
 	Error        string `json:"error,omitempty"`
 	IsHTTPS      bool   `json:"isHttps"`
 	SSLVerified  bool   `json:"sslVerified,omitempty"`
+	// Tips are troubleshooting tips for a failed connection, in the request's language
+	Tips []string `json:"tips,omitempty"`
 }
 
 // handleServerConnection handles requests to check server connection
@@ -1150,10 +1734,10 @@ func handleServerConnection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Determine server URL
-	serverURL := "http://localhost:8080"
+	serverURL := config.DefaultServerURL
 
 	// Try to determine the server URL from config.ini if using runtime DLL
-	if strings.Contains(strings.ToLower(dllPath), "customdll.dll") && !strings.Contains(strings.ToLower(dllPath), "static") {
+	if isRuntimeDLL(dllPath) {
 		configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
 		if _, err := os.Stat(configPath); err == nil {
 			// Read the config.ini file to get the server URL
@@ -1188,7 +1772,7 @@ func handleServerConnection(w http.ResponseWriter, r *http.Request) {
 		result.SSLVerified = true
 
 		// Check config.ini for verify_ssl setting
-		if strings.Contains(strings.ToLower(dllPath), "customdll.dll") && !strings.Contains(strings.ToLower(dllPath), "static") {
+		if isRuntimeDLL(dllPath) {
 			configPath := filepath.Join(filepath.Dir(dllPath), "config.ini")
 			if _, err := os.Stat(configPath); err == nil {
 				// Read the config.ini file to get the verify_ssl setting
@@ -1218,12 +1802,16 @@ func handleServerConnection(w http.ResponseWriter, r *http.Request) {
 	client := http.Client{
 		Timeout: 5 * time.Second,
 	}
-	resp, err := client.Get(serverURL)
+	resp, err := client.Do(newProbeRequest(serverURL))
 
 	if err != nil {
 		// Connection failed
 		result.Success = false
 		result.Error = err.Error()
+		lang := requestLanguage(r)
+		for _, key := range []string{"tips.connection.running", "tips.connection.network", "tips.connection.base_url", "tips.connection.firewall"} {
+			result.Tips = append(result.Tips, message(lang, key))
+		}
 		log.Printf("Server connection test failed: %v", err)
 	} else {
 		// Connection successful
@@ -1241,11 +1829,101 @@ func handleServerConnection(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "bench-compare":
+			os.Exit(runBenchCompare(os.Args[2:]))
+		case "soak":
+			os.Exit(runSoak(os.Args[2:]))
+		case "capacity":
+			os.Exit(runCapacity(os.Args[2:]))
+		case "hermetic":
+			os.Exit(runHermetic(os.Args[2:]))
+		case "gen-tests":
+			os.Exit(runGenTests(os.Args[2:]))
+		case "mutate":
+			os.Exit(runMutate(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "worker":
+			os.Exit(runWorker(os.Args[2:]))
+		}
+	}
+
 	// Parse command line flags
 	port := flag.Int("port", DefaultPort, "Port to listen on")
 	dllPathFlag := flag.String("dll", DefaultDllPath, "Path to the DLL")
 	useStaticDll := flag.Bool("static", false, "Use the static DLL instead of the runtime DLL")
-	flag.Parse()
+	usersFile := flag.String("users", "", "JSON users file enabling role-based access control (admin, operator, viewer)")
+	flag.BoolVar(&simulate, "simulate", false, "Simulation-only demo mode: answer tests with canned behaviors instead of calling DLLs")
+	flag.BoolVar(&intercept, "intercept", false, "Record the DLL's requests to the backend through a local proxy, pointing the base_url of config.ini at it while the simulator runs")
+	flag.IntVar(&loadRetries, "load-retries", DefaultLoadRetries, "Retries of a DLL load failing with a network error, such as a DLL on an unreachable share")
+	flag.DurationVar(&loadBackoff, "load-backoff", DefaultLoadBackoff, "Delay before the first retry of a DLL load, doubled for each further retry")
+	flag.BoolVar(&verifySignature, "verify-signature", false, "Check the Authenticode signature of each DLL before loading it, warning if it is not trusted")
+	flag.BoolVar(&requireSignature, "require-signature", false, "Refuse to load DLLs without a trusted Authenticode signature")
+	flag.StringVar(&defaultLanguage, "lang", DefaultLanguage, "Language of error explanations and troubleshooting tips for requests without a lang parameter or a supported Accept-Language (en, ro)")
+	flag.BoolVar(&readOnly, "read-only", false, "Read-only mode for external access: only the stored suites can be run and results viewed; ad-hoc tests, suite changes and config file access are refused")
+	flag.BoolVar(&isolate, "isolate", false, "Call the DLL of every profile in a worker process that is restarted if the DLL crashes")
+	flag.BoolVar(&moduleSnapshots, "modules", false, "Attach the modules loaded in the process hosting the DLL, with their versions, to every result")
+	flag.BoolVar(&etwTracing, "etw", false, "Record the network and loader events of the process hosting the DLL in an ETW trace around every call, stored with the run (Windows, needs administrator rights)")
+	profilesFile := flag.String("profiles", "", "JSON file defining DLL profiles (DLL path and buffer protocol version) selectable per test")
+	flag.StringVar(&suitesDir, "suites", DefaultSuitesDir, "Directory of the test suites")
+	dictionaryFile := flag.String("dictionary", "", "JSON file adding or replacing parameter dictionary definitions")
+	runsDir := flag.String("runs", DefaultRunsDir, "Directory storing the artifacts of each test run (empty to disable)")
+	queueDir := flag.String("queue", "", "Directory of the durable queue of submitted suite runs, resumed after a restart (empty to disable)")
+	callSpec := flag.String("call", "", `Perform one DLL call with the given parameters, such as "Endpoint=getInfo,CFResp=yes,ID=123", print the result and exit`)
+	callProfile := flag.String("profile", "", "DLL profile of -call (default profile if empty)")
+	stdinMode := flag.Bool("stdin", false, "Read test cases as JSON objects (the /run-test format) from standard input and write each result to standard output, then exit")
+	tuiMode := flag.Bool("tui", false, "Run the terminal interface instead of the web interface, for consoles without a browser")
+	hooksFile := flag.String("hooks", "", "JSON file of shell commands run before and after each DLL call (pre_call, post_call) and suite run (pre_suite, post_suite)")
+	flag.DurationVar(&hookTimeout, "hook-timeout", DefaultHookTimeout, "Time a hook command may take before it is killed")
+	validatorsFile := flag.String("validators", "", "JSON file of validator commands that check each test result for custom rules")
+	flag.DurationVar(&validatorTimeout, "validator-timeout", DefaultValidatorTimeout, "Time a validator may take to check a result before it is killed")
+	outputFormat := flag.String("output", "", "Output format of -call and -stdin: json (one object per line), table or quiet (exit code only); default table for -call, json for -stdin")
+	settings := config.New(flag.CommandLine, "CCSIM")
+	settings.Check("port", config.IntRange(1, 65535))
+	settings.Check("load-retries", config.IntRange(0, 100))
+	settings.Check("load-backoff", config.MinDuration(0))
+	settings.Check("hook-timeout", config.MinDuration(time.Millisecond))
+	settings.Check("validator-timeout", config.MinDuration(time.Millisecond))
+	settings.Check("lang", checkLanguage)
+	settings.Check("output", config.OneOf("", OutputJSON, OutputTable, OutputQuiet))
+	err := settings.Parse(os.Args[1:])
+	cliMode = *callSpec != "" || *stdinMode
+	if err != nil {
+		fatalf(ExitConfig, "Invalid configuration: %v", err)
+	}
+
+	var callParameters []Parameter
+	if *callSpec != "" {
+		var err error
+		if callParameters, err = parseCallParameters(*callSpec); err != nil {
+			fatalf(ExitConfig, "Invalid -call option: %v", err)
+		}
+	}
+	if *outputFormat == "" {
+		*outputFormat = OutputTable
+		if *stdinMode {
+			*outputFormat = OutputJSON
+		}
+	}
+	out, err := newResultWriter(*outputFormat, os.Stdout)
+	if err != nil {
+		fatalf(ExitConfig, "Invalid -output option: %v", err)
+	}
+
+	// Load users for role-based access control
+	var users *auth.Users
+	if *usersFile != "" {
+		var err error
+		users, err = auth.LoadUsers(*usersFile, "Contact Center Simulator")
+		if err != nil {
+			fatalf(ExitConfig, "Failed to load users: %v", err)
+		}
+	}
 
 	// Set DLL path based on flags
 	if *useStaticDll {
@@ -1259,37 +1937,159 @@ func main() {
 	}
 
 	// Resolve DLL path if it's relative
-	if !filepath.IsAbs(dllPath) {
-		// Get executable directory
-		exePath, err := os.Executable()
-		if err == nil {
-			exeDir := filepath.Dir(exePath)
-			dllPath = filepath.Join(exeDir, dllPath)
+	dllPath = resolveDllPath(dllPath)
+
+	// Load the parameter dictionary
+	if *dictionaryFile != "" {
+		if err := loadDictionary(*dictionaryFile); err != nil {
+			fatalf(ExitConfig, "Failed to load parameter dictionary: %v", err)
 		}
 	}
 
-	// Load DLL
-	err := loadDLL(dllPath)
-	if err != nil {
-		log.Fatalf("Failed to load DLL: %v", err)
+	// Load the hooks run around calls and suites
+	if *hooksFile != "" {
+		if err := loadHooks(*hooksFile); err != nil {
+			fatalf(ExitConfig, "Failed to load hooks: %v", err)
+		}
+	}
+
+	// Load the validators checking each result
+	if *validatorsFile != "" {
+		if err := loadValidators(*validatorsFile); err != nil {
+			fatalf(ExitConfig, "Failed to load validators: %v", err)
+		}
+	}
+
+	// Store the artifacts of each run
+	if *runsDir != "" {
+		var err error
+		runs, err = newRunStore(*runsDir)
+		if err != nil {
+			fatalf(ExitConfig, "Failed to set up run storage: %v", err)
+		}
+		if err := results.load(runs); err != nil {
+			fatalf(ExitConfig, "Failed to index stored results: %v", err)
+		}
+		series = newTimeSeries(*runsDir)
 	}
-	defer unloadDLL()
 
-	log.Printf("DLL loaded successfully: %s", dllPath)
+	// Record edits made to the suite files while the simulator was stopped
+	recordSuiteVersions()
+
+	// Open the queue of suite runs, with the runs left from before a restart
+	if *queueDir != "" {
+		var err error
+		if queue, err = openQueue(*queueDir); err != nil {
+			fatalf(ExitConfig, "Failed to open the queue: %v", err)
+		}
+	}
 
-	// Register handlers
-	http.HandleFunc("/", handleRoot)
-	http.HandleFunc("/run-test", handleRunTest)
-	http.HandleFunc("/debug/dll-config", handleDllConfig)
-	http.HandleFunc("/debug/server-connection", handleServerConnection)
+	// Load the DLL profiles
+	if err := loadProfiles(*profilesFile, dllPath); err != nil {
+		fatalf(ExitConfig, "Failed to load profiles: %v", err)
+	}
+
+	// Load the DLL of every profile
+	for _, name := range profileNames() {
+		p := profiles[name]
+		d, err := loadDLL(p)
+		if err != nil {
+			fatalf(ExitDLLLoad, "Failed to load DLL for profile '%s': %v", name, err)
+		}
+		if d.note != "" {
+			log.Printf("Profile '%s' (buffer protocol v%d): %s", name, p.Protocol, d.note)
+		} else {
+			log.Printf("DLL loaded successfully for profile '%s': %s (buffer protocol v%d)", name, p.DLL, p.Protocol)
+		}
+	}
+	defer unloadDLLs()
+
+	// Perform the single call of -call or the test cases of -stdin, or run the
+	// terminal interface, and exit without the web interface
+	if cliMode || *tuiMode {
+		var code int
+		switch {
+		case *stdinMode:
+			code = runStdin(os.Stdin, out)
+		case callParameters != nil:
+			code = runCall(callParameters, *callProfile, out)
+		default:
+			code = runTUI(os.Stdin, os.Stdout)
+		}
+		unloadDLLs()
+		stopInterceptors()
+		if series != nil {
+			series.close()
+		}
+		os.Exit(code)
+	}
+
+	// Register handlers (viewers see the UI and diagnostics, operators run tests;
+	// in read-only mode only the stored suites run)
+	http.HandleFunc("/", users.Require(auth.Viewer, handleRoot))
+	http.HandleFunc("/run-test", users.Require(auth.Operator, writable(handleRunTest)))
+	http.HandleFunc("/profiles", users.Require(auth.Viewer, handleProfiles))
+	http.HandleFunc("/runs", users.Require(auth.Viewer, handleRuns))
+	http.HandleFunc("/runs/artifact", users.Require(auth.Viewer, handleRunArtifact))
+	http.HandleFunc("/runs/repro", users.Require(auth.Viewer, handleRunRepro))
+	http.HandleFunc("/api/results", users.Require(auth.Viewer, handleResults))
+	http.HandleFunc("/api/timeseries", users.Require(auth.Viewer, handleTimeSeries))
+	http.HandleFunc("/api/trends", users.Require(auth.Viewer, handleTrends))
+	http.HandleFunc("/api/timeseries/grafana/", users.Require(auth.Viewer, handleGrafana))
+	http.HandleFunc("/api/parameters", users.Require(auth.Viewer, handleParameters))
+	http.HandleFunc("/api/autocomplete", users.Require(auth.Viewer, handleAutocomplete))
+	http.HandleFunc("/suites", users.Require(auth.Viewer, handleSuites))
+	http.HandleFunc("/suites/export", users.Require(auth.Viewer, handleSuiteExport))
+	http.HandleFunc("/suites/import", users.Require(auth.Operator, writable(handleSuiteImport)))
+	http.HandleFunc("/suites/save", users.Require(auth.Operator, writable(handleSuiteSave)))
+	http.HandleFunc("/suites/history", users.Require(auth.Viewer, handleSuiteHistory))
+	http.HandleFunc("/suites/run", users.Require(auth.Operator, handleSuiteRun))
+	http.HandleFunc("/queue", users.Require(auth.Viewer, handleQueue))
+	http.HandleFunc("/queue/submit", users.Require(auth.Operator, handleQueueSubmit))
+	http.HandleFunc("/queue/cancel", users.Require(auth.Operator, handleQueueCancel))
+	http.HandleFunc("/debug/dll-config", users.Require(auth.Viewer, handleDllConfig))
+	http.HandleFunc("/debug/config-diff", users.Require(auth.Operator, writable(handleConfigDiff)))
+	http.HandleFunc("/debug/server-connection", users.Require(auth.Operator, handleServerConnection))
+
+	if readOnly {
+		log.Printf("Read-only mode: ad-hoc tests, suite changes and config file access are disabled")
+	}
 
 	// Log available debugging tools
 	log.Printf("Debugging tools available at:")
 	log.Printf("  - /debug/dll-config - View DLL configuration")
+	log.Printf("  - /debug/config-diff - Compare config.ini files")
 	log.Printf("  - /debug/server-connection - Test server connection")
 
-	// Start server
+	// Start server, until interrupted (Ctrl+C), so config.ini files rewritten for
+	// -intercept are restored
 	addr := fmt.Sprintf(":%d", *port)
+	server := &http.Server{Addr: addr}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	if series != nil {
+		go series.run(ctx)
+	}
+	if queue != nil {
+		go queue.work(ctx)
+	}
+	for _, setting := range settings.Settings() {
+		if setting.Source == config.SourceEnv || setting.Source == config.SourceFile {
+			log.Printf("Setting -%s = %s (from %s)", setting.Name, setting.Value, setting.Source)
+		}
+	}
 	log.Printf("Starting Contact Center Simulator on http://localhost%s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		stopInterceptors()
+		log.Fatal(err)
+	}
+	log.Printf("Stopping Contact Center Simulator")
+	stopInterceptors()
+	if series != nil {
+		series.close()
+	}
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Calls log their parameters and results
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Scripted behaviors of the fake profiles of the tests
+var testBehaviors = map[string]FakeBehavior{
+	"getInfo": {
+		Output:  map[string]string{"CFResp": "Info for ID={ID}"},
+		Require: []string{"ID"},
+	},
+	FakeDefaultEndpoint: {
+		ReturnCode: 5,
+		LastError:  "HTTP error: received status code 404",
+	},
+}
+
+// useFakeProfiles replaces the profiles for the duration of a test with profiles
+// calling the fake invoker with testBehaviors
+func useFakeProfiles(t *testing.T, config map[string]*DLLProfile) {
+	t.Helper()
+	data, err := json.Marshal(testBehaviors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := filepath.Join(t.TempDir(), "fake.json")
+	if err := os.WriteFile(fake, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	savedProfiles, savedTags, savedEndpoints := profiles, tagRoutes, endpointRoutes
+	profiles = make(map[string]*DLLProfile)
+	tagRoutes, endpointRoutes = make(map[string]string), make(map[string]string)
+	t.Cleanup(func() {
+		unloadDLLs()
+		profiles, tagRoutes, endpointRoutes = savedProfiles, savedTags, savedEndpoints
+	})
+
+	for name, p := range config {
+		p.Fake = fake
+		if err := p.prepare(name, "CustomDLL.dll"); err != nil {
+			t.Fatal(err)
+		}
+		profiles[name] = p
+	}
+	if err := addRoutes(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// postTestCase posts a test case to the run-test handler
+func postTestCase(t *testing.T, testCase TestCase) (int, TestResult, string) {
+	t.Helper()
+	body, _ := json.Marshal(testCase)
+	w := httptest.NewRecorder()
+	handleRunTest(w, httptest.NewRequest(http.MethodPost, "/run-test", bytes.NewReader(body)))
+
+	var result TestResult
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("invalid result %s: %v", w.Body, err)
+		}
+	}
+	return w.Code, result, w.Body.String()
+}
+
+func TestHandleRunTest(t *testing.T) {
+	useFakeProfiles(t, map[string]*DLLProfile{
+		DefaultProfileName: {},
+		"v2":               {Protocol: 2, Checksum: true},
+	})
+
+	tests := []struct {
+		name       string
+		testCase   TestCase
+		success    bool
+		returnCode int
+		// response is a part of the response or of the error details
+		response string
+	}{
+		{"success", TestCase{Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", "42"}, {"CFResp", "yes"}}},
+			true, 0, "Info for ID=42"},
+		{"protocol 2 with checksum", TestCase{Profile: "v2", Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", "7"}, {"CFResp", "yes"}}},
+			true, 0, "Info for ID=7"},
+		{"missing required parameter", TestCase{Parameters: []Parameter{{"Endpoint", "getInfo"}}},
+			false, 1, "ID"},
+		{"DLL error", TestCase{Parameters: []Parameter{{"Endpoint", "unknown"}}},
+			false, 5, "received status code 404"},
+		{"expected error", TestCase{Parameters: []Parameter{{"Endpoint", "unknown"}}, ExpectError: true},
+			true, 5, "received status code 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, result, body := postTestCase(t, tt.testCase)
+			if code != http.StatusOK {
+				t.Fatalf("status %d: %s", code, body)
+			}
+			if result.Success != tt.success || result.ReturnCode != tt.returnCode {
+				t.Errorf("success %v, return code %d; want %v, %d (%s)", result.Success, result.ReturnCode, tt.success, tt.returnCode, body)
+			}
+			if !strings.Contains(result.Response+result.ErrorDetails, tt.response) {
+				t.Errorf("response %q, error details %q; want %q", result.Response, result.ErrorDetails, tt.response)
+			}
+			if len(result.Warnings) == 0 || !strings.HasPrefix(result.Warnings[len(result.Warnings)-1], "Fake invoker:") {
+				t.Errorf("warnings %q do not mention the fake invoker", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestHandleRunTestRouting(t *testing.T) {
+	useFakeProfiles(t, map[string]*DLLProfile{
+		DefaultProfileName: {},
+		"info":             {Endpoints: []string{"getInfo"}},
+		"tagged":           {Tags: []string{"smoke"}},
+	})
+
+	tests := []struct {
+		name     string
+		testCase TestCase
+		profile  string
+	}{
+		{"default", TestCase{Parameters: []Parameter{{"Endpoint", "other"}}}, DefaultProfileName},
+		{"endpoint", TestCase{Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", "1"}}}, "info"},
+		{"tag over endpoint", TestCase{Tags: []string{"smoke"}, Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", "1"}}}, "tagged"},
+		{"selected", TestCase{Profile: "tagged", Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", "1"}}}, "tagged"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, result, body := postTestCase(t, tt.testCase)
+			if code != http.StatusOK || result.Profile != tt.profile {
+				t.Errorf("status %d, profile %q; want profile %q (%s)", code, result.Profile, tt.profile, body)
+			}
+		})
+	}
+}
+
+func TestHandleRunTestErrors(t *testing.T) {
+	useFakeProfiles(t, map[string]*DLLProfile{DefaultProfileName: {Env: map[string]string{"HTTPS_PROXY": ""}}})
+
+	code, _, body := postTestCase(t, TestCase{Profile: "missing"})
+	if code != http.StatusBadRequest || !strings.Contains(body, "unknown DLL profile 'missing'") {
+		t.Errorf("unknown profile: status %d: %s", code, body)
+	}
+
+	code, _, body = postTestCase(t, TestCase{Env: map[string]string{"LD_PRELOAD": "/tmp/evil.so"}})
+	if code != http.StatusBadRequest || !strings.Contains(body, "LD_PRELOAD") {
+		t.Errorf("undeclared environment variable: status %d: %s", code, body)
+	}
+	if code, _, body = postTestCase(t, TestCase{Env: map[string]string{"HTTPS_PROXY": "http://proxy:3128"}}); code != http.StatusOK {
+		t.Errorf("declared environment variable: status %d: %s", code, body)
+	}
+
+	w := httptest.NewRecorder()
+	handleRunTest(w, httptest.NewRequest(http.MethodPost, "/run-test", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleRunTest(w, httptest.NewRequest(http.MethodGet, "/run-test", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", w.Code)
+	}
+}
+
+func TestHandleProfiles(t *testing.T) {
+	useFakeProfiles(t, map[string]*DLLProfile{
+		DefaultProfileName: {},
+		"v2":               {Protocol: 2},
+	})
+
+	w := httptest.NewRecorder()
+	handleProfiles(w, httptest.NewRequest(http.MethodGet, "/profiles", nil))
+	var list []ProfileInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid profiles %s: %v", w.Body, err)
+	}
+	if len(list) != 2 || list[0].Name != DefaultProfileName || list[1].Name != "v2" || list[1].Protocol != 2 {
+		t.Fatalf("profiles = %+v", list)
+	}
+	for _, p := range list {
+		if p.Fake == "" || p.Isolate {
+			t.Errorf("profile %s: fake %q, isolate %v", p.Name, p.Fake, p.Isolate)
+		}
+	}
+}
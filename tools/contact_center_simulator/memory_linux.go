@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processMemory returns the resident memory of the simulator process, which hosts
+// the DLL, in bytes
+func processMemory() (uint64, bool) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * uint64(os.Getpagesize()), true
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package main
+
+// processMemory is not available on this platform
+func processMemory() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is the language of error explanations and troubleshooting tips
+// when a request asks for none of the catalog's languages
+const DefaultLanguage = "en"
+
+// defaultLanguage is the language of requests without one and of the command-line
+// tools (-lang)
+var defaultLanguage = DefaultLanguage
+
+// messageCatalog holds the user-facing texts of the simulator per language, as
+// fmt formats. Most testers and the people reading the results are Romanian-speaking
+// contact-center staff, so every text has a Romanian translation. Texts missing from
+// a language fall back to English.
+var messageCatalog = map[string]map[string]string{
+	"en": {
+		"error.code":               "DLL function returned error code: %d (%s)",
+		"error.dll_message":        "Detailed error message: %s",
+		"error.missing_endpoint":   "Missing 'Endpoint' parameter which is required",
+		"error.missing_params":     "Missing required parameters for endpoint '%s': %s",
+		"error.missing_id":         "Missing required parameter 'ID' for endpoint '%s'",
+		"error.invalid_endpoint":   "Invalid endpoint: '%s'. Valid endpoints are: %s",
+		"error.dll_not_found":      "DLL file not found at path: %s",
+		"error.config_not_found":   "Warning: config.ini not found at path: %s",
+		"error.system":             "System error: %d",
+		"error.server_unreachable": "Could not connect to server at %s: %v",
+		"error.malformed_output":   "The DLL returned success but wrote a malformed output buffer: %v",
+		"error.checksum":           "Output buffer checksum verification failed: %v",
+		"error.latency_budget":     "LATENCY BUDGET EXCEEDED: the DLL call took %.1f ms, %.1f ms (%.0f%%) over the budget of %g ms",
+		"error.validator":          "Validator '%s' rejected the result: %s",
+		"error.validator_broken":   "Validator '%s' could not check the result: %v",
+		"error.snapshot":           "Output differs from the snapshot:\n  %s",
+		"error.expected_error":     "The test expects an error, but the DLL returned success",
+		"tips.title":               "Troubleshooting tips:",
+		"tips.dll_exists":          "Make sure the DLL file exists and is accessible",
+		"tips.parameters":          "Check that all required parameters are provided",
+		"tips.endpoint":            "Verify that the endpoint name is correct",
+		"tips.config":              "If using the runtime DLL, ensure config.ini exists in the same directory",
+		"tips.server_down":         "The server at %s appears to be unreachable. Make sure it's running.",
+		"tips.network":             "Check your network connection and firewall settings",
+		"tips.server_logs":         "Check the server logs for more details",
+		"tips.connection.running":  "Make sure the server is running",
+		"tips.connection.network":  "Check your network connection",
+		"tips.connection.base_url": "Verify the server URL in config.ini",
+		"tips.connection.firewall": "Check firewall settings",
+	},
+	"ro": {
+		"error.code":               "Funcția DLL a returnat codul de eroare: %d (%s)",
+		"error.dll_message":        "Mesajul de eroare detaliat: %s",
+		"error.missing_endpoint":   "Lipsește parametrul obligatoriu 'Endpoint'",
+		"error.missing_params":     "Lipsesc parametrii obligatorii pentru endpoint-ul '%s': %s",
+		"error.missing_id":         "Lipsește parametrul obligatoriu 'ID' pentru endpoint-ul '%s'",
+		"error.invalid_endpoint":   "Endpoint invalid: '%s'. Endpoint-urile valide sunt: %s",
+		"error.dll_not_found":      "Fișierul DLL nu a fost găsit la calea: %s",
+		"error.config_not_found":   "Atenție: config.ini nu a fost găsit la calea: %s",
+		"error.system":             "Eroare de sistem: %d",
+		"error.server_unreachable": "Nu s-a putut realiza conexiunea la serverul %s: %v",
+		"error.malformed_output":   "DLL-ul a raportat succes, dar a scris un buffer de ieșire invalid: %v",
+		"error.checksum":           "Verificarea sumei de control a bufferului de ieșire a eșuat: %v",
+		"error.latency_budget":     "BUGETUL DE LATENȚĂ A FOST DEPĂȘIT: apelul DLL a durat %.1f ms, cu %.1f ms (%.0f%%) peste bugetul de %g ms",
+		"error.validator":          "Validatorul '%s' a respins rezultatul: %s",
+		"error.validator_broken":   "Validatorul '%s' nu a putut verifica rezultatul: %v",
+		"error.snapshot":           "Ieșirea diferă de snapshot:\n  %s",
+		"error.expected_error":     "Testul așteaptă o eroare, dar DLL-ul a returnat succes",
+		"tips.title":               "Sfaturi de depanare:",
+		"tips.dll_exists":          "Verificați că fișierul DLL există și poate fi accesat",
+		"tips.parameters":          "Verificați că toți parametrii obligatorii sunt completați",
+		"tips.endpoint":            "Verificați că numele endpoint-ului este corect",
+		"tips.config":              "Pentru DLL-ul runtime, verificați că config.ini există în același director",
+		"tips.server_down":         "Serverul %s pare să nu fie accesibil. Verificați că rulează.",
+		"tips.network":             "Verificați conexiunea la rețea și setările firewall-ului",
+		"tips.server_logs":         "Consultați jurnalele serverului pentru mai multe detalii",
+		"tips.connection.running":  "Verificați că serverul rulează",
+		"tips.connection.network":  "Verificați conexiunea la rețea",
+		"tips.connection.base_url": "Verificați adresa serverului din config.ini",
+		"tips.connection.firewall": "Verificați setările firewall-ului",
+	},
+}
+
+// message formats the text of key in a language, falling back to English, and to
+// the key itself for texts missing from the catalog
+func message(lang, key string, args ...interface{}) string {
+	format, ok := messageCatalog[lang][key]
+	if !ok {
+		format, ok = messageCatalog[DefaultLanguage][key]
+	}
+	if !ok {
+		format = key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// languages returns the languages of the message catalog
+func languages() []string {
+	names := make([]string, 0, len(messageCatalog))
+	for name := range messageCatalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkLanguage fails for a language missing from the catalog
+func checkLanguage(lang string) error {
+	if _, ok := messageCatalog[lang]; !ok {
+		return fmt.Errorf("unknown language '%s' (valid languages: %s)", lang, strings.Join(languages(), ", "))
+	}
+	return nil
+}
+
+// parseLanguage returns the catalog language of a language tag such as "ro-RO"
+func parseLanguage(tag string) (string, bool) {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	_, ok := messageCatalog[primary]
+	return primary, ok
+}
+
+// requestLanguage picks the language of a request: the lang query parameter, or
+// else the first catalog language of the Accept-Language header, which browsers
+// send from the user's settings, or else the default language
+func requestLanguage(r *http.Request) string {
+	if lang, ok := parseLanguage(r.URL.Query().Get("lang")); ok {
+		return lang
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		if lang, ok := parseLanguage(tag); ok {
+			return lang
+		}
+	}
+	return defaultLanguage
+}
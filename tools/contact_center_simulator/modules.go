@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LoadedModule is a module loaded in the process hosting the DLL at the time of
+// a call, to show which libcurl or OpenSSL the DLL actually got
+type LoadedModule struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Version is the file version of a DLL, or the version in the name of a shared library
+	Version        string `json:"version,omitempty"`
+	ProductVersion string `json:"productVersion,omitempty"`
+}
+
+// moduleLister is implemented by invokers that list the modules of the process
+// hosting the DLL, such as the worker invoker
+type moduleLister interface {
+	// CallModules returns the modules loaded at the last call that asked for them
+	CallModules() []ModuleInfo
+}
+
+// Context key of calls asking for the loaded modules
+type callModulesKey struct{}
+
+// withCallModules returns a context asking a worker invoker for its loaded
+// modules after the call
+func withCallModules(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callModulesKey{}, true)
+}
+
+// wantsModules reports whether a call asks for the loaded modules
+func wantsModules(ctx context.Context) bool {
+	want, _ := ctx.Value(callModulesKey{}).(bool)
+	return want
+}
+
+// moduleVersion is the version of a module file
+type moduleVersion struct {
+	version, product string
+}
+
+// Versions of the module files seen so far, read once per path since a loaded
+// module does not change
+var (
+	moduleVersionsMu sync.Mutex
+	moduleVersions   = make(map[string]moduleVersion)
+)
+
+// snapshotModules describes the loaded modules with their versions, sorted by name
+func snapshotModules(modules []ModuleInfo) []LoadedModule {
+	snapshot := make([]LoadedModule, 0, len(modules))
+	for _, m := range modules {
+		moduleVersionsMu.Lock()
+		v, ok := moduleVersions[m.Path]
+		if !ok {
+			v.version, v.product = libraryVersion(m.Path)
+			moduleVersions[m.Path] = v
+		}
+		moduleVersionsMu.Unlock()
+		snapshot = append(snapshot, LoadedModule{Name: filepath.Base(m.Path), Path: m.Path, Version: v.version, ProductVersion: v.product})
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return strings.ToLower(snapshot[i].Name) < strings.ToLower(snapshot[j].Name)
+	})
+	return snapshot
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadedModules lists the files mapped into the process, from /proc/self/maps
+func loadedModules() []ModuleInfo {
+	f, err := os.Open("/proc/self/maps")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var modules []ModuleInfo
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// start-end perms offset dev inode path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			continue
+		}
+		base, err1 := strconv.ParseUint(start, 16, 64)
+		limit, err2 := strconv.ParseUint(end, 16, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		// A module spans from its first mapping to the end of its last one
+		path := fields[5]
+		if i, ok := index[path]; ok {
+			m := &modules[i]
+			if limit > m.Base+m.Size {
+				m.Size = limit - m.Base
+			}
+			continue
+		}
+		index[path] = len(modules)
+		modules = append(modules, ModuleInfo{Path: path, Base: base, Size: limit - base})
+	}
+	return modules
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package main
+
+// loadedModules is not available on this platform, so crashes are reported
+// without their faulting module
+func loadedModules() []ModuleInfo {
+	return nil
+}
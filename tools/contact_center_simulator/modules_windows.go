@@ -0,0 +1,54 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procEnumProcessModules   = psapi.NewProc("EnumProcessModules")
+	procGetModuleInformation = psapi.NewProc("GetModuleInformation")
+	procGetModuleFileNameExW = psapi.NewProc("GetModuleFileNameExW")
+)
+
+// moduleInformation is MODULEINFO
+type moduleInformation struct {
+	baseOfDll   uintptr
+	sizeOfImage uint32
+	entryPoint  uintptr
+}
+
+// loadedModules lists the modules loaded in the process
+func loadedModules() []ModuleInfo {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil
+	}
+	handles := make([]syscall.Handle, 1024)
+	var needed uint32
+	ret, _, _ := procEnumProcessModules.Call(uintptr(process), uintptr(unsafe.Pointer(&handles[0])),
+		uintptr(len(handles))*unsafe.Sizeof(handles[0]), uintptr(unsafe.Pointer(&needed)))
+	if ret == 0 {
+		return nil
+	}
+	count := min(int(needed/uint32(unsafe.Sizeof(handles[0]))), len(handles))
+
+	var modules []ModuleInfo
+	for _, module := range handles[:count] {
+		var info moduleInformation
+		ret, _, _ := procGetModuleInformation.Call(uintptr(process), uintptr(module),
+			uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+		if ret == 0 {
+			continue
+		}
+		name := make([]uint16, syscall.MAX_PATH)
+		n, _, _ := procGetModuleFileNameExW.Call(uintptr(process), uintptr(module),
+			uintptr(unsafe.Pointer(&name[0])), uintptr(len(name)))
+		modules = append(modules, ModuleInfo{
+			Path: syscall.UTF16ToString(name[:n]),
+			Base: uint64(info.baseOfDll),
+			Size: uint64(info.sizeOfImage),
+		})
+	}
+	return modules
+}
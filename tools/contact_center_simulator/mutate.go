@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Default factor of the passing call's duration beyond which a mutated call counts as hung
+const DefaultSlowFactor = 10
+
+// Outcomes of a mutated call
+const (
+	// The DLL accepted the value and answered normally
+	mutationAccepted = "accepted"
+	// The DLL rejected the value with a defined error code
+	mutationRejected = "rejected"
+	// The DLL or the backend did not handle the value gracefully
+	mutationNonGraceful = "non-graceful"
+)
+
+// mutator transforms a parameter value for robustness testing
+type mutator struct {
+	name   string
+	mutate func(value string) string
+}
+
+// swapCase inverts the case of every letter
+func swapCase(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, value)
+}
+
+// mutators are the transformations applied to each parameter value in turn: case
+// changes, whitespace, characters the DLL must escape for the URL, SQL and format
+// string metacharacters the backend must not interpret, and extreme lengths
+var mutators = []mutator{
+	{"upper-case", strings.ToUpper},
+	{"lower-case", strings.ToLower},
+	{"swap-case", swapCase},
+	{"empty", func(string) string { return "" }},
+	{"spaces-around", func(v string) string { return "  " + v + "  " }},
+	{"inner-tab", func(v string) string { return v[:len(v)/2] + "\t" + v[len(v)/2:] }},
+	{"newline", func(v string) string { return v + "\r\n" }},
+	{"url-metacharacters", func(v string) string { return v + "&x=1?#%20+/" }},
+	{"quotes", func(v string) string { return `"` + v + `'` }},
+	{"diacritics", func(v string) string { return v + "ăâîșțĂÂÎȘȚ" }},
+	{"emoji", func(v string) string { return v + "😀" }},
+	{"control-characters", func(v string) string { return v + "\x01\x1b[2J\x7f" }},
+	{"sql-injection", func(v string) string { return v + "' OR '1'='1' --" }},
+	{"sql-statement", func(v string) string { return v + "'; DROP TABLE customers; --" }},
+	{"format-string", func(v string) string { return v + "%s%s%n%x%d" }},
+	{"template-expression", func(v string) string { return v + "${7*7}{{7*7}}{0}" }},
+	{"max-length", func(v string) string { return strings.Repeat("9", buffer.ValueSize-1) }},
+	{"overlong", func(v string) string { return strings.Repeat("9", buffer.ValueSize) }},
+}
+
+// MutationResult is the outcome of a call with one mutated parameter value
+type MutationResult struct {
+	Parameter      string  `json:"parameter"`
+	Mutation       string  `json:"mutation"`
+	Value          string  `json:"value"`
+	Outcome        string  `json:"outcome"`
+	ReturnCode     int     `json:"returnCode"`
+	ReturnCodeName string  `json:"returnCodeName"`
+	DurationMs     float64 `json:"durationMs"`
+	// Problem explains a non-graceful outcome
+	Problem string `json:"problem,omitempty"`
+	RunID   string `json:"runId,omitempty"`
+}
+
+// MutationReport is the report of the mutate subcommand
+type MutationReport struct {
+	Profile     string           `json:"profile"`
+	Endpoint    string           `json:"endpoint"`
+	BaselineMs  float64          `json:"baselineMs"`
+	Calls       int              `json:"calls"`
+	Accepted    int              `json:"accepted"`
+	Rejected    int              `json:"rejected"`
+	NonGraceful int              `json:"nonGraceful"`
+	Results     []MutationResult `json:"results"`
+}
+
+// classifyMutation decides whether a mutated call was handled gracefully: the DLL
+// answered with a well-formed buffer, or with one of its defined error codes and
+// the backend did not fail
+func classifyMutation(result TestResult, baselineMs, slowFactor float64) (outcome, problem string) {
+	code := dllclient.ErrorCode(result.ReturnCode)
+	var serverErrors []string
+	for _, e := range result.Exchanges {
+		if e.StatusCode >= 500 {
+			serverErrors = append(serverErrors, fmt.Sprintf("%d for %s", e.StatusCode, e.URL))
+		}
+	}
+	switch {
+	case result.Crash != nil:
+		return mutationNonGraceful, "the DLL crashed: " + result.Crash.Summary
+	case result.ReturnCode == -1:
+		return mutationNonGraceful, "the call failed: " + firstLine(result.ErrorDetails)
+	case result.OutputError != nil:
+		return mutationNonGraceful, "malformed output buffer: " + result.OutputError.Message
+	case code == dllclient.UnexpectedException:
+		return mutationNonGraceful, "unexpected exception in the DLL: " + firstLine(result.ErrorDetails)
+	case code.String() == "UNKNOWN_ERROR":
+		return mutationNonGraceful, fmt.Sprintf("undefined return code %d", result.ReturnCode)
+	case len(serverErrors) > 0:
+		return mutationNonGraceful, "the backend answered " + strings.Join(serverErrors, ", ")
+	case baselineMs > 0 && result.DurationMs > baselineMs*slowFactor:
+		return mutationNonGraceful, fmt.Sprintf("the call took %.1f ms, %.0f times the %.1f ms of the passing call", result.DurationMs, result.DurationMs/baselineMs, baselineMs)
+	case result.ReturnCode != 0:
+		return mutationRejected, ""
+	default:
+		return mutationAccepted, ""
+	}
+}
+
+// runMutate implements the mutate subcommand: it calls a passing test case once,
+// then again with each parameter value changed by each mutator in turn, and
+// reports the calls the DLL or the backend did not handle gracefully. Every call
+// is stored as a run. It returns 1 if a call was not handled gracefully, and 2
+// for invalid options or a test case that does not pass.
+//
+//	ContactCenterSimulator mutate -param Endpoint=getInfo -param CFResp=yes -param ID=12345 -isolate -intercept
+func runMutate(args []string) int {
+	fs := flag.NewFlagSet("mutate", flag.ContinueOnError)
+	callFlags := addCallFlags(fs)
+	fs.BoolVar(&isolate, "isolate", false, "Call the DLL in a worker process, so a crash is reported instead of stopping the run")
+	fs.BoolVar(&intercept, "intercept", false, "Record the DLL's requests to the backend, to report backend errors (5xx)")
+	runsDir := fs.String("runs", DefaultRunsDir, "Directory storing the artifacts of each call (empty to disable)")
+	slowFactor := fs.Float64("slow-factor", DefaultSlowFactor, "Factor of the passing call's duration beyond which a mutated call counts as hung")
+	skip := fs.String("skip", "Endpoint,CFResp", "Comma-separated parameters left unchanged")
+	out := fs.String("out", "", "Output file of the JSON report (default standard output)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *slowFactor <= 1 {
+		fmt.Fprintln(os.Stderr, "mutate: -slow-factor must be greater than 1")
+		return 2
+	}
+	if *runsDir != "" {
+		var err error
+		if runs, err = newRunStore(*runsDir); err != nil {
+			fmt.Fprintf(os.Stderr, "mutate: %v\n", err)
+			return 1
+		}
+	}
+
+	_, profile, testCase, code, err := callFlags.prepare()
+	defer stopInterceptors()
+	defer unloadDLLs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mutate: %v\n", err)
+		return code
+	}
+	skipped := make(map[string]bool)
+	for _, key := range strings.Split(*skip, ",") {
+		skipped[strings.TrimSpace(key)] = true
+	}
+	mutable := 0
+	for _, param := range testCase.Parameters {
+		if !skipped[param.Key] {
+			mutable++
+		}
+	}
+
+	baseline := runTestCase(profile, testCase, defaultLanguage)
+	if !baseline.Success {
+		fmt.Fprintf(os.Stderr, "mutate: the test case must pass before it is mutated: %s\n", firstLine(baseline.ErrorDetails))
+		return 2
+	}
+	report := MutationReport{Profile: profile.name, Endpoint: endpointOf(testCase), BaselineMs: baseline.DurationMs, Results: []MutationResult{}}
+	log.Printf("Passing call took %.1f ms; mutating %d parameters", baseline.DurationMs, mutable)
+
+	for _, param := range testCase.Parameters {
+		if skipped[param.Key] {
+			continue
+		}
+		for _, m := range mutators {
+			value := m.mutate(param.Value)
+			if value == param.Value {
+				continue
+			}
+			mutated := testCase
+			mutated.Name = fmt.Sprintf("%s-%s", param.Key, m.name)
+			mutated.Parameters = withValue(testCase.Parameters, param.Key, value)
+
+			result := runTestCase(profile, mutated, defaultLanguage)
+			recordRun(mutated, profile, &result)
+			outcome, problem := classifyMutation(result, baseline.DurationMs, *slowFactor)
+			report.Results = append(report.Results, MutationResult{
+				Parameter:      param.Key,
+				Mutation:       m.name,
+				Value:          value,
+				Outcome:        outcome,
+				ReturnCode:     result.ReturnCode,
+				ReturnCodeName: dllclient.ErrorCode(result.ReturnCode).String(),
+				DurationMs:     result.DurationMs,
+				Problem:        problem,
+				RunID:          result.RunID,
+			})
+			report.Calls++
+			switch outcome {
+			case mutationAccepted:
+				report.Accepted++
+			case mutationRejected:
+				report.Rejected++
+			default:
+				report.NonGraceful++
+				log.Printf("NON-GRACEFUL: %s %s: %s", param.Key, m.name, problem)
+			}
+		}
+	}
+	log.Printf("%d calls: %d accepted, %d rejected, %d non-graceful", report.Calls, report.Accepted, report.Rejected, report.NonGraceful)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mutate: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "mutate: %v\n", err)
+		return 1
+	}
+	if report.NonGraceful > 0 {
+		return 1
+	}
+	return 0
+}
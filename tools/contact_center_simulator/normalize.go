@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Kinds of normalization rules
+const (
+	normalizeTimestamps = "timestamps"
+	normalizeWhitespace = "whitespace"
+	normalizeRedact     = "redact"
+	normalizeRegex      = "regex"
+)
+
+// Placeholders normalized values get in place of dynamic content
+const (
+	timestampPlaceholder = "<timestamp>"
+	redactedPlaceholder  = "<redacted>"
+)
+
+// Dates and times as backends write them: ISO 8601 (2024-05-17T09:30:00Z,
+// 2024-05-17 09:30:00.123), Romanian dates (17.05.2024 09:30) and bare times
+var timestampPattern = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?)?` +
+		`|\d{2}[./]\d{2}[./]\d{4}(?: \d{2}:\d{2}(?::\d{2})?)?` +
+		`|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`)
+
+// Runs of whitespace, collapsed by the whitespace rule
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// Normalization is a rule of a suite's normalize list, transforming output values
+// before they are compared with the snapshots so dynamic content does not fail
+// the comparison:
+//
+//	{"type": "timestamps"}                                  dates and times become <timestamp>
+//	{"type": "whitespace"}                                  trims and collapses whitespace
+//	{"type": "redact", "keys": ["SessionID"]}               the whole value becomes <redacted>
+//	{"type": "redact", "pattern": "TX-[0-9]+"}              matches become <redacted>
+//	{"type": "regex", "pattern": "v[0-9.]+", "replace": "v*"}  matches are replaced
+//
+// Keys limits a rule to the values of these output keys (all if empty).
+type Normalization struct {
+	Type    string   `json:"type"`
+	Keys    []string `json:"keys,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Replace string   `json:"replace,omitempty"`
+}
+
+// normalizer applies the normalization rules of a suite
+type normalizer struct {
+	rules    []Normalization
+	patterns []*regexp.Regexp
+}
+
+// newNormalizer checks and compiles normalization rules
+func newNormalizer(rules []Normalization) (*normalizer, error) {
+	n := &normalizer{rules: rules, patterns: make([]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		switch rule.Type {
+		case normalizeTimestamps, normalizeWhitespace:
+		case normalizeRedact:
+			if rule.Pattern == "" && len(rule.Keys) == 0 {
+				return nil, fmt.Errorf("normalization rule %d: redact needs keys or a pattern", i+1)
+			}
+		case normalizeRegex:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("normalization rule %d: regex needs a pattern", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("normalization rule %d: unknown type '%s' (valid types: redact, regex, timestamps, whitespace)", i+1, rule.Type)
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("normalization rule %d: invalid pattern: %v", i+1, err)
+			}
+			n.patterns[i] = pattern
+		}
+	}
+	return n, nil
+}
+
+// normalize returns the output values with every rule applied, in order
+func (n *normalizer) normalize(output map[string]string) map[string]string {
+	normalized := make(map[string]string, len(output))
+	for key, value := range output {
+		for i, rule := range n.rules {
+			if len(rule.Keys) > 0 && !slices.Contains(rule.Keys, key) {
+				continue
+			}
+			switch rule.Type {
+			case normalizeTimestamps:
+				value = timestampPattern.ReplaceAllString(value, timestampPlaceholder)
+			case normalizeWhitespace:
+				value = whitespacePattern.ReplaceAllString(strings.TrimSpace(value), " ")
+			case normalizeRedact:
+				if n.patterns[i] == nil {
+					value = redactedPlaceholder
+				} else {
+					value = n.patterns[i].ReplaceAllLiteralString(value, redactedPlaceholder)
+				}
+			case normalizeRegex:
+				value = n.patterns[i].ReplaceAllString(value, rule.Replace)
+			}
+		}
+		normalized[key] = value
+	}
+	return normalized
+}
+
+// snapshotPath returns the snapshot file of a case of a suite, which holds the
+// expected output values as a JSON object; false for cases whose name cannot be
+// a file name
+func snapshotPath(suite *Suite, testCase TestCase) (string, bool) {
+	dir, err := suitePath(suite.Name)
+	if err != nil || !validSuiteName.MatchString(testCase.Name) {
+		return "", false
+	}
+	return filepath.Join(dir, suiteSnapshotsDir, testCase.Name+".json"), true
+}
+
+// checkSnapshot compares the output values of a suite case with its snapshot, both
+// normalized by the suite's rules, and fails the result if they differ. Cases
+// without a snapshot are not compared. With updateSnapshots, the output values
+// are stored as the new snapshot instead.
+func checkSnapshot(suite *Suite, testCase TestCase, result *TestResult, lang string) {
+	path, ok := snapshotPath(suite, testCase)
+	if !ok {
+		return
+	}
+	if suite.updateSnapshots {
+		if result.Output == nil {
+			return
+		}
+		data, _ := json.MarshalIndent(result.Output, "", "  ")
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = os.WriteFile(path, append(data, '\n'), 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to update snapshot of case '%s': %v", testCase.Name, err)
+		} else {
+			log.Printf("Updated snapshot of case '%s' of suite '%s'", testCase.Name, suite.Name)
+		}
+		return
+	}
+
+	var expected map[string]string
+	if err := readJSONFile(path, &expected); os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		failResult(result, fmt.Sprintf("Failed to read snapshot %s: %v", path, err))
+		return
+	}
+	n, err := newNormalizer(suite.Normalize)
+	if err != nil {
+		failResult(result, fmt.Sprintf("Suite '%s': %v", suite.Name, err))
+		return
+	}
+	if diffs := diffOutput(n.normalize(expected), n.normalize(result.Output)); len(diffs) > 0 {
+		details := message(lang, "error.snapshot", strings.Join(diffs, "\n  "))
+		log.Printf("Test '%s': %s", testCase.Name, details)
+		failResult(result, details)
+	}
+}
+
+// diffOutput lists the differences between expected and actual output values, by key
+func diffOutput(expected, actual map[string]string) []string {
+	keys := make(map[string]bool)
+	for key := range expected {
+		keys[key] = true
+	}
+	for key := range actual {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, key := range sorted {
+		want, inExpected := expected[key]
+		got, inActual := actual[key]
+		switch {
+		case !inActual:
+			diffs = append(diffs, fmt.Sprintf("%s: missing, expected %q", key, want))
+		case !inExpected:
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected value %q", key, got))
+		case want != got:
+			diffs = append(diffs, fmt.Sprintf("%s: expected %q, got %q", key, want, got))
+		}
+	}
+	return diffs
+}
+
+// failResult fails a test result, putting details before earlier error details
+func failResult(result *TestResult, details string) {
+	if result.ErrorDetails != "" {
+		details += "\n" + result.ErrorDetails
+	}
+	result.Success, result.ErrorDetails = false, details
+}
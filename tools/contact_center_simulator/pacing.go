@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pacing models of the load subcommands: when the calls are made
+const (
+	// Each caller calls again as soon as its previous call returns
+	pacingContinuous = "continuous"
+	// Calls arrive evenly spaced at the rate
+	pacingUniform = "uniform"
+	// Calls arrive independently of each other at the average rate, in bursts and
+	// lulls, as calls reach a contact center
+	pacingPoisson = "poisson"
+	// Poisson arrivals whose rate follows the hour of the day, peaking at the rate
+	pacingWorkingHours = "working-hours"
+)
+
+// Relative call volume of each hour of the day (0-23) for working-hours pacing:
+// quiet nights, a morning peak at 10:00, a lunch dip and an afternoon peak
+var defaultHourlyProfile = []float64{
+	0.02, 0.01, 0.01, 0.01, 0.01, 0.02, 0.05, 0.15,
+	0.45, 0.85, 1.00, 0.95, 0.70, 0.75, 0.90, 0.85,
+	0.70, 0.45, 0.20, 0.10, 0.06, 0.04, 0.03, 0.02,
+}
+
+// pacingFlags are the pacing options of a load subcommand
+type pacingFlags struct {
+	model     *string
+	rate      *float64
+	hourly    *string
+	dayLength *time.Duration
+}
+
+// addPacingFlags adds the pacing options to fs, with the model used by default
+func addPacingFlags(fs *flag.FlagSet, defaultModel string, models []string) *pacingFlags {
+	return &pacingFlags{
+		model:     fs.String("pacing", defaultModel, "When calls are made: "+strings.Join(models, ", ")),
+		rate:      fs.Float64("rate", 0, "Calls per second of uniform and poisson pacing, and the peak rate of working-hours pacing"),
+		hourly:    fs.String("hourly", "", "24 comma-separated relative call volumes of the hours of the day, for working-hours pacing (default a contact-center working day)"),
+		dayLength: fs.Duration("day-length", 24*time.Hour, "Real time a simulated day of working-hours pacing takes, e.g. 1h to replay a whole day in an hour"),
+	}
+}
+
+// pacer schedules the arrivals of calls
+type pacer struct {
+	model     string
+	rate      float64
+	hourly    []float64
+	dayLength time.Duration
+	// start is when the pacer was created, and day the time of day then
+	start time.Time
+	day   time.Duration
+	rnd   *rand.Rand
+}
+
+// newPacer creates a pacer of one of the models, at rate calls per second
+func newPacer(model string, rate float64, hourly []float64, dayLength time.Duration) *pacer {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return &pacer{
+		model:     model,
+		rate:      rate,
+		hourly:    hourly,
+		dayLength: dayLength,
+		start:     now,
+		day:       now.Sub(midnight),
+		rnd:       rand.New(rand.NewPCG(uint64(now.UnixNano()), 0)),
+	}
+}
+
+// pacer checks the pacing options against the models of the subcommand and
+// creates their pacer, nil for continuous pacing
+func (f *pacingFlags) pacer(models []string) (*pacer, error) {
+	if !slices.Contains(models, *f.model) {
+		return nil, fmt.Errorf("unknown -pacing '%s' (valid models: %s)", *f.model, strings.Join(models, ", "))
+	}
+	if *f.model == pacingContinuous {
+		return nil, nil
+	}
+	if *f.rate <= 0 {
+		return nil, fmt.Errorf("-pacing %s needs a positive -rate", *f.model)
+	}
+	if *f.dayLength <= 0 {
+		return nil, fmt.Errorf("-day-length must be positive")
+	}
+	hourly := defaultHourlyProfile
+	if *f.hourly != "" {
+		var err error
+		if hourly, err = parseHourlyProfile(*f.hourly); err != nil {
+			return nil, err
+		}
+	}
+	return newPacer(*f.model, *f.rate, hourly, *f.dayLength), nil
+}
+
+// parseHourlyProfile reads 24 relative call volumes, scaled so the busiest hour is 1
+func parseHourlyProfile(s string) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != 24 {
+		return nil, fmt.Errorf("-hourly needs 24 values, one per hour of the day, not %d", len(fields))
+	}
+	hourly := make([]float64, 24)
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("-hourly value %d '%s' is not a number of at least 0", i+1, field)
+		}
+		hourly[i] = v
+	}
+	peak := slices.Max(hourly)
+	if peak == 0 {
+		return nil, fmt.Errorf("-hourly needs at least one hour with calls")
+	}
+	for i := range hourly {
+		hourly[i] /= peak
+	}
+	return hourly, nil
+}
+
+// factor returns the share of the peak rate at a moment of working-hours pacing,
+// interpolated between the hours of the simulated day
+func (p *pacer) factor(t time.Time) float64 {
+	elapsed := time.Duration(float64(t.Sub(p.start)) * float64(24*time.Hour) / float64(p.dayLength))
+	hours := (p.day + elapsed).Hours()
+	hour := int(hours) % 24
+	frac := hours - float64(int(hours))
+	return p.hourly[hour]*(1-frac) + p.hourly[(hour+1)%24]*frac
+}
+
+// next returns when the call after the one due at at arrives
+func (p *pacer) next(at time.Time) time.Time {
+	gap := func() time.Time {
+		return at.Add(time.Duration(p.rnd.ExpFloat64() / p.rate * float64(time.Second)))
+	}
+	switch p.model {
+	case pacingUniform:
+		return at.Add(time.Duration(float64(time.Second) / p.rate))
+	case pacingWorkingHours:
+		// Thinning: arrivals at the peak rate, each kept with the share of the peak
+		// rate at its time
+		for {
+			at = gap()
+			if p.rnd.Float64() < p.factor(at) {
+				return at
+			}
+		}
+	default:
+		return gap()
+	}
+}
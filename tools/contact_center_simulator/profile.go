@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Name of the profile used by tests that do not select one
+const DefaultProfileName = "default"
+
+// DLLProfile describes a DLL build the simulator calls and how it exchanges
+// buffers with it, so several builds can be tested side by side
+type DLLProfile struct {
+	// DLL is the path of the DLL (defaults to the -dll path)
+	DLL string `json:"dll,omitempty"`
+	// Protocol is the buffer protocol version the DLL build speaks (1 or 2, default 1)
+	Protocol int `json:"protocol,omitempty"`
+	// Base64Keys are the keys whose values travel base64-encoded in the buffer,
+	// so binary tokens survive the fixed-width text fields
+	Base64Keys []string `json:"base64_keys,omitempty"`
+	// Checksum appends a CRC32 pair to input buffers and verifies it on output buffers
+	Checksum bool `json:"checksum,omitempty"`
+	// Normalize applies a Unicode normalization form ("nfc" or "nfd") to parameter
+	// values before they are encoded, so composed and decomposed diacritics in test
+	// data match the backend records
+	Normalize string `json:"normalize,omitempty"`
+	// Charset is the character encoding of values inside the buffer ("utf-8",
+	// "windows-1250" or "iso-8859-2", default utf-8). The production DLL reads the
+	// buffer in the system ANSI codepage.
+	Charset string `json:"charset,omitempty"`
+	// Fake is a JSON file of scripted behaviors by endpoint; when set, the profile
+	// calls the fake invoker instead of its DLL
+	Fake string `json:"fake,omitempty"`
+	// Isolate calls the DLL in a separate worker process, so a crash in the DLL
+	// fails the test instead of stopping the simulator (see worker.go)
+	Isolate bool `json:"isolate,omitempty"`
+	// SHA256 is the expected hex SHA-256 of the DLL; a DLL with another hash is
+	// not loaded, so tests cannot run against the wrong build
+	SHA256 string `json:"sha256,omitempty"`
+	// SearchDirs are extra directories searched for the DLL's dependencies, and
+	// LoadFlags the LOAD_LIBRARY_SEARCH_* flags the DLL is loaded with, so
+	// dependencies resolve as when OSCC loads the DLL (Windows only)
+	SearchDirs []string `json:"search_dirs,omitempty"`
+	LoadFlags  []string `json:"load_flags,omitempty"`
+	// DllDirectory is set with SetDllDirectory before the DLL is loaded (Windows
+	// only). It applies to the whole process, so isolate profiles that differ.
+	DllDirectory string `json:"dll_directory,omitempty"`
+	// Endpoints and Tags route test cases that do not select a profile to this
+	// one: the cases with one of the tags, then the cases calling one of the
+	// endpoints, as when separate DLL builds handle different backend integrations
+	Endpoints []string `json:"endpoints,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Env sets environment variables of the worker process hosting the DLL, such
+	// as proxy and debug settings the DLL reads; test cases can override them. A
+	// profile with environment variables is isolated.
+	Env map[string]string `json:"env,omitempty"`
+	// WorkingDir is the working directory of the worker process hosting the DLL,
+	// which relative paths inside the DLL (certificate files, logs) resolve
+	// against, as in the directory OSCC runs in. A profile with a working
+	// directory is isolated.
+	WorkingDir string `json:"working_dir,omitempty"`
+	// Modules attaches the modules loaded in the process hosting the DLL after
+	// each call to the results, with their versions
+	Modules bool `json:"modules,omitempty"`
+	// ETW captures the network and loader events of the process hosting the DLL
+	// in an ETW trace around each call, stored with the run (Windows only)
+	ETW bool `json:"etw,omitempty"`
+
+	name      string
+	version   buffer.Version
+	loadFlags uint32
+}
+
+// Unicode normalization forms by their profile name
+var normalizationForms = map[string]norm.Form{
+	"nfc": norm.NFC,
+	"nfd": norm.NFD,
+}
+
+// Known DLL profiles by name
+var profiles = make(map[string]*DLLProfile)
+
+// Profiles that test cases without a profile are routed to, by tag and by endpoint
+var (
+	tagRoutes      = make(map[string]string)
+	endpointRoutes = make(map[string]string)
+)
+
+// prepare checks the profile and fills in its defaults
+func (p *DLLProfile) prepare(name, defaultDLL string) error {
+	version, err := buffer.ParseVersion(p.Protocol)
+	if err != nil {
+		return fmt.Errorf("profile '%s': %v", name, err)
+	}
+	p.name = name
+	p.version = version
+	p.Protocol = int(version)
+	p.Charset = strings.ToLower(p.Charset)
+	if p.Charset == "" {
+		p.Charset = "utf-8"
+	}
+	if _, ok := bufferCharsets[p.Charset]; !ok {
+		return fmt.Errorf("profile '%s': unknown charset '%s' (valid charsets: %s)", name, p.Charset, strings.Join(charsetNames(), ", "))
+	}
+	p.Normalize = strings.ToLower(p.Normalize)
+	if _, ok := normalizationForms[p.Normalize]; !ok && p.Normalize != "" {
+		return fmt.Errorf("profile '%s': unknown normalization form '%s' (valid forms: nfc, nfd)", name, p.Normalize)
+	}
+	p.SHA256 = strings.ToLower(p.SHA256)
+	if _, err := hex.DecodeString(p.SHA256); err != nil || (p.SHA256 != "" && len(p.SHA256) != 64) {
+		return fmt.Errorf("profile '%s': sha256 must be 64 hex digits", name)
+	}
+	if p.loadFlags, err = dllclient.ParseLoadFlags(p.LoadFlags); err != nil {
+		return fmt.Errorf("profile '%s': %v", name, err)
+	}
+	for i, dir := range p.SearchDirs {
+		p.SearchDirs[i] = resolveDllPath(dir)
+	}
+	if p.DllDirectory != "" {
+		p.DllDirectory = resolveDllPath(p.DllDirectory)
+	}
+	if p.WorkingDir != "" {
+		p.WorkingDir = resolveDllPath(p.WorkingDir)
+		if info, err := os.Stat(p.WorkingDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("profile '%s': working directory %s does not exist", name, p.WorkingDir)
+		}
+	}
+	if p.DLL == "" {
+		p.DLL = defaultDLL
+	}
+	p.DLL = resolveDllPath(p.DLL)
+	return nil
+}
+
+// loadOptions are the options the DLL of the profile is loaded with
+func (p *DLLProfile) loadOptions() dllclient.Options {
+	return dllclient.Options{LoadFlags: p.loadFlags, SearchDirs: p.SearchDirs, DllDirectory: p.DllDirectory}
+}
+
+// loadKey identifies how the DLL of the profile is loaded, from every setting
+// that affects loading: profiles with the same key share a loaded DLL or worker
+func (p *DLLProfile) loadKey() string {
+	key := fmt.Sprintf("%s|%#x|%q|%s", p.DLL, p.loadFlags, p.SearchDirs, p.DllDirectory)
+	if p.isolated() {
+		key += "|" + p.WorkingDir
+		for _, name := range slices.Sorted(maps.Keys(p.Env)) {
+			key += "|" + name + "=" + p.Env[name]
+		}
+	}
+	return key
+}
+
+// loadProfiles sets up the default profile for the -dll path, then reads the
+// profiles of a JSON file (if any) of the form
+//
+//	{"v2-build": {"dll": "dist/v2/CustomDLL.dll", "protocol": 2, "base64_keys": ["Token_b64"]}}
+//
+// A profile named "default" replaces the built-in one.
+func loadProfiles(path, defaultDLL string) error {
+	config := map[string]*DLLProfile{DefaultProfileName: {}}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read profiles file: %v", err)
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("failed to parse profiles file %s: %v", path, err)
+		}
+		if config[DefaultProfileName] == nil {
+			config[DefaultProfileName] = &DLLProfile{}
+		}
+	}
+
+	for name, p := range config {
+		if p == nil {
+			p = &DLLProfile{}
+		}
+		if err := p.prepare(name, defaultDLL); err != nil {
+			return err
+		}
+		profiles[name] = p
+	}
+	return addRoutes(config)
+}
+
+// addRoutes records the tags and endpoints the profiles claim. A tag or endpoint
+// claimed by two profiles is an error, as the cases using it could go to either.
+func addRoutes(config map[string]*DLLProfile) error {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	add := func(routes map[string]string, kind, key, name string) error {
+		if other, ok := routes[key]; ok && other != name {
+			return fmt.Errorf("%s '%s' is routed to both profile '%s' and profile '%s'", kind, key, other, name)
+		}
+		routes[key] = name
+		return nil
+	}
+	for _, name := range names {
+		p := profiles[name]
+		for _, tag := range p.Tags {
+			if err := add(tagRoutes, "tag", tag, name); err != nil {
+				return err
+			}
+		}
+		for _, endpoint := range p.Endpoints {
+			if err := add(endpointRoutes, "endpoint", endpoint, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// routeProfile returns the name of the profile a test case runs with: the one it
+// selects, else the profile of its first routed tag, else the profile of its
+// endpoint, else the default profile
+func routeProfile(testCase TestCase) string {
+	if testCase.Profile != "" {
+		return testCase.Profile
+	}
+	for _, tag := range testCase.Tags {
+		if name, ok := tagRoutes[tag]; ok {
+			return name
+		}
+	}
+	if name, ok := endpointRoutes[endpointOf(testCase)]; ok {
+		return name
+	}
+	return DefaultProfileName
+}
+
+// dllEnvironment returns the environment variables of a test case's call: those
+// of the profile, overridden by those of the case
+func dllEnvironment(profile *DLLProfile, testCase TestCase) map[string]string {
+	if len(profile.Env) == 0 && len(testCase.Env) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(profile.Env)+len(testCase.Env))
+	for name, value := range profile.Env {
+		env[name] = value
+	}
+	for name, value := range testCase.Env {
+		env[name] = value
+	}
+	return env
+}
+
+// checkCaseEnv checks that a test case only overrides environment variables its
+// profile declares in "env". Cases arrive over HTTP and in uploaded suites, and
+// variables such as LD_PRELOAD or PATH would load code of their choice into the
+// worker hosting the DLL.
+func checkCaseEnv(testCase TestCase) error {
+	if len(testCase.Env) == 0 {
+		return nil
+	}
+	profile, err := profileFor(testCase)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(testCase.Env)) {
+		if _, ok := profile.Env[name]; !ok {
+			return fmt.Errorf("test case '%s' sets environment variable %s, which profile '%s' does not declare in \"env\"", testCase.Name, name, profile.name)
+		}
+	}
+	return nil
+}
+
+// checkSuiteEnv checks the environment variables of every case of a suite (see checkCaseEnv)
+func checkSuiteEnv(suite *Suite) error {
+	for _, testCase := range suite.Cases {
+		if err := checkCaseEnv(testCase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// profileFor returns the profile a test case runs with (see routeProfile)
+func profileFor(testCase TestCase) (*DLLProfile, error) {
+	return lookupProfile(routeProfile(testCase))
+}
+
+// lookupProfile returns a profile by name, or the default profile for ""
+func lookupProfile(name string) (*DLLProfile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown DLL profile '%s' (available profiles: %v)", name, profileNames())
+	}
+	return p, nil
+}
+
+// profileNames lists the known profiles
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveDllPath makes a relative DLL path relative to the simulator executable
+func resolveDllPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(filepath.Dir(exePath), path)
+}
+
+// isRuntimeDLL reports whether a DLL is a build of the runtime-configurable
+// CustomDLL, which reads config.ini from its directory
+func isRuntimeDLL(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	name = strings.TrimPrefix(strings.TrimSuffix(name, filepath.Ext(name)), "lib")
+	return name == "customdll"
+}
+
+// isolated reports whether the DLL of the profile runs in a worker process
+func (p *DLLProfile) isolated() bool {
+	return (p.Isolate || isolate || len(p.Env) > 0 || p.WorkingDir != "") && p.Fake == "" && !simulate
+}
+
+// snapshotModules reports whether the results of the profile list the loaded modules
+func (p *DLLProfile) snapshotModules() bool {
+	return (p.Modules || moduleSnapshots) && p.Fake == "" && !simulate
+}
+
+// traceETW reports whether the calls of the profile are recorded in an ETW trace
+func (p *DLLProfile) traceETW() bool {
+	return (p.ETW || etwTracing) && p.Fake == "" && !simulate
+}
+
+// ProfileInfo describes a profile in the profiles API
+type ProfileInfo struct {
+	Name       string   `json:"name"`
+	DLL        string   `json:"dll"`
+	Protocol   int      `json:"protocol"`
+	Base64Keys []string `json:"base64_keys,omitempty"`
+	Checksum   bool     `json:"checksum"`
+	Normalize  string   `json:"normalize,omitempty"`
+	Charset    string   `json:"charset"`
+	Fake       string   `json:"fake,omitempty"`
+	Isolate    bool     `json:"isolate,omitempty"`
+	SHA256     string   `json:"sha256,omitempty"`
+	SearchDirs []string `json:"search_dirs,omitempty"`
+	LoadFlags  []string `json:"load_flags,omitempty"`
+	// DllDirectory is set with SetDllDirectory before the DLL is loaded
+	DllDirectory string `json:"dll_directory,omitempty"`
+	// Endpoints and Tags are the test cases routed to the profile
+	Endpoints []string `json:"endpoints,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Env names the environment variables the profile sets (their values may be secret)
+	Env        []string `json:"env,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty"`
+	Modules    bool     `json:"modules,omitempty"`
+	ETW        bool     `json:"etw,omitempty"`
+}
+
+// info describes the profile
+func (p *DLLProfile) info() ProfileInfo {
+	return ProfileInfo{Name: p.name, DLL: p.DLL, Protocol: p.Protocol, Base64Keys: p.Base64Keys, Checksum: p.Checksum, Normalize: p.Normalize, Charset: p.Charset, Fake: p.Fake, Isolate: p.isolated(), SHA256: p.SHA256,
+		SearchDirs: p.SearchDirs, LoadFlags: p.LoadFlags, DllDirectory: p.DllDirectory, Endpoints: p.Endpoints, Tags: p.Tags, Env: slices.Sorted(maps.Keys(p.Env)), WorkingDir: p.WorkingDir, Modules: p.snapshotModules(), ETW: p.traceETW()}
+}
+
+// handleProfiles lists the DLL profiles
+func handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var list []ProfileInfo
+	for _, name := range profileNames() {
+		list = append(list, profiles[name].info())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// States of a queued suite run
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// Job is a suite run submitted to the queue. It is stored in the queue directory
+// after each case, so a run interrupted by a restart resumes at the case that was
+// running. The job file holds its progress; the results of its cases are appended
+// to a JSON lines file next to it, so storing a case costs the same however long
+// the run is.
+type Job struct {
+	ID        int        `json:"id"`
+	Status    string     `json:"status"`
+	User      string     `json:"user"`
+	Lang      string     `json:"lang"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	// Next is the index of the next case to run
+	Next int `json:"next"`
+	// Resumed counts the restarts the run resumed after
+	Resumed int `json:"resumed,omitempty"`
+	// Error explains a failed job, one whose suite could not be loaded
+	Error string `json:"error,omitempty"`
+	SuiteRun
+}
+
+// jobResult is a line of the results file of a job
+type jobResult struct {
+	// Index is the index of the case in the suite
+	Index  int        `json:"index"`
+	Result TestResult `json:"result"`
+}
+
+// jobQueue runs submitted suite runs one at a time, in submission order, keeping
+// each job in a JSON file of its own. Plain files need no database driver and can
+// be read and cleaned up by hand.
+type jobQueue struct {
+	dir string
+
+	mu     sync.Mutex
+	jobs   map[int]*Job
+	nextID int
+	wake   chan struct{}
+}
+
+// Queue of suite runs, nil when disabled (without -queue)
+var queue *jobQueue
+
+// openQueue opens the queue stored in dir, with the jobs it already holds
+func openQueue(dir string) (*jobQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %v", err)
+	}
+	q := &jobQueue{dir: dir, jobs: make(map[int]*Job), nextID: 1, wake: make(chan struct{}, 1)}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		var job Job
+		if err := readJSONFile(path, &job); err != nil {
+			log.Printf("Skipping unreadable queue job %s: %v", path, err)
+			continue
+		}
+		if err := q.loadResults(&job); err != nil {
+			log.Printf("Failed to read the results of queue job %d: %v", job.ID, err)
+		}
+		q.jobs[job.ID] = &job
+		q.nextID = max(q.nextID, job.ID+1)
+	}
+	return q, nil
+}
+
+// resultsPath returns the results file of a job
+func (q *jobQueue) resultsPath(id int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%06d.results.jsonl", id))
+}
+
+// loadResults reads the results of a job's cases. Results of cases after Next,
+// stored just before a crash kept the job from recording its progress, are left
+// out, as those cases run again. A case that ran again has more than one line,
+// and its last one is its result.
+func (q *jobQueue) loadResults(job *Job) error {
+	job.Results = []TestResult{}
+	f, err := os.Open(q.resultsPath(job.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	results := make(map[int]TestResult)
+	dec := json.NewDecoder(f)
+	for {
+		var line jobResult
+		// The file ends at its end, or at a line cut short by a crash
+		if err := dec.Decode(&line); err != nil {
+			break
+		}
+		if line.Index < job.Next {
+			results[line.Index] = line.Result
+		}
+	}
+	for _, index := range slices.Sorted(maps.Keys(results)) {
+		job.Results = append(job.Results, results[index])
+	}
+	return nil
+}
+
+// save stores the progress of a job without its results, through a temporary
+// file so a crash does not leave it half written
+func (q *jobQueue) save(job *Job) {
+	progress := *job
+	progress.Results = nil
+	data, _ := json.MarshalIndent(progress, "", "  ")
+	path := filepath.Join(q.dir, fmt.Sprintf("%06d.json", job.ID))
+	err := os.WriteFile(path+".tmp", append(data, '\n'), 0644)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Printf("Failed to store queue job %d: %v", job.ID, err)
+	}
+}
+
+// appendResult appends the result of the case index to the results file of a job
+func (q *jobQueue) appendResult(job *Job, index int, result TestResult) {
+	data, _ := json.Marshal(jobResult{Index: index, Result: result})
+	f, err := os.OpenFile(q.resultsPath(job.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to store a result of queue job %d: %v", job.ID, err)
+	}
+}
+
+// submit adds a suite run to the queue
+func (q *jobQueue) submit(suite string, version int, user, lang string) *Job {
+	q.mu.Lock()
+	job := &Job{ID: q.nextID, Status: jobQueued, User: user, Lang: lang, Submitted: time.Now(),
+		SuiteRun: SuiteRun{Suite: suite, Version: version, Results: []TestResult{}}}
+	q.nextID++
+	q.jobs[job.ID] = job
+	q.save(job)
+	snapshot := *job
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return &snapshot
+}
+
+// Error of requests for a job the queue does not hold
+var errUnknownJob = errors.New("unknown job")
+
+// cancel cancels a queued job, or a running job once its current case is done
+func (q *jobQueue) cancel(id int) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", errUnknownJob, id)
+	}
+	if job.Status != jobQueued && job.Status != jobRunning {
+		return nil, fmt.Errorf("job %d is %s", id, job.Status)
+	}
+	job.Status = jobCanceled
+	now := time.Now()
+	job.Finished = &now
+	q.save(job)
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// list returns the jobs, newest first
+func (q *jobQueue) list() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		summary := *job
+		summary.Results = nil
+		jobs = append(jobs, summary)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID > jobs[j].ID })
+	return jobs
+}
+
+// job returns a job with its results
+func (q *jobQueue) job(id int) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	snapshot := *job
+	snapshot.Results = append([]TestResult{}, job.Results...)
+	return snapshot, true
+}
+
+// pending returns the oldest job left to run: an interrupted one first, then the
+// oldest queued one
+func (q *jobQueue) pending() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *Job
+	for _, job := range q.jobs {
+		switch {
+		case job.Status == jobRunning && (next == nil || next.Status != jobRunning || job.ID < next.ID):
+			next = job
+		case job.Status == jobQueued && (next == nil || next.Status == jobQueued && job.ID < next.ID):
+			next = job
+		}
+	}
+	return next
+}
+
+// work runs the jobs of the queue until ctx is done
+func (q *jobQueue) work(ctx context.Context) {
+	for {
+		if job := q.pending(); job != nil {
+			q.run(job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
+
+// run runs the remaining cases of a job, storing it after each one
+func (q *jobQueue) run(job *Job) {
+	q.mu.Lock()
+	if job.Status == jobRunning {
+		job.Resumed++
+	}
+	job.Status = jobRunning
+	if job.Started == nil {
+		now := time.Now()
+		job.Started = &now
+	}
+	q.save(job)
+	name, version, lang, start := job.Suite, job.Version, job.Lang, job.Next
+	q.mu.Unlock()
+
+	suite, err := loadSuiteVersion(name, version)
+	if err != nil {
+		q.finish(job, jobFailed, err.Error())
+		return
+	}
+	if start > 0 {
+		log.Printf("Resuming suite '%s' version %d (job %d) at case %d of %d", name, version, job.ID, start+1, len(suite.Cases))
+	} else {
+		log.Printf("Running queued suite '%s' version %d (job %d, %d cases)", name, version, job.ID, len(suite.Cases))
+	}
+
+	canceled := func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return job.Status == jobCanceled
+	}
+	runSuiteFrom(suite, version, lang, start, func(index int, result *TestResult) {
+		if result == nil {
+			return
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		job.Results = append(job.Results, *result)
+		q.appendResult(job, index, *result)
+		if result.Success {
+			job.Passed++
+		} else {
+			job.Failed++
+		}
+		job.Next = index + 1
+		q.save(job)
+	}, canceled)
+	if canceled() {
+		log.Printf("Queued suite '%s' (job %d) canceled after %d of %d cases", name, job.ID, job.Next, len(suite.Cases))
+		return
+	}
+	q.finish(job, jobDone, "")
+}
+
+// finish ends a job with its final status
+func (q *jobQueue) finish(job *Job, status, errorDetails string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	job.Status, job.Error, job.Finished = status, errorDetails, &now
+	q.save(job)
+	log.Printf("Queued suite '%s' (job %d) %s: %d passed, %d failed", job.Suite, job.ID, status, job.Passed, job.Failed)
+}
+
+// handleQueue lists the queued suite runs (GET /queue), or one with its results
+// (GET /queue?id=...)
+func handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if queue == nil {
+		http.Error(w, "The queue is disabled (start the simulator with -queue)", http.StatusNotFound)
+		return
+	}
+
+	var v interface{}
+	if s := r.URL.Query().Get("id"); s != "" {
+		id, _ := strconv.Atoi(s)
+		job, ok := queue.job(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown job '%s'", s), http.StatusNotFound)
+			return
+		}
+		v = job
+	} else {
+		v = queue.list()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleQueueSubmit queues a run of a suite, the current version or the one given
+// by version (POST /queue/submit?name=...&version=...)
+func handleQueueSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if queue == nil {
+		http.Error(w, "The queue is disabled (start the simulator with -queue)", http.StatusNotFound)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	version, err := recordSuiteVersion(name, fileEditUser)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid version '%s'", v), http.StatusBadRequest)
+			return
+		}
+		if _, err := loadSuiteVersion(name, version); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	job := queue.submit(name, version, requestUser(r), requestLanguage(r))
+	log.Printf("Queued suite '%s' version %d as job %d for %s", name, version, job.ID, job.User)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleQueueCancel cancels a queued or running suite run (POST /queue/cancel?id=...)
+func handleQueueCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if queue == nil {
+		http.Error(w, "The queue is disabled (start the simulator with -queue)", http.StatusNotFound)
+		return
+	}
+
+	s := r.URL.Query().Get("id")
+	id, _ := strconv.Atoi(s)
+	job, err := queue.cancel(id)
+	if err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errUnknownJob) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("Job %d canceled by %s", id, requestUser(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueueResume(t *testing.T) {
+	useFakeProfiles(t, map[string]*DLLProfile{DefaultProfileName: {}})
+	saved := suitesDir
+	suitesDir = t.TempDir()
+	t.Cleanup(func() { suitesDir = saved })
+
+	suite := Suite{Name: "resume"}
+	for _, id := range []string{"1", "2", "3"} {
+		suite.Cases = append(suite.Cases, TestCase{Name: "case " + id,
+			Parameters: []Parameter{{"Endpoint", "getInfo"}, {"ID", id}, {"CFResp", "yes"}}})
+	}
+	data, _ := json.Marshal(suite)
+	if err := os.MkdirAll(filepath.Join(suitesDir, "resume"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(suitesDir, "resume", suiteFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first case is done, and the result of the second one was stored just
+	// before a crash kept the job from recording its progress
+	dir := t.TempDir()
+	q, err := openQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{ID: 1, Status: jobRunning, Next: 1, SuiteRun: SuiteRun{Suite: "resume", Passed: 1}}
+	q.save(job)
+	q.appendResult(job, 0, TestResult{Name: "case 1", Success: true})
+	q.appendResult(job, 1, TestResult{Name: "stale"})
+
+	q, err = openQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.run(q.pending())
+	if job, _ := q.job(1); job.Status != jobDone || job.Resumed != 1 || job.Passed != 3 || len(job.Results) != 3 {
+		t.Fatalf("resumed job: %+v", job)
+	}
+
+	// The second case has two lines now, and the last one counts
+	q, err = openQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ := q.job(1)
+	if len(reloaded.Results) != 3 {
+		t.Fatalf("reloaded %d results, want 3", len(reloaded.Results))
+	}
+	for i, result := range reloaded.Results {
+		if want := suite.Cases[i].Name; result.Name != want || !result.Success {
+			t.Errorf("result %d: %q, success %v; want %q to pass", i, result.Name, result.Success, want)
+		}
+	}
+}
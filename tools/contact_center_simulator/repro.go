@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/pe"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// reproScript calls the DLL with the input buffer of a stored run through P/Invoke,
+// so the call can be reproduced on any Windows machine without the simulator
+var reproScript = template.Must(template.New("repro.ps1").Parse(`# Reproduces run {{.ID}} of the Contact Center Simulator outside the simulator:
+# loads the DLL, calls CustomFunctionExample with the recorded input buffer
+# (input.bin) and writes the output buffer to output.bin.
+#
+# Profile:      {{.Profile.Name}} (buffer protocol v{{.Profile.Protocol}}{{if .Profile.Checksum}}, checksums{{end}})
+# DLL:          {{.DLLName}}{{if .Result.DllVersion}} version {{.Result.DllVersion}}{{end}}
+# SHA-256:      {{if .Result.DllHash}}{{.Result.DllHash}}{{else}}unknown{{end}}
+# Return code:  {{.Result.ReturnCode}} in the simulator
+#
+# The DLL reads config.ini from its own directory. Run repro.bat, which picks the
+# PowerShell matching the DLL's bitness, or:
+#   powershell -ExecutionPolicy Bypass -File repro.ps1 -Dll C:\path\to\{{.DLLName}}
+param(
+    [string]$Dll = (Join-Path $PSScriptRoot '{{.DLLName}}'),
+    [string]$InputFile = (Join-Path $PSScriptRoot 'input.bin'),
+    [string]$OutputFile = (Join-Path $PSScriptRoot 'output.bin')
+)
+$ErrorActionPreference = 'Stop'
+
+Add-Type -TypeDefinition @'
+using System;
+using System.Runtime.InteropServices;
+
+public static class Repro {
+    [DllImport("kernel32", SetLastError = true, CharSet = CharSet.Unicode)]
+    public static extern IntPtr LoadLibraryExW(string path, IntPtr file, uint flags);
+
+    [DllImport("kernel32", SetLastError = true, CharSet = CharSet.Ansi)]
+    public static extern IntPtr GetProcAddress(IntPtr module, string name);
+
+    [UnmanagedFunctionPointer(CallingConvention.Cdecl)]
+    public delegate int CustomFunction(byte[] dataIn, byte[] dataOut);
+
+    [UnmanagedFunctionPointer(CallingConvention.Cdecl)]
+    public delegate IntPtr LastErrorFunction();
+}
+'@
+
+# LOAD_WITH_ALTERED_SEARCH_PATH finds the DLL's dependencies next to it
+$path = (Resolve-Path $Dll).Path
+$module = [Repro]::LoadLibraryExW($path, [IntPtr]::Zero, 8)
+if ($module -eq [IntPtr]::Zero) {
+    $code = [Runtime.InteropServices.Marshal]::GetLastWin32Error()
+    throw "Cannot load ${path}: Windows error $code (193 means the DLL and this PowerShell differ in bitness)"
+}
+$function = [Repro]::GetProcAddress($module, 'CustomFunctionExample')
+if ($function -eq [IntPtr]::Zero) {
+    throw "$path does not export CustomFunctionExample"
+}
+$call = [Runtime.InteropServices.Marshal]::GetDelegateForFunctionPointer($function, [Repro+CustomFunction])
+
+$inputBuffer = [IO.File]::ReadAllBytes($InputFile)
+$outputBuffer = New-Object byte[] {{.OutputSize}}
+Write-Host "Calling $path with $($inputBuffer.Length) input bytes"
+$elapsed = [Diagnostics.Stopwatch]::StartNew()
+$ret = $call.Invoke($inputBuffer, $outputBuffer)
+$elapsed.Stop()
+Write-Host "Return code: $ret (the simulator got {{.Result.ReturnCode}}) in $($elapsed.Elapsed.TotalMilliseconds) ms"
+
+$lastError = [Repro]::GetProcAddress($module, 'GetLastErrorMessage')
+if ($lastError -ne [IntPtr]::Zero) {
+    $message = [Runtime.InteropServices.Marshal]::GetDelegateForFunctionPointer($lastError, [Repro+LastErrorFunction]).Invoke()
+    Write-Host "GetLastErrorMessage: $([Runtime.InteropServices.Marshal]::PtrToStringAnsi($message))"
+}
+
+[IO.File]::WriteAllBytes($OutputFile, $outputBuffer)
+$text = [Text.Encoding]::GetEncoding(28591).GetString($outputBuffer) -replace "\x00", '.'
+Write-Host "Output buffer (written to $OutputFile, NUL shown as .):"
+Write-Host $text
+exit $ret
+`))
+
+// reproBatch starts the script with the PowerShell of the DLL's bitness, as a
+// 32-bit DLL cannot be loaded into a 64-bit process
+var reproBatch = template.Must(template.New("repro.bat").Parse(`@echo off
+rem Reproduces run {{.ID}} of the Contact Center Simulator: calls {{.DLLName}}
+rem with input.bin outside the simulator (see repro.ps1)
+set PS=%SystemRoot%\System32\WindowsPowerShell\v1.0\powershell.exe
+{{if .Is32Bit}}if exist "%SystemRoot%\SysWOW64\WindowsPowerShell\v1.0\powershell.exe" set PS=%SystemRoot%\SysWOW64\WindowsPowerShell\v1.0\powershell.exe
+{{end}}"%PS%" -NoProfile -ExecutionPolicy Bypass -File "%~dp0repro.ps1" %*
+exit /b %ERRORLEVEL%
+`))
+
+// reproReadme explains the bundle to whoever receives it, such as the DLL vendor
+var reproReadme = template.Must(template.New("README.txt").Parse(`Reproduction of a CustomDLL call (run {{.ID}})
+
+Put {{.DLLName}}{{if .Result.DllHash}} (SHA-256 {{.Result.DllHash}}){{end}} and config.ini in this
+directory, or pass -Dll to repro.ps1, and run repro.bat. The script calls
+CustomFunctionExample with input.bin, the exact input buffer the simulator passed,
+and prints the return code and GetLastErrorMessage.
+
+Profile:       {{.Profile.Name}} (buffer protocol v{{.Profile.Protocol}}, checksums {{if .Profile.Checksum}}on{{else}}off{{end}}, charset {{.Profile.Charset}})
+Return code:   {{.Result.ReturnCode}}
+Duration:      {{printf "%.1f" .Result.DurationMs}} ms
+{{- if .Result.DllVersion}}
+DLL version:   {{.Result.DllVersion}}{{end}}
+
+Parameters:
+{{range $key, $value := .Result.Parameters}}  {{$key}} = {{$value}}
+{{end}}
+{{- if .Result.CurlCommand}}
+Backend request the DLL is expected to make:
+  {{.Result.CurlCommand}}
+{{end}}
+{{- if .Result.ErrorDetails}}
+Error details:
+{{.Result.ErrorDetails}}
+{{end}}
+Files:
+  repro.bat, repro.ps1  the harness
+  input.bin             input buffer
+  expected-output.bin   output buffer the simulator got
+{{- if .HasConfig}}
+  config.ini            config.ini of the DLL at the time of the bundle{{end}}
+  request.json, result.json, profile.json  the test and its result
+`))
+
+// reproData fills the templates of a reproduction bundle
+type reproData struct {
+	ID         string
+	Profile    ProfileInfo
+	Result     TestResult
+	DLLName    string
+	OutputSize int
+	Is32Bit    bool
+	HasConfig  bool
+}
+
+// reproFile is a file of a reproduction bundle
+type reproFile struct {
+	name    string
+	content []byte
+}
+
+// is32BitDLL reports whether a DLL is built for 32-bit x86; false when it cannot be read
+func is32BitDLL(path string) bool {
+	f, err := pe.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return f.Machine == pe.IMAGE_FILE_MACHINE_I386
+}
+
+// reproBundle builds the zip bundle reproducing a stored run outside the simulator:
+// the raw input buffer, a PowerShell harness calling the DLL with it, a batch file
+// starting the harness, and the run's artifacts
+func (s *runStore) reproBundle(id string) ([]byte, error) {
+	if !validArtifactName.MatchString(id) {
+		return nil, fmt.Errorf("invalid run ID '%s'", id)
+	}
+	dir := filepath.Join(s.dir, id)
+	data := reproData{ID: id}
+	if err := readJSONFile(filepath.Join(dir, runProfileFile), &data.Profile); err != nil {
+		return nil, fmt.Errorf("unknown run '%s'", id)
+	}
+	if err := readJSONFile(filepath.Join(dir, runResultFile), &data.Result); err != nil {
+		return nil, fmt.Errorf("unknown run '%s'", id)
+	}
+	if data.Profile.Fake != "" || slices.Contains(data.Result.Warnings, simulateNote) {
+		return nil, fmt.Errorf("run '%s' did not call a DLL", id)
+	}
+	input, err := os.ReadFile(filepath.Join(dir, runInputFile))
+	if err != nil {
+		return nil, fmt.Errorf("run '%s' has no input buffer", id)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, runOutputFile))
+	if err != nil {
+		return nil, fmt.Errorf("run '%s' has no output buffer", id)
+	}
+	data.DLLName = filepath.Base(data.Profile.DLL)
+	data.OutputSize = len(output)
+	data.Is32Bit = is32BitDLL(data.Profile.DLL)
+
+	// The original config.ini, also while -intercept points base_url at the proxy
+	configPath := filepath.Join(filepath.Dir(data.Profile.DLL), "config.ini")
+	config, err := os.ReadFile(configPath + configBackupSuffix)
+	if err != nil {
+		config, err = os.ReadFile(configPath)
+	}
+	data.HasConfig = err == nil
+
+	var bundle bytes.Buffer
+	zw := zip.NewWriter(&bundle)
+	add := func(name string, content []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(content)
+		return err
+	}
+	// Scripts get CRLF line endings for cmd and Notepad
+	addTemplate := func(t *template.Template) error {
+		var text strings.Builder
+		if err := t.Execute(&text, data); err != nil {
+			return err
+		}
+		return add(t.Name(), []byte(strings.ReplaceAll(text.String(), "\n", "\r\n")))
+	}
+
+	for _, t := range []*template.Template{reproScript, reproBatch, reproReadme} {
+		if err := addTemplate(t); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", t.Name(), err)
+		}
+	}
+	files := []reproFile{{"input.bin", input}, {"expected-output.bin", output}}
+	if data.HasConfig {
+		files = append(files, reproFile{"config.ini", config})
+	}
+	for _, name := range []string{runRequestFile, runResultFile, runProfileFile} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			files = append(files, reproFile{name, content})
+		}
+	}
+	for _, f := range files {
+		if err := add(f.name, f.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return bundle.Bytes(), nil
+}
+
+// handleRunRepro returns a zip bundle reproducing a stored run outside the
+// simulator (GET /runs/repro?id=...), for handing a failing call to the DLL vendor
+func handleRunRepro(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if runs == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	bundle, err := runs.reproBundle(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="repro-%s.zip"`, id))
+	w.Write(bundle)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page sizes of the results API
+const (
+	DefaultResultsLimit = 100
+	MaxResultsLimit     = 1000
+)
+
+// ResultSummary is one entry of the result history
+type ResultSummary struct {
+	RunID      string    `json:"runId"`
+	Time       time.Time `json:"time"`
+	Name       string    `json:"name"`
+	Profile    string    `json:"profile"`
+	Endpoint   string    `json:"endpoint"`
+	Success    bool      `json:"success"`
+	Crashed    bool      `json:"crashed,omitempty"`
+	ReturnCode int       `json:"returnCode"`
+	DurationMs float64   `json:"durationMs"`
+	// Suite and SuiteVersion are set for runs of a suite
+	Suite        string `json:"suite,omitempty"`
+	SuiteVersion int    `json:"suiteVersion,omitempty"`
+	// DllVersion and DllHash identify the DLL build of the run
+	DllVersion string `json:"dllVersion,omitempty"`
+	DllHash    string `json:"dllHash,omitempty"`
+}
+
+// ResultsPage is a page of the results API. NextCursor is empty on the last page.
+type ResultsPage struct {
+	Results    []ResultSummary `json:"results"`
+	Total      int             `json:"total"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// Orderings of the results API. Ties are broken by run ID, so the order is total
+// and a cursor always resumes after the same entry.
+var resultOrderings = map[string]func(a, b *ResultSummary) int{
+	"time": func(a, b *ResultSummary) int {
+		return a.Time.Compare(b.Time)
+	},
+	"duration": func(a, b *ResultSummary) int {
+		switch {
+		case a.DurationMs < b.DurationMs:
+			return -1
+		case a.DurationMs > b.DurationMs:
+			return 1
+		}
+		return 0
+	},
+	"status": func(a, b *ResultSummary) int {
+		// Failures first, then by return code
+		switch {
+		case a.Success != b.Success:
+			if a.Success {
+				return 1
+			}
+			return -1
+		case a.ReturnCode != b.ReturnCode:
+			return a.ReturnCode - b.ReturnCode
+		}
+		return 0
+	},
+}
+
+// resultIndex keeps the summaries of the stored runs in memory, so the history can
+// be paged, sorted and filtered without reading every run directory
+type resultIndex struct {
+	mu      sync.RWMutex
+	results map[string]*ResultSummary
+}
+
+// Index of the stored results
+var results = &resultIndex{results: make(map[string]*ResultSummary)}
+
+// summarize builds the history entry of a run
+func summarize(id string, testCase TestCase, result TestResult) *ResultSummary {
+	t, err := time.ParseInLocation("20060102-150405", id[:min(len(id), 15)], time.Local)
+	if err != nil {
+		t = time.Now()
+	}
+	endpoint := ""
+	for _, param := range testCase.Parameters {
+		if param.Key == "Endpoint" {
+			endpoint = param.Value
+		}
+	}
+	return &ResultSummary{
+		RunID:        id,
+		Time:         t,
+		Name:         testCase.Name,
+		Profile:      result.Profile,
+		Endpoint:     endpoint,
+		Success:      result.Success,
+		Crashed:      result.Crash != nil,
+		ReturnCode:   result.ReturnCode,
+		DurationMs:   result.DurationMs,
+		Suite:        result.Suite,
+		SuiteVersion: result.SuiteVersion,
+		DllVersion:   result.DllVersion,
+		DllHash:      result.DllHash,
+	}
+}
+
+// add records the result of a run
+func (x *resultIndex) add(id string, testCase TestCase, result TestResult) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.results[id] = summarize(id, testCase, result)
+}
+
+// load indexes the results of the runs already in the store, and remembers the
+// parameters of the passing ones for autocompletion
+func (x *resultIndex) load(s *runStore) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read runs directory: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		var testCase TestCase
+		var result TestResult
+		if err := readJSONFile(filepath.Join(s.dir, entry.Name(), runRequestFile), &testCase); err != nil {
+			continue
+		}
+		if err := readJSONFile(filepath.Join(s.dir, entry.Name(), runResultFile), &result); err != nil {
+			continue
+		}
+		x.add(entry.Name(), testCase, result)
+		recent.add(testCase, result)
+	}
+	return nil
+}
+
+// readJSONFile decodes a JSON file into v
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ResultsQuery selects, orders and pages the result history
+type ResultsQuery struct {
+	Profile    string
+	Endpoint   string
+	ReturnCode *int
+	Sort       string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+// parseResultsQuery reads the query parameters of the results API
+func parseResultsQuery(r *http.Request) (ResultsQuery, error) {
+	values := r.URL.Query()
+	q := ResultsQuery{
+		Profile:  values.Get("profile"),
+		Endpoint: values.Get("endpoint"),
+		Sort:     values.Get("sort"),
+		Limit:    DefaultResultsLimit,
+		Cursor:   values.Get("cursor"),
+	}
+	if q.Sort == "" {
+		q.Sort = "time"
+	}
+	if resultOrderings[q.Sort] == nil {
+		return q, fmt.Errorf("unknown sort '%s' (valid sorts: duration, status, time)", q.Sort)
+	}
+	switch order := values.Get("order"); order {
+	case "", "desc":
+		q.Descending = true
+	case "asc":
+	default:
+		return q, fmt.Errorf("unknown order '%s' (valid orders: asc, desc)", order)
+	}
+	if v := values.Get("returnCode"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid returnCode '%s'", v)
+		}
+		q.ReturnCode = &code
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MaxResultsLimit {
+			return q, fmt.Errorf("invalid limit '%s' (1 to %d)", v, MaxResultsLimit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// match reports whether a result passes the filters of the query
+func (q ResultsQuery) match(s *ResultSummary) bool {
+	return (q.Profile == "" || s.Profile == q.Profile) &&
+		(q.Endpoint == "" || strings.EqualFold(s.Endpoint, q.Endpoint)) &&
+		(q.ReturnCode == nil || s.ReturnCode == *q.ReturnCode)
+}
+
+// less orders two results as the query requires
+func (q ResultsQuery) less(a, b *ResultSummary) bool {
+	c := resultOrderings[q.Sort](a, b)
+	if c == 0 {
+		c = strings.Compare(a.RunID, b.RunID)
+	}
+	if q.Descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+// encodeCursor makes the opaque cursor resuming after a result
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// query returns a page of the results matching the query. The cursor is keyset
+// based: the next page starts after the last entry of the previous one, so
+// results stored in the meantime do not shift or repeat entries.
+func (x *resultIndex) query(q ResultsQuery) (ResultsPage, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var after *ResultSummary
+	if q.Cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil || x.results[string(id)] == nil {
+			return ResultsPage{}, fmt.Errorf("invalid cursor '%s'", q.Cursor)
+		}
+		after = x.results[string(id)]
+	}
+
+	var matched []*ResultSummary
+	for _, s := range x.results {
+		if q.match(s) {
+			matched = append(matched, s)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return q.less(matched[i], matched[j]) })
+
+	page := ResultsPage{Results: []ResultSummary{}, Total: len(matched)}
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matched), func(i int) bool { return q.less(after, matched[i]) })
+	}
+	end := min(start+q.Limit, len(matched))
+	for _, s := range matched[start:end] {
+		page.Results = append(page.Results, *s)
+	}
+	if end < len(matched) {
+		page.NextCursor = encodeCursor(matched[end-1].RunID)
+	}
+	return page, nil
+}
+
+// handleResults returns a page of the result history (GET /api/results), filtered
+// by profile, endpoint and returnCode, sorted by time, duration or status
+// (order=asc or desc, default newest first), with limit and cursor for paging
+func handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if runs == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	q, err := parseResultsQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := results.query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
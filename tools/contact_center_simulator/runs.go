@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default directory of run artifacts, relative to the working directory
+const DefaultRunsDir = "runs"
+
+// Artifacts every run stores
+const (
+	runRequestFile = "request.json"
+	runProfileFile = "profile.json"
+	runResultFile  = "result.json"
+	runInputFile   = "input.bin"
+	runOutputFile  = "output.bin"
+	// Output of a crashed worker, stored for crashed runs only
+	runCrashLogFile = "crash.log"
+	// ETW trace of the call, stored for profiles with ETW tracing only
+	runTraceFile = "trace.etl"
+)
+
+// Valid run IDs and artifact names, which must not reach outside the run directory
+var validArtifactName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// ArtifactInfo describes a stored artifact
+type ArtifactInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// RunInfo describes a stored run and its artifacts
+type RunInfo struct {
+	ID        string         `json:"id"`
+	Time      time.Time      `json:"time"`
+	Artifacts []ArtifactInfo `json:"artifacts"`
+}
+
+// runStore keeps the artifacts of each run (the test request, the profile, the raw
+// buffers and the result, plus anything a run adds such as crash logs or reports)
+// in a directory of its own, so everything needed to investigate a failure is in one place
+type runStore struct {
+	dir string
+
+	mu   sync.Mutex
+	last string
+	seq  int
+}
+
+// Run artifact storage, nil when disabled with -runs ""
+var runs *runStore
+
+// newRunStore creates a store writing to dir
+func newRunStore(dir string) (*runStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create runs directory: %v", err)
+	}
+	return &runStore{dir: dir}, nil
+}
+
+// newID returns a unique, time-ordered run ID
+func (s *runStore) newID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp := time.Now().Format("20060102-150405")
+	if stamp != s.last {
+		s.last, s.seq = stamp, 0
+	}
+	s.seq++
+	return fmt.Sprintf("%s-%03d", stamp, s.seq)
+}
+
+// save stores the artifacts of a test run and returns its ID
+func (s *runStore) save(testCase TestCase, profile *DLLProfile, result TestResult) (string, error) {
+	id := s.newID()
+	if err := os.Mkdir(filepath.Join(s.dir, id), 0755); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %v", err)
+	}
+
+	// Point the crash report at the stored worker output, and the hooks at theirs
+	if result.Crash != nil {
+		result.Crash.Log = fmt.Sprintf("/runs/artifact?id=%s&name=%s", id, runCrashLogFile)
+	}
+	hookArtifacts(result.Hooks)
+	tracePath := ""
+	if result.Trace != nil && result.Trace.path != "" {
+		tracePath = result.Trace.path
+		result.Trace.File = fmt.Sprintf("/runs/artifact?id=%s&name=%s", id, runTraceFile)
+	}
+
+	artifacts := []struct {
+		name string
+		v    interface{}
+	}{
+		{runRequestFile, testCase},
+		{runProfileFile, profile.info()},
+		{runResultFile, result},
+	}
+	for _, a := range artifacts {
+		data, err := json.MarshalIndent(a.v, "", "  ")
+		if err != nil {
+			return id, fmt.Errorf("failed to encode %s: %v", a.name, err)
+		}
+		if err := s.addArtifact(id, a.name, append(data, '\n')); err != nil {
+			return id, err
+		}
+	}
+	if result.input != nil {
+		if err := s.addArtifact(id, runInputFile, result.input); err != nil {
+			return id, err
+		}
+	}
+	if result.output != nil {
+		if err := s.addArtifact(id, runOutputFile, result.output); err != nil {
+			return id, err
+		}
+	}
+	if result.Crash != nil {
+		if err := s.addArtifact(id, runCrashLogFile, []byte(result.Crash.output)); err != nil {
+			return id, err
+		}
+	}
+	for _, h := range result.Hooks {
+		if err := s.addArtifact(id, h.Artifact, h.output); err != nil {
+			return id, err
+		}
+	}
+	if tracePath != "" {
+		if err := s.moveArtifact(id, runTraceFile, tracePath); err != nil {
+			return id, err
+		}
+		result.Trace.path = ""
+	}
+	return id, nil
+}
+
+// moveArtifact moves a file into the directory of a run, such as a trace too
+// large to hold in memory
+func (s *runStore) moveArtifact(id, name, path string) error {
+	if !validArtifactName.MatchString(id) || !validArtifactName.MatchString(name) {
+		return fmt.Errorf("invalid artifact '%s/%s'", id, name)
+	}
+	target := filepath.Join(s.dir, id, name)
+	if err := os.Rename(path, target); err == nil {
+		return nil
+	}
+	// The temporary directory may be on another volume
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read artifact %s of run %s: %v", name, id, err)
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return fmt.Errorf("failed to write artifact %s of run %s: %v", name, id, err)
+	}
+	os.Remove(path)
+	return nil
+}
+
+// addArtifact stores a file in the directory of a run
+func (s *runStore) addArtifact(id, name string, data []byte) error {
+	if !validArtifactName.MatchString(id) || !validArtifactName.MatchString(name) {
+		return fmt.Errorf("invalid artifact '%s/%s'", id, name)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, id, name), data, 0644); err != nil {
+		return fmt.Errorf("failed to write artifact %s of run %s: %v", name, id, err)
+	}
+	return nil
+}
+
+// run describes a stored run
+func (s *runStore) run(id string) (RunInfo, error) {
+	if !validArtifactName.MatchString(id) {
+		return RunInfo{}, fmt.Errorf("invalid run ID '%s'", id)
+	}
+	dir := filepath.Join(s.dir, id)
+	stat, err := os.Stat(dir)
+	if err != nil || !stat.IsDir() {
+		return RunInfo{}, fmt.Errorf("unknown run '%s'", id)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return RunInfo{}, fmt.Errorf("failed to read run %s: %v", id, err)
+	}
+
+	info := RunInfo{ID: id, Time: stat.ModTime(), Artifacts: []ArtifactInfo{}}
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		info.Artifacts = append(info.Artifacts, ArtifactInfo{Name: entry.Name(), Size: fi.Size()})
+	}
+	return info, nil
+}
+
+// list describes every stored run, most recent first
+func (s *runStore) list() ([]RunInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runs directory: %v", err)
+	}
+
+	list := []RunInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if info, err := s.run(entry.Name()); err == nil {
+			list = append(list, info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+// recordRun stores the artifacts of a run if the store is enabled, setting the
+// run ID of the result, and adds the run to the time series
+func recordRun(testCase TestCase, profile *DLLProfile, result *TestResult) {
+	if series != nil {
+		series.add(sourceServer, result.Profile, endpointOf(testCase), result.DurationMs, result.Success)
+	}
+	recent.add(testCase, *result)
+	if runs == nil {
+		return
+	}
+	id, err := runs.save(testCase, profile, *result)
+	if err != nil {
+		log.Printf("Failed to store run artifacts: %v", err)
+		return
+	}
+	result.RunID = id
+	results.add(id, testCase, *result)
+}
+
+// handleRuns lists the stored runs (GET /runs), or the artifacts of one run
+// (GET /runs?id=...)
+func handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if runs == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	var v interface{}
+	var err error
+	if id := r.URL.Query().Get("id"); id != "" {
+		v, err = runs.run(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	} else {
+		v, err = runs.list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleRunArtifact downloads an artifact of a run (GET /runs/artifact?id=...&name=...)
+func handleRunArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if runs == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	id, name := r.URL.Query().Get("id"), r.URL.Query().Get("name")
+	if !validArtifactName.MatchString(id) || !validArtifactName.MatchString(name) {
+		http.Error(w, "Invalid run ID or artifact name", http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(filepath.Join(runs.dir, id, name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unknown artifact '%s' of run '%s'", name, id), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		http.Error(w, fmt.Sprintf("Unknown artifact '%s' of run '%s'", name, id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s"`, id, name))
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
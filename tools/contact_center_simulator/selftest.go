@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// Default number of random parameter sets each selftest property is checked with
+const DefaultSelftestIterations = 1000
+
+// codecProperty is a property of the buffer codec that must hold for every random
+// parameter set of its generator. check returns why the property does not hold.
+type codecProperty struct {
+	name     string
+	version  buffer.Version
+	generate func(r *rand.Rand, v buffer.Version) []buffer.Pair
+	check    func(v buffer.Version, pairs []buffer.Pair) error
+}
+
+// codecProperties are the properties checked by the selftest subcommand
+var codecProperties = []codecProperty{
+	{"round-trip", buffer.V1, randomPairs, checkRoundTrip},
+	{"round-trip", buffer.V2, randomPairs, checkRoundTrip},
+	{"size", buffer.V1, randomPairs, checkSize},
+	{"size", buffer.V2, randomPairs, checkSize},
+	{"truncation", buffer.V1, overlongPairs, checkTruncation},
+	{"overlong-rejected", buffer.V2, overlongPairs, checkOverlongRejected},
+	{"checksum-round-trip", buffer.V1, randomPairs, checkChecksumRoundTrip},
+	{"checksum-round-trip", buffer.V2, randomPairs, checkChecksumRoundTrip},
+	{"checksum-detects-corruption", buffer.V1, randomPairs, checkCorruptionDetected},
+	{"checksum-detects-corruption", buffer.V2, randomPairs, checkCorruptionDetected},
+}
+
+// Characters of random keys and values besides printable ASCII
+var (
+	selftestUTF8    = []string{"ă", "î", "ș", "ț", "€", "😀"}
+	selftestControl = []byte{'\t', '\n', '\r', 0x01, 0x1b, 0x7f}
+)
+
+// randomValue returns a random key or value of at most n bytes: mostly printable
+// ASCII, with UTF-8 and control characters, and NULs in version 2, the only
+// version that carries them. Lengths at the field size are favored, as that is
+// where layouts break.
+func randomValue(r *rand.Rand, v buffer.Version, n int) string {
+	length := r.IntN(n + 1)
+	if r.IntN(4) == 0 {
+		length = n - r.IntN(2)
+	}
+	b := make([]byte, 0, length)
+	for len(b) < length {
+		switch r.IntN(10) {
+		case 0:
+			if c := selftestUTF8[r.IntN(len(selftestUTF8))]; len(b)+len(c) <= length {
+				b = append(b, c...)
+				continue
+			}
+		case 1:
+			b = append(b, selftestControl[r.IntN(len(selftestControl))])
+			continue
+		case 2:
+			if v == buffer.V2 {
+				b = append(b, 0)
+				continue
+			}
+		}
+		b = append(b, byte(' '+r.IntN('~'-' '+1)))
+	}
+	return string(b)
+}
+
+// randomPairs returns a random parameter set: up to one pair less than
+// buffer.MaxPairs, leaving room for a checksum pair, with distinct non-empty keys
+// and values fitting their fields
+func randomPairs(r *rand.Rand, v buffer.Version) []buffer.Pair {
+	count := r.IntN(buffer.MaxPairs)
+	pairs := make([]buffer.Pair, 0, count)
+	seen := map[string]bool{buffer.ChecksumKey: true}
+	for len(pairs) < count {
+		key := randomValue(r, v, buffer.KeySize)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pairs = append(pairs, buffer.Pair{Key: key, Value: randomValue(r, v, buffer.ValueSize)})
+	}
+	return pairs
+}
+
+// overlongPairs returns a random parameter set with one value longer than its field
+func overlongPairs(r *rand.Rand, v buffer.Version) []buffer.Pair {
+	pairs := randomPairs(r, v)
+	if len(pairs) == 0 {
+		pairs = append(pairs, buffer.Pair{Key: "Key"})
+	}
+	i := r.IntN(len(pairs))
+	pairs[i].Value = randomValue(r, v, buffer.ValueSize)
+	for len(pairs[i].Value) <= buffer.ValueSize {
+		pairs[i].Value += randomValue(r, v, buffer.ValueSize) + "x"
+	}
+	return pairs
+}
+
+// equalPairs compares decoded pairs with the pairs that were encoded
+func equalPairs(decoded, expected []buffer.Pair) error {
+	if len(decoded) != len(expected) {
+		return fmt.Errorf("decoded %d pairs, encoded %d", len(decoded), len(expected))
+	}
+	for i := range expected {
+		if decoded[i] != expected[i] {
+			return fmt.Errorf("pair %d decoded as %q=%q, encoded %q=%q", i+1, decoded[i].Key, decoded[i].Value, expected[i].Key, expected[i].Value)
+		}
+	}
+	return nil
+}
+
+// encodeDecode encodes pairs, checks the buffer size and decodes it again
+func encodeDecode(v buffer.Version, pairs []buffer.Pair, checksum bool) ([]byte, []buffer.Pair, error) {
+	encode := buffer.Encode
+	if checksum {
+		encode = buffer.EncodeWithChecksum
+	}
+	data, err := encode(v, pairs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode failed: %v", err)
+	}
+	decoded, err := buffer.Decode(v, data)
+	if err != nil {
+		return data, nil, fmt.Errorf("decode failed: %v", err)
+	}
+	return data, decoded, nil
+}
+
+// checkRoundTrip: decoding an encoded parameter set gives it back unchanged
+func checkRoundTrip(v buffer.Version, pairs []buffer.Pair) error {
+	_, decoded, err := encodeDecode(v, pairs, false)
+	if err != nil {
+		return err
+	}
+	return equalPairs(decoded, pairs)
+}
+
+// checkSize: a buffer has the size of its version for its number of pairs, and
+// its version is detected from its header
+func checkSize(v buffer.Version, pairs []buffer.Pair) error {
+	data, err := buffer.Encode(v, pairs)
+	if err != nil {
+		return fmt.Errorf("encode failed: %v", err)
+	}
+	if len(data) != v.Size(len(pairs)) {
+		return fmt.Errorf("buffer is %d bytes, expected %d", len(data), v.Size(len(pairs)))
+	}
+	if detected := buffer.DetectVersion(data); detected != v {
+		return fmt.Errorf("buffer detected as version %d", detected)
+	}
+	return nil
+}
+
+// checkTruncation: version 1 cuts overlong values to their field, as OSCC does
+func checkTruncation(v buffer.Version, pairs []buffer.Pair) error {
+	_, decoded, err := encodeDecode(v, pairs, false)
+	if err != nil {
+		return err
+	}
+	expected := slices.Clone(pairs)
+	for i := range expected {
+		expected[i].Value = expected[i].Value[:min(len(expected[i].Value), buffer.ValueSize)]
+	}
+	return equalPairs(decoded, expected)
+}
+
+// checkOverlongRejected: version 2 refuses to encode values longer than their field
+func checkOverlongRejected(v buffer.Version, pairs []buffer.Pair) error {
+	if _, err := buffer.Encode(v, pairs); err == nil {
+		return errors.New("an overlong value was encoded")
+	}
+	return nil
+}
+
+// checkChecksumRoundTrip: a buffer with a checksum verifies, and decodes to the
+// parameter set followed by the checksum pair
+func checkChecksumRoundTrip(v buffer.Version, pairs []buffer.Pair) error {
+	data, decoded, err := encodeDecode(v, pairs, true)
+	if err != nil {
+		return err
+	}
+	if present, err := buffer.VerifyChecksum(v, data); err != nil || !present {
+		return fmt.Errorf("checksum not verified (present: %v): %v", present, err)
+	}
+	if len(decoded) == 0 || decoded[len(decoded)-1].Key != buffer.ChecksumKey {
+		return fmt.Errorf("last pair is not the %s checksum pair", buffer.ChecksumKey)
+	}
+	return equalPairs(decoded[:len(decoded)-1], pairs)
+}
+
+// checkCorruptionDetected: flipping a bit of a checksummed pair fails verification
+func checkCorruptionDetected(v buffer.Version, pairs []buffer.Pair) error {
+	data, err := buffer.EncodeWithChecksum(v, pairs)
+	if err != nil {
+		return fmt.Errorf("encode failed: %v", err)
+	}
+	offset := buffer.Corrupt(v, data)
+	if offset < 0 {
+		return nil
+	}
+	if present, err := buffer.VerifyChecksum(v, data); err == nil {
+		return fmt.Errorf("bit flipped at offset %d not detected (checksum present: %v)", offset, present)
+	}
+	return nil
+}
+
+// shrink reduces a parameter set for which a property fails to a smaller one for
+// which it still fails, by dropping pairs and halving values, so the failure
+// reported is easy to read
+func shrink(p codecProperty, pairs []buffer.Pair) []buffer.Pair {
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(pairs); i++ {
+			smaller := slices.Delete(slices.Clone(pairs), i, i+1)
+			if p.check(p.version, smaller) != nil {
+				pairs, changed = smaller, true
+				i--
+			}
+		}
+		for i := range pairs {
+			for len(pairs[i].Value) > 0 {
+				smaller := slices.Clone(pairs)
+				smaller[i].Value = smaller[i].Value[:len(smaller[i].Value)/2]
+				if p.check(p.version, smaller) == nil {
+					break
+				}
+				pairs, changed = smaller, true
+			}
+		}
+	}
+	return pairs
+}
+
+// runSelftest implements the selftest subcommand: it checks properties of the
+// shared buffer codec, such as encode then decode giving back the same pairs,
+// with random parameter sets for both protocol versions, and prints the smallest
+// parameter set found for each property that does not hold. A failure can be
+// reproduced with the -seed it prints. It returns 1 if a property does not hold,
+// and 2 for invalid options.
+//
+//	ContactCenterSimulator selftest -iterations 10000
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	iterations := fs.Int("iterations", DefaultSelftestIterations, "Random parameter sets to check each property with")
+	seed := fs.Uint64("seed", 0, "Seed of the random parameter sets, to reproduce a failure (default time-based)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *iterations < 1 {
+		fmt.Fprintln(os.Stderr, "selftest: -iterations must be at least 1")
+		return 2
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+	fmt.Printf("Buffer codec selftest, seed %d\n", *seed)
+
+	failed := 0
+	for i, p := range codecProperties {
+		r := rand.New(rand.NewPCG(*seed, uint64(i)))
+		var failure error
+		var pairs []buffer.Pair
+		n := 0
+		for ; n < *iterations && failure == nil; n++ {
+			pairs = p.generate(r, p.version)
+			failure = p.check(p.version, pairs)
+		}
+		if failure == nil {
+			fmt.Printf("ok    %-28s v%d  %d parameter sets\n", p.name, p.version, n)
+			continue
+		}
+		failed++
+		pairs = shrink(p, pairs)
+		fmt.Printf("FAIL  %-28s v%d  after %d parameter sets: %v\n", p.name, p.version, n, p.check(p.version, pairs))
+		fmt.Printf("      smallest failing parameter set (%d pairs):\n", len(pairs))
+		for _, pair := range pairs {
+			fmt.Printf("        %q = %q\n", pair.Key, pair.Value)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d properties failed (reproduce with -seed %d)\n", failed, len(codecProperties), *seed)
+		return 1
+	}
+	fmt.Printf("All %d properties hold\n", len(codecProperties))
+	return 0
+}
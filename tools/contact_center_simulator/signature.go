@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Authenticode signature checks before a DLL is loaded (-verify-signature), and
+// refusal of DLLs without a trusted signature (-require-signature)
+var (
+	verifySignature  bool
+	requireSignature bool
+)
+
+// Index of the certificate table in the PE data directories, and the type of
+// the WIN_CERTIFICATE holding an Authenticode PKCS#7 signature
+const (
+	peCertificateTable   = 4
+	winCertTypePKCSigned = 0x0002
+)
+
+// SignatureInfo describes the Authenticode signature of a DLL
+type SignatureInfo struct {
+	Signed bool `json:"signed"`
+	// Trusted is whether WinVerifyTrust accepts the signature (nil where it is
+	// not available)
+	Trusted *bool `json:"trusted,omitempty"`
+	// Status is the outcome of the trust check, or why there is none
+	Status string `json:"status"`
+	// Signer certificate details
+	Subject    string    `json:"subject,omitempty"`
+	Issuer     string    `json:"issuer,omitempty"`
+	Serial     string    `json:"serial,omitempty"`
+	NotBefore  time.Time `json:"notBefore,omitzero"`
+	NotAfter   time.Time `json:"notAfter,omitzero"`
+	Thumbprint string    `json:"thumbprint,omitempty"`
+}
+
+// pkcs7ContentInfo is the ContentInfo wrapping the SignedData of a signature
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// pkcs7SignedData is the part of SignedData needed to find the signer's certificate
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// pkcs7SignerInfo is the start of a SignerInfo, identifying the signer's certificate
+type pkcs7SignerInfo struct {
+	Version         int
+	IssuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+}
+
+// readSignature returns the PKCS#7 signature embedded in a PE file, or nil if the
+// file is not signed
+func readSignature(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, err := pe.NewFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a PE file: %v", err)
+	}
+
+	var directory pe.DataDirectory
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > peCertificateTable {
+			directory = header.DataDirectory[peCertificateTable]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > peCertificateTable {
+			directory = header.DataDirectory[peCertificateTable]
+		}
+	}
+	if directory.VirtualAddress == 0 || directory.Size < 8 {
+		return nil, nil
+	}
+
+	// The certificate table address is a file offset: WIN_CERTIFICATE is the
+	// length, revision and type, then the certificate
+	table := make([]byte, directory.Size)
+	if _, err := f.ReadAt(table, int64(directory.VirtualAddress)); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read the certificate table: %v", err)
+	}
+	length := binary.LittleEndian.Uint32(table)
+	certType := binary.LittleEndian.Uint16(table[6:])
+	if length < 8 || int(length) > len(table) || certType != winCertTypePKCSigned {
+		return nil, fmt.Errorf("unsupported certificate table entry (type %d)", certType)
+	}
+	return table[8:length], nil
+}
+
+// signerCertificate finds the certificate of the signer in a PKCS#7 signature
+func signerCertificate(signature []byte) (*x509.Certificate, error) {
+	var info pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(signature, &info); err != nil {
+		return nil, fmt.Errorf("malformed signature: %v", err)
+	}
+	var signed pkcs7SignedData
+	if _, err := asn1.Unmarshal(info.Content.FullBytes, &signed); err != nil {
+		return nil, fmt.Errorf("malformed signed data: %v", err)
+	}
+	certs, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("signature has no readable certificates")
+	}
+	var signer pkcs7SignerInfo
+	if _, err := asn1.Unmarshal(signed.SignerInfos.Bytes, &signer); err == nil {
+		for _, cert := range certs {
+			if cert.SerialNumber.Cmp(signer.IssuerAndSerial.Serial) == 0 &&
+				bytes.Equal(cert.RawIssuer, signer.IssuerAndSerial.Issuer.FullBytes) {
+				return cert, nil
+			}
+		}
+	}
+	return certs[0], nil
+}
+
+// inspectSignature reads the Authenticode signature of a DLL and checks whether
+// Windows trusts it
+func inspectSignature(path string) SignatureInfo {
+	signature, err := readSignature(path)
+	if err != nil {
+		return SignatureInfo{Status: fmt.Sprintf("cannot be read: %v", err)}
+	}
+	if signature == nil {
+		return SignatureInfo{Status: "not signed"}
+	}
+
+	info := SignatureInfo{Signed: true}
+	if cert, err := signerCertificate(signature); err != nil {
+		info.Status = err.Error()
+	} else {
+		thumbprint := sha1.Sum(cert.Raw)
+		info.Subject = cert.Subject.String()
+		info.Issuer = cert.Issuer.String()
+		info.Serial = strings.ToUpper(cert.SerialNumber.Text(16))
+		info.NotBefore, info.NotAfter = cert.NotBefore, cert.NotAfter
+		info.Thumbprint = strings.ToUpper(hex.EncodeToString(thumbprint[:]))
+	}
+	trusted, status, ok := verifyTrust(path)
+	if ok {
+		info.Trusted = &trusted
+	}
+	if info.Status == "" || ok {
+		info.Status = status
+	}
+	return info
+}
+
+// checkSignature verifies the signature of a DLL before it is loaded, with
+// -verify-signature or -require-signature. With -require-signature, a DLL
+// without a trusted signature is refused.
+func checkSignature(path string) error {
+	if !verifySignature && !requireSignature {
+		return nil
+	}
+	info := inspectSignature(path)
+	switch {
+	case info.Trusted != nil && *info.Trusted:
+		log.Printf("Signature of %s is trusted: %s", path, info.Subject)
+		return nil
+	case requireSignature && (!info.Signed || info.Trusted != nil):
+		return fmt.Errorf("refusing to load %s, which has no trusted signature (%s)", path, info.Status)
+	case info.Signed && info.Trusted == nil:
+		log.Printf("Warning: %s is signed by %s, but the signature cannot be verified: %s", path, info.Subject, info.Status)
+	default:
+		log.Printf("Warning: signature of %s: %s", path, info.Status)
+	}
+	return nil
+}
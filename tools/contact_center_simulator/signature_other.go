@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// verifyTrust is not available on this platform: signer details are shown, but
+// whether the signature is trusted cannot be checked
+func verifyTrust(path string) (bool, string, bool) {
+	return false, "trust not verified (WinVerifyTrust is only available on Windows)", false
+}
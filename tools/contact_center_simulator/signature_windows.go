@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	wintrust           = syscall.NewLazyDLL("wintrust.dll")
+	procWinVerifyTrust = wintrust.NewProc("WinVerifyTrust")
+)
+
+// WINTRUST_ACTION_GENERIC_VERIFY_V2, the Authenticode policy
+var actionGenericVerifyV2 = syscall.GUID{
+	Data1: 0x00aac56b, Data2: 0xcd44, Data3: 0x11d0,
+	Data4: [8]byte{0x8c, 0xc2, 0x00, 0xc0, 0x4f, 0xc2, 0x95, 0xee},
+}
+
+// WINTRUST_DATA settings of a silent check of a file
+const (
+	wtdUINone            = 2
+	wtdRevokeNone        = 0
+	wtdChoiceFile        = 1
+	wtdStateActionVerify = 1
+	wtdStateActionClose  = 2
+)
+
+// Results of WinVerifyTrust worth naming
+var trustErrors = map[uint32]string{
+	0x800B0100: "no signature",
+	0x800B0004: "the publisher is not trusted",
+	0x800B0111: "the certificate is explicitly distrusted",
+	0x800B0101: "the certificate has expired",
+	0x800B0109: "the certificate chain ends in an untrusted root",
+	0x80096010: "the file was modified after it was signed",
+	0x800B010C: "the certificate was revoked",
+	0x80092026: "the check is blocked by the security settings",
+}
+
+// wintrustFileInfo is WINTRUST_FILE_INFO
+type wintrustFileInfo struct {
+	cbStruct       uint32
+	pcwszFilePath  *uint16
+	hFile          syscall.Handle
+	pgKnownSubject *syscall.GUID
+}
+
+// wintrustData is WINTRUST_DATA
+type wintrustData struct {
+	cbStruct            uint32
+	pPolicyCallbackData uintptr
+	pSIPClientData      uintptr
+	dwUIChoice          uint32
+	fdwRevocationChecks uint32
+	dwUnionChoice       uint32
+	pFile               *wintrustFileInfo
+	dwStateAction       uint32
+	hWVTStateData       syscall.Handle
+	pwszURLReference    *uint16
+	dwProvFlags         uint32
+	dwUIContext         uint32
+	pSignatureSettings  uintptr
+}
+
+// verifyTrust checks the Authenticode signature of a file with WinVerifyTrust
+func verifyTrust(path string) (bool, string, bool) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false, err.Error(), true
+	}
+	file := wintrustFileInfo{pcwszFilePath: name}
+	file.cbStruct = uint32(unsafe.Sizeof(file))
+	data := wintrustData{
+		dwUIChoice:          wtdUINone,
+		fdwRevocationChecks: wtdRevokeNone,
+		dwUnionChoice:       wtdChoiceFile,
+		pFile:               &file,
+		dwStateAction:       wtdStateActionVerify,
+	}
+	data.cbStruct = uint32(unsafe.Sizeof(data))
+
+	ret, _, _ := procWinVerifyTrust.Call(^uintptr(0), uintptr(unsafe.Pointer(&actionGenericVerifyV2)), uintptr(unsafe.Pointer(&data)))
+	data.dwStateAction = wtdStateActionClose
+	procWinVerifyTrust.Call(^uintptr(0), uintptr(unsafe.Pointer(&actionGenericVerifyV2)), uintptr(unsafe.Pointer(&data)))
+
+	code := uint32(ret)
+	if code == 0 {
+		return true, "trusted", true
+	}
+	reason, ok := trustErrors[code]
+	if !ok {
+		reason = fmt.Sprintf("WinVerifyTrust error 0x%08X", code)
+	}
+	return false, "not trusted: " + reason, true
+}
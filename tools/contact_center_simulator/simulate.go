@@ -0,0 +1,37 @@
+package main
+
+import "github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+
+// Canned behaviors of simulation mode, answering like the DLL calling the test
+// server: the endpoints' responses, their required parameters and typical latency
+var simulatedBehaviors = map[string]FakeBehavior{
+	"procesareDate_1": {
+		Output:  map[string]string{"CFResp": "Success: Processed data for Tel={Tel}, CIF={CIF}, CID={CID}"},
+		Require: []string{"Tel", "CIF", "CID"},
+		DelayMs: 120,
+	},
+	"procesareDate_2": {
+		Output:  map[string]string{"CFResp": "status=ok;version=2;tel={Tel};cif={CIF};cid={CID}"},
+		Require: []string{"Tel", "CIF"},
+		DelayMs: 120,
+	},
+	"getInfo": {
+		Output:  map[string]string{"CFResp": "Info for ID={ID}: Customer information retrieved successfully"},
+		Require: []string{"ID"},
+		DelayMs: 80,
+	},
+	"getInfo_2": {
+		Output:  map[string]string{"CFResp": "status=ok;version=2;id={ID};segment=standard"},
+		Require: []string{"ID"},
+		DelayMs: 80,
+	},
+	// Unknown endpoints get the test server's 404, like the real setup
+	FakeDefaultEndpoint: {
+		ReturnCode: int(dllclient.HTTPError),
+		LastError:  "HTTP error: received status code 404",
+		DelayMs:    60,
+	},
+}
+
+// Note added to results in simulation mode
+const simulateNote = "Simulation mode: canned behaviors answered, no DLL was called"
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the soak subcommand
+const (
+	DefaultSoakDuration = 24 * time.Hour
+	DefaultSoakInterval = 10 * time.Minute
+	// Latencies kept for the percentiles of the final report
+	soakSampleSize = 100000
+)
+
+// SoakInterval summarizes one reporting interval of a soak test. The drift and
+// growth fields compare it with the first interval, the trend with the previous one.
+type SoakInterval struct {
+	Index     int          `json:"index"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Calls     int          `json:"calls"`
+	Errors    int          `json:"errors"`
+	ErrorRate float64      `json:"error_rate"`
+	LatencyMs LatencyStats `json:"latency_ms"`
+	// LatencyDrift is the change of p95 latency since the first interval, in percent
+	LatencyDrift float64 `json:"latency_drift"`
+	// ErrorRateTrend is the change of error rate since the previous interval, in percentage points
+	ErrorRateTrend float64 `json:"error_rate_trend"`
+	// MemoryBytes is the memory of the process hosting the DLL (0 if unavailable)
+	MemoryBytes       uint64 `json:"memory_bytes"`
+	MemoryGrowthBytes int64  `json:"memory_growth_bytes"`
+	// Heartbeats counts the heartbeat calls of the interval, with -heartbeat
+	Heartbeats *HeartbeatStats `json:"heartbeats,omitempty"`
+	// Counters are the peaks of the performance counters of the DLL host process
+	// in the interval, with -counters
+	Counters map[string]float64 `json:"counters,omitempty"`
+}
+
+// SoakReport is the final report of a soak test
+type SoakReport struct {
+	Profile     string    `json:"profile"`
+	DLL         string    `json:"dll"`
+	Endpoint    string    `json:"endpoint"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Concurrency int       `json:"concurrency"`
+	// Pacing is the pacing model, and Rate its rate in calls per second
+	Pacing string  `json:"pacing"`
+	Rate   float64 `json:"rate,omitempty"`
+	// Offered counts the calls the pacing scheduled, and Dropped those not made
+	// because every caller was busy
+	Offered           int            `json:"offered,omitempty"`
+	Dropped           int            `json:"dropped,omitempty"`
+	Calls             int            `json:"calls"`
+	Errors            int            `json:"errors"`
+	ErrorRate         float64        `json:"error_rate"`
+	LatencyMs         LatencyStats   `json:"latency_ms"`
+	LatencyDrift      float64        `json:"latency_drift"`
+	MemoryGrowthBytes int64          `json:"memory_growth_bytes"`
+	Intervals         []SoakInterval `json:"intervals"`
+	// Alerts are the alert rules that fired or resolved during the test
+	Alerts []AlertEvent `json:"alerts,omitempty"`
+	// Heartbeats are the heartbeat calls made in the background, with -heartbeat
+	Heartbeats *HeartbeatReport `json:"heartbeats,omitempty"`
+	// Counters is the file of the performance counter samples, with -counters
+	Counters string `json:"counters,omitempty"`
+}
+
+// soakTest collects the calls of a soak test into intervals
+type soakTest struct {
+	mu        sync.Mutex
+	start     time.Time
+	latencies []float64
+	errors    int
+
+	// Reservoir sample of every latency, for the final percentiles
+	sample []float64
+	seen   int
+
+	totalCalls  int
+	totalErrors int
+
+	intervals []SoakInterval
+}
+
+// add records a call
+func (s *soakTest) add(latency float64, ret int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies = append(s.latencies, latency)
+	if ret != 0 {
+		s.errors++
+	}
+	s.seen++
+	if len(s.sample) < soakSampleSize {
+		s.sample = append(s.sample, latency)
+	} else if i := rand.Intn(s.seen); i < soakSampleSize {
+		s.sample[i] = latency
+	}
+}
+
+// rotate closes the current interval and returns its summary
+func (s *soakTest) rotate() SoakInterval {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	interval := SoakInterval{
+		Index:     len(s.intervals) + 1,
+		Start:     s.start,
+		End:       now,
+		Calls:     len(s.latencies),
+		Errors:    s.errors,
+		LatencyMs: latencyStats(s.latencies),
+	}
+	if interval.Calls > 0 {
+		interval.ErrorRate = float64(interval.Errors) / float64(interval.Calls)
+	}
+	if memory, ok := processMemory(); ok {
+		interval.MemoryBytes = memory
+	}
+	if len(s.intervals) > 0 {
+		first, previous := s.intervals[0], s.intervals[len(s.intervals)-1]
+		if first.LatencyMs.P95 > 0 {
+			interval.LatencyDrift = (interval.LatencyMs.P95 - first.LatencyMs.P95) / first.LatencyMs.P95 * 100
+		}
+		interval.ErrorRateTrend = (interval.ErrorRate - previous.ErrorRate) * 100
+		if first.MemoryBytes > 0 && interval.MemoryBytes > 0 {
+			interval.MemoryGrowthBytes = int64(interval.MemoryBytes) - int64(first.MemoryBytes)
+		}
+	}
+
+	s.intervals = append(s.intervals, interval)
+	s.totalCalls += interval.Calls
+	s.totalErrors += interval.Errors
+	s.start, s.latencies, s.errors = now, nil, 0
+	return interval
+}
+
+// update replaces a closed interval, once the heartbeats and counters of the
+// interval were added to it
+func (s *soakTest) update(interval SoakInterval) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.intervals[interval.Index-1] = interval
+}
+
+// report builds the final report from the closed intervals
+func (s *soakTest) report() SoakReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := SoakReport{
+		Calls:     s.totalCalls,
+		Errors:    s.totalErrors,
+		LatencyMs: latencyStats(s.sample),
+		Intervals: s.intervals,
+	}
+	if report.Calls > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Calls)
+	}
+	if n := len(s.intervals); n > 0 {
+		report.LatencyDrift = s.intervals[n-1].LatencyDrift
+		report.MemoryGrowthBytes = s.intervals[n-1].MemoryGrowthBytes
+	}
+	return report
+}
+
+// writeJSONFile writes v as indented JSON
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Pacing models of the soak subcommand
+var soakPacingModels = []string{pacingContinuous, pacingUniform, pacingPoisson, pacingWorkingHours}
+
+// runSoak implements the soak subcommand: it calls the DLL for -duration, at once
+// again after each call or at the arrivals of a -pacing model, writing an interim
+// summary every -interval and a final report to -report-dir. With -heartbeat, a
+// lightweight call is also made every -heartbeat-interval in the background, and
+// the failed and missed heartbeats are tracked. With -counters, performance
+// counters of the process hosting the DLL are sampled to counters.jsonl.
+// Interrupting it (Ctrl+C) writes the final report early.
+//
+//	ContactCenterSimulator soak -param Endpoint=getInfo -param ID=12345 -duration 72h -interval 15m
+//	ContactCenterSimulator soak -param Endpoint=getInfo -param ID=12345 -pacing working-hours -rate 20 -day-length 2h
+//	ContactCenterSimulator soak -param Endpoint=getInfo -param ID=12345 -heartbeat Endpoint=ping -heartbeat-interval 10s
+func runSoak(args []string) int {
+	fs := flag.NewFlagSet("soak", flag.ContinueOnError)
+	callFlags := addCallFlags(fs)
+	pacing := addPacingFlags(fs, pacingContinuous, soakPacingModels)
+	heartbeatFlags := addHeartbeatFlags(fs)
+	counterFlags := addCounterFlags(fs)
+	duration := fs.Duration("duration", DefaultSoakDuration, "Total duration of the soak test")
+	interval := fs.Duration("interval", DefaultSoakInterval, "Interval between interim reports")
+	concurrency := fs.Int("concurrency", 1, "Number of concurrent callers")
+	reportDir := fs.String("report-dir", "", "Directory of the interim and final reports (default soak-<start time>)")
+	alertsFile := fs.String("alerts", "", "JSON file of alert rules evaluated during the test, and their notifiers")
+	runsDir := fs.String("runs", DefaultRunsDir, "Runs directory whose time series records the calls per minute (empty to disable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *duration <= 0 || *interval <= 0 || *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "soak: -duration, -interval and -concurrency must be positive")
+		return 2
+	}
+	pacer, err := pacing.pacer(soakPacingModels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+		return 2
+	}
+	counterNames, err := counterFlags.selected()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+		return 2
+	}
+
+	var alertConfig *AlertConfig
+	if *alertsFile != "" {
+		var err error
+		if alertConfig, err = loadAlertConfig(*alertsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+			return 2
+		}
+	}
+
+	call, profile, testCase, code, err := callFlags.prepare()
+	defer unloadDLLs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+		return code
+	}
+	heartbeat, err := heartbeatFlags.heartbeat(profile.name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+		return 2
+	}
+
+	started := time.Now()
+	if *reportDir == "" {
+		*reportDir = "soak-" + started.Format("20060102-150405")
+	}
+	if err := os.MkdirAll(*reportDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "soak: failed to create report directory: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	// Record the calls per minute in the time series of the runs directory, which
+	// the simulator's time series API serves
+	var ts *timeSeries
+	var flushing sync.WaitGroup
+	seriesCtx, stopSeries := context.WithCancel(context.Background())
+	defer stopSeries()
+	if *runsDir != "" {
+		if err := os.MkdirAll(*runsDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "soak: failed to create runs directory: %v\n", err)
+			return 1
+		}
+		ts = newTimeSeries(*runsDir)
+		flushing.Add(1)
+		go func() {
+			defer flushing.Done()
+			ts.run(seriesCtx)
+		}()
+	}
+	endpoint := endpointOf(testCase)
+
+	// Evaluate the alert rules while the test runs, notifying as soon as one fires
+	alertTicker := &time.Ticker{}
+	var alerts *alertMonitor
+	if alertConfig != nil {
+		alerts = newAlertMonitor(alertConfig, fmt.Sprintf("soak test of profile '%s' (%s)", profile.name, *reportDir))
+		alertTicker = time.NewTicker(alertCheckInterval)
+		defer alertTicker.Stop()
+	}
+
+	log.Printf("Soak test of profile '%s' for %v with %s pacing, reporting every %v to %s", profile.name, *duration, *pacing.model, *interval, *reportDir)
+	test := &soakTest{start: started}
+	var wg sync.WaitGroup
+	if heartbeat != nil {
+		log.Printf("Heartbeat every %v, missed after %v", heartbeat.interval, heartbeat.timeout)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			heartbeat.run(ctx)
+		}()
+	}
+	var counters *counterSampler
+	if len(counterNames) > 0 {
+		var err error
+		counters, err = newCounterSampler(filepath.Join(*reportDir, "counters.jsonl"), counterNames, *counterFlags.interval,
+			func() int { return hostPID(call.dll) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "soak: %v\n", err)
+			return 1
+		}
+		defer counters.close()
+		log.Printf("Sampling %s of the DLL host process every %v", strings.Join(counterNames, ", "), *counterFlags.interval)
+		counters.setPhase("interval 1")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counters.run(ctx)
+		}()
+	}
+	rotate := func() SoakInterval {
+		s := test.rotate()
+		if heartbeat != nil {
+			s.Heartbeats = heartbeat.rotate()
+		}
+		if counters != nil {
+			s.Counters = counters.takePeaks()
+			counters.setPhase(fmt.Sprintf("interval %d", s.Index+1))
+		}
+		test.update(s)
+		return s
+	}
+
+	// With a pacing model, calls are handed to the callers as they arrive. A call
+	// arriving while every caller is busy and the queue is full is dropped.
+	var due chan struct{}
+	var offered, dropped int
+	if pacer != nil {
+		due = make(chan struct{}, *concurrency)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(due)
+			timer := time.NewTimer(0)
+			defer timer.Stop()
+			for at := pacer.next(time.Now()); ; at = pacer.next(at) {
+				timer.Reset(time.Until(at))
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return
+				}
+				offered++
+				select {
+				case due <- struct{}{}:
+				default:
+					dropped++
+				}
+			}
+		}()
+	}
+	arrived := func() bool {
+		if due == nil {
+			return ctx.Err() == nil
+		}
+		_, ok := <-due
+		return ok
+	}
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for arrived() {
+				latency, ret := call.invoke()
+				test.add(latency, ret)
+				if alerts != nil {
+					alerts.add(latency, ret)
+				}
+				if ts != nil {
+					ts.add(sourceSoak, profile.name, endpoint, latency, ret == 0)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	writeInterim := func(s SoakInterval) {
+		log.Printf("Interval %d: %d calls, error rate %.2f%% (%+.2f), p95 %.3f ms (drift %+.1f%%), memory %d bytes (%+d)",
+			s.Index, s.Calls, s.ErrorRate*100, s.ErrorRateTrend, s.LatencyMs.P95, s.LatencyDrift, s.MemoryBytes, s.MemoryGrowthBytes)
+		if h := s.Heartbeats; h != nil {
+			log.Printf("Interval %d heartbeats: %d sent, %d failed, %d missed", s.Index, h.Sent, h.Failed, h.Missed)
+		}
+		path := filepath.Join(*reportDir, fmt.Sprintf("interim-%03d.json", s.Index))
+		if err := writeJSONFile(path, s); err != nil {
+			log.Printf("Failed to write interim report: %v", err)
+		}
+	}
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			writeInterim(rotate())
+		case now := <-alertTicker.C:
+			for _, event := range alerts.check(now) {
+				alertConfig.Notify.notify(event)
+			}
+		case <-ctx.Done():
+			running = false
+		}
+	}
+	wg.Wait()
+	writeInterim(rotate())
+	if ts != nil {
+		stopSeries()
+		flushing.Wait()
+		ts.close()
+	}
+
+	report := test.report()
+	report.Profile, report.DLL, report.Endpoint = profile.name, call.dll.path, endpoint
+	report.Started, report.Finished, report.Concurrency = started, time.Now(), *concurrency
+	report.Pacing, report.Offered, report.Dropped = *pacing.model, offered, dropped
+	if pacer != nil {
+		report.Rate = pacer.rate
+		if dropped > 0 {
+			log.Printf("%d of %d calls were dropped because every caller was busy; raise -concurrency", dropped, offered)
+		}
+	}
+	if alerts != nil {
+		report.Alerts = alerts.events
+	}
+	if counters != nil {
+		report.Counters = filepath.Join(*reportDir, "counters.jsonl")
+	}
+	if heartbeat != nil {
+		report.Heartbeats = heartbeat.report(report.Finished)
+		log.Printf("Heartbeats: %d sent, %d succeeded, %d failed, %d missed, longest outage %s",
+			report.Heartbeats.Sent, report.Heartbeats.Succeeded, report.Heartbeats.Failed, report.Heartbeats.Missed, report.Heartbeats.LongestOutage)
+	}
+	path := filepath.Join(*reportDir, "report.json")
+	if err := writeJSONFile(path, report); err != nil {
+		fmt.Fprintf(os.Stderr, "soak: failed to write the final report: %v\n", err)
+		return 1
+	}
+	log.Printf("Soak test finished: %d calls, error rate %.2f%%, p95 drift %+.1f%%, memory growth %d bytes. Report: %s",
+		report.Calls, report.ErrorRate*100, report.LatencyDrift, report.MemoryGrowthBytes, path)
+	return 0
+}
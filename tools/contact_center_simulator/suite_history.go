@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+)
+
+// Directory of a suite holding its versions: one snapshot of suite.json per
+// version (1.json, 2.json, ...) and the change history in history.json
+const suiteHistoryDir = "history"
+
+// User recorded for changes made by editing suite.json directly
+const fileEditUser = "(file edit)"
+
+// SuiteVersion is an entry of the change history of a suite
+type SuiteVersion struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Changes []string  `json:"changes"`
+}
+
+// SuiteRun is the outcome of running every case of a suite version
+type SuiteRun struct {
+	Suite   string       `json:"suite"`
+	Version int          `json:"version"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Results []TestResult `json:"results"`
+}
+
+// Serializes changes to the suite histories
+var suiteHistoryMu sync.Mutex
+
+// suiteHistory reads the change history of a suite, oldest first
+func suiteHistory(name string) ([]SuiteVersion, error) {
+	dir, err := suitePath(name)
+	if err != nil {
+		return nil, err
+	}
+	var history []SuiteVersion
+	err = readJSONFile(filepath.Join(dir, suiteHistoryDir, "history.json"), &history)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the history of suite '%s': %v", name, err)
+	}
+	return history, nil
+}
+
+// loadSuiteVersion reads a version of a suite, or the current definition for version 0
+func loadSuiteVersion(name string, version int) (*Suite, error) {
+	if version == 0 {
+		return loadSuite(name)
+	}
+	dir, err := suitePath(name)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := readJSONFile(filepath.Join(dir, suiteHistoryDir, fmt.Sprintf("%d.json", version)), &suite); err != nil {
+		return nil, fmt.Errorf("unknown version %d of suite '%s'", version, name)
+	}
+	suite.Name = name
+	return &suite, nil
+}
+
+// describeChanges lists what changed between two versions of a suite
+func describeChanges(old, cur *Suite) []string {
+	if old == nil {
+		return []string{fmt.Sprintf("created with %d cases", len(cur.Cases))}
+	}
+
+	var changes []string
+	if old.Description != cur.Description {
+		changes = append(changes, "changed the description")
+	}
+	oldCases := make(map[string][]byte)
+	for _, c := range old.Cases {
+		oldCases[c.Name], _ = json.Marshal(c)
+	}
+	seen := make(map[string]bool)
+	for _, c := range cur.Cases {
+		seen[c.Name] = true
+		data, _ := json.Marshal(c)
+		previous, ok := oldCases[c.Name]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("added case '%s'", c.Name))
+		case !bytes.Equal(previous, data):
+			changes = append(changes, fmt.Sprintf("changed case '%s'", c.Name))
+		}
+	}
+	for _, c := range old.Cases {
+		if !seen[c.Name] {
+			changes = append(changes, fmt.Sprintf("removed case '%s'", c.Name))
+		}
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "reordered cases")
+	}
+	return changes
+}
+
+// recordSuiteVersion adds the current definition of a suite to its history if it
+// differs from the latest version, and returns the current version
+func recordSuiteVersion(name, user string) (int, error) {
+	suiteHistoryMu.Lock()
+	defer suiteHistoryMu.Unlock()
+
+	cur, err := loadSuite(name)
+	if err != nil {
+		return 0, err
+	}
+	history, err := suiteHistory(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest *Suite
+	if len(history) > 0 {
+		latest, err = loadSuiteVersion(name, history[len(history)-1].Version)
+		if err != nil {
+			return 0, err
+		}
+		a, _ := json.Marshal(latest)
+		b, _ := json.Marshal(cur)
+		if bytes.Equal(a, b) {
+			return history[len(history)-1].Version, nil
+		}
+	}
+
+	entry := SuiteVersion{
+		Version: len(history) + 1,
+		Time:    time.Now(),
+		User:    user,
+		Changes: describeChanges(latest, cur),
+	}
+	dir, _ := suitePath(name)
+	historyDir := filepath.Join(dir, suiteHistoryDir)
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to record version of suite '%s': %v", name, err)
+	}
+	snapshot, _ := json.MarshalIndent(cur, "", "  ")
+	if err := os.WriteFile(filepath.Join(historyDir, fmt.Sprintf("%d.json", entry.Version)), append(snapshot, '\n'), 0644); err != nil {
+		return 0, fmt.Errorf("failed to record version of suite '%s': %v", name, err)
+	}
+	data, _ := json.MarshalIndent(append(history, entry), "", "  ")
+	if err := os.WriteFile(filepath.Join(historyDir, "history.json"), append(data, '\n'), 0644); err != nil {
+		return 0, fmt.Errorf("failed to record version of suite '%s': %v", name, err)
+	}
+	log.Printf("Suite '%s' version %d by %s: %v", name, entry.Version, user, entry.Changes)
+	return entry.Version, nil
+}
+
+// recordSuiteVersions records edits made directly to the suite files since the
+// simulator last saw them
+func recordSuiteVersions() {
+	for _, info := range listSuites() {
+		if _, err := recordSuiteVersion(info.Name, fileEditUser); err != nil {
+			log.Printf("Failed to record the version of suite '%s': %v", info.Name, err)
+		}
+	}
+}
+
+// requestUser returns the name of the user making a request
+func requestUser(r *http.Request) string {
+	if user, ok := auth.FromRequest(r); ok {
+		return user.Name
+	}
+	return "anonymous"
+}
+
+// runSuite runs every case of a suite version between the suite's pre_suite and
+// post_suite hooks and stores each run, explaining failures in the language lang.
+// The output of the pre_suite hooks is stored with the first run, that of the
+// post_suite hooks with the last one. If a pre_suite hook fails, no case runs.
+// progress, if not nil, is called before each case with a nil result and after
+// it with the result.
+func runSuite(suite *Suite, version int, lang string, progress func(index int, result *TestResult)) SuiteRun {
+	return runSuiteFrom(suite, version, lang, 0, progress, nil)
+}
+
+// runSuiteFrom runs a suite as runSuite does, from the case at index start, to
+// resume a suite run that was interrupted. The hooks run as for a whole run.
+// stop, if not nil, is called before each case, and ends the run early (still
+// running the post_suite hooks) when it returns true.
+func runSuiteFrom(suite *Suite, version int, lang string, start int, progress func(index int, result *TestResult), stop func() bool) SuiteRun {
+	run := SuiteRun{Suite: suite.Name, Version: version, Results: []TestResult{}}
+	env := map[string]string{"CCS_SUITE": suite.Name, "CCS_SUITE_VERSION": strconv.Itoa(version)}
+	pre, preErr := runHooks(hookPreSuite, suite, env)
+	for i := start; i < len(suite.Cases); i++ {
+		if stop != nil && stop() {
+			break
+		}
+		testCase := suite.Cases[i]
+		if progress != nil {
+			progress(i, nil)
+		}
+		var result TestResult
+		profile, err := profileFor(testCase)
+		switch {
+		case preErr != nil:
+			result = TestResult{Name: testCase.Name, Profile: testCase.Profile, ReturnCode: -1, ErrorDetails: fmt.Sprintf("The suite did not run: the %v", preErr),
+				Suite: suite.Name, SuiteVersion: version}
+			if i == start && profile != nil {
+				result.Hooks = pre
+				recordRun(testCase, profile, &result)
+			}
+		case err != nil:
+			result = TestResult{Name: testCase.Name, Profile: testCase.Profile, ReturnCode: -1, ErrorDetails: err.Error(), Suite: suite.Name, SuiteVersion: version}
+		default:
+			var earlier []HookResult
+			if i == start {
+				earlier = pre
+			}
+			result = callWithHooks(profile, testCase, lang, suite, version, earlier)
+		}
+		if result.Success {
+			run.Passed++
+		} else {
+			run.Failed++
+		}
+		run.Results = append(run.Results, result)
+		if progress != nil {
+			progress(i, &result)
+		}
+	}
+
+	if preErr == nil {
+		env["CCS_PASSED"] = strconv.Itoa(run.Passed)
+		env["CCS_FAILED"] = strconv.Itoa(run.Failed)
+		post, _ := runHooks(hookPostSuite, suite, env)
+		if n := len(run.Results); n > 0 {
+			attachHooks(run.Results[n-1].RunID, post)
+		}
+	}
+	return run
+}
+
+// handleSuiteSave stores a new definition of a suite from the request body and
+// records it as a version (POST /suites/save?name=...)
+func handleSuiteSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	dir, err := suitePath(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var suite Suite
+	if err := json.NewDecoder(r.Body).Decode(&suite); err != nil {
+		http.Error(w, "Invalid suite definition", http.StatusBadRequest)
+		return
+	}
+	suite.Name = name
+	if _, err := newNormalizer(suite.Normalize); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkSuiteHooks(suite.Hooks); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkSuiteEnv(&suite); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Record edits made on disk first, so they are not attributed to this user
+	if _, err := os.Stat(filepath.Join(dir, suiteFile)); err == nil {
+		if _, err := recordSuiteVersion(name, fileEditUser); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	data, _ := json.MarshalIndent(suite, "", "  ")
+	err = os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, suiteFile), append(data, '\n'), 0644)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save suite '%s': %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	if _, err := recordSuiteVersion(name, requestUser(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSuiteHistory(w, name)
+}
+
+// handleSuiteHistory returns the change history of a suite (GET /suites/history?name=...)
+func handleSuiteHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if _, err := recordSuiteVersion(name, fileEditUser); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeSuiteHistory(w, name)
+}
+
+// writeSuiteHistory writes the change history of a suite as JSON
+func writeSuiteHistory(w http.ResponseWriter, name string) {
+	history, err := suiteHistory(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleSuiteRun runs a suite, the current version or the one given by version
+// (POST /suites/run?name=...&version=...). With update-snapshots=true, the output
+// values become the snapshots of the cases, which is refused in read-only mode.
+func handleSuiteRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	current, err := recordSuiteVersion(name, fileEditUser)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	version := current
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid version '%s'", v), http.StatusBadRequest)
+			return
+		}
+	}
+	suite, err := loadSuiteVersion(name, version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("update-snapshots") == "true" {
+		if readOnly {
+			http.Error(w, "Forbidden: the simulator is in read-only mode", http.StatusForbidden)
+			return
+		}
+		suite.updateSnapshots = true
+	}
+
+	log.Printf("Running suite '%s' version %d (%d cases)", name, version, len(suite.Cases))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runSuite(suite, version, requestLanguage(r), nil))
+}
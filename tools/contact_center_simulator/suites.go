@@ -0,0 +1,369 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Default directory of test suites, relative to the working directory
+const DefaultSuitesDir = "suites"
+
+// Files of a suite directory. Besides the definition, a suite may hold the DLL
+// profiles of its environment, fixture files and the expected snapshots.
+const (
+	suiteFile         = "suite.json"
+	suiteProfilesFile = "profiles.json"
+	suiteFixturesDir  = "fixtures"
+	suiteSnapshotsDir = "snapshots"
+)
+
+// Largest suite bundle accepted for import
+const MaxSuiteBundleSize = 64 << 20
+
+// Valid suite names
+var validSuiteName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// errSuiteExists reports an import that would overwrite a suite without replace
+var errSuiteExists = errors.New("already exists")
+
+// Suite is a named list of test cases, stored as suite.json in a directory of its own
+type Suite struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Cases       []TestCase `json:"cases"`
+	// Hooks run for this suite, after those of -hooks: names of the commands of
+	// the -hooks file (see hooks.go)
+	Hooks *Hooks `json:"hooks,omitempty"`
+	// Normalize transforms output values before they are compared with the
+	// snapshots (see normalize.go)
+	Normalize []Normalization `json:"normalize,omitempty"`
+
+	// updateSnapshots stores the output values of a run as the snapshots
+	updateSnapshots bool
+}
+
+// SuiteInfo describes a stored suite
+type SuiteInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Cases       int    `json:"cases"`
+	Profiles    bool   `json:"profiles"`
+	Fixtures    int    `json:"fixtures"`
+	Snapshots   int    `json:"snapshots"`
+}
+
+// Directory of the test suites, set by -suites
+var suitesDir = DefaultSuitesDir
+
+// suitePath returns the directory of a suite
+func suitePath(name string) (string, error) {
+	if !validSuiteName.MatchString(name) {
+		return "", fmt.Errorf("invalid suite name '%s'", name)
+	}
+	return filepath.Join(suitesDir, name), nil
+}
+
+// loadSuite reads the definition of a stored suite
+func loadSuite(name string) (*Suite, error) {
+	dir, err := suitePath(name)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := readJSONFile(filepath.Join(dir, suiteFile), &suite); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown suite '%s'", name)
+		}
+		return nil, fmt.Errorf("failed to read suite '%s': %v", name, err)
+	}
+	suite.Name = name
+	return &suite, nil
+}
+
+// countFiles returns the number of regular files under dir
+func countFiles(dir string) int {
+	n := 0
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// suiteInfo describes a stored suite
+func suiteInfo(name string) (SuiteInfo, error) {
+	suite, err := loadSuite(name)
+	if err != nil {
+		return SuiteInfo{}, err
+	}
+	dir, _ := suitePath(name)
+	_, statErr := os.Stat(filepath.Join(dir, suiteProfilesFile))
+	return SuiteInfo{
+		Name:        name,
+		Description: suite.Description,
+		Cases:       len(suite.Cases),
+		Profiles:    statErr == nil,
+		Fixtures:    countFiles(filepath.Join(dir, suiteFixturesDir)),
+		Snapshots:   countFiles(filepath.Join(dir, suiteSnapshotsDir)),
+	}, nil
+}
+
+// listSuites describes every stored suite, by name
+func listSuites() []SuiteInfo {
+	list := []SuiteInfo{}
+	entries, err := os.ReadDir(suitesDir)
+	if err != nil {
+		return list
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if info, err := suiteInfo(entry.Name()); err == nil {
+			list = append(list, info)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// exportSuite writes a suite directory as a zip bundle
+func exportSuite(name string, w io.Writer) error {
+	if _, err := loadSuite(name); err != nil {
+		return err
+	}
+	dir, _ := suitePath(name)
+
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p == filepath.Join(dir, suiteHistoryDir) {
+			// The history stays with the suite it was recorded for
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export suite '%s': %v", name, err)
+	}
+	return zw.Close()
+}
+
+// bundleEntryPath checks the path of a bundle entry, which must stay inside the suite directory
+func bundleEntryPath(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, ":") {
+		return "", fmt.Errorf("bundle entry '%s' is outside the suite", name)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+// importSuite unpacks a zip bundle as a stored suite, named after its suite.json
+// unless name is given. An existing suite is only overwritten with replace, and
+// the import is recorded in its history as a change by user.
+func importSuite(bundle []byte, name, user string, replace bool) (SuiteInfo, error) {
+	zr, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	if err != nil {
+		return SuiteInfo{}, fmt.Errorf("invalid suite bundle: %v", err)
+	}
+
+	// Check the whole bundle before writing anything
+	var suite *Suite
+	var total uint64
+	for _, f := range zr.File {
+		rel, err := bundleEntryPath(f.Name)
+		if err != nil {
+			return SuiteInfo{}, err
+		}
+		total += f.UncompressedSize64
+		if total > MaxSuiteBundleSize {
+			return SuiteInfo{}, fmt.Errorf("suite bundle is larger than %d bytes", MaxSuiteBundleSize)
+		}
+		if filepath.ToSlash(rel) == suiteFile {
+			rc, err := f.Open()
+			if err != nil {
+				return SuiteInfo{}, fmt.Errorf("invalid suite bundle: %v", err)
+			}
+			suite = &Suite{}
+			err = json.NewDecoder(rc).Decode(suite)
+			rc.Close()
+			if err != nil {
+				return SuiteInfo{}, fmt.Errorf("invalid %s in suite bundle: %v", suiteFile, err)
+			}
+		}
+	}
+	if suite == nil {
+		return SuiteInfo{}, fmt.Errorf("suite bundle has no %s", suiteFile)
+	}
+	if err := checkSuiteHooks(suite.Hooks); err != nil {
+		return SuiteInfo{}, err
+	}
+	if err := checkSuiteEnv(suite); err != nil {
+		return SuiteInfo{}, err
+	}
+	if name == "" {
+		name = suite.Name
+	}
+	dir, err := suitePath(name)
+	if err != nil {
+		return SuiteInfo{}, err
+	}
+	if _, err := os.Stat(dir); err == nil && !replace {
+		return SuiteInfo{}, fmt.Errorf("suite '%s' %w", name, errSuiteExists)
+	}
+
+	// Unpack next to the suites, then swap the directory in
+	if err := os.MkdirAll(suitesDir, 0755); err != nil {
+		return SuiteInfo{}, fmt.Errorf("failed to create suites directory: %v", err)
+	}
+	tmp, err := os.MkdirTemp(suitesDir, ".import-")
+	if err != nil {
+		return SuiteInfo{}, fmt.Errorf("failed to import suite: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rel, _ := bundleEntryPath(f.Name)
+		if strings.SplitN(filepath.ToSlash(rel), "/", 2)[0] == suiteHistoryDir {
+			continue
+		}
+		target := filepath.Join(tmp, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return SuiteInfo{}, fmt.Errorf("failed to import suite: %v", err)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return SuiteInfo{}, fmt.Errorf("invalid suite bundle: %v", err)
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, MaxSuiteBundleSize))
+		rc.Close()
+		if err != nil {
+			return SuiteInfo{}, fmt.Errorf("invalid suite bundle entry %s: %v", f.Name, err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return SuiteInfo{}, fmt.Errorf("failed to import suite: %v", err)
+		}
+	}
+
+	// Move the suite being replaced aside, swap the import in, and restore the
+	// suite if that fails, so a failed import loses neither
+	backup := ""
+	if _, err := os.Stat(dir); err == nil {
+		backup = tmp + ".old"
+		if err := os.Rename(dir, backup); err != nil {
+			return SuiteInfo{}, fmt.Errorf("failed to replace suite '%s': %v", name, err)
+		}
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if backup != "" {
+			if restoreErr := os.Rename(backup, dir); restoreErr != nil {
+				return SuiteInfo{}, fmt.Errorf("failed to import suite: %v (the previous suite is kept in %s: %v)", err, backup, restoreErr)
+			}
+		}
+		return SuiteInfo{}, fmt.Errorf("failed to import suite: %v", err)
+	}
+	if backup != "" {
+		// Keep the history of the replaced suite
+		if err := os.Rename(filepath.Join(backup, suiteHistoryDir), filepath.Join(dir, suiteHistoryDir)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to keep the history of suite '%s' (kept in %s): %v", name, backup, err)
+		} else {
+			os.RemoveAll(backup)
+		}
+	}
+	if _, err := recordSuiteVersion(name, user); err != nil {
+		return SuiteInfo{}, err
+	}
+	return suiteInfo(name)
+}
+
+// handleSuites lists the stored suites
+func handleSuites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listSuites())
+}
+
+// handleSuiteExport downloads a suite as a zip bundle (GET /suites/export?name=...)
+func handleSuiteExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	var bundle bytes.Buffer
+	if err := exportSuite(name, &bundle); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+	w.Write(bundle.Bytes())
+}
+
+// handleSuiteImport stores a suite from a zip bundle in the request body
+// (POST /suites/import, with optional name=... and replace=true)
+func handleSuiteImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bundle, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxSuiteBundleSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid suite bundle: %v", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	info, err := importSuite(bundle, r.URL.Query().Get("name"), requestUser(r), r.URL.Query().Get("replace") == "true")
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errSuiteExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("Imported suite '%s' (%d cases)", info.Name, info.Cases)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time series of call outcomes, aggregated per minute and appended to a file of
+// the runs directory, one JSON object per line
+const (
+	timeSeriesFile = "timeseries.jsonl"
+	// timeSeriesFlushInterval is how often completed minutes are written
+	timeSeriesFlushInterval = 10 * time.Second
+	// DefaultTimeSeriesWindow is the time range queried when from is not given
+	DefaultTimeSeriesWindow = 24 * time.Hour
+)
+
+// Sources of time series points
+const (
+	sourceServer = "server"
+	sourceSoak   = "soak"
+)
+
+// TimeSeriesPoint aggregates the calls of one minute, for one source (test runs
+// of the server, or a soak test), profile and endpoint
+type TimeSeriesPoint struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Profile  string    `json:"profile"`
+	Endpoint string    `json:"endpoint"`
+	Calls    int       `json:"calls"`
+	Errors   int       `json:"errors"`
+	// SuccessRate is the share of calls that succeeded, from 0 to 1
+	SuccessRate float64      `json:"successRate"`
+	LatencyMs   LatencyStats `json:"latencyMs"`
+}
+
+// seriesKey identifies a series: the points of one source, profile and endpoint
+type seriesKey struct {
+	source, profile, endpoint string
+}
+
+// minuteBucket collects the calls of a series during one minute
+type minuteBucket struct {
+	minute    time.Time
+	key       seriesKey
+	latencies []float64
+	errors    int
+}
+
+// timeSeries aggregates calls into minute buckets and appends the buckets of
+// completed minutes to its file
+type timeSeries struct {
+	path string
+
+	mu      sync.Mutex
+	buckets map[string]*minuteBucket
+}
+
+// Time series of the server's test runs, nil when run storage is disabled
+var series *timeSeries
+
+// newTimeSeries creates a time series appending to the time series file of dir
+func newTimeSeries(dir string) *timeSeries {
+	return &timeSeries{path: filepath.Join(dir, timeSeriesFile), buckets: make(map[string]*minuteBucket)}
+}
+
+// add records a call that ended now
+func (t *timeSeries) add(source, profile, endpoint string, latency float64, success bool) {
+	key := seriesKey{source, profile, endpoint}
+	minute := time.Now().Truncate(time.Minute)
+	id := fmt.Sprintf("%d|%s|%s|%s", minute.Unix(), source, profile, endpoint)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.buckets[id]
+	if b == nil {
+		b = &minuteBucket{minute: minute, key: key}
+		t.buckets[id] = b
+	}
+	b.latencies = append(b.latencies, latency)
+	if !success {
+		b.errors++
+	}
+}
+
+// flush appends the buckets of the minutes before the given time to the file
+func (t *timeSeries) flush(before time.Time) error {
+	t.mu.Lock()
+	var points []TimeSeriesPoint
+	for id, b := range t.buckets {
+		if !b.minute.Before(before.Truncate(time.Minute)) {
+			continue
+		}
+		p := TimeSeriesPoint{
+			Time:      b.minute,
+			Source:    b.key.source,
+			Profile:   b.key.profile,
+			Endpoint:  b.key.endpoint,
+			Calls:     len(b.latencies),
+			Errors:    b.errors,
+			LatencyMs: latencyStats(b.latencies),
+		}
+		p.SuccessRate = float64(p.Calls-p.Errors) / float64(p.Calls)
+		points = append(points, p)
+		delete(t.buckets, id)
+	}
+	t.mu.Unlock()
+	if len(points) == 0 {
+		return nil
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	var sb strings.Builder
+	for _, p := range points {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open time series: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("failed to write time series: %v", err)
+	}
+	return nil
+}
+
+// run writes completed minutes until ctx is done
+func (t *timeSeries) run(ctx context.Context) {
+	ticker := time.NewTicker(timeSeriesFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := t.flush(now); err != nil {
+				log.Printf("Failed to store time series: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// close writes every bucket, including the current minute
+func (t *timeSeries) close() {
+	if err := t.flush(time.Now().Add(time.Minute)); err != nil {
+		log.Printf("Failed to store time series: %v", err)
+	}
+}
+
+// TimeSeriesQuery selects the points of the time series API
+type TimeSeriesQuery struct {
+	From, To time.Time
+	Source   string
+	Profile  string
+	Endpoint string
+}
+
+// match reports whether a point passes the filters of the query
+func (q TimeSeriesQuery) match(p TimeSeriesPoint) bool {
+	return !p.Time.Before(q.From) && p.Time.Before(q.To) &&
+		(q.Source == "" || p.Source == q.Source) &&
+		(q.Profile == "" || p.Profile == q.Profile) &&
+		(q.Endpoint == "" || strings.EqualFold(p.Endpoint, q.Endpoint))
+}
+
+// Series is the points of one source, profile and endpoint, oldest first
+type Series struct {
+	Source   string            `json:"source"`
+	Profile  string            `json:"profile"`
+	Endpoint string            `json:"endpoint"`
+	Points   []TimeSeriesPoint `json:"points"`
+}
+
+// query reads the stored points matching the query, grouped into series
+func (t *timeSeries) query(q TimeSeriesQuery) ([]Series, error) {
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return []Series{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read time series: %v", err)
+	}
+	defer f.Close()
+
+	index := make(map[seriesKey]int)
+	list := []Series{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p TimeSeriesPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil || !q.match(p) {
+			continue
+		}
+		key := seriesKey{p.Source, p.Profile, p.Endpoint}
+		i, ok := index[key]
+		if !ok {
+			i = len(list)
+			index[key] = i
+			list = append(list, Series{Source: p.Source, Profile: p.Profile, Endpoint: p.Endpoint})
+		}
+		list[i].Points = append(list[i].Points, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read time series: %v", err)
+	}
+	for _, s := range list {
+		sort.SliceStable(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Profile != b.Profile {
+			return a.Profile < b.Profile
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return list, nil
+}
+
+// parseTime reads an RFC 3339 time or Unix milliseconds
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s' (RFC 3339 or Unix milliseconds)", s)
+}
+
+// handleTimeSeries returns the per-minute time series of call outcomes and latency
+// (GET /api/timeseries), between from and to (default the last 24 hours), filtered
+// by source (server or soak), profile and endpoint
+func handleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if series == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	values := r.URL.Query()
+	q := TimeSeriesQuery{
+		To:       time.Now(),
+		Source:   values.Get("source"),
+		Profile:  values.Get("profile"),
+		Endpoint: values.Get("endpoint"),
+	}
+	if v := values.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-DefaultTimeSeriesWindow)
+	if v := values.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.From = t
+	}
+
+	list, err := series.query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"series": list})
+}
+
+// Metrics of the Grafana JSON datasource, as read from a point
+var grafanaMetrics = map[string]func(p TimeSeriesPoint) float64{
+	"calls":        func(p TimeSeriesPoint) float64 { return float64(p.Calls) },
+	"errors":       func(p TimeSeriesPoint) float64 { return float64(p.Errors) },
+	"success_rate": func(p TimeSeriesPoint) float64 { return p.SuccessRate * 100 },
+	"mean_ms":      func(p TimeSeriesPoint) float64 { return p.LatencyMs.Mean },
+	"p50_ms":       func(p TimeSeriesPoint) float64 { return p.LatencyMs.P50 },
+	"p95_ms":       func(p TimeSeriesPoint) float64 { return p.LatencyMs.P95 },
+	"p99_ms":       func(p TimeSeriesPoint) float64 { return p.LatencyMs.P99 },
+	"max_ms":       func(p TimeSeriesPoint) float64 { return p.LatencyMs.Max },
+}
+
+// grafanaQuery is the body of a query of the Grafana JSON datasource
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is a series of a Grafana JSON datasource response: pairs of
+// value and Unix milliseconds
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// handleGrafana implements the Grafana JSON datasource (/api/timeseries/grafana):
+// the connection test (/), the metric names (/search) and time series queries
+// (/query). Each metric yields one series per source, profile and endpoint.
+func handleGrafana(w http.ResponseWriter, r *http.Request) {
+	if series == nil {
+		http.Error(w, "Run storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	var v interface{}
+	switch strings.TrimPrefix(r.URL.Path, "/api/timeseries/grafana") {
+	case "", "/":
+		v = "OK"
+	case "/search":
+		names := []string{}
+		for name := range grafanaMetrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		v = names
+	case "/query":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var body grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		list, err := series.query(TimeSeriesQuery{From: body.Range.From, To: body.Range.To})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := []grafanaSeries{}
+		for _, target := range body.Targets {
+			metric := grafanaMetrics[target.Target]
+			if metric == nil {
+				http.Error(w, fmt.Sprintf("Unknown metric '%s'", target.Target), http.StatusBadRequest)
+				return
+			}
+			for _, s := range list {
+				g := grafanaSeries{
+					Target:     fmt.Sprintf("%s %s/%s %s", s.Source, s.Profile, s.Endpoint, target.Target),
+					Datapoints: [][2]float64{},
+				}
+				for _, p := range s.Points {
+					g.Datapoints = append(g.Datapoints, [2]float64{metric(p), float64(p.Time.UnixMilli())})
+				}
+				response = append(response, g)
+			}
+		}
+		v = response
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
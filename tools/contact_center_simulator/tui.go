@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Lines of a page of the buffer and log views
+const tuiPageLines = 20
+
+// Lines of simulator log kept for the log view of the terminal interface
+const tuiLogLines = 500
+
+// Width of the progress bar of a suite run
+const tuiBarWidth = 30
+
+// ANSI escape sequences of the terminal interface
+const (
+	ansiClear  = "\x1b[H\x1b[2J"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// Views of the terminal interface
+const (
+	viewSuites = iota
+	viewSuite
+	viewCase
+	viewBuffer
+	viewLog
+)
+
+// logTail keeps the last lines of the simulator log while the terminal interface
+// owns the screen
+type logTail struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.lines = append(t.lines, line)
+	}
+	if len(t.lines) > tuiLogLines {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-tuiLogLines:]...)
+	}
+	return len(p), nil
+}
+
+// snapshot returns the kept lines, oldest first
+func (t *logTail) snapshot() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+// tuiProgress reports a case of a suite run to the terminal interface: its start,
+// then its result
+type tuiProgress struct {
+	index  int
+	result *TestResult
+}
+
+// tui is the state of the terminal interface. Everything but the log is only
+// touched by the loop of runTUI.
+type tui struct {
+	out     io.Writer
+	logs    *logTail
+	view    int
+	back    int // view the buffer and log views return to
+	message string
+
+	suites []SuiteInfo
+
+	// The open suite, the results of its last run (nil for cases not run yet)
+	// and the case shown by the case and buffer views
+	suite   *Suite
+	version int
+	results []*TestResult
+	running int // index of the running case, -1 when no run is in progress
+	current int
+
+	// The buffer shown by the buffer view (input or output) and the first line
+	// of the buffer and log views
+	buffer string
+	offset int
+}
+
+// runTUI runs the terminal interface, for operators on SSH or RDP consoles without
+// a browser: the stored suites, live progress of suite runs, failure details and
+// the buffers exchanged with the DLL. Commands are typed followed by Enter, so the
+// interface works on any terminal. The simulator log is kept for the log view
+// instead of being written over the screen.
+func runTUI(in io.Reader, out io.Writer) int {
+	enableVirtualTerminal()
+	logs := &logTail{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	t := &tui{out: out, logs: logs, running: -1, suites: listSuites()}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+	progress := make(chan tuiProgress)
+
+	for {
+		t.draw()
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return 0
+			}
+			t.message = ""
+			if t.command(line, progress) {
+				fmt.Fprint(out, ansiClear)
+				return 0
+			}
+		case p := <-progress:
+			if p.result == nil {
+				t.running = p.index
+			} else {
+				t.results[p.index] = p.result
+				if p.index == len(t.suite.Cases)-1 {
+					t.running = -1
+					passed, failed := t.counts()
+					t.message = fmt.Sprintf("Run finished: %d passed, %d failed", passed, failed)
+				}
+			}
+		}
+	}
+}
+
+// command performs a command typed in the current view; true quits
+func (t *tui) command(line string, progress chan<- tuiProgress) bool {
+	switch line {
+	case "q":
+		if t.running >= 0 {
+			t.message = "A suite run is in progress; quit when it has finished"
+			return false
+		}
+		return true
+	case "l":
+		if t.view != viewLog {
+			t.back, t.view = t.view, viewLog
+			t.offset = max(0, len(t.logs.snapshot())-tuiPageLines)
+		}
+		return false
+	}
+
+	switch t.view {
+	case viewSuites:
+		switch line {
+		case "", "r":
+			t.suites = listSuites()
+		default:
+			if i, ok := t.choice(line, len(t.suites)); ok {
+				t.open(t.suites[i].Name)
+			}
+		}
+	case viewSuite:
+		switch line {
+		case "":
+		case "b":
+			t.view, t.suites = viewSuites, listSuites()
+		case "r":
+			t.run(progress)
+		default:
+			if i, ok := t.choice(line, len(t.suite.Cases)); ok {
+				t.view, t.current = viewCase, i
+			}
+		}
+	case viewCase:
+		switch line {
+		case "":
+		case "b":
+			t.view = viewSuite
+		case "n":
+			t.current = min(t.current+1, len(t.suite.Cases)-1)
+		case "p":
+			t.current = max(t.current-1, 0)
+		case "i", "o":
+			if t.results[t.current] == nil {
+				t.message = "The case has not run yet"
+				break
+			}
+			t.back, t.view, t.offset = viewCase, viewBuffer, 0
+			t.buffer = map[string]string{"i": "input", "o": "output"}[line]
+		default:
+			t.message = fmt.Sprintf("Unknown command '%s'", line)
+		}
+	case viewBuffer, viewLog:
+		switch line {
+		case "b":
+			t.view = t.back
+		case "n", "":
+			t.offset += tuiPageLines
+		case "p":
+			t.offset = max(t.offset-tuiPageLines, 0)
+		default:
+			t.message = fmt.Sprintf("Unknown command '%s'", line)
+		}
+	}
+	return false
+}
+
+// choice parses the number of an entry of a list of n entries, the only other
+// input of the list views
+func (t *tui) choice(line string, n int) (int, bool) {
+	i, err := strconv.Atoi(line)
+	if err != nil {
+		t.message = fmt.Sprintf("Unknown command '%s'", line)
+		return 0, false
+	}
+	if i < 1 || i > n {
+		t.message = fmt.Sprintf("No entry %d", i)
+		return 0, false
+	}
+	return i - 1, true
+}
+
+// open shows a suite, the current version of its definition
+func (t *tui) open(name string) {
+	if t.running >= 0 && name != t.suite.Name {
+		t.message = fmt.Sprintf("Suite %s is running; open another suite when it has finished", t.suite.Name)
+		return
+	}
+	if t.running >= 0 {
+		t.view = viewSuite
+		return
+	}
+	version, err := recordSuiteVersion(name, fileEditUser)
+	if err == nil {
+		t.suite, err = loadSuiteVersion(name, version)
+	}
+	if err != nil {
+		t.message = err.Error()
+		return
+	}
+	t.view, t.version = viewSuite, version
+	t.results = make([]*TestResult, len(t.suite.Cases))
+	t.current = 0
+}
+
+// run starts running the open suite; its progress comes back through progress
+func (t *tui) run(progress chan<- tuiProgress) {
+	if t.running >= 0 {
+		t.message = "The suite is already running"
+		return
+	}
+	if len(t.suite.Cases) == 0 {
+		t.message = "The suite has no cases"
+		return
+	}
+	t.results = make([]*TestResult, len(t.suite.Cases))
+	t.running = 0
+	log.Printf("Running suite '%s' version %d (%d cases) from the terminal interface", t.suite.Name, t.version, len(t.suite.Cases))
+
+	suite, version := t.suite, t.version
+	go runSuite(suite, version, defaultLanguage, func(index int, result *TestResult) {
+		progress <- tuiProgress{index: index, result: result}
+	})
+}
+
+// counts returns the passed and failed cases of the last run
+func (t *tui) counts() (passed, failed int) {
+	for _, result := range t.results {
+		if result == nil {
+			continue
+		}
+		if result.Success {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// status returns the colored status of case i of the open suite
+func (t *tui) status(i int) string {
+	result := t.results[i]
+	switch {
+	case i == t.running && result == nil:
+		return ansiYellow + "RUN  " + ansiReset
+	case result == nil:
+		return "-    "
+	case result.Crash != nil:
+		return ansiRed + "CRASH" + ansiReset
+	case !result.Success:
+		return ansiRed + "FAIL " + ansiReset
+	default:
+		return ansiGreen + "PASS " + ansiReset
+	}
+}
+
+// draw redraws the screen for the current view
+func (t *tui) draw() {
+	var b strings.Builder
+	b.WriteString(ansiClear)
+	b.WriteString(ansiBold + "Contact Center Simulator" + ansiReset)
+	if simulate {
+		b.WriteString(ansiYellow + "  [simulation mode]" + ansiReset)
+	}
+	b.WriteString("\n\n")
+
+	var help string
+	switch t.view {
+	case viewSuites:
+		help = t.drawSuites(&b)
+	case viewSuite:
+		help = t.drawSuite(&b)
+	case viewCase:
+		help = t.drawCase(&b)
+	case viewBuffer:
+		help = t.drawBuffer(&b)
+	case viewLog:
+		help = t.drawPage(&b, "Simulator log", t.logs.snapshot())
+	}
+
+	b.WriteString("\n")
+	if t.message != "" {
+		b.WriteString(ansiYellow + t.message + ansiReset + "\n")
+	}
+	b.WriteString(help + ", l log, q quit\n> ")
+	fmt.Fprint(t.out, b.String())
+}
+
+// drawSuites draws the list of stored suites
+func (t *tui) drawSuites(b *strings.Builder) string {
+	fmt.Fprintf(b, "Suites in %s\n\n", suitesDir)
+	if len(t.suites) == 0 {
+		b.WriteString("  No suites\n")
+	}
+	for i, info := range t.suites {
+		fmt.Fprintf(b, "  %3d  %-24s %4d cases  %s\n", i+1, info.Name, info.Cases, info.Description)
+	}
+	return "Commands: <number> open suite, r reload"
+}
+
+// drawSuite draws the cases of the open suite with the progress of its run
+func (t *tui) drawSuite(b *strings.Builder) string {
+	fmt.Fprintf(b, "Suite %s, version %d", t.suite.Name, t.version)
+	if t.suite.Description != "" {
+		fmt.Fprintf(b, ": %s", t.suite.Description)
+	}
+	b.WriteString("\n\n")
+
+	passed, failed := t.counts()
+	done := passed + failed
+	if done > 0 || t.running >= 0 {
+		filled := done * tuiBarWidth / len(t.suite.Cases)
+		fmt.Fprintf(b, "  [%s%s] %d/%d  %s%d passed%s, %s%d failed%s", strings.Repeat("#", filled), strings.Repeat(".", tuiBarWidth-filled),
+			done, len(t.suite.Cases), ansiGreen, passed, ansiReset, ansiRed, failed, ansiReset)
+		if t.running >= 0 {
+			fmt.Fprintf(b, "  running %s", t.suite.Cases[t.running].Name)
+		}
+		b.WriteString("\n\n")
+	}
+
+	for i, testCase := range t.suite.Cases {
+		fmt.Fprintf(b, "  %3d  %s  %-24s %-16s", i+1, t.status(i), testCase.Name, endpointOf(testCase))
+		if result := t.results[i]; result != nil {
+			fmt.Fprintf(b, " %8.1f ms", result.DurationMs)
+			if !result.Success {
+				fmt.Fprintf(b, "  %s", firstLine(result.ErrorDetails))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return "Commands: <number> case details, r run suite, b back"
+}
+
+// drawCase draws a case of the open suite and its last result
+func (t *tui) drawCase(b *strings.Builder) string {
+	testCase := t.suite.Cases[t.current]
+	fmt.Fprintf(b, "Case %d/%d: %s  %s\n\n", t.current+1, len(t.suite.Cases), testCase.Name, t.status(t.current))
+	fmt.Fprintf(b, "  Profile:    %s\n", routeProfile(testCase))
+	b.WriteString("  Parameters:\n")
+	for _, p := range testCase.Parameters {
+		fmt.Fprintf(b, "    %s = %s\n", p.Key, escapeValue(p.Value))
+	}
+
+	result := t.results[t.current]
+	if result == nil {
+		b.WriteString("\n  Not run yet\n")
+		return "Commands: n next, p previous, b back"
+	}
+	fmt.Fprintf(b, "\n  Return code: %d (%s) in %.1f ms\n", result.ReturnCode, dllclient.ErrorCode(result.ReturnCode).String(), result.DurationMs)
+	if result.RunID != "" {
+		fmt.Fprintf(b, "  Run:         %s\n", result.RunID)
+	}
+	if len(result.Output) > 0 {
+		b.WriteString("  Output:\n")
+		keys := make([]string, 0, len(result.Output))
+		for key := range result.Output {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(b, "    %s = %s\n", key, escapeValue(result.Output[key]))
+		}
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(b, "  %sWarning: %s%s\n", ansiYellow, warning, ansiReset)
+	}
+	if result.ErrorDetails != "" {
+		fmt.Fprintf(b, "\n  %sError details:%s\n", ansiRed, ansiReset)
+		for _, line := range strings.Split(strings.TrimRight(result.ErrorDetails, "\n"), "\n") {
+			fmt.Fprintf(b, "    %s\n", line)
+		}
+	}
+	return "Commands: i input buffer, o output buffer, n next, p previous, b back"
+}
+
+// drawBuffer draws the input or output buffer of the shown case: decoded, then
+// as a hex dump
+func (t *tui) drawBuffer(b *strings.Builder) string {
+	result := t.results[t.current]
+	decoded, raw := result.InputBuffer, result.input
+	if t.buffer == "output" {
+		decoded, raw = result.OutputBuffer, result.output
+	}
+	lines := strings.Split(strings.TrimRight(decoded, "\n"), "\n")
+	if len(raw) > 0 {
+		lines = append(lines, "", fmt.Sprintf("%d bytes:", len(raw)))
+		lines = append(lines, strings.Split(strings.TrimRight(hex.Dump(raw), "\n"), "\n")...)
+	}
+	title := fmt.Sprintf("%s buffer of case %s", strings.ToUpper(t.buffer[:1])+t.buffer[1:], t.suite.Cases[t.current].Name)
+	return t.drawPage(b, title, lines)
+}
+
+// drawPage draws a page of lines from the current offset
+func (t *tui) drawPage(b *strings.Builder, title string, lines []string) string {
+	t.offset = max(0, min(t.offset, len(lines)-tuiPageLines))
+	end := min(t.offset+tuiPageLines, len(lines))
+	fmt.Fprintf(b, "%s (lines %d-%d of %d)\n\n", title, min(t.offset+1, end), end, len(lines))
+	for _, line := range lines[t.offset:end] {
+		fmt.Fprintf(b, "  %s\n", line)
+	}
+	return "Commands: n or Enter next page, p previous page, b back"
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// enableVirtualTerminal does nothing: terminals interpret ANSI escape sequences
+func enableVirtualTerminal() {}
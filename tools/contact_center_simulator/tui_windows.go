@@ -0,0 +1,29 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// ENABLE_VIRTUAL_TERMINAL_PROCESSING of SetConsoleMode
+const enableVirtualTerminalProcessing = 0x0004
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+// enableVirtualTerminal makes the console interpret the ANSI escape sequences of
+// the terminal interface, which Windows consoles only do when asked
+func enableVirtualTerminal() {
+	handle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
+	if err != nil {
+		return
+	}
+	var mode uint32
+	if ret, _, _ := procGetConsoleMode.Call(uintptr(handle), uintptr(unsafe.Pointer(&mode))); ret == 0 {
+		return
+	}
+	procSetConsoleMode.Call(uintptr(handle), uintptr(mode|enableVirtualTerminalProcessing))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default time a validator may take to check a result before it is killed
+const DefaultValidatorTimeout = 30 * time.Second
+
+// Validator is an external command checking test results for rules the simulator
+// does not know, such as the CID format of a customer, so teams can add checks
+// without changing the simulator. It reads the result as JSON (the /run-test
+// response) from standard input and writes its verdict as JSON to standard output:
+//
+//	{"pass": false, "messages": ["CID 12AB is not 10 digits"]}
+type Validator struct {
+	// Command is run through the system shell
+	Command string `json:"command"`
+	// Endpoints limits the validator to the results of these endpoints (all if empty)
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	name string
+}
+
+// verdict is what a validator writes to standard output
+type verdict struct {
+	Pass     *bool    `json:"pass"`
+	Messages []string `json:"messages"`
+}
+
+// Validation is the verdict of a validator on a test result
+type Validation struct {
+	Validator  string   `json:"validator"`
+	Pass       bool     `json:"pass"`
+	Messages   []string `json:"messages,omitempty"`
+	DurationMs float64  `json:"durationMs"`
+	// Error is set when the validator could not check the result: it did not
+	// start, timed out or wrote no verdict. The result fails then too.
+	Error string `json:"error,omitempty"`
+}
+
+// Validators from -validators, sorted by name, and how long each may take
+var (
+	validators       []*Validator
+	validatorTimeout = DefaultValidatorTimeout
+)
+
+// loadValidators reads the validators of a JSON file of the form
+//
+//	{"cid-format": {"command": "python validators/cid.py", "endpoints": ["saveCID", "getCID"]}}
+func loadValidators(path string) error {
+	var config map[string]*Validator
+	if err := readJSONFile(path, &config); err != nil {
+		return fmt.Errorf("failed to read validators file %s: %v", path, err)
+	}
+	for name, v := range config {
+		if v == nil || strings.TrimSpace(v.Command) == "" {
+			return fmt.Errorf("validator '%s' has no command", name)
+		}
+		v.name = name
+		validators = append(validators, v)
+	}
+	sort.Slice(validators, func(i, j int) bool { return validators[i].name < validators[j].name })
+	return nil
+}
+
+// check runs the validator on a test result
+func (v *Validator) check(endpoint string, result []byte) Validation {
+	validation := Validation{Validator: v.name}
+	ctx, cancel := context.WithTimeout(context.Background(), validatorTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, v.Command, map[string]string{"CCS_VALIDATOR": v.name, "CCS_ENDPOINT": endpoint})
+	cmd.Stdin = bytes.NewReader(result)
+	var stdout, stderr outputBuffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	start := time.Now()
+	err := cmd.Run()
+	validation.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if s := strings.TrimSpace(stderr.String()); s != "" {
+		log.Printf("Validator '%s': %s", v.name, s)
+	}
+
+	var verdict verdict
+	decodeErr := json.Unmarshal([]byte(stdout.String()), &verdict)
+	switch {
+	case ctx.Err() != nil:
+		validation.Error = fmt.Sprintf("timed out after %s", validatorTimeout)
+	case decodeErr == nil && verdict.Pass != nil:
+		// A verdict counts whatever the exit code, as some tools exit with 1 on failure
+		validation.Pass, validation.Messages = *verdict.Pass, verdict.Messages
+	case err != nil && !errors.As(err, new(*exec.ExitError)):
+		validation.Error = err.Error()
+	default:
+		validation.Error = fmt.Sprintf("no verdict on standard output (exit code %d): %s", cmd.ProcessState.ExitCode(), firstLine(stdout.String()))
+	}
+	return validation
+}
+
+// runValidators checks a test result with the validators of its endpoint and
+// fails it if one rejects it or cannot check it
+func runValidators(testCase TestCase, result *TestResult, lang string) {
+	endpoint := endpointOf(testCase)
+	var data []byte
+	for _, v := range validators {
+		if len(v.Endpoints) > 0 && !slices.Contains(v.Endpoints, endpoint) {
+			continue
+		}
+		if data == nil {
+			data, _ = json.Marshal(result)
+		}
+
+		validation := v.check(endpoint, data)
+		result.Validations = append(result.Validations, validation)
+		var details string
+		switch {
+		case validation.Error != "":
+			details = message(lang, "error.validator_broken", v.name, validation.Error)
+		case !validation.Pass:
+			reason := strings.Join(validation.Messages, "; ")
+			if reason == "" {
+				reason = "no reason given"
+			}
+			details = message(lang, "error.validator", v.name, reason)
+		default:
+			continue
+		}
+		log.Printf("Test '%s': %s", testCase.Name, details)
+		if result.ErrorDetails != "" {
+			details += "\n" + result.ErrorDetails
+		}
+		result.Success, result.ErrorDetails = false, details
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// normalizeParameters applies the normalization form of the profile (if any) to the
+// parameter values, returning a warning for each value it changed
+func normalizeParameters(profile *DLLProfile, parameters []Parameter) ([]Parameter, []string) {
+	form, ok := normalizationForms[profile.Normalize]
+	if !ok {
+		return parameters, nil
+	}
+
+	var warnings []string
+	normalized := make([]Parameter, len(parameters))
+	for i, param := range parameters {
+		if value := form.String(param.Value); value != param.Value {
+			warnings = append(warnings, fmt.Sprintf("Parameter '%s' was changed by %s normalization: '%s' (%d bytes) became '%s' (%d bytes)",
+				param.Key, strings.ToUpper(profile.Normalize), param.Value, len(param.Value), value, len(value)))
+			param.Value = value
+		}
+		normalized[i] = param
+	}
+	return normalized, warnings
+}
+
+// encodeParameters prepares parameter values for the buffer as the profile requires:
+// base64 for the base64 keys, the buffer charset for the others
+func encodeParameters(profile *DLLProfile, parameters []Parameter) ([]Parameter, error) {
+	encoded := make([]Parameter, len(parameters))
+	for i, param := range parameters {
+		if profile.isBase64Key(param.Key) {
+			value := base64.StdEncoding.EncodeToString([]byte(param.Value))
+			if len(value) > buffer.ValueSize {
+				return nil, fmt.Errorf("base64 value of '%s' is %d characters long (maximum is %d, i.e. %d bytes before encoding)",
+					param.Key, len(value), buffer.ValueSize, buffer.ValueSize/4*3)
+			}
+			param.Value = value
+		} else {
+			value, err := encodeCharset(profile.Charset, param.Value)
+			if err != nil {
+				return nil, fmt.Errorf("value of '%s' cannot be encoded in %v", param.Key, err)
+			}
+			param.Value = value
+		}
+		encoded[i] = param
+	}
+	return encoded, nil
+}
+
+// decodeOutput decodes output values as the profile requires, returning warnings
+// for values that could not be decoded (they are left as received)
+func decodeOutput(profile *DLLProfile, output map[string]string) []string {
+	var warnings []string
+	for key, value := range output {
+		if !profile.isBase64Key(key) {
+			output[key] = decodeCharset(profile.Charset, value)
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Output value '%s' is not valid base64: %v", key, err))
+			continue
+		}
+		output[key] = string(decoded)
+	}
+	return warnings
+}
+
+// isBase64Key reports whether values of a key are base64-encoded in the buffer
+func (p *DLLProfile) isBase64Key(key string) bool {
+	for _, k := range p.Base64Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeValue makes NULs, control characters and invalid UTF-8 in a key or value
+// visible as \xNN escapes (and a backslash as \\), so they are not hidden or
+// mistaken for the end of the value when displayed
+func escapeValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, "\\x%02X", s[i])
+		case r < 0x20 || r == 0x7F:
+			fmt.Fprintf(&b, "\\x%02X", r)
+		case r == '\\':
+			b.WriteString("\\\\")
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// findEmbeddedNULs warns about version 1 output values holding a NUL before their
+// end: OSCC reads a value up to its first NUL, so the rest would be lost. Version 2
+// values are binary-safe.
+func findEmbeddedNULs(version buffer.Version, output map[string]string) []string {
+	if version == buffer.V2 {
+		return nil
+	}
+	keys := make([]string, 0, len(output))
+	for key := range output {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var warnings []string
+	for _, key := range keys {
+		if i := strings.IndexByte(output[key], 0); i >= 0 {
+			warnings = append(warnings, fmt.Sprintf("Output value '%s' contains a NUL at byte %d; OSCC would only read '%s'",
+				escapeValue(key), i, escapeValue(output[key][:i])))
+		}
+	}
+	return warnings
+}
+
+// BufferError describes a malformed buffer in a test result
+type BufferError struct {
+	// Kind is bad_header, truncated_pair, bad_length or duplicate_key
+	Kind    string `json:"kind"`
+	Pair    int    `json:"pair"`
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+	// Head is the hex of the first bytes of the buffer, for header and size errors
+	Head string `json:"head,omitempty"`
+	// ExpectedSize is the buffer size the header calls for, ActualSize the size found
+	ExpectedSize int `json:"expectedSize,omitempty"`
+	ActualSize   int `json:"actualSize,omitempty"`
+}
+
+// Kinds of buffer errors as reported in results
+var bufferErrorKinds = []struct {
+	err  error
+	kind string
+}{
+	{buffer.ErrBadHeader, "bad_header"},
+	{buffer.ErrTruncatedPair, "truncated_pair"},
+	{buffer.ErrBadLength, "bad_length"},
+	{buffer.ErrDuplicateKey, "duplicate_key"},
+}
+
+// newBufferError converts a buffer parse error for a test result (nil for nil)
+func newBufferError(err error) *BufferError {
+	var parseErr *buffer.ParseError
+	if !errors.As(err, &parseErr) {
+		return nil
+	}
+	result := &BufferError{
+		Kind:         "unknown",
+		Pair:         parseErr.Pair,
+		Offset:       parseErr.Offset,
+		Message:      parseErr.Error(),
+		ExpectedSize: parseErr.ExpectedSize,
+	}
+	if parseErr.Head != nil {
+		result.Head = fmt.Sprintf("% X", parseErr.Head)
+		result.ActualSize = parseErr.ActualSize
+	}
+	for _, k := range bufferErrorKinds {
+		if errors.Is(err, k.err) {
+			result.Kind = k.kind
+		}
+	}
+	return result
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// How long a worker may take to start and load its DLL
+const workerStartTimeout = 10 * time.Second
+
+// Largest amount of worker output kept for crash reports
+const maxWorkerOutput = 64 << 10
+
+// The worker writes workerCallMarker to its standard output after each call, so
+// the output of the call can be told from the next one. The simulator waits up to
+// workerOutputTimeout for it.
+const (
+	workerCallMarker    = "\x00end of call\x00\n"
+	workerOutputTimeout = time.Second
+)
+
+// workerHello is the first message of a worker, after it loaded its DLL
+type workerHello struct {
+	Token        string `json:"token"`
+	Error        string `json:"error,omitempty"`
+	HasLastError bool   `json:"has_last_error"`
+	// Modules are loaded in the worker, to locate the faulting address of a crash
+	Modules []ModuleInfo `json:"modules,omitempty"`
+}
+
+// workerRequest asks a worker to call its DLL
+type workerRequest struct {
+	Input      []byte `json:"input"`
+	OutputSize int    `json:"output_size"`
+	// Modules asks for the modules loaded after the call
+	Modules bool `json:"modules,omitempty"`
+}
+
+// workerResponse is the outcome of a call in a worker
+type workerResponse struct {
+	ReturnCode   int     `json:"return_code"`
+	Errno        uintptr `json:"errno"`
+	Output       []byte  `json:"output"`
+	LastError    string  `json:"last_error"`
+	HasLastError bool    `json:"has_last_error"`
+	Error        string  `json:"error,omitempty"`
+	// Modules are loaded in the worker after the call, if asked for
+	Modules []ModuleInfo `json:"modules,omitempty"`
+}
+
+// WorkerCrash reports a worker process that died during a call
+type WorkerCrash struct {
+	Info *CrashInfo
+}
+
+func (c *WorkerCrash) Error() string {
+	return fmt.Sprintf("the worker process hosting the DLL crashed: %s", c.Info.Summary)
+}
+
+// outputBuffer collects the last maxWorkerOutput bytes written by a worker
+type outputBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	// total counts every byte written, including those dropped from buf
+	total int64
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	b.total += int64(len(p))
+	if len(b.buf) > maxWorkerOutput {
+		b.buf = b.buf[len(b.buf)-maxWorkerOutput:]
+	}
+	return len(p), nil
+}
+
+// String returns the collected output, without call markers
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.ReplaceAll(string(b.buf), workerCallMarker, "")
+}
+
+// position returns the number of bytes written so far
+func (b *outputBuffer) position() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.total
+}
+
+// callOutput waits for the marker ending a call and returns the output written
+// from start up to the marker, and the position after it
+func (b *outputBuffer) callOutput(start int64) (string, int64) {
+	deadline := time.Now().Add(workerOutputTimeout)
+	for {
+		b.mu.Lock()
+		first := b.total - int64(len(b.buf))
+		from := max(start, first)
+		written := string(b.buf[from-first:])
+		b.mu.Unlock()
+
+		if i := strings.Index(written, workerCallMarker); i >= 0 {
+			return written[:i], from + int64(i+len(workerCallMarker))
+		}
+		if time.Now().After(deadline) {
+			return written, from + int64(len(written))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Context key of the environment variables of a call
+type callEnvKey struct{}
+
+// withCallEnv returns a context asking a worker invoker to call the DLL with the
+// environment variables env
+func withCallEnv(ctx context.Context, env map[string]string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, callEnvKey{}, env)
+}
+
+// workerEnv returns the environment variables of a call as NAME=value, sorted
+func workerEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(callEnvKey{}).(map[string]string)
+	vars := make([]string, 0, len(env))
+	for name, value := range env {
+		vars = append(vars, name+"="+value)
+	}
+	slices.Sort(vars)
+	return vars
+}
+
+// workerInvoker calls a DLL loaded in a separate worker process, so a crash in the
+// DLL kills the worker instead of the simulator. A crashed worker is respawned,
+// reloading the DLL, on the next call. The C runtime reads the environment when
+// the DLL is loaded, so a call with other environment variables than the worker
+// was started with restarts it.
+type workerInvoker struct {
+	path    string
+	options dllclient.Options
+	// dir is the working directory of the worker ("" for the simulator's), and
+	// env the environment variables it runs with, over the simulator's own
+	dir string
+	env []string
+
+	mu           sync.Mutex
+	cmd          *exec.Cmd
+	conn         net.Conn
+	enc          *json.Encoder
+	dec          *json.Decoder
+	output       *outputBuffer
+	exited       chan struct{}
+	lastError    string
+	hasLastError bool
+	modules      []ModuleInfo
+	// Output of the last call, and the position of the next call's output
+	callOutput     string
+	outputPosition int64
+	// Modules loaded at the last call that asked for them
+	callModules []ModuleInfo
+	// processID is the process ID of the running worker, 0 if there is none
+	processID atomic.Int64
+}
+
+// newWorkerInvoker starts a worker process hosting the DLL at path, in the
+// working directory dir with the environment variables env
+func newWorkerInvoker(path string, options dllclient.Options, dir string, env map[string]string) (*workerInvoker, error) {
+	w := &workerInvoker{path: path, options: options, dir: dir, env: workerEnv(withCallEnv(context.Background(), env))}
+	if err := w.start(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// start spawns the worker and waits for it to connect back once its DLL is loaded
+func (w *workerInvoker) start() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the simulator executable: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen for the worker: %v", err)
+	}
+	defer ln.Close()
+
+	token := make([]byte, 16)
+	rand.Read(token)
+	w.output = &outputBuffer{}
+	args := []string{"worker", "-dll", w.path, "-connect", ln.Addr().String(), "-token", hex.EncodeToString(token),
+		"-load-flags", strconv.FormatUint(uint64(w.options.LoadFlags), 10), "-dll-directory", w.options.DllDirectory}
+	for _, dir := range w.options.SearchDirs {
+		args = append(args, "-search-dir", dir)
+	}
+	w.cmd = exec.Command(exe, args...)
+	w.cmd.Dir = w.dir
+	if len(w.env) > 0 {
+		w.cmd.Env = append(os.Environ(), w.env...)
+	}
+	w.cmd.Stdout, w.cmd.Stderr = w.output, w.output
+	if err := w.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the worker: %v", err)
+	}
+	w.exited = make(chan struct{})
+	w.processID.Store(int64(w.cmd.Process.Pid))
+	go func(cmd *exec.Cmd, exited chan struct{}) {
+		cmd.Wait()
+		close(exited)
+	}(w.cmd, w.exited)
+
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(workerStartTimeout))
+	conn, err := ln.Accept()
+	if err != nil {
+		w.kill()
+		return fmt.Errorf("the worker did not start: %v %s", err, w.output.String())
+	}
+	w.conn = conn
+	w.enc = json.NewEncoder(conn)
+	w.dec = json.NewDecoder(bufio.NewReader(conn))
+
+	var hello workerHello
+	if err := w.dec.Decode(&hello); err != nil || hello.Token != hex.EncodeToString(token) {
+		w.kill()
+		return fmt.Errorf("the worker did not start: %v %s", err, w.output.String())
+	}
+	if hello.Error != "" {
+		w.kill()
+		return errors.New(hello.Error)
+	}
+	w.hasLastError, w.modules = hello.HasLastError, hello.Modules
+	w.outputPosition = w.output.position()
+	details := ""
+	if w.dir != "" {
+		details += " in " + w.dir
+	}
+	if len(w.env) > 0 {
+		details += " with " + envNames(w.env)
+	}
+	log.Printf("Worker process %d hosts %s%s", w.cmd.Process.Pid, w.path, details)
+	return nil
+}
+
+// envNames lists the names of environment variables, leaving out their values,
+// which may be secret
+func envNames(env []string) string {
+	names := make([]string, len(env))
+	for i, v := range env {
+		names[i], _, _ = strings.Cut(v, "=")
+	}
+	return strings.Join(names, ", ")
+}
+
+// kill stops the worker process and waits for it to exit
+func (w *workerInvoker) kill() {
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	if w.cmd != nil && w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+		<-w.exited
+	}
+	w.cmd, w.conn = nil, nil
+	w.processID.Store(0)
+}
+
+// crash waits for a worker that broke the connection to exit and describes its end
+func (w *workerInvoker) crash() *WorkerCrash {
+	select {
+	case <-w.exited:
+	case <-time.After(2 * time.Second):
+		w.cmd.Process.Kill()
+		<-w.exited
+	}
+	crash := &WorkerCrash{Info: decodeCrash(w.cmd.ProcessState.ExitCode(), exitSignal(w.cmd.ProcessState), w.output.String(), w.modules)}
+	w.conn.Close()
+	w.cmd, w.conn = nil, nil
+	w.processID.Store(0)
+	return crash
+}
+
+func (w *workerInvoker) Invoke(ctx context.Context, input, output []byte) (int, uintptr, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if env := workerEnv(ctx); !slices.Equal(env, w.env) {
+		if w.cmd != nil {
+			log.Printf("Restarting the worker for %s to change its environment variables", w.path)
+			w.kill()
+		}
+		w.env = env
+	}
+	if w.cmd == nil {
+		log.Printf("Restarting the worker for %s", w.path)
+		if err := w.start(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	w.callModules = nil
+	if err := w.enc.Encode(workerRequest{Input: input, OutputSize: len(output), Modules: wantsModules(ctx)}); err != nil {
+		return 0, 0, w.crash()
+	}
+
+	// A hung call is abandoned by killing the worker
+	done := make(chan struct{})
+	defer close(done)
+	go func(conn net.Conn) {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}(w.conn)
+
+	var resp workerResponse
+	if err := w.dec.Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			w.kill()
+			return 0, 0, ctx.Err()
+		}
+		return 0, 0, w.crash()
+	}
+	if resp.Error != "" {
+		w.callOutput, w.outputPosition = w.output.callOutput(w.outputPosition)
+		return 0, 0, errors.New(resp.Error)
+	}
+	copy(output, resp.Output)
+	w.lastError, w.hasLastError = resp.LastError, resp.HasLastError
+	w.callModules = resp.Modules
+	w.callOutput, w.outputPosition = w.output.callOutput(w.outputPosition)
+	return resp.ReturnCode, resp.Errno, nil
+}
+
+// pid returns the process ID of the worker, 0 when it is not running. It does
+// not wait for a call in progress.
+func (w *workerInvoker) pid() int {
+	return int(w.processID.Load())
+}
+
+// HasLastError reports whether the DLL exports GetLastErrorMessage
+func (w *workerInvoker) HasLastError() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.hasLastError
+}
+
+// CallOutput returns what the DLL printed to standard output and error during the
+// last call
+func (w *workerInvoker) CallOutput() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.callOutput
+}
+
+// CallModules returns the modules loaded in the worker at the last call that
+// asked for them
+func (w *workerInvoker) CallModules() []ModuleInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.callModules
+}
+
+func (w *workerInvoker) LastError() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastError, w.hasLastError
+}
+
+func (w *workerInvoker) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.kill()
+	return nil
+}
+
+// runWorker implements the worker subcommand, which the simulator starts to host a
+// DLL in a separate process: it loads the DLL, connects back to the simulator and
+// calls the DLL for every request until the connection closes
+func runWorker(args []string) int {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	path := fs.String("dll", "", "Path to the DLL")
+	addr := fs.String("connect", "", "Address of the simulator")
+	token := fs.String("token", "", "Token identifying the worker to the simulator")
+	var options dllclient.Options
+	fs.Func("load-flags", "LoadLibraryEx flags", func(s string) error {
+		flags, err := strconv.ParseUint(s, 10, 32)
+		options.LoadFlags = uint32(flags)
+		return err
+	})
+	fs.StringVar(&options.DllDirectory, "dll-directory", "", "Directory set with SetDllDirectory")
+	fs.Func("search-dir", "Extra DLL search directory (repeatable)", func(s string) error {
+		options.SearchDirs = append(options.SearchDirs, s)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	conn, err := net.Dial("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "worker: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(bufio.NewReader(conn))
+
+	client, err := dllclient.Load(*path, options)
+	if err != nil {
+		enc.Encode(workerHello{Token: *token, Error: err.Error()})
+		return 1
+	}
+	defer client.Close()
+	enc.Encode(workerHello{Token: *token, HasLastError: client.HasLastError(), Modules: loadedModules()})
+
+	for {
+		var req workerRequest
+		if err := dec.Decode(&req); err != nil {
+			return 0
+		}
+		output := make([]byte, req.OutputSize)
+		ret, errno, err := client.Invoke(context.Background(), req.Input, output)
+		resp := workerResponse{ReturnCode: ret, Errno: errno, Output: bytes.Clone(output)}
+
+		// Mark the end of the call's output, after what the DLL left in the C
+		// runtime's buffers
+		dllclient.FlushStdio()
+		os.Stdout.WriteString(workerCallMarker)
+
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if req.Modules {
+			resp.Modules = loadedModules()
+		}
+		if ret != 0 {
+			resp.LastError, resp.HasLastError = client.LastError()
+		} else {
+			resp.HasLastError = client.HasLastError()
+		}
+		if err := enc.Encode(resp); err != nil {
+			return 1
+		}
+	}
+}
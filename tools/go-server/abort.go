@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Connection abort modes
+const (
+	// AbortHeaders drops the connection in the middle of the response headers
+	AbortHeaders = "headers"
+	// AbortBody drops the connection after the headers and part of the body
+	AbortBody = "body"
+)
+
+// abortResponse starts writing a response and resets the connection part way,
+// so the client sees a truncated response instead of an HTTP error
+func abortResponse(w http.ResponseWriter, r *http.Request, mode string, status int, body, clientIP, endpoint string) {
+	body += "\n"
+	head := fmt.Sprintf("HTTP/1.1 %d %s\r\n%s: %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\n\r\n",
+		status, http.StatusText(status), RequestIDHeader, requestID(r), len(body))
+
+	var partial, received string
+	switch mode {
+	case AbortHeaders:
+		partial = head[:len(head)/2]
+	default:
+		received = body[:len(body)/2]
+		partial = head + received
+	}
+
+	// Record what the client received in the capture (status 0: no complete response)
+	if rec := findResponseRecorder(w); rec != nil {
+		rec.status = 0
+		rec.body.WriteString(received)
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// HTTP/2 connections cannot be hijacked; abort the stream instead
+		mainLog(r).Printf("Aborting %s endpoint response (stream reset)", endpoint)
+		mainLog(r).Printf("=== END CURL REQUEST ===")
+		panic(http.ErrAbortHandler)
+	}
+	defer conn.Close()
+
+	buf.WriteString(partial)
+	buf.Flush()
+
+	// Close with a TCP reset rather than an orderly shutdown
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+
+	mainLog(r).Printf("Aborted %s endpoint response after %d bytes (%s)", endpoint, len(partial), mode)
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+	errorLog(r).Printf("Response: connection aborted (%s) - Client IP: %s, Endpoint: %s", mode, clientIP, endpoint)
+}
+
+// findResponseRecorder returns the responseRecorder wrapped by w, if any
+func findResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	for {
+		if rec, ok := w.(*responseRecorder); ok {
+			return rec
+		}
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = unwrapper.Unwrap()
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log file name pattern (Apache combined format, one file per day)
+const accessLogFilePattern = "access_%s.log"
+
+// Status logged for requests that got no response (black-holed or aborted), as nginx does
+const statusNoResponse = 444
+
+// accessLog writes one line per request in Apache combined log format to daily files
+// in the log directory, for log-analysis tools such as GoAccess
+type accessLog struct {
+	mu     sync.Mutex
+	dir    string
+	date   string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// Global access log, nil unless enabled with -access-log
+var accessLogs *accessLog
+
+// newAccessLog creates an access log writing to dir
+func newAccessLog(dir string) *accessLog {
+	return &accessLog{dir: dir}
+}
+
+// write appends a line to the file of the day t falls on
+func (l *accessLog) write(t time.Time, line string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Switch to a new file when the day changes
+	date := t.Format("2006-01-02")
+	if l.file == nil || date != l.date {
+		if err := l.closeFile(); err != nil {
+			return err
+		}
+		path := filepath.Join(l.dir, fmt.Sprintf(accessLogFilePattern, date))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open access log file: %v", err)
+		}
+		l.file = file
+		l.writer = bufio.NewWriter(file)
+		l.date = date
+	}
+
+	l.writer.WriteString(line)
+	l.writer.WriteByte('\n')
+	return l.writer.Flush()
+}
+
+// Close closes the current file
+func (l *accessLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.closeFile()
+}
+
+// currentFile returns the path of the file being written, which must not be purged
+func (l *accessLog) currentFile() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ""
+	}
+	return l.file.Name()
+}
+
+// closeFile flushes and closes the current file
+func (l *accessLog) closeFile() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.writer.Flush()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	l.writer = nil
+	return err
+}
+
+// accessLogWriter is an http.ResponseWriter that counts the status and bytes sent
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (a *accessLogWriter) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *accessLogWriter) Write(data []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(data)
+	a.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (a *accessLogWriter) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// withAccessLog logs every request to the access log, when it is enabled
+func withAccessLog(next http.Handler) http.Handler {
+	if accessLogs == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		aw := &accessLogWriter{ResponseWriter: w}
+
+		// Log from a deferred call, so requests dropped with http.ErrAbortHandler are logged too
+		defer func() {
+			if err := accessLogs.write(start, combinedLogLine(r, aw, start)); err != nil {
+				errorLogger.Printf("Failed to write access log: %v", err)
+			}
+		}()
+		next.ServeHTTP(aw, r)
+	})
+}
+
+// combinedLogLine formats a request in Apache combined log format:
+// host ident user [time] "request" status bytes "referer" "user-agent"
+func combinedLogLine(r *http.Request, aw *accessLogWriter, t time.Time) string {
+	user := "-"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = escapeLogField(name)
+	}
+	status := aw.status
+	if status == 0 {
+		status = statusNoResponse
+	}
+	bytes := "-"
+	if aw.bytes > 0 {
+		bytes = fmt.Sprint(aw.bytes)
+	}
+	request := fmt.Sprintf("%s %s %s", r.Method, maskURL(r.URL), r.Proto)
+
+	return fmt.Sprintf(`%s - %s [%s] "%s" %d %s "%s" "%s"`,
+		clientHost(r.RemoteAddr), user, t.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogField(request), status, bytes,
+		escapeLogField(orDash(r.Referer())), escapeLogField(orDash(r.UserAgent())))
+}
+
+// escapeLogField escapes quotes, backslashes and control characters as Apache does
+func escapeLogField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// orDash returns "-" for empty log fields
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
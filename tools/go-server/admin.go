@@ -0,0 +1,713 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+)
+
+// Default admin configuration
+const (
+	DefaultAdminPort    = 0
+	DefaultCaptureLimit = 50
+)
+
+// Running admin server, shut down together with the listeners
+var adminServer *http.Server
+
+// Users allowed to access the admin UI and API (nil disables access control)
+var adminUsers *auth.Users
+
+// readOnly refuses every change through the admin API (endpoint behaviors,
+// forced statuses, resets), to expose the admin UI to people outside the team
+var readOnly bool
+
+// startAdminServer serves the admin UI and API on its own port
+func startAdminServer(port int) {
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+
+	addr := fmt.Sprintf(":%d", port)
+	adminServer = &http.Server{Addr: addr, Handler: mux}
+	log.Printf("Starting admin UI on http://localhost%s/admin/", addr)
+	go func() {
+		if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+			errorLogger.Printf("Admin server stopped: %v", err)
+		}
+	}()
+}
+
+// registerAdminHandlers registers the admin UI and API routes
+func registerAdminHandlers(mux *http.ServeMux) {
+	// Viewers can see everything; changes are checked per method by the handlers
+	mux.HandleFunc("/admin/", adminUsers.Require(auth.Viewer, handleAdminUI))
+	mux.HandleFunc("/admin/api/profiles", adminUsers.Require(auth.Viewer, handleAdminProfiles))
+	mux.HandleFunc("/admin/api/endpoints", adminUsers.Require(auth.Viewer, handleAdminEndpoints))
+	mux.HandleFunc("/admin/api/endpoint", adminUsers.Require(auth.Viewer, handleAdminEndpoint))
+	mux.HandleFunc("/admin/api/captures", adminUsers.Require(auth.Viewer, handleAdminCaptures))
+	mux.HandleFunc("/admin/api/capture", adminUsers.Require(auth.Viewer, handleAdminCapture))
+	mux.HandleFunc("/admin/api/stats", adminUsers.Require(auth.Viewer, handleAdminStats))
+	mux.HandleFunc("/admin/api/audit", adminUsers.Require(auth.Viewer, handleAdminAudit))
+	mux.HandleFunc("/admin/api/export", adminUsers.Require(auth.Viewer, handleAdminExport))
+	mux.HandleFunc("/admin/api/scenarios", adminUsers.Require(auth.Viewer, handleAdminScenarios))
+	mux.HandleFunc("/admin/force", adminUsers.Require(auth.Viewer, handleAdminForce))
+	mux.HandleFunc("/admin/stats", adminUsers.Require(auth.Viewer, handleAdminStatsCounters))
+	mux.HandleFunc("/admin/coverage", adminUsers.Require(auth.Viewer, handleAdminCoverage))
+}
+
+// requireRole writes a 403 response unless the authenticated user has at least the given role
+func requireRole(w http.ResponseWriter, r *http.Request, role auth.Role) bool {
+	user, ok := auth.FromRequest(r)
+	if !ok || user.Role < role {
+		http.Error(w, fmt.Sprintf("Forbidden: this action requires the %s role", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// requireChange writes a 403 response in read-only mode, or unless the authenticated
+// user has at least the given role
+func requireChange(w http.ResponseWriter, r *http.Request, role auth.Role) bool {
+	if readOnly {
+		http.Error(w, "Forbidden: the admin API is in read-only mode", http.StatusForbidden)
+		return false
+	}
+	return requireRole(w, r, role)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryLimit parses the optional 'limit' query parameter, writing a 400 response if it is invalid
+func queryLimit(w http.ResponseWriter, r *http.Request, defaultLimit int) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// adminProfile returns the profile selected by the 'profile' query parameter
+// (the default profile when absent), writing a 404 response if it does not exist
+func adminProfile(w http.ResponseWriter, r *http.Request) *Profile {
+	name := r.URL.Query().Get("profile")
+	p := lookupProfile(name)
+	if p == nil {
+		http.Error(w, fmt.Sprintf("Unknown profile '%s'", name), http.StatusNotFound)
+	}
+	return p
+}
+
+// ProfileInfo is a profile as listed by the admin API
+type ProfileInfo struct {
+	Name      string   `json:"name"`
+	Endpoints []string `json:"endpoints"`
+	Listeners []string `json:"listeners"`
+}
+
+// handleAdminProfiles lists the profiles with their endpoints and listeners
+func handleAdminProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	infos := []ProfileInfo{}
+	for _, name := range profileNames() {
+		p := lookupProfile(name)
+		info := ProfileInfo{Name: name, Endpoints: p.endpointNames(), Listeners: []string{}}
+		for _, l := range listeners {
+			if l.Profile == name {
+				info.Listeners = append(info.Listeners, l.Addr)
+			}
+		}
+		infos = append(infos, info)
+	}
+	writeJSON(w, infos)
+}
+
+// handleAdminEndpoints lists the endpoints of a profile with their behavior
+func handleAdminEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := adminProfile(w, r)
+	if p == nil {
+		return
+	}
+	writeJSON(w, endpointStates(p))
+}
+
+// handleAdminEndpoint returns (GET) or changes (POST) the behavior of one endpoint in a profile
+func handleAdminEndpoint(w http.ResponseWriter, r *http.Request) {
+	p := adminProfile(w, r)
+	if p == nil {
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	handler := p.lookup(name)
+	if handler == nil {
+		http.Error(w, fmt.Sprintf("Unknown endpoint '%s'", name), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, endpointState(p, handler.Name()))
+	case http.MethodPost:
+		if !requireChange(w, r, auth.Admin) {
+			return
+		}
+		var b EndpointBehavior
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := b.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		previous := p.behaviors.get(handler.Name())
+		p.behaviors.set(handler.Name(), b)
+		mainLogger.Printf("Admin: behavior of %s endpoint in profile '%s' changed to %+v", handler.Name(), p.Name, b)
+
+		action := "endpoint.modified"
+		if b.simulatesFailures() && !previous.simulatesFailures() {
+			action = "chaos.enabled"
+		} else if !b.simulatesFailures() && previous.simulatesFailures() {
+			action = "chaos.disabled"
+		}
+		audit.record(r, action, p.Name+"/"+handler.Name(), map[string]EndpointBehavior{
+			"before": previous,
+			"after":  b,
+		})
+		writeJSON(w, endpointState(p, handler.Name()))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminForce returns (GET) or sets (POST) the forced status of an endpoint:
+// POST /admin/force?endpoint=getInfo&status=500&count=3 makes the next 3 responses fail
+func handleAdminForce(w http.ResponseWriter, r *http.Request) {
+	p := adminProfile(w, r)
+	if p == nil {
+		return
+	}
+
+	name := r.URL.Query().Get("endpoint")
+	handler := p.lookup(name)
+	if handler == nil {
+		http.Error(w, fmt.Sprintf("Unknown endpoint '%s'", name), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, endpointState(p, handler.Name()))
+	case http.MethodPost:
+		if !requireChange(w, r, auth.Admin) {
+			return
+		}
+
+		query := r.URL.Query()
+		status := http.StatusInternalServerError
+		if value := query.Get("status"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 400 || n > 599 {
+				http.Error(w, "status must be a 4xx or 5xx status code", http.StatusBadRequest)
+				return
+			}
+			status = n
+		}
+		count := 1
+		if value := query.Get("count"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				http.Error(w, "count must be a non-negative number (0 cancels)", http.StatusBadRequest)
+				return
+			}
+			count = n
+		}
+
+		p.behaviors.force(handler.Name(), status, count)
+		mainLogger.Printf("Admin: next %d responses of %s endpoint in profile '%s' forced to status %d", count, handler.Name(), p.Name, status)
+
+		action := "status.forced"
+		if count == 0 {
+			action = "status.force_cancelled"
+		}
+		audit.record(r, action, p.Name+"/"+handler.Name(), ForcedStatus{Status: status, Remaining: count})
+		writeJSON(w, endpointState(p, handler.Name()))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminCaptures lists recent captures, newest first
+func handleAdminCaptures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, ok := queryLimit(w, r, DefaultCaptureLimit)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, recentCaptures.recent(limit, r.URL.Query().Get("endpoint")))
+}
+
+// handleAdminCapture returns a single capture by ID or request ID
+func handleAdminCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Captures can also be found by the X-Request-ID of their request
+	if requestID := r.URL.Query().Get("request_id"); requestID != "" {
+		c, found := recentCaptures.findRequest(requestID)
+		if !found {
+			http.Error(w, fmt.Sprintf("Capture of request %s not found", requestID), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, c)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid capture ID", http.StatusBadRequest)
+		return
+	}
+
+	c, found := recentCaptures.find(id)
+	if !found {
+		http.Error(w, fmt.Sprintf("Capture %d not found", id), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, c)
+}
+
+// handleAdminStats returns the live request statistics
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, stats.snapshot())
+}
+
+// handleAdminStatsCounters returns (GET) or resets (POST) the per-endpoint counters,
+// for all endpoints or the one given by the 'endpoint' query parameter, so tests can
+// assert exactly how often the DLL called an endpoint:
+// POST /admin/stats?action=reset, run the test, then GET /admin/stats?endpoint=getInfo
+func handleAdminStatsCounters(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Query().Get("endpoint")
+	if endpoint != "" {
+		if h := lookupHandler(endpoint); h != nil {
+			endpoint = h.Name()
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if endpoint != "" {
+			writeJSON(w, stats.endpoint(endpoint))
+			return
+		}
+		writeJSON(w, stats.snapshot())
+	case http.MethodPost:
+		if action := r.URL.Query().Get("action"); action != "reset" {
+			http.Error(w, fmt.Sprintf("Unknown action '%s' (valid actions: reset)", action), http.StatusBadRequest)
+			return
+		}
+		if !requireChange(w, r, auth.Operator) {
+			return
+		}
+
+		stats.reset(endpoint)
+		target := endpoint
+		if target == "" {
+			target = "all endpoints"
+		}
+		mainLogger.Printf("Admin: statistics reset for %s", target)
+		audit.record(r, "stats.reset", target, nil)
+		writeJSON(w, stats.snapshot())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminCoverage returns (GET) or resets (POST) the coverage of the endpoint
+// catalog, as JSON or as a text matrix with format=text, to check a suite run left
+// no combination untested before a release:
+// POST /admin/coverage?action=reset, run the suite, then GET /admin/coverage?format=text
+func handleAdminCoverage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := coverage.report()
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "json":
+			writeJSON(w, report)
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			report.writeText(w)
+		default:
+			http.Error(w, fmt.Sprintf("Unknown format '%s' (valid formats: json, text)", format), http.StatusBadRequest)
+		}
+	case http.MethodPost:
+		if action := r.URL.Query().Get("action"); action != "reset" {
+			http.Error(w, fmt.Sprintf("Unknown action '%s' (valid actions: reset)", action), http.StatusBadRequest)
+			return
+		}
+		if !requireChange(w, r, auth.Operator) {
+			return
+		}
+
+		coverage.reset()
+		mainLogger.Printf("Admin: coverage reset")
+		audit.record(r, "coverage.reset", "all endpoints", nil)
+		writeJSON(w, coverage.report())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAdminUI serves the admin web interface
+func handleAdminUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/admin/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	tmpl := template.Must(template.New("admin").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <title>CustomDLL Test Server - Admin</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            margin: 0;
+            padding: 20px;
+            line-height: 1.6;
+        }
+        h1, h2 {
+            color: #333;
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+        }
+        table {
+            border-collapse: collapse;
+            width: 100%;
+            margin-bottom: 20px;
+        }
+        th, td {
+            border: 1px solid #ddd;
+            padding: 6px 8px;
+            text-align: left;
+        }
+        th {
+            background-color: #f5f5f5;
+        }
+        input[type="number"] {
+            width: 90px;
+        }
+        button {
+            background-color: #4CAF50;
+            color: white;
+            padding: 5px 10px;
+            border: none;
+            cursor: pointer;
+        }
+        button:hover {
+            background-color: #45a049;
+        }
+        tr.capture:hover {
+            background-color: #f0f8ff;
+            cursor: pointer;
+        }
+        .status-error {
+            color: red;
+        }
+        pre {
+            background-color: #eee;
+            padding: 10px;
+            overflow-x: auto;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>CustomDLL Test Server - Admin</h1>
+        {{if .ReadOnly}}<p class="status-error">Read-only mode: endpoint behaviors cannot be changed.</p>{{end}}
+
+        <h2>Endpoints</h2>
+        <p>
+            <label for="profile">Profile:</label>
+            <select id="profile" onchange="loadEndpoints()"></select>
+            <span id="profileListeners"></span>
+        </p>
+        <table>
+            <thead>
+                <tr><th>Endpoint</th><th>Disabled</th><th>Latency (ms)</th><th>Error rate (0-1)</th><th>Error status</th><th></th></tr>
+            </thead>
+            <tbody id="endpoints"></tbody>
+        </table>
+
+        <h2>Live Stats</h2>
+        <p id="statsSummary"></p>
+        <table>
+            <thead>
+                <tr><th>Endpoint</th><th>Hits</th><th>2xx/3xx</th><th>4xx</th><th>5xx</th><th>Avg latency (ms)</th></tr>
+            </thead>
+            <tbody id="stats"></tbody>
+        </table>
+
+        <h2>Recent Captures</h2>
+        <table>
+            <thead>
+                <tr><th>ID</th><th>Time</th><th>Profile</th><th>Client</th><th>Endpoint</th><th>Status</th><th>Duration (ms)</th></tr>
+            </thead>
+            <tbody id="captures"></tbody>
+        </table>
+        <pre id="captureDetail" style="display: none;"></pre>
+
+        <h2>Audit Log</h2>
+        <table>
+            <thead>
+                <tr><th>Time</th><th>User</th><th>Client</th><th>Action</th><th>Target</th></tr>
+            </thead>
+            <tbody id="audit"></tbody>
+        </table>
+    </div>
+
+    <script>
+        function escapeHtml(text) {
+            return String(text).replace(/[&<>"']/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c]));
+        }
+
+        let profiles = [];
+        let endpointBehaviors = {};
+
+        function selectedProfile() {
+            return document.getElementById('profile').value || 'default';
+        }
+
+        function loadProfiles() {
+            fetch('/admin/api/profiles')
+            .then(response => response.json())
+            .then(result => {
+                profiles = result;
+                const select = document.getElementById('profile');
+                select.innerHTML = '';
+                for (const p of profiles) {
+                    const option = document.createElement('option');
+                    option.value = p.name;
+                    option.textContent = p.name;
+                    select.appendChild(option);
+                }
+                select.value = 'default';
+                loadEndpoints();
+            });
+        }
+
+        function loadEndpoints() {
+            const profile = profiles.find(p => p.name === selectedProfile());
+            document.getElementById('profileListeners').textContent =
+                profile && profile.listeners.length ? 'Listening on ' + profile.listeners.join(', ') : 'No listeners';
+
+            fetch('/admin/api/endpoints?profile=' + encodeURIComponent(selectedProfile()))
+            .then(response => response.json())
+            .then(endpoints => {
+                let html = '';
+                endpointBehaviors = {};
+                for (const e of endpoints) {
+                    endpointBehaviors[e.name] = e.behavior;
+                    const name = escapeHtml(e.name);
+                    html += '<tr data-name="' + name + '">';
+                    let forced = '';
+                    if (e.forced) {
+                        forced = ' <small>(next ' + e.forced.remaining + ' forced to ' + e.forced.status + ')</small>';
+                    }
+                    const modes = describeModes(e.behavior);
+                    if (modes) {
+                        forced += ' <small>(' + escapeHtml(modes) + ')</small>';
+                    }
+                    html += '<td>' + name + forced + '</td>';
+                    html += '<td><input type="checkbox" class="disabled"' + (e.behavior.disabled ? ' checked' : '') + '></td>';
+                    html += '<td><input type="number" class="latency" min="0" value="' + e.behavior.latency_ms + '"></td>';
+                    html += '<td><input type="number" class="errorRate" min="0" max="1" step="0.05" value="' + e.behavior.error_rate + '"></td>';
+                    html += '<td><input type="number" class="errorStatus" min="0" max="599" value="' + e.behavior.error_status + '"></td>';
+                    html += '<td><button onclick="saveEndpoint(this)">Save</button></td>';
+                    html += '</tr>';
+                }
+                document.getElementById('endpoints').innerHTML = html;
+            });
+        }
+
+        // describeModes summarizes the behavior settings that are only configurable through the API
+        function describeModes(b) {
+            const modes = [];
+            if (b.trickle_delay_ms) {
+                modes.push('trickle ' + (b.trickle_bytes || 1) + ' B every ' + b.trickle_delay_ms + ' ms');
+            }
+            if (b.black_hole) {
+                modes.push('black hole');
+            }
+            if (b.redirects) {
+                modes.push(b.redirects + ' redirects (' + (b.redirect_status || 302) + (b.redirect_to ? ' to ' + b.redirect_to : '') + ')');
+            }
+            if (b.response_size) {
+                modes.push('responses padded to ' + b.response_size + ' characters');
+            }
+            if (b.charset) {
+                modes.push('charset ' + b.charset);
+            }
+            if (b.require_session) {
+                modes.push('session required');
+            }
+            if (b.abort) {
+                modes.push('abort in ' + b.abort);
+            }
+            return modes.join(', ');
+        }
+
+        function saveEndpoint(button) {
+            const row = button.closest('tr');
+            // Keep the settings that are not editable in the table
+            const behavior = {
+                ...endpointBehaviors[row.dataset.name],
+                disabled: row.querySelector('.disabled').checked,
+                latency_ms: parseInt(row.querySelector('.latency').value) || 0,
+                error_rate: parseFloat(row.querySelector('.errorRate').value) || 0,
+                error_status: parseInt(row.querySelector('.errorStatus').value) || 0
+            };
+
+            fetch('/admin/api/endpoint?profile=' + encodeURIComponent(selectedProfile()) + '&name=' + encodeURIComponent(row.dataset.name), {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json'
+                },
+                body: JSON.stringify(behavior)
+            })
+            .then(response => {
+                if (!response.ok) {
+                    return response.text().then(text => { throw new Error(text); });
+                }
+                loadEndpoints();
+                loadAudit();
+            })
+            .catch(error => alert('Failed to save endpoint: ' + error.message));
+        }
+
+        function loadStats() {
+            fetch('/admin/api/stats')
+            .then(response => response.json())
+            .then(stats => {
+                document.getElementById('statsSummary').textContent =
+                    stats.total_requests + ' request(s) since ' + new Date(stats.since).toLocaleString();
+                let html = '';
+                for (const e of stats.endpoints) {
+                    html += '<tr>';
+                    html += '<td>' + escapeHtml(e.endpoint) + '</td>';
+                    html += '<td>' + e.hits + '</td>';
+                    html += '<td>' + e.success + '</td>';
+                    html += '<td>' + e.client_errors + '</td>';
+                    html += '<td>' + e.server_errors + '</td>';
+                    html += '<td>' + e.avg_latency_ms.toFixed(2) + '</td>';
+                    html += '</tr>';
+                }
+                document.getElementById('stats').innerHTML = html;
+            });
+        }
+
+        function loadCaptures() {
+            fetch('/admin/api/captures?limit=50')
+            .then(response => response.json())
+            .then(captures => {
+                let html = '';
+                for (const c of captures) {
+                    html += '<tr class="capture" onclick="showCapture(' + c.id + ')">';
+                    html += '<td>' + c.id + '</td>';
+                    html += '<td>' + new Date(c.timestamp).toLocaleTimeString() + '</td>';
+                    html += '<td>' + escapeHtml(c.profile) + '</td>';
+                    html += '<td>' + escapeHtml(c.client_ip) + '</td>';
+                    html += '<td>' + escapeHtml(c.endpoint) + '</td>';
+                    html += '<td' + (c.status >= 400 ? ' class="status-error"' : '') + '>' + c.status + '</td>';
+                    html += '<td>' + c.duration_ms.toFixed(2) + '</td>';
+                    html += '</tr>';
+                }
+                document.getElementById('captures').innerHTML = html;
+            });
+        }
+
+        function showCapture(id) {
+            fetch('/admin/api/capture?id=' + id)
+            .then(response => response.json())
+            .then(capture => {
+                const detail = document.getElementById('captureDetail');
+                detail.textContent = JSON.stringify(capture, null, 2);
+                detail.style.display = 'block';
+            });
+        }
+
+        function loadAudit() {
+            fetch('/admin/api/audit?limit=20')
+            .then(response => response.json())
+            .then(entries => {
+                let html = '';
+                for (const e of entries) {
+                    html += '<tr>';
+                    html += '<td>' + new Date(e.timestamp).toLocaleString() + '</td>';
+                    html += '<td>' + escapeHtml(e.user) + '</td>';
+                    html += '<td>' + escapeHtml(e.client_ip) + '</td>';
+                    html += '<td>' + escapeHtml(e.action) + '</td>';
+                    html += '<td>' + escapeHtml(e.target) + '</td>';
+                    html += '</tr>';
+                }
+                document.getElementById('audit').innerHTML = html;
+            });
+        }
+
+        window.onload = function() {
+            loadAudit();
+            loadProfiles();
+            loadStats();
+            loadCaptures();
+            setInterval(function() {
+                loadStats();
+                loadCaptures();
+            }, 2000);
+        };
+    </script>
+</body>
+</html>
+`))
+
+	tmpl.Execute(w, struct{ ReadOnly bool }{readOnly})
+}
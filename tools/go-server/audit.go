@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+)
+
+// Audit log file name (append-only, not subject to retention)
+const auditLogFileName = "audit.log"
+
+// AuditEntry records one administrative action
+type AuditEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	User      string      `json:"user"`
+	ClientIP  string      `json:"client_ip"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// auditLog appends entries to a JSONL file
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Global audit log
+var audit *auditLog
+
+// openAuditLog opens (or creates) the audit log for appending
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+// record appends an entry for an action performed through the admin API
+func (a *auditLog) record(r *http.Request, action, target string, details interface{}) {
+	entry := AuditEntry{
+		Timestamp: time.Now(),
+		User:      adminUser(r),
+		ClientIP:  requestClientIP(r),
+		Action:    action,
+		Target:    target,
+		Details:   details,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		errorLogger.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		errorLogger.Printf("Failed to write audit entry: %v", err)
+		return
+	}
+	a.file.Sync()
+	mainLogger.Printf("Audit: %s %s %s", entry.User, action, target)
+}
+
+// entries returns up to limit entries, newest first
+func (a *auditLog) entries(limit int) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var all []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			all = append(all, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := []AuditEntry{}
+	for i := len(all) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, all[i])
+	}
+	return result, nil
+}
+
+// Close closes the audit log file
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.file.Close()
+}
+
+// trustProxyUser takes the audited user and client address from the headers set
+// by an authenticating reverse proxy in front of the admin port
+var trustProxyUser bool
+
+// adminUser identifies the user performing an admin request: the user
+// authenticated against -users, or with -trust-proxy-user the user asserted by
+// the reverse proxy. Any other request is anonymous, and identified by its
+// client address only.
+func adminUser(r *http.Request) string {
+	if user, ok := auth.FromRequest(r); ok && adminUsers != nil {
+		return user.Name
+	}
+	if user := r.Header.Get("X-Remote-User"); trustProxyUser && user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// requestClientIP returns the client address, or with -trust-proxy-user the
+// address forwarded by the reverse proxy
+func requestClientIP(r *http.Request) string {
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); trustProxyUser && forwardedFor != "" {
+		return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+	return r.RemoteAddr
+}
+
+// handleAdminAudit returns the most recent audit entries
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, ok := queryLimit(w, r, DefaultCaptureLimit)
+	if !ok {
+		return
+	}
+
+	entries, err := audit.entries(limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminUser(t *testing.T) {
+	t.Cleanup(func() { trustProxyUser = false })
+
+	tests := []struct {
+		name       string
+		trustProxy bool
+		user, ip   string
+	}{
+		{"anonymous", false, "anonymous", "192.0.2.1:1234"},
+		{"trusted proxy", true, "alice", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustProxyUser = tt.trustProxy
+			r := httptest.NewRequest("POST", "/admin/api/endpoint", nil)
+			r.SetBasicAuth("mallory", "")
+			r.Header.Set("X-Remote-User", "alice")
+			r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+			if user, ip := adminUser(r), requestClientIP(r); user != tt.user || ip != tt.ip {
+				t.Errorf("user %q, client %q; want %q, %q", user, ip, tt.user, tt.ip)
+			}
+		})
+	}
+}
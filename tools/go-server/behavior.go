@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointBehavior controls how an endpoint responds on top of its handler logic.
+// It is changed at runtime from the admin UI to simulate backend problems.
+type EndpointBehavior struct {
+	// Disabled makes the endpoint answer 503 Service Unavailable
+	Disabled bool `json:"disabled"`
+	// LatencyMs delays every response by the given number of milliseconds
+	LatencyMs int `json:"latency_ms"`
+	// ErrorRate is the fraction (0-1) of requests that fail with ErrorStatus
+	ErrorRate float64 `json:"error_rate"`
+	// ErrorStatus is the status returned for failed requests (defaults to 500)
+	ErrorStatus int `json:"error_status"`
+	// TrickleDelayMs writes the response body slowly, pausing this long between chunks
+	TrickleDelayMs int `json:"trickle_delay_ms,omitempty"`
+	// TrickleBytes is the size of each trickled chunk (defaults to 1 byte)
+	TrickleBytes int `json:"trickle_bytes,omitempty"`
+	// Abort resets the connection part way through the response headers ("headers") or body ("body")
+	Abort string `json:"abort,omitempty"`
+	// BlackHole accepts the request but never responds, until the client gives up
+	BlackHole bool `json:"black_hole,omitempty"`
+	// Redirects sends the client through a chain of this many redirects before responding
+	Redirects int `json:"redirects,omitempty"`
+	// RedirectStatus is the status of each redirect: 301, 302 (default), 303, 307 or 308
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// RedirectTo is the base URL of the redirect targets, e.g. https://localhost:8443 to
+	// switch scheme (defaults to this server)
+	RedirectTo string `json:"redirect_to,omitempty"`
+	// ResponseSize pads successful response bodies to at least this many characters,
+	// to exercise truncation into the DLL's 128-character output value
+	ResponseSize int `json:"response_size,omitempty"`
+	// Charset encodes successful response bodies in utf-8 (default), iso-8859-2 or windows-1250
+	Charset string `json:"charset,omitempty"`
+	// RequireSession answers 401 unless the request presents a session cookie issued by the login endpoint
+	RequireSession bool `json:"require_session,omitempty"`
+}
+
+// validate checks that the behavior settings are usable
+func (b EndpointBehavior) validate() error {
+	if b.LatencyMs < 0 {
+		return fmt.Errorf("latency_ms must not be negative")
+	}
+	if b.ErrorRate < 0 || b.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if b.ErrorStatus != 0 && (b.ErrorStatus < 400 || b.ErrorStatus > 599) {
+		return fmt.Errorf("error_status must be a 4xx or 5xx status code")
+	}
+	if b.TrickleDelayMs < 0 || b.TrickleBytes < 0 {
+		return fmt.Errorf("trickle_delay_ms and trickle_bytes must not be negative")
+	}
+	if b.Abort != "" && b.Abort != AbortHeaders && b.Abort != AbortBody {
+		return fmt.Errorf("abort must be '%s' or '%s'", AbortHeaders, AbortBody)
+	}
+	if b.ResponseSize < 0 || b.ResponseSize > MaxResponseSize {
+		return fmt.Errorf("response_size must be between 0 and %d", MaxResponseSize)
+	}
+	if b.Charset != "" && !validCharset(b.Charset) {
+		return fmt.Errorf("charset must be one of: %s", strings.Join(charsetNames(), ", "))
+	}
+	if b.Redirects < 0 {
+		return fmt.Errorf("redirects must not be negative")
+	}
+	switch b.RedirectStatus {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("redirect_status must be 301, 302, 303, 307 or 308")
+	}
+	if b.RedirectTo != "" {
+		u, err := url.Parse(b.RedirectTo)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("redirect_to must be an http or https base URL")
+		}
+	}
+	return nil
+}
+
+// simulatesFailures reports whether the behavior injects problems (chaos) into responses
+func (b EndpointBehavior) simulatesFailures() bool {
+	return b != (EndpointBehavior{})
+}
+
+// ForcedStatus makes the next Remaining responses of an endpoint fail with Status
+type ForcedStatus struct {
+	Status    int `json:"status"`
+	Remaining int `json:"remaining"`
+}
+
+// behaviorStore holds the behavior and forced statuses of each endpoint, keyed by lower-case endpoint name
+type behaviorStore struct {
+	mu        sync.RWMutex
+	behaviors map[string]EndpointBehavior
+	forced    map[string]ForcedStatus
+}
+
+// newBehaviorStore creates a store where every endpoint has default behavior
+func newBehaviorStore() *behaviorStore {
+	return &behaviorStore{
+		behaviors: make(map[string]EndpointBehavior),
+		forced:    make(map[string]ForcedStatus),
+	}
+}
+
+// get returns the behavior of an endpoint (the zero value when none is set)
+func (s *behaviorStore) get(endpoint string) EndpointBehavior {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.behaviors[strings.ToLower(endpoint)]
+}
+
+// set replaces the behavior of an endpoint
+func (s *behaviorStore) set(endpoint string, b EndpointBehavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b == (EndpointBehavior{}) {
+		delete(s.behaviors, strings.ToLower(endpoint))
+		return
+	}
+	s.behaviors[strings.ToLower(endpoint)] = b
+}
+
+// force makes the next count responses of an endpoint fail with status (count 0 cancels)
+func (s *behaviorStore) force(endpoint string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if count <= 0 {
+		delete(s.forced, strings.ToLower(endpoint))
+		return
+	}
+	s.forced[strings.ToLower(endpoint)] = ForcedStatus{Status: status, Remaining: count}
+}
+
+// getForced returns the pending forced status of an endpoint, if any
+func (s *behaviorStore) getForced(endpoint string) (ForcedStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.forced[strings.ToLower(endpoint)]
+	return f, ok
+}
+
+// takeForced consumes one forced response of an endpoint, returning its status
+func (s *behaviorStore) takeForced(endpoint string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(endpoint)
+	f, ok := s.forced[key]
+	if !ok {
+		return 0, false
+	}
+	if f.Remaining <= 1 {
+		delete(s.forced, key)
+	} else {
+		f.Remaining--
+		s.forced[key] = f
+	}
+	return f.Status, true
+}
+
+// EndpointState is an endpoint as listed by the admin API
+type EndpointState struct {
+	Name     string           `json:"name"`
+	Behavior EndpointBehavior `json:"behavior"`
+	Forced   *ForcedStatus    `json:"forced,omitempty"`
+}
+
+// endpointState returns the current state of one endpoint of a profile
+func endpointState(p *Profile, name string) EndpointState {
+	state := EndpointState{Name: name, Behavior: p.behaviors.get(name)}
+	if f, ok := p.behaviors.getForced(name); ok {
+		state.Forced = &f
+	}
+	return state
+}
+
+// endpointStates lists every endpoint of a profile with its current behavior
+func endpointStates(p *Profile) []EndpointState {
+	states := []EndpointState{}
+	for _, name := range p.endpointNames() {
+		states = append(states, endpointState(p, name))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// responseWriter returns the writer responses are written through, slowed down
+// when the behavior trickles them
+func (b EndpointBehavior) responseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if b.TrickleDelayMs <= 0 {
+		return w
+	}
+	chunk := b.TrickleBytes
+	if chunk <= 0 {
+		chunk = 1
+	}
+	return &trickleWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		chunk:          chunk,
+		delay:          time.Duration(b.TrickleDelayMs) * time.Millisecond,
+	}
+}
+
+// trickleWriter writes the body a few bytes at a time, flushing each chunk and
+// pausing between them, to exercise the client's low-speed and stall handling
+type trickleWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	chunk int
+	delay time.Duration
+}
+
+func (t *trickleWriter) Write(data []byte) (int, error) {
+	controller := http.NewResponseController(t.ResponseWriter)
+	written := 0
+	for written < len(data) {
+		end := written + t.chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		n, err := t.ResponseWriter.Write(data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		controller.Flush()
+
+		if written < len(data) {
+			select {
+			case <-t.ctx.Done():
+				// The client gave up waiting
+				return written, t.ctx.Err()
+			case <-time.After(t.delay):
+			}
+		}
+	}
+	return written, nil
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (t *trickleWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// blackHole holds the request without ever responding, until the client gives up
+// or the server shuts down, and then drops the connection
+func blackHole(w http.ResponseWriter, r *http.Request, endpoint, clientIP string) {
+	mainLog(r).Printf("Black-holing request to %s endpoint", endpoint)
+	if rec := findResponseRecorder(w); rec != nil {
+		rec.status = 0
+	}
+
+	start := time.Now()
+	select {
+	case <-r.Context().Done():
+		mainLog(r).Printf("Client gave up on black-holed %s endpoint after %s", endpoint, time.Since(start).Round(time.Millisecond))
+	case <-shuttingDown:
+		mainLog(r).Printf("Dropping black-holed %s endpoint request on shutdown", endpoint)
+	}
+	errorLog(r).Printf("Response: none (black hole) - Client IP: %s, Endpoint: %s", clientIP, endpoint)
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+
+	// Close the connection without writing a response
+	panic(http.ErrAbortHandler)
+}
+
+// Query parameter counting the redirects a client has followed
+const redirectHopParam = "_redirect_hop"
+
+// redirect sends the client to the next hop of the redirect chain, returning
+// false once the chain has been followed to its end
+func redirect(w http.ResponseWriter, r *http.Request, b EndpointBehavior, endpoint string) bool {
+	hop, _ := strconv.Atoi(r.URL.Query().Get(redirectHopParam))
+	if hop >= b.Redirects {
+		return false
+	}
+
+	query := r.URL.Query()
+	query.Set(redirectHopParam, strconv.Itoa(hop+1))
+	target := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	if b.RedirectTo != "" {
+		base, _ := url.Parse(b.RedirectTo)
+		target.Scheme = base.Scheme
+		target.Host = base.Host
+		target.Path = strings.TrimSuffix(base.Path, "/") + r.URL.Path
+	}
+
+	status := b.RedirectStatus
+	if status == 0 {
+		status = http.StatusFound
+	}
+	mainLog(r).Printf("Redirect %d/%d for %s endpoint: %d to %s", hop+1, b.Redirects, endpoint, status, maskURL(&target))
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+	w.Header().Set("Location", target.String())
+	w.WriteHeader(status)
+	return true
+}
+
+// Largest body response_size can produce
+const MaxResponseSize = 1 << 20
+
+// padBody pads a response body to the configured size with a ruler, where each
+// multiple of 10 ends with its position (...-----120-----130...), so the point
+// where a client truncated the body can be read off the received text
+func (b EndpointBehavior) padBody(body string) string {
+	if len(body) >= b.ResponseSize {
+		return body
+	}
+
+	var ruler strings.Builder
+	for end := 10; ruler.Len() < b.ResponseSize; end += 10 {
+		mark := strconv.Itoa(end)
+		ruler.WriteString(strings.Repeat("-", 10-len(mark)) + mark)
+	}
+	return body + " " + ruler.String()[len(body)+1:b.ResponseSize]
+}
+
+// applyForcedStatus consumes a status forced for the endpoint of a profile, writing it as the response.
+// It returns false when the response was forced.
+func applyForcedStatus(w http.ResponseWriter, r *http.Request, p *Profile, endpoint, clientIP string) bool {
+	status, ok := p.behaviors.takeForced(endpoint)
+	if !ok {
+		return true
+	}
+	mainLog(r).Printf("Forcing status %d for %s endpoint", status, endpoint)
+	writeErrorResponse(w, r, status,
+		fmt.Sprintf("Error: Forced status %d for endpoint '%s'", status, endpoint), clientIP, endpoint)
+	return false
+}
+
+// applyBehavior applies the behavior of an endpoint before its handler runs.
+// It returns false when the behavior already produced the response.
+func applyBehavior(w http.ResponseWriter, r *http.Request, b EndpointBehavior, endpoint, clientIP string) bool {
+	if b.BlackHole {
+		blackHole(w, r, endpoint, clientIP)
+		return false
+	}
+
+	if b.Redirects > 0 && redirect(w, r, b, endpoint) {
+		return false
+	}
+
+	if b.RequireSession {
+		ok, err := checkSession(r)
+		if err != nil {
+			writeErrorResponse(w, r, http.StatusInternalServerError,
+				fmt.Sprintf("Error: Failed to look up session: %v", err), clientIP, endpoint)
+			return false
+		}
+		if !ok {
+			writeErrorResponse(w, r, http.StatusUnauthorized,
+				fmt.Sprintf("Error: Endpoint '%s' requires a valid %s session cookie (call the login endpoint first)", endpoint, SessionCookieName), clientIP, endpoint)
+			return false
+		}
+	}
+
+	if b.Disabled {
+		writeErrorResponse(w, r, http.StatusServiceUnavailable,
+			fmt.Sprintf("Error: Endpoint '%s' is disabled", endpoint), clientIP, endpoint)
+		return false
+	}
+
+	if b.LatencyMs > 0 {
+		mainLog(r).Printf("Simulating %d ms latency for %s endpoint", b.LatencyMs, endpoint)
+		time.Sleep(time.Duration(b.LatencyMs) * time.Millisecond)
+	}
+
+	if b.ErrorRate > 0 && rand.Float64() < b.ErrorRate {
+		status := b.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		writeErrorResponse(w, r, status,
+			fmt.Sprintf("Error: Simulated failure for endpoint '%s'", endpoint), clientIP, endpoint)
+		return false
+	}
+
+	return true
+}
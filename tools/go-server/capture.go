@@ -0,0 +1,246 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default number of recent captures kept in memory for the capture browser
+const DefaultCaptureBufferSize = 1000
+
+// Capture is the record of one API exchange between the DLL and the server
+type Capture struct {
+	ID         int64             `json:"id"`
+	Timestamp  time.Time         `json:"timestamp"`
+	RequestID  string            `json:"request_id"`
+	Profile    string            `json:"profile"`
+	ClientIP   string            `json:"client_ip"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Endpoint   string            `json:"endpoint"`
+	Parameters map[string]string `json:"parameters"`
+	Status     int               `json:"status"`
+	Response   string            `json:"response"`
+	DurationMs float64           `json:"duration_ms"`
+}
+
+// CaptureSink receives every capture recorded by the server
+type CaptureSink interface {
+	// Write stores or forwards a capture
+	Write(c Capture) error
+	// Close flushes pending captures and releases resources
+	Close() error
+}
+
+// Registered capture sinks
+var (
+	captureSinksMu sync.RWMutex
+	captureSinks   []registeredSink
+	lastCaptureID  atomic.Int64
+)
+
+// Fraction of successful requests whose captures reach sampled sinks, set by -capture-sample
+var captureSampleRate = 1.0
+
+// registeredSink is a capture sink and whether it only receives sampled captures
+type registeredSink struct {
+	sink    CaptureSink
+	sampled bool
+}
+
+// addCaptureSink registers a sink to receive every capture
+func addCaptureSink(sink CaptureSink) {
+	captureSinksMu.Lock()
+	defer captureSinksMu.Unlock()
+
+	captureSinks = append(captureSinks, registeredSink{sink: sink})
+}
+
+// addSampledCaptureSink registers a sink to receive only sampled captures, for
+// stores and publishers whose volume must stay manageable during soak tests
+func addSampledCaptureSink(sink CaptureSink) {
+	captureSinksMu.Lock()
+	defer captureSinksMu.Unlock()
+
+	captureSinks = append(captureSinks, registeredSink{sink: sink, sampled: true})
+}
+
+// captureSampled decides whether a capture reaches the sampled sinks.
+// Failed requests are always kept, so no error goes unrecorded.
+func captureSampled(c Capture) bool {
+	if c.Status >= 400 || c.Status == 0 {
+		return true
+	}
+	return captureSampleRate >= 1 || rand.Float64() < captureSampleRate
+}
+
+// recordCapture hands a capture to every registered sink, and to the sampled
+// sinks only when it is sampled
+func recordCapture(c Capture) {
+	c.ID = lastCaptureID.Add(1)
+	sampled := captureSampled(c)
+
+	captureSinksMu.RLock()
+	defer captureSinksMu.RUnlock()
+
+	for _, s := range captureSinks {
+		if s.sampled && !sampled {
+			continue
+		}
+		if err := s.sink.Write(c); err != nil {
+			errorLogger.Printf("Failed to record capture: %v", err)
+		}
+	}
+}
+
+// closeCaptureSinks closes every registered sink
+func closeCaptureSinks() {
+	captureSinksMu.Lock()
+	defer captureSinksMu.Unlock()
+
+	for _, s := range captureSinks {
+		if err := s.sink.Close(); err != nil {
+			errorLogger.Printf("Failed to close capture sink: %v", err)
+		}
+	}
+	captureSinks = nil
+}
+
+// newCapture starts a capture for an API request
+func newCapture(r *http.Request, p *Profile, clientIP string) Capture {
+	return Capture{
+		Timestamp:  time.Now(),
+		RequestID:  requestID(r),
+		Profile:    p.Name,
+		ClientIP:   clientIP,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Parameters: make(map[string]string),
+		Status:     http.StatusOK,
+	}
+}
+
+// captureParameters copies the parsed request parameters into the capture
+func (c *Capture) captureParameters(r *http.Request) {
+	for key, values := range r.Form {
+		c.Parameters[key] = strings.Join(values, ", ")
+	}
+}
+
+// finish completes the capture with what was written to the client
+func (c *Capture) finish(rec *responseRecorder) {
+	c.Status = rec.status
+	c.Response = strings.TrimRight(rec.body.String(), "\r\n")
+	c.DurationMs = float64(time.Since(c.Timestamp).Microseconds()) / 1000
+}
+
+// responseRecorder is an http.ResponseWriter that remembers the status and body it wrote
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        strings.Builder
+	wroteHeader bool
+}
+
+// newResponseRecorder wraps w
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, so http.ResponseController can reach it
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// captureBuffer is a CaptureSink keeping the most recent captures in memory
+type captureBuffer struct {
+	mu       sync.Mutex
+	captures []Capture
+	next     int
+	full     bool
+}
+
+// Global buffer of recent captures
+var recentCaptures = newCaptureBuffer(DefaultCaptureBufferSize)
+
+// newCaptureBuffer creates a buffer holding up to size captures
+func newCaptureBuffer(size int) *captureBuffer {
+	return &captureBuffer{captures: make([]Capture, size)}
+}
+
+func (b *captureBuffer) Write(c Capture) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.captures[b.next] = c
+	b.next = (b.next + 1) % len(b.captures)
+	if b.next == 0 {
+		b.full = true
+	}
+	return nil
+}
+
+func (b *captureBuffer) Close() error {
+	return nil
+}
+
+// recent returns up to limit captures, newest first, optionally for one endpoint only
+func (b *captureBuffer) recent(limit int, endpoint string) []Capture {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.captures)
+	}
+
+	result := []Capture{}
+	for i := 1; i <= count && len(result) < limit; i++ {
+		c := b.captures[(b.next-i+len(b.captures))%len(b.captures)]
+		if endpoint == "" || strings.EqualFold(c.Endpoint, endpoint) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// find returns the capture with the given ID if it is still buffered
+func (b *captureBuffer) find(id int64) (Capture, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.captures {
+		if c.ID == id && id != 0 {
+			return c, true
+		}
+	}
+	return Capture{}, false
+}
+
+// findRequest returns the newest buffered capture with the given request ID
+func (b *captureBuffer) findRequest(requestID string) (Capture, bool) {
+	for _, c := range b.recent(len(b.captures), "") {
+		if c.RequestID == requestID {
+			return c, true
+		}
+	}
+	return Capture{}, false
+}
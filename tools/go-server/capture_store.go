@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Capture store file name pattern (one JSON capture per line, one file per day)
+const captureFilePattern = "captures_%s.jsonl"
+
+// captureFileStore is a CaptureSink persisting captures to daily JSONL files in the log directory
+type captureFileStore struct {
+	mu     sync.Mutex
+	dir    string
+	date   string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// Global persistent capture store
+var captureStore *captureFileStore
+
+// newCaptureFileStore creates a store writing to dir
+func newCaptureFileStore(dir string) *captureFileStore {
+	return &captureFileStore{dir: dir}
+}
+
+func (s *captureFileStore) Write(c Capture) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Switch to a new file when the day changes
+	date := c.Timestamp.Format("2006-01-02")
+	if s.file == nil || date != s.date {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+		path := filepath.Join(s.dir, fmt.Sprintf(captureFilePattern, date))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open capture file: %v", err)
+		}
+		s.file = file
+		s.writer = bufio.NewWriter(file)
+		s.date = date
+	}
+
+	s.writer.Write(data)
+	s.writer.WriteByte('\n')
+	return s.writer.Flush()
+}
+
+func (s *captureFileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeFile()
+}
+
+// closeFile flushes and closes the current file
+func (s *captureFileStore) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	s.writer = nil
+	return err
+}
+
+// currentFile returns the path of the file being written, which must not be purged
+func (s *captureFileStore) currentFile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ""
+	}
+	return s.file.Name()
+}
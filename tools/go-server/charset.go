@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Response charsets, keyed by lower-case name. A nil encoding means UTF-8.
+var responseCharsets = map[string]encoding.Encoding{
+	"utf-8":        nil,
+	"iso-8859-2":   charmap.ISO8859_2,
+	"windows-1250": charmap.Windows1250,
+}
+
+// Romanian letters with comma below, which the legacy Central European charsets
+// only have in their older cedilla form
+var commaBelowToCedilla = strings.NewReplacer("Ș", "Ş", "ș", "ş", "Ț", "Ţ", "ț", "ţ")
+
+// charsetNames lists the supported response charsets
+func charsetNames() []string {
+	names := make([]string, 0, len(responseCharsets))
+	for name := range responseCharsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validCharset reports whether charset is a supported response charset
+func validCharset(charset string) bool {
+	_, ok := responseCharsets[strings.ToLower(charset)]
+	return ok
+}
+
+// encodeBody encodes a response body in the given charset
+func encodeBody(charset, body string) ([]byte, error) {
+	enc, ok := responseCharsets[strings.ToLower(charset)]
+	if !ok {
+		return nil, fmt.Errorf("unknown charset '%s'", charset)
+	}
+	if enc == nil {
+		return []byte(body), nil
+	}
+
+	data, err := enc.NewEncoder().Bytes([]byte(commaBelowToCedilla.Replace(body)))
+	if err != nil {
+		return nil, fmt.Errorf("response cannot be encoded in %s: %v", charset, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Value classes tracked for each declared parameter
+const (
+	coveragePresent  = "present"
+	coverageMissing  = "missing"
+	coverageBoundary = "boundary"
+)
+
+// Value classes in report order
+var coverageClasses = []string{coveragePresent, coverageMissing, coverageBoundary}
+
+// Length of a value that fills a version 1 buffer value (127 characters plus the
+// terminator), the boundary of parameters declared without length limits
+const bufferValueBoundary = 127
+
+// ParameterCoverage counts the requests that exercised each value class of a parameter
+type ParameterCoverage struct {
+	Parameter string `json:"parameter"`
+	Present   int64  `json:"present"`
+	Missing   int64  `json:"missing"`
+	Boundary  int64  `json:"boundary"`
+}
+
+// count returns the counter of a value class
+func (p ParameterCoverage) count(class string) int64 {
+	switch class {
+	case coveragePresent:
+		return p.Present
+	case coverageMissing:
+		return p.Missing
+	default:
+		return p.Boundary
+	}
+}
+
+// EndpointCoverage is the coverage of one catalog endpoint
+type EndpointCoverage struct {
+	Endpoint   string              `json:"endpoint"`
+	Calls      int64               `json:"calls"`
+	Parameters []ParameterCoverage `json:"parameters"`
+}
+
+// CoverageGap is a combination of the catalog no request exercised
+type CoverageGap struct {
+	Endpoint  string `json:"endpoint"`
+	Parameter string `json:"parameter,omitempty"`
+	Class     string `json:"class,omitempty"`
+}
+
+// String describes the gap for the text report
+func (g CoverageGap) String() string {
+	if g.Parameter == "" {
+		return fmt.Sprintf("%s (never called)", g.Endpoint)
+	}
+	return fmt.Sprintf("%s %s %s", g.Endpoint, g.Parameter, g.Class)
+}
+
+// CoverageReport is the coverage matrix of the catalog since the last reset
+type CoverageReport struct {
+	Since     time.Time          `json:"since"`
+	Covered   int                `json:"covered"`
+	Total     int                `json:"total"`
+	Percent   float64            `json:"percent"`
+	Endpoints []EndpointCoverage `json:"endpoints"`
+	Untested  []CoverageGap      `json:"untested"`
+}
+
+// coverageSink is a CaptureSink that records which endpoints, parameters and value
+// classes the requests exercised, to compare a suite run against the catalog
+type coverageSink struct {
+	mu     sync.Mutex
+	since  time.Time
+	calls  map[string]int64
+	counts map[string]map[string]*ParameterCoverage
+}
+
+// Global coverage of the catalog
+var coverage = newCoverageSink()
+
+// newCoverageSink creates empty coverage
+func newCoverageSink() *coverageSink {
+	return &coverageSink{
+		since:  time.Now(),
+		calls:  make(map[string]int64),
+		counts: make(map[string]map[string]*ParameterCoverage),
+	}
+}
+
+// valueClass classifies a parameter value against its declaration
+func valueClass(spec ParamSpec, value string) string {
+	if value == "" {
+		return coverageMissing
+	}
+	length := utf8.RuneCountInString(value)
+	switch {
+	case spec.MinLength > 0 && length == spec.MinLength:
+		return coverageBoundary
+	case spec.MaxLength > 0 && length == spec.MaxLength:
+		return coverageBoundary
+	case spec.MinLength == 0 && spec.MaxLength == 0 && length >= bufferValueBoundary:
+		return coverageBoundary
+	}
+	return coveragePresent
+}
+
+// captureValue returns a captured parameter, ignoring the case of its name
+func captureValue(params map[string]string, name string) string {
+	for key, value := range params {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (s *coverageSink) Write(c Capture) error {
+	h := lookupHandler(c.Endpoint)
+	if h == nil {
+		// Requests to unknown endpoints are not part of the catalog
+		return nil
+	}
+	endpoint := h.Name()
+	specs, _ := lookupParamSpecs(endpoint)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[endpoint]++
+	params, ok := s.counts[endpoint]
+	if !ok {
+		params = make(map[string]*ParameterCoverage)
+		s.counts[endpoint] = params
+	}
+	for name, spec := range specs {
+		p, ok := params[name]
+		if !ok {
+			p = &ParameterCoverage{Parameter: name}
+			params[name] = p
+		}
+		switch valueClass(spec, captureValue(c.Parameters, name)) {
+		case coveragePresent:
+			p.Present++
+		case coverageMissing:
+			p.Missing++
+		case coverageBoundary:
+			p.Boundary++
+		}
+	}
+	return nil
+}
+
+func (s *coverageSink) Close() error {
+	return nil
+}
+
+// report builds the coverage matrix of every registered endpoint and its declared
+// parameters, listing the combinations no request exercised
+func (s *coverageSink) report() CoverageReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := CoverageReport{Since: s.since, Endpoints: []EndpointCoverage{}, Untested: []CoverageGap{}}
+	for _, endpoint := range registeredEndpoints() {
+		e := EndpointCoverage{Endpoint: endpoint, Calls: s.calls[endpoint], Parameters: []ParameterCoverage{}}
+
+		report.Total++
+		if e.Calls > 0 {
+			report.Covered++
+		} else {
+			report.Untested = append(report.Untested, CoverageGap{Endpoint: endpoint})
+		}
+
+		specs, _ := lookupParamSpecs(endpoint)
+		names := make([]string, 0, len(specs))
+		for name := range specs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p := ParameterCoverage{Parameter: name}
+			if counted, ok := s.counts[endpoint][name]; ok {
+				p = *counted
+			}
+			for _, class := range coverageClasses {
+				report.Total++
+				if p.count(class) > 0 {
+					report.Covered++
+				} else {
+					report.Untested = append(report.Untested, CoverageGap{endpoint, name, class})
+				}
+			}
+			e.Parameters = append(e.Parameters, p)
+		}
+		report.Endpoints = append(report.Endpoints, e)
+	}
+	if report.Total > 0 {
+		report.Percent = float64(report.Covered) * 100 / float64(report.Total)
+	}
+	return report
+}
+
+// reset clears the coverage
+func (s *coverageSink) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.since = time.Now()
+	s.calls = make(map[string]int64)
+	s.counts = make(map[string]map[string]*ParameterCoverage)
+}
+
+// writeText writes the report as a plain-text matrix followed by the untested combinations
+func (r CoverageReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Coverage since %s: %d of %d combinations (%.1f%%)\n\n",
+		r.Since.Format(time.RFC3339), r.Covered, r.Total, r.Percent)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tCALLS\tPARAMETER\tPRESENT\tMISSING\tBOUNDARY")
+	for _, e := range r.Endpoints {
+		if len(e.Parameters) == 0 {
+			fmt.Fprintf(tw, "%s\t%d\t-\t\t\t\n", e.Endpoint, e.Calls)
+			continue
+		}
+		for i, p := range e.Parameters {
+			endpoint, calls := "", ""
+			if i == 0 {
+				endpoint, calls = e.Endpoint, fmt.Sprint(e.Calls)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\n", endpoint, calls, p.Parameter, p.Present, p.Missing, p.Boundary)
+		}
+	}
+	tw.Flush()
+
+	if len(r.Untested) == 0 {
+		fmt.Fprintln(w, "\nEvery combination was exercised.")
+		return
+	}
+	fmt.Fprintln(w, "\nUntested:")
+	for _, g := range r.Untested {
+		fmt.Fprintf(w, "  %s\n", g)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Register the built-in endpoints
+func init() {
+	RegisterHandler(procesareDateHandler{}, "procesareDate", "procesareDate3", "procesareDate4")
+	RegisterHandler(getInfoHandler{})
+	RegisterHandler(saveCIDHandler{})
+	RegisterHandler(getCIDHandler{})
+	RegisterHandler(getDiacriticsHandler{})
+}
+
+// procesareDateHandler handles the procesareDate_1 endpoint
+type procesareDateHandler struct{}
+
+func (procesareDateHandler) Name() string {
+	return "procesareDate_1"
+}
+
+func (procesareDateHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (procesareDateHandler) Respond(r *http.Request) (Response, error) {
+	tel := getCaseInsensitiveFormValue(r, "tel")
+	cif := getCaseInsensitiveFormValue(r, "cif")
+	cid := getCaseInsensitiveFormValue(r, "cid")
+
+	return Response{
+		Body: fmt.Sprintf("Success: Processed data for Tel=%s, CIF=%s, CID=%s", tel, cif, cid),
+		Parameters: map[string]string{
+			"tel": tel,
+			"cif": cif,
+			"cid": cid,
+		},
+	}, nil
+}
+
+// getInfoHandler handles the getInfo endpoint
+type getInfoHandler struct{}
+
+func (getInfoHandler) Name() string {
+	return "getInfo"
+}
+
+func (getInfoHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (getInfoHandler) Respond(r *http.Request) (Response, error) {
+	id := getCaseInsensitiveFormValue(r, "id")
+
+	return Response{
+		Body: fmt.Sprintf("Info for ID=%s: Customer information retrieved successfully", id),
+		Parameters: map[string]string{
+			"id": id,
+		},
+	}, nil
+}
+
+// saveCIDHandler handles the saveCID endpoint
+type saveCIDHandler struct{}
+
+func (saveCIDHandler) Name() string {
+	return "saveCID"
+}
+
+func (saveCIDHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (saveCIDHandler) Respond(r *http.Request) (Response, error) {
+	cid := getCaseInsensitiveFormValue(r, "cid")
+
+	// Remember the CID so any instance sharing the store can look it up
+	if err := stateStore.Set("cid:"+cid, time.Now().Format(time.RFC3339), 0); err != nil {
+		return Response{}, fmt.Errorf("Error: Failed to save CID: %v", err)
+	}
+
+	return Response{
+		Body: fmt.Sprintf("Success: Saved CID=%s", cid),
+		Parameters: map[string]string{
+			"cid": cid,
+		},
+	}, nil
+}
+
+// getCIDHandler handles the getCID endpoint, which reports whether a CID was saved
+type getCIDHandler struct{}
+
+func (getCIDHandler) Name() string {
+	return "getCID"
+}
+
+func (getCIDHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (getCIDHandler) Respond(r *http.Request) (Response, error) {
+	cid := getCaseInsensitiveFormValue(r, "cid")
+	params := map[string]string{
+		"cid": cid,
+	}
+
+	// Look up the CID in the state store
+	savedAt, found, err := stateStore.Get("cid:" + cid)
+	if err != nil {
+		return Response{}, fmt.Errorf("Error: Failed to look up CID: %v", err)
+	}
+	if !found {
+		return Response{
+			Status:     http.StatusNotFound,
+			Body:       fmt.Sprintf("Error: CID=%s has not been saved", cid),
+			Parameters: params,
+		}, nil
+	}
+
+	return Response{
+		Body:       fmt.Sprintf("Success: CID=%s saved at %s", cid, savedAt),
+		Parameters: params,
+	}, nil
+}
+
+// Romanian sample text with every diacritic, in both the comma-below (Ș ș Ț ț)
+// and the legacy cedilla (Ş ş Ţ ţ) forms
+const diacriticsSample = "Bună ziua! Ă ă Â â Î î Ș ș Ț ț / Ş ş Ţ ţ - Știință, țară, învățământ"
+
+// getDiacriticsHandler handles the getDiacritics endpoint, which returns Romanian
+// sample text to validate the encoding of responses from the server to the DLL
+// output buffer (combine it with the charset behavior)
+type getDiacriticsHandler struct{}
+
+func (getDiacriticsHandler) Name() string {
+	return "getDiacritics"
+}
+
+func (getDiacriticsHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (getDiacriticsHandler) Respond(r *http.Request) (Response, error) {
+	return Response{Body: diacriticsSample}, nil
+}
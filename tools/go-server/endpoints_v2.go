@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Register version 2 of the API, served alongside version 1. Clients select it
+// with the versioned endpoint name (procesareDate_2) or with version=2.
+func init() {
+	RegisterHandler(procesareDateV2Handler{})
+	RegisterHandler(getInfoV2Handler{})
+}
+
+// procesareDateV2Handler handles the procesareDate_2 endpoint. Unlike version 1,
+// the phone number must be numeric, the CID is optional and the response is a
+// list of key=value fields.
+type procesareDateV2Handler struct{}
+
+func (procesareDateV2Handler) Name() string {
+	return "procesareDate_2"
+}
+
+func (procesareDateV2Handler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (procesareDateV2Handler) Respond(r *http.Request) (Response, error) {
+	tel := getCaseInsensitiveFormValue(r, "tel")
+	cif := getCaseInsensitiveFormValue(r, "cif")
+	cid := getCaseInsensitiveFormValue(r, "cid")
+
+	return Response{
+		Body: fmt.Sprintf("status=ok;version=2;tel=%s;cif=%s;cid=%s", tel, cif, cid),
+		Parameters: map[string]string{
+			"tel": tel,
+			"cif": cif,
+			"cid": cid,
+		},
+	}, nil
+}
+
+// getInfoV2Handler handles the getInfo_2 endpoint, returning the customer
+// information as key=value fields
+type getInfoV2Handler struct{}
+
+func (getInfoV2Handler) Name() string {
+	return "getInfo_2"
+}
+
+func (getInfoV2Handler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (getInfoV2Handler) Respond(r *http.Request) (Response, error) {
+	id := getCaseInsensitiveFormValue(r, "id")
+
+	return Response{
+		Body: fmt.Sprintf("status=ok;version=2;id=%s;segment=standard", id),
+		Parameters: map[string]string{
+			"id": id,
+		},
+	}, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+)
+
+// Largest capture line read from a capture file when exporting
+const maxCaptureLineSize = 4 << 20
+
+// AnonymizedCapture is a capture stripped of customer information, safe to share with
+// the vendor: identifiers are replaced by keyed hashes and free text is dropped
+type AnonymizedCapture struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"`
+	Profile   string    `json:"profile"`
+	// Client is the hashed client address, so requests of one client can still be grouped
+	Client   string `json:"client"`
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	// Parameters keep their names; values other than the common parameters are hashed
+	Parameters map[string]string `json:"parameters"`
+	Status     int               `json:"status"`
+	// ResponseLength replaces the response body, which is free text
+	ResponseLength int     `json:"response_length"`
+	DurationMs     float64 `json:"duration_ms"`
+}
+
+// anonymizer hashes identifiers with a random key that is never stored, so values
+// are consistent within one export but cannot be recovered or brute-forced
+type anonymizer struct {
+	key []byte
+}
+
+// newAnonymizer creates an anonymizer with a fresh random key
+func newAnonymizer() (*anonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &anonymizer{key: key}, nil
+}
+
+// hash returns the anonymized form of a value
+func (a *anonymizer) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return "anon:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// capture anonymizes a capture
+func (a *anonymizer) capture(c Capture) AnonymizedCapture {
+	params := make(map[string]string, len(c.Parameters))
+	for key, value := range c.Parameters {
+		if containsFold(commonParams, key) {
+			params[key] = value
+		} else {
+			params[key] = a.hash(value)
+		}
+	}
+	return AnonymizedCapture{
+		ID:             c.ID,
+		Timestamp:      c.Timestamp,
+		RequestID:      c.RequestID,
+		Profile:        c.Profile,
+		Client:         a.hash(clientHost(c.ClientIP)),
+		Method:         c.Method,
+		Endpoint:       c.Endpoint,
+		Parameters:     params,
+		Status:         c.Status,
+		ResponseLength: len(c.Response),
+		DurationMs:     c.DurationMs,
+	}
+}
+
+// exportDates parses the 'from' and 'to' query parameters (YYYY-MM-DD, default today),
+// writing a 400 response if they are invalid
+func exportDates(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	today := time.Now().Format("2006-01-02")
+	parse := func(name string) (time.Time, bool) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			value = today
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid '%s' date (expected YYYY-MM-DD)", name), http.StatusBadRequest)
+			return time.Time{}, false
+		}
+		return t, true
+	}
+
+	from, ok := parse("from")
+	if !ok {
+		return from, from, false
+	}
+	to, ok := parse("to")
+	if !ok {
+		return from, to, false
+	}
+	if to.Before(from) {
+		http.Error(w, "Invalid date range ('to' is before 'from')", http.StatusBadRequest)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// handleAdminExport streams the stored captures of a date range as anonymized JSON lines
+func handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, auth.Operator) {
+		return
+	}
+	if captureStore == nil {
+		http.Error(w, "Capture store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	from, to, ok := exportDates(w, r)
+	if !ok {
+		return
+	}
+	anon, err := newAnonymizer()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create anonymization key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	target := fmt.Sprintf("%s..%s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	mainLogger.Printf("Admin: exporting anonymized captures for %s", target)
+	audit.record(r, "captures.exported", target, map[string]string{"mode": "anonymized"})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"captures_anonymized_%s.jsonl\"", target))
+
+	encoder := json.NewEncoder(w)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		path := filepath.Join(captureStore.dir, fmt.Sprintf(captureFilePattern, day.Format("2006-01-02")))
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), maxCaptureLineSize)
+		for scanner.Scan() {
+			var c Capture
+			if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+				continue
+			}
+			encoder.Encode(anon.capture(c))
+		}
+		if err := scanner.Err(); err != nil {
+			errorLogger.Printf("Failed to read %s for export: %v", path, err)
+		}
+		file.Close()
+	}
+}
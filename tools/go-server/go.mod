@@ -1,3 +1,27 @@
 module go-server
 
-go 1.24
\ No newline at end of file
+go 1.24
+
+require (
+	github.com/Microsoft/go-winio v0.6.2
+	github.com/dop251/goja v0.0.0-20250309171923-bcd7cc6bf64c
+	github.com/rabbitmq/amqp091-go v1.15.0
+	github.com/redis/go-redis/v9 v9.17.2
+	github.com/segmentio/kafka-go v0.4.51
+	golang.org/x/text v0.23.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+)
+
+require github.com/cristiangirlea/OScapeDLCapture/tools/shared v0.0.0
+
+replace github.com/cristiangirlea/OScapeDLCapture/tools/shared => ../shared
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler implements the behavior of a single API endpoint.
+//
+// Custom endpoint behaviors are compiled in by adding a file to this package
+// that registers a Handler from an init function:
+//
+//	func init() {
+//		RegisterHandler(myHandler{}, "myEndpointAlias")
+//	}
+type Handler interface {
+	// Name returns the endpoint name as sent in the 'endpoint' parameter
+	Name() string
+	// Validate checks the request before Respond is called, after the parameters
+	// declared for the endpoint (see params.go) have been validated, so a
+	// handler whose parameters are all declared there returns nil.
+	// A non-nil error is returned to the client as a 400 Bad Request.
+	Validate(r *http.Request) error
+	// Respond produces the response for a validated request.
+	// A non-nil error is returned to the client as a 500 Internal Server Error.
+	Respond(r *http.Request) (Response, error)
+}
+
+// Response is the result of a Handler
+type Response struct {
+	// Status is the HTTP status code (defaults to 200 OK)
+	Status int
+	// Body is the response body written to the client
+	Body string
+	// Parameters are the request parameters the handler used, for the data log
+	Parameters map[string]string
+	// Headers are extra response headers, such as Set-Cookie
+	Headers map[string]string
+}
+
+// Handler registry, keyed by lower-case endpoint name and alias
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]Handler)
+)
+
+// RegisterHandler registers a handler under its name and any aliases.
+// Endpoint names are matched case-insensitively. Registering a name twice panics,
+// so conflicting plugins are caught at startup.
+func RegisterHandler(h Handler, aliases ...string) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	for _, name := range append([]string{h.Name()}, aliases...) {
+		key := strings.ToLower(name)
+		if _, exists := handlers[key]; exists {
+			panic(fmt.Sprintf("handler already registered for endpoint '%s'", name))
+		}
+		handlers[key] = h
+	}
+}
+
+// lookupHandler returns the handler registered for an endpoint, or nil
+func lookupHandler(endpoint string) Handler {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+
+	return handlers[strings.ToLower(endpoint)]
+}
+
+// registeredEndpoints returns the sorted names of all registered handlers (without aliases)
+func registeredEndpoints() []string {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, h := range handlers {
+		if !seen[h.Name()] {
+			seen[h.Name()] = true
+			names = append(names, h.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serveHandler validates the request with the handler, writes its response and logs the exchange
+func serveHandler(w http.ResponseWriter, r *http.Request, p *Profile, h Handler, clientIP string) {
+	name := h.Name()
+
+	// Use the scenario the caller selected, or else the behavior configured for the profile
+	b, scenario, err := requestBehavior(r, p, name)
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, err.Error(), clientIP, name)
+		return
+	}
+	if scenario != "" {
+		mainLog(r).Printf("Using scenario '%s' for %s endpoint", scenario, name)
+	} else if !applyForcedStatus(w, r, p, name, clientIP) {
+		return
+	}
+
+	// Trickle the response when the endpoint is slowed down
+	w = b.responseWriter(w, r)
+
+	if !applyBehavior(w, r, b, name, clientIP) {
+		return
+	}
+
+	// Validate the declared parameters, then any handler-specific rules
+	violations := validateParams(r, name)
+	if p.strict || strictParams {
+		violations = append(violations, unknownParams(r, name)...)
+	}
+	if len(violations) > 0 {
+		writeValidationError(w, r, violations, clientIP, name)
+		return
+	}
+	if err := h.Validate(r); err != nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, err.Error(), clientIP, name)
+		return
+	}
+
+	// Produce the response
+	resp, err := h.Respond(r)
+	if err != nil {
+		writeErrorResponse(w, r, http.StatusInternalServerError, err.Error(), clientIP, name)
+		return
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	if b.Abort != "" {
+		abortResponse(w, r, b.Abort, resp.Status, resp.Body, clientIP, name)
+		return
+	}
+	if resp.Status >= 400 {
+		writeErrorResponse(w, r, resp.Status, resp.Body, clientIP, name)
+		return
+	}
+
+	// Pad the body when oversized responses are simulated
+	if b.ResponseSize > 0 {
+		resp.Body = b.padBody(resp.Body)
+	}
+
+	// Encode the body in the charset configured for the endpoint
+	body := []byte(resp.Body + "\n")
+	if b.Charset != "" {
+		encoded, err := encodeBody(b.Charset, resp.Body+"\n")
+		if err != nil {
+			writeErrorResponse(w, r, http.StatusInternalServerError, "Error: "+err.Error(), clientIP, name)
+			return
+		}
+		body = encoded
+		w.Header().Set("Content-Type", "text/plain; charset="+strings.ToUpper(b.Charset))
+	}
+
+	// Write the response
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(body)
+
+	// Create response data for JSON export
+	responseData := map[string]interface{}{
+		"timestamp":  time.Now().Format(time.RFC3339),
+		"request_id": requestID(r),
+		"client_ip":  clientIP,
+		"endpoint":   name,
+		"status":     resp.Status,
+		"parameters": maskParameters(resp.Parameters),
+		"response":   maskText(r, resp.Body),
+	}
+
+	// Export response data to data log
+	if jsonData, err := json.MarshalIndent(responseData, "", "  "); err == nil {
+		dataLog(r).Printf("RESPONSE DATA: %s", string(jsonData))
+	}
+
+	// Log the successful response
+	mainLog(r).Printf("Response: %d %s - %s endpoint", resp.Status, http.StatusText(resp.Status), name)
+	mainLog(r).Printf("Response body: %s", maskText(r, resp.Body))
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+}
+
+// writeErrorResponse writes an error response for an endpoint and logs it
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, errMsg, clientIP, endpoint string) {
+	http.Error(w, errMsg, status)
+	errMsg = maskText(r, errMsg)
+	errorLog(r).Printf("Response: %d %s - %s", status, http.StatusText(status), errMsg)
+	errorLog(r).Printf("Client IP: %s, Endpoint: %s", clientIP, endpoint)
+	mainLog(r).Printf("Response: %d %s - %s", status, http.StatusText(status), errMsg)
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Request size limits, set by -max-url-length and -max-body-size (0 for no limit)
+var (
+	maxURLLength int
+	maxBodySize  int64
+)
+
+// checkRequestLimits checks a request against the configured size limits, returning
+// the status and message to reject it with (status 0 when it is within the limits).
+// The body is wrapped so that reading past the limit fails during form parsing.
+func checkRequestLimits(w http.ResponseWriter, r *http.Request) (int, string) {
+	if maxURLLength > 0 && len(r.RequestURI) > maxURLLength {
+		return http.StatusRequestURITooLong,
+			fmt.Sprintf("Error: URL length %d exceeds the limit of %d characters", len(r.RequestURI), maxURLLength)
+	}
+	if maxBodySize > 0 {
+		if r.ContentLength > maxBodySize {
+			return http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Error: Request body of %d bytes exceeds the limit of %d bytes", r.ContentLength, maxBodySize)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+	return 0, ""
+}
+
+// bodyTooLarge reports whether a form parsing error was caused by the body size limit
+func bodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
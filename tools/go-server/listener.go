@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Address scheme prefixes for -listen
+const (
+	pipeAddrPrefix = "pipe:"
+	unixAddrPrefix = "unix:"
+)
+
+// Default permissions of Unix domain sockets, letting a reverse proxy running as
+// another user (e.g. nginx) connect
+const DefaultSocketMode os.FileMode = 0666
+
+// socketMode is the permissions of Unix domain sockets
+var socketMode = DefaultSocketMode
+
+// fileModeFlag is a flag holding octal permissions such as 0660
+type fileModeFlag os.FileMode
+
+func (f *fileModeFlag) String() string {
+	return fmt.Sprintf("%04o", uint32(*f))
+}
+
+func (f *fileModeFlag) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("expected octal permissions such as 0660, got '%s'", value)
+	}
+	*f = fileModeFlag(mode)
+	return nil
+}
+
+// ListenerConfig is an address the server listens on and the profile it serves
+type ListenerConfig struct {
+	Addr    string
+	Profile string
+}
+
+// Configured listeners
+var listeners []ListenerConfig
+
+// listenFlag collects repeated -listen flags
+type listenFlag []ListenerConfig
+
+func (f *listenFlag) String() string {
+	var parts []string
+	for _, l := range *f {
+		parts = append(parts, l.Addr+"="+l.Profile)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Set parses ADDR or ADDR=PROFILE, where ADDR is a TCP address,
+// unix:/PATH.sock for a Unix domain socket or pipe:\\.\pipe\NAME
+// for a Windows named pipe
+func (f *listenFlag) Set(value string) error {
+	l := ListenerConfig{Addr: value, Profile: DefaultProfileName}
+	if i := strings.LastIndex(value, "="); i >= 0 {
+		l.Addr, l.Profile = value[:i], value[i+1:]
+	}
+	if l.Addr == "" || l.Profile == "" {
+		return fmt.Errorf("expected ADDR or ADDR=PROFILE, got '%s'", value)
+	}
+	*f = append(*f, l)
+	return nil
+}
+
+// serveListeners starts every configured listener and blocks until one of them
+// fails or ctx is cancelled. On cancellation the listeners stop accepting new
+// connections and in-flight requests get up to shutdownTimeout to complete.
+func serveListeners(ctx context.Context, certFile, keyFile string, shutdownTimeout time.Duration) error {
+	// Check if we should use HTTPS
+	useHTTPS := certFile != "" && keyFile != ""
+	if useHTTPS {
+		log.Printf("Using certificate file: %s", certFile)
+		log.Printf("Using key file: %s", keyFile)
+	} else {
+		log.Printf("To use HTTPS, provide certificate and key files with -cert and -key flags")
+	}
+
+	var servers []*http.Server
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		p := lookupProfile(l.Profile)
+		if p == nil {
+			shutdownServers(servers, shutdownTimeout)
+			return fmt.Errorf("listener %s: unknown profile '%s'", l.Addr, l.Profile)
+		}
+
+		ln, err := newNetListener(l.Addr)
+		if err != nil {
+			shutdownServers(servers, shutdownTimeout)
+			return fmt.Errorf("listener %s: %v", l.Addr, err)
+		}
+
+		server := &http.Server{Handler: p.newMux()}
+		servers = append(servers, server)
+		go func(l ListenerConfig) {
+			var err error
+			if useHTTPS {
+				log.Printf("Starting HTTPS server on %s (profile '%s')", l.Addr, l.Profile)
+				err = server.ServeTLS(ln, certFile, keyFile)
+			} else {
+				log.Printf("Starting HTTP server on %s (profile '%s')", l.Addr, l.Profile)
+				err = server.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				errs <- fmt.Errorf("listener %s: %v", l.Addr, err)
+			}
+		}(l)
+	}
+	if adminServer != nil {
+		servers = append(servers, adminServer)
+	}
+
+	select {
+	case err := <-errs:
+		shutdownServers(servers, shutdownTimeout)
+		return err
+	case <-ctx.Done():
+		log.Printf("Shutting down, waiting up to %s for in-flight requests", shutdownTimeout)
+		return shutdownServers(servers, shutdownTimeout)
+	}
+}
+
+// Closed when the servers start shutting down, to release requests held open on purpose
+var (
+	shuttingDown     = make(chan struct{})
+	shuttingDownOnce sync.Once
+)
+
+// shutdownServers gracefully stops servers, returning an error if in-flight
+// requests did not complete before the timeout
+func shutdownServers(servers []*http.Server, timeout time.Duration) error {
+	shuttingDownOnce.Do(func() { close(shuttingDown) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				errs <- err
+			}
+		}(server)
+	}
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return fmt.Errorf("in-flight requests did not complete within %s: %v", timeout, err)
+	}
+	return nil
+}
+
+// newNetListener opens the listener for an address given to -listen
+func newNetListener(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, pipeAddrPrefix) {
+		return listenPipe(strings.TrimPrefix(addr, pipeAddrPrefix))
+	}
+	if strings.HasPrefix(addr, unixAddrPrefix) {
+		return listenUnix(strings.TrimPrefix(addr, unixAddrPrefix))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket
+// left behind by a previous run that did not shut down cleanly. A socket
+// another server still accepts connections on is left alone.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("failed to check socket %s: %v", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %v", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %v", path, err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// listenPipe is only available on Windows
+func listenPipe(path string) (net.Listener, error) {
+	return nil, fmt.Errorf("named pipe listeners are only supported on Windows")
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goserver.sock")
+
+	// A socket a crashed run left behind is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	saved := socketMode
+	t.Cleanup(func() { socketMode = saved })
+	if err := (*fileModeFlag)(&socketMode).Set("0660"); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	defer ln.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("socket permissions %v, %v; want 0660", info.Mode().Perm(), err)
+	}
+
+	// A socket in use is left alone
+	if _, err := listenUnix(path); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("socket in use: error %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("socket in use was removed: %v", err)
+	}
+}
+
+func TestFileModeFlag(t *testing.T) {
+	var mode fileModeFlag
+	for _, value := range []string{"", "0999", "01777", "rw"} {
+		if err := mode.Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded", value)
+		}
+	}
+}
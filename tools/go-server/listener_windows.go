@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// listenPipe listens on a Windows named pipe such as \\.\pipe\goserver
+func listenPipe(path string) (net.Listener, error) {
+	return winio.ListenPipe(path, nil)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Handlers log through the global loggers, which main sets up
+	mainLogger = log.New(io.Discard, "", 0)
+	errorLogger = log.New(io.Discard, "", 0)
+	dataLogger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maskRule describes how the values of one sensitive parameter are masked
+type maskRule struct {
+	// mode is "last" (keep the last keep characters), "hash" or "redact"
+	mode string
+	keep int
+}
+
+// Masking configuration, keyed by lower-case parameter name
+var (
+	maskRules = make(map[string]maskRule)
+	maskSalt  string
+)
+
+// parseMaskRules parses a comma-separated list of PARAM=RULE entries, where RULE is
+// lastN (keep the last N characters, e.g. last4), hash (salted SHA-256 prefix)
+// or redact (replace the whole value)
+func parseMaskRules(spec, salt string) error {
+	maskSalt = salt
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("invalid mask rule '%s' (expected PARAM=RULE)", entry)
+		}
+		param := strings.ToLower(strings.TrimSpace(parts[0]))
+		rule := strings.ToLower(strings.TrimSpace(parts[1]))
+
+		switch {
+		case rule == "hash" || rule == "redact":
+			maskRules[param] = maskRule{mode: rule}
+		case strings.HasPrefix(rule, "last"):
+			keep, err := strconv.Atoi(strings.TrimPrefix(rule, "last"))
+			if err != nil || keep < 0 {
+				return fmt.Errorf("invalid mask rule '%s' (expected lastN, e.g. last4)", entry)
+			}
+			maskRules[param] = maskRule{mode: "last", keep: keep}
+		default:
+			return fmt.Errorf("unknown mask rule '%s' for parameter '%s' (valid rules: lastN, hash, redact)", rule, param)
+		}
+	}
+	return nil
+}
+
+// maskValue masks the value of a parameter if a rule applies to it
+func maskValue(param, value string) string {
+	rule, ok := maskRules[strings.ToLower(param)]
+	if !ok || value == "" {
+		return value
+	}
+
+	switch rule.mode {
+	case "hash":
+		sum := sha256.Sum256([]byte(maskSalt + value))
+		return "sha256:" + hex.EncodeToString(sum[:])[:12]
+	case "redact":
+		return "[REDACTED]"
+	default:
+		runes := []rune(value)
+		if len(runes) <= rule.keep {
+			return value
+		}
+		return strings.Repeat("*", len(runes)-rule.keep) + string(runes[len(runes)-rule.keep:])
+	}
+}
+
+// maskParameters returns a copy of a parameter map with sensitive values masked
+func maskParameters(params map[string]string) map[string]string {
+	if len(maskRules) == 0 || params == nil {
+		return params
+	}
+
+	masked := make(map[string]string, len(params))
+	for key, value := range params {
+		masked[key] = maskValue(key, value)
+	}
+	return masked
+}
+
+// maskURL returns the URL as a string with sensitive query parameters masked
+func maskURL(u *url.URL) string {
+	if len(maskRules) == 0 {
+		return u.String()
+	}
+
+	query := u.Query()
+	for key, values := range query {
+		for i, value := range values {
+			values[i] = maskValue(key, value)
+		}
+		query[key] = values
+	}
+
+	masked := *u
+	masked.RawQuery = query.Encode()
+	return masked.String()
+}
+
+// maskText masks every occurrence of the request's sensitive parameter values
+// in free text such as response bodies and error messages
+func maskText(r *http.Request, text string) string {
+	if len(maskRules) == 0 || r.Form == nil {
+		return text
+	}
+
+	// Replace longer values first, so a value contained in another is not masked twice
+	type replacement struct{ value, masked string }
+	var replacements []replacement
+	for key, values := range r.Form {
+		for _, value := range values {
+			if masked := maskValue(key, value); masked != value {
+				replacements = append(replacements, replacement{value, masked})
+			}
+		}
+	}
+	sort.Slice(replacements, func(i, j int) bool { return len(replacements[i].value) > len(replacements[j].value) })
+
+	for _, rep := range replacements {
+		text = strings.ReplaceAll(text, rep.value, rep.masked)
+	}
+	return text
+}
+
+// masked returns a copy of the capture with sensitive values masked,
+// ready to be written to logs, sinks and exports
+func (c Capture) masked(r *http.Request) Capture {
+	if len(maskRules) == 0 {
+		return c
+	}
+
+	c.URL = maskURL(r.URL)
+	c.Parameters = maskParameters(c.Parameters)
+	c.Response = maskText(r, c.Response)
+	return c
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// setMaskRules replaces the masking configuration for the duration of a test
+func setMaskRules(t *testing.T, spec, salt string) {
+	t.Helper()
+	saved, savedSalt := maskRules, maskSalt
+	maskRules = make(map[string]maskRule)
+	t.Cleanup(func() { maskRules, maskSalt = saved, savedSalt })
+	if err := parseMaskRules(spec, salt); err != nil {
+		t.Fatalf("parseMaskRules(%q): %v", spec, err)
+	}
+}
+
+func TestParseMaskRules(t *testing.T) {
+	tests := []struct {
+		spec string
+		want map[string]maskRule
+		err  string
+	}{
+		{"", map[string]maskRule{}, ""},
+		{"tel=last4, CIF=hash ,cid=redact", map[string]maskRule{
+			"tel": {mode: "last", keep: 4},
+			"cif": {mode: "hash"},
+			"cid": {mode: "redact"},
+		}, ""},
+		{"tel=LAST0", map[string]maskRule{"tel": {mode: "last"}}, ""},
+		{"tel", nil, "expected PARAM=RULE"},
+		{"=hash", nil, "expected PARAM=RULE"},
+		{"tel=last", nil, "expected lastN"},
+		{"tel=last-1", nil, "expected lastN"},
+		{"tel=scramble", nil, "unknown mask rule 'scramble'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			saved := maskRules
+			maskRules = make(map[string]maskRule)
+			defer func() { maskRules = saved }()
+
+			err := parseMaskRules(tt.spec, "")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(maskRules) != len(tt.want) {
+				t.Errorf("rules = %v, want %v", maskRules, tt.want)
+			}
+			for param, rule := range tt.want {
+				if maskRules[param] != rule {
+					t.Errorf("rule of %s = %+v, want %+v", param, maskRules[param], rule)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	setMaskRules(t, "tel=last4,cif=hash,cid=redact", "salt")
+	tests := []struct {
+		param, value, want string
+	}{
+		{"tel", "0721123456", "******3456"},
+		{"TEL", "0721123456", "******3456"},
+		{"tel", "123", "123"},
+		{"tel", "ăâîșț12", "***șț12"},
+		{"cid", "secret", "[REDACTED]"},
+		{"cid", "", ""},
+		{"other", "visible", "visible"},
+	}
+	for _, tt := range tests {
+		if got := maskValue(tt.param, tt.value); got != tt.want {
+			t.Errorf("maskValue(%q, %q) = %q, want %q", tt.param, tt.value, got, tt.want)
+		}
+	}
+
+	hashed := maskValue("cif", "1234567890")
+	if !strings.HasPrefix(hashed, "sha256:") || len(hashed) != len("sha256:")+12 {
+		t.Errorf("hashed value %q, want sha256: and 12 hex digits", hashed)
+	}
+	if maskValue("cif", "1234567890") != hashed {
+		t.Error("hashing the same value twice gave different results")
+	}
+	setMaskRules(t, "cif=hash", "other salt")
+	if maskValue("cif", "1234567890") == hashed {
+		t.Error("hashes with different salts are equal")
+	}
+}
+
+func TestMaskRequest(t *testing.T) {
+	setMaskRules(t, "tel=last4,cid=redact", "")
+
+	u, _ := url.Parse("http://localhost/?endpoint=getInfo&tel=0721123456&cid=abc")
+	got := maskURL(u)
+	if strings.Contains(got, "0721123456") || !strings.Contains(got, "tel=%2A%2A%2A%2A%2A%2A3456") || !strings.Contains(got, "cid=%5BREDACTED%5D") {
+		t.Errorf("maskURL = %s", got)
+	}
+
+	params := maskParameters(map[string]string{"tel": "0721123456", "endpoint": "getInfo"})
+	if params["tel"] != "******3456" || params["endpoint"] != "getInfo" {
+		t.Errorf("maskParameters = %v", params)
+	}
+
+	r := httptest.NewRequest("GET", u.String(), nil)
+	r.ParseForm()
+	text := maskText(r, "caller 0721123456 has cid abc")
+	if text != "caller ******3456 has cid [REDACTED]" {
+		t.Errorf("maskText = %q", text)
+	}
+}
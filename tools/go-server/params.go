@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ParamSpec declares one parameter of an endpoint and how it is validated
+type ParamSpec struct {
+	// Required rejects requests where the parameter is missing or empty
+	Required bool `json:"required,omitempty"`
+	// Format is numeric (digits only), phone (optional +, 6 to 15 digits) or alphanumeric
+	Format string `json:"format,omitempty"`
+	// Pattern is a regular expression the whole value must match
+	Pattern string `json:"pattern,omitempty"`
+	// MinLength and MaxLength limit the number of characters (0 for no limit)
+	MinLength int `json:"min_length,omitempty"`
+	MaxLength int `json:"max_length,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Parameter formats
+var paramFormats = map[string]*regexp.Regexp{
+	"numeric":      regexp.MustCompile(`^[0-9]+$`),
+	"phone":        regexp.MustCompile(`^\+?[0-9]{6,15}$`),
+	"alphanumeric": regexp.MustCompile(`^[A-Za-z0-9]+$`),
+}
+
+// Descriptions of the parameter formats, for error messages
+var paramFormatDescriptions = map[string]string{
+	"numeric":      "numeric (digits only)",
+	"phone":        "a phone number (optional +, 6 to 15 digits)",
+	"alphanumeric": "alphanumeric (letters and digits only)",
+}
+
+// Declared parameters of the built-in endpoints, keyed by endpoint name
+var defaultParamSpecs = map[string]map[string]ParamSpec{
+	"procesareDate_1": {
+		"tel": {Required: true},
+		"cif": {Required: true},
+		"cid": {Required: true},
+	},
+	"procesareDate_2": {
+		"tel": {Required: true, Format: "phone"},
+		"cif": {Required: true},
+		"cid": {},
+	},
+	"getInfo":       {"id": {Required: true}},
+	"getInfo_2":     {"id": {Required: true}},
+	"saveCID":       {"cid": {Required: true}},
+	"getCID":        {"cid": {Required: true}},
+	"getDiacritics": {},
+	"login":         {"user": {}},
+}
+
+// Parameters accepted by every endpoint
+var commonParams = []string{"endpoint", "version", scenarioParam, redirectHopParam}
+
+// Strict mode for every profile, set by -strict
+var strictParams bool
+
+// Declared parameters, keyed by lower-case endpoint name
+var (
+	paramSpecsMu sync.RWMutex
+	paramSpecs   = make(map[string]map[string]ParamSpec)
+)
+
+func init() {
+	for endpoint, specs := range defaultParamSpecs {
+		if err := setParamSpecs(endpoint, specs); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// compile checks the spec and prepares its pattern
+func (s *ParamSpec) compile() error {
+	if s.Format != "" && paramFormats[s.Format] == nil {
+		return fmt.Errorf("unknown format '%s' (valid formats: alphanumeric, numeric, phone)", s.Format)
+	}
+	if s.MinLength < 0 || s.MaxLength < 0 || (s.MaxLength > 0 && s.MinLength > s.MaxLength) {
+		return fmt.Errorf("invalid length limits %d-%d", s.MinLength, s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + s.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+// setParamSpecs declares the parameters of an endpoint, replacing previous declarations
+func setParamSpecs(endpoint string, specs map[string]ParamSpec) error {
+	compiled := make(map[string]ParamSpec, len(specs))
+	for name, spec := range specs {
+		if err := spec.compile(); err != nil {
+			return fmt.Errorf("endpoint '%s', parameter '%s': %v", endpoint, name, err)
+		}
+		compiled[strings.ToLower(name)] = spec
+	}
+
+	paramSpecsMu.Lock()
+	defer paramSpecsMu.Unlock()
+
+	paramSpecs[strings.ToLower(endpoint)] = compiled
+	return nil
+}
+
+// lookupParamSpecs returns the declared parameters of an endpoint
+func lookupParamSpecs(endpoint string) (map[string]ParamSpec, bool) {
+	paramSpecsMu.RLock()
+	defer paramSpecsMu.RUnlock()
+
+	specs, ok := paramSpecs[strings.ToLower(endpoint)]
+	return specs, ok
+}
+
+// loadParamSpecs reads parameter declarations from a JSON file of the form
+//
+//	{"getInfo": {"id": {"required": true, "format": "numeric", "max_length": 10}}}
+//
+// Each endpoint listed replaces its built-in declarations.
+func loadParamSpecs(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read parameters file: %v", err)
+	}
+
+	var config map[string]map[string]ParamSpec
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse parameters file %s: %v", path, err)
+	}
+
+	for endpoint, specs := range config {
+		h := lookupHandler(endpoint)
+		if h == nil {
+			return fmt.Errorf("parameters file %s: unknown endpoint '%s'", path, endpoint)
+		}
+		if err := setParamSpecs(h.Name(), specs); err != nil {
+			return fmt.Errorf("parameters file %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// ParamViolation describes a parameter that failed validation
+type ParamViolation struct {
+	Parameter string `json:"parameter"`
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+}
+
+// validateParams checks the request against the parameters declared for the endpoint
+func validateParams(r *http.Request, endpoint string) []ParamViolation {
+	specs, _ := lookupParamSpecs(endpoint)
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []ParamViolation
+	for _, name := range names {
+		spec := specs[name]
+		value := getCaseInsensitiveFormValue(r, name)
+		length := utf8.RuneCountInString(value)
+
+		switch {
+		case value == "":
+			if spec.Required {
+				violations = append(violations, ParamViolation{name, "required",
+					fmt.Sprintf("Missing required parameter '%s'", name)})
+			}
+		case spec.Format != "" && !paramFormats[spec.Format].MatchString(value):
+			violations = append(violations, ParamViolation{name, "format",
+				fmt.Sprintf("Parameter '%s' must be %s", name, paramFormatDescriptions[spec.Format])})
+		case spec.pattern != nil && !spec.pattern.MatchString(value):
+			violations = append(violations, ParamViolation{name, "pattern",
+				fmt.Sprintf("Parameter '%s' must match %s", name, spec.Pattern)})
+		case spec.MinLength > 0 && length < spec.MinLength:
+			violations = append(violations, ParamViolation{name, "min_length",
+				fmt.Sprintf("Parameter '%s' must have at least %d characters", name, spec.MinLength)})
+		case spec.MaxLength > 0 && length > spec.MaxLength:
+			violations = append(violations, ParamViolation{name, "max_length",
+				fmt.Sprintf("Parameter '%s' must have at most %d characters", name, spec.MaxLength)})
+		}
+	}
+	return violations
+}
+
+// unknownParams reports the request parameters not declared for the endpoint, with
+// the declared parameters listed and the closest one suggested for likely typos.
+// Endpoints without declarations (such as scripts not listed in -params) accept anything.
+func unknownParams(r *http.Request, endpoint string) []ParamViolation {
+	specs, ok := lookupParamSpecs(endpoint)
+	if !ok {
+		return nil
+	}
+
+	declared := append([]string{}, commonParams...)
+	for name := range specs {
+		declared = append(declared, name)
+	}
+	sort.Strings(declared)
+
+	// Internal parameters are accepted but not advertised
+	var listed []string
+	for _, name := range declared {
+		if !strings.HasPrefix(name, "_") {
+			listed = append(listed, name)
+		}
+	}
+
+	var received []string
+	for key := range r.Form {
+		received = append(received, key)
+	}
+	sort.Strings(received)
+
+	var violations []ParamViolation
+	for _, key := range received {
+		if containsFold(declared, key) {
+			continue
+		}
+		message := fmt.Sprintf("Unknown parameter '%s'.", key)
+		if suggestion := closestParam(key, declared); suggestion != "" {
+			message += fmt.Sprintf(" Did you mean '%s'?", suggestion)
+		}
+		message += fmt.Sprintf(" Parameters of %s: %s", endpoint, strings.Join(listed, ", "))
+		violations = append(violations, ParamViolation{key, "unknown", message})
+	}
+	return violations
+}
+
+// containsFold reports whether names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// closestParam returns the declared parameter within two edits of name, if any
+func closestParam(name string, declared []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range declared {
+		if d := editDistance(strings.ToLower(name), candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// ValidationError is the structured body of a 400 response for invalid parameters
+type ValidationError struct {
+	Error      string           `json:"error"`
+	Endpoint   string           `json:"endpoint"`
+	Violations []ParamViolation `json:"violations"`
+}
+
+// writeValidationError writes a structured 400 response listing the violations and logs it
+func writeValidationError(w http.ResponseWriter, r *http.Request, violations []ParamViolation, clientIP, endpoint string) {
+	body, _ := json.Marshal(ValidationError{
+		Error:      "Invalid parameters",
+		Endpoint:   endpoint,
+		Violations: violations,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(append(body, '\n'))
+
+	errMsg := maskText(r, string(body))
+	errorLog(r).Printf("Response: 400 Bad Request - %s", errMsg)
+	errorLog(r).Printf("Client IP: %s, Endpoint: %s", clientIP, endpoint)
+	mainLog(r).Printf("Response: 400 Bad Request - %s", errMsg)
+	mainLog(r).Printf("=== END CURL REQUEST ===")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateParams(t *testing.T) {
+	specs := map[string]ParamSpec{
+		"tel":  {Required: true, Format: "phone"},
+		"id":   {Format: "numeric", MinLength: 2, MaxLength: 4},
+		"code": {Pattern: "[A-Z]{3}"},
+		"name": {Format: "alphanumeric"},
+	}
+	if err := setParamSpecs("_testValidate", specs); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		// want lists the violations as parameter:rule
+		want []string
+	}{
+		{"tel=%2B40721123456", nil},
+		{"Tel=0721123456&id=12&code=ABC&name=abc1", nil},
+		{"", []string{"tel:required"}},
+		{"tel=", []string{"tel:required"}},
+		{"tel=12345", []string{"tel:format"}},
+		{"tel=0721123456&id=1", []string{"id:min_length"}},
+		{"tel=0721123456&id=12345", []string{"id:max_length"}},
+		{"tel=0721123456&id=1a", []string{"id:format"}},
+		{"tel=0721123456&code=ABCD", []string{"code:pattern"}},
+		{"tel=0721123456&code=xABC", []string{"code:pattern"}},
+		{"tel=0721123456&name=a-b", []string{"name:format"}},
+		{"id=1&code=ab", []string{"code:pattern", "id:min_length", "tel:required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			r.ParseForm()
+			var got []string
+			for _, v := range validateParams(r, "_testValidate") {
+				got = append(got, v.Parameter+":"+v.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamSpecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec ParamSpec
+		err  string
+	}{
+		{"unknown format", ParamSpec{Format: "email"}, "unknown format 'email'"},
+		{"negative length", ParamSpec{MinLength: -1}, "invalid length limits"},
+		{"min above max", ParamSpec{MinLength: 5, MaxLength: 2}, "invalid length limits"},
+		{"bad pattern", ParamSpec{Pattern: "("}, "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setParamSpecs("_testErrors", map[string]ParamSpec{"p": tt.spec})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUnknownParams(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		query    string
+		// want lists the unknown parameters, and suggestion the parameter suggested
+		// for the first one
+		want       []string
+		suggestion string
+	}{
+		{"getInfo", "endpoint=getInfo&ID=1", nil, ""},
+		{"getInfo", "endpoint=getInfo&idd=1", []string{"idd"}, "id"},
+		{"procesareDate_1", "tell=1&cif=2&cid=3&zzzzzz=4", []string{"tell", "zzzzzz"}, "tel"},
+		{"_undeclared", "anything=1", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint+"?"+tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			r.ParseForm()
+			violations := unknownParams(r, tt.endpoint)
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Parameter)
+				if v.Rule != "unknown" {
+					t.Errorf("rule of %s = %s, want unknown", v.Parameter, v.Rule)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("unknown parameters = %v, want %v", got, tt.want)
+			}
+			if tt.suggestion != "" && !strings.Contains(violations[0].Message, "Did you mean '"+tt.suggestion+"'?") {
+				t.Errorf("message %q does not suggest %s", violations[0].Message, tt.suggestion)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"tel", "tel", 0},
+		{"tel", "tell", 1},
+		{"cif", "cid", 1},
+		{"id", "", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoadParamSpecs(t *testing.T) {
+	saved, _ := lookupParamSpecs("getInfo")
+	t.Cleanup(func() { setParamSpecs("getInfo", saved) })
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"valid", `{"GETINFO": {"id": {"required": true, "format": "numeric"}}}`, ""},
+		{"unknown endpoint", `{"noSuchEndpoint": {}}`, "unknown endpoint 'noSuchEndpoint'"},
+		{"invalid spec", `{"getInfo": {"id": {"format": "date"}}}`, "unknown format 'date'"},
+		{"invalid JSON", `{"getInfo": [`, "failed to parse parameters file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "params.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := loadParamSpecs(path)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				specs, _ := lookupParamSpecs("getinfo")
+				if spec := specs["id"]; !spec.Required || spec.Format != "numeric" {
+					t.Errorf("spec of id = %+v", spec)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWriteValidationError(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?endpoint=getInfo", nil)
+	r.ParseForm()
+	w := httptest.NewRecorder()
+	writeValidationError(w, r, []ParamViolation{{"id", "required", "Missing required parameter 'id'"}}, "127.0.0.1", "getInfo")
+
+	if w.Code != 400 || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var body ValidationError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Endpoint != "getInfo" || len(body.Violations) != 1 || body.Violations[0].Rule != "required" {
+		t.Errorf("body = %+v", body)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultProfileName is the profile serving every endpoint, used by listeners without an explicit profile
+const DefaultProfileName = "default"
+
+// Profile is an endpoint catalog with its own behavior settings.
+// Each listener is bound to a profile, so one process can simulate several
+// APIs (e.g. a primary API and a fallback API the DLL fails over to).
+type Profile struct {
+	Name string
+	// endpoints restricts the catalog to these lower-case endpoint names (nil serves all)
+	endpoints map[string]bool
+	behaviors *behaviorStore
+	// strict rejects requests with parameters not declared for the endpoint
+	strict bool
+}
+
+// ProfileConfig is the definition of a profile in the profiles file
+type ProfileConfig struct {
+	// Endpoints lists the endpoints served by the profile (empty serves all)
+	Endpoints []string `json:"endpoints"`
+	// Behaviors sets the initial behavior of endpoints
+	Behaviors map[string]EndpointBehavior `json:"behaviors"`
+	// Strict rejects requests with undeclared parameters (also enabled for every profile by -strict)
+	Strict bool `json:"strict"`
+}
+
+// Known profiles by name
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]*Profile{
+		DefaultProfileName: newProfile(DefaultProfileName),
+	}
+)
+
+// newProfile creates a profile serving every endpoint with default behavior
+func newProfile(name string) *Profile {
+	return &Profile{Name: name, behaviors: newBehaviorStore()}
+}
+
+// loadProfiles reads profile definitions from a JSON file of the form
+//
+//	{"fallback": {"endpoints": ["getInfo"], "behaviors": {"getInfo": {"latency_ms": 200}}}}
+//
+// Endpoint names must refer to registered handlers, so load scripts first.
+func loadProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read profiles file: %v", err)
+	}
+
+	var configs map[string]ProfileConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("failed to parse profiles file %s: %v", path, err)
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	for name, config := range configs {
+		p := newProfile(name)
+		p.strict = config.Strict
+		if len(config.Endpoints) > 0 {
+			p.endpoints = make(map[string]bool)
+			for _, endpoint := range config.Endpoints {
+				if lookupHandler(endpoint) == nil {
+					return fmt.Errorf("profile '%s': unknown endpoint '%s'", name, endpoint)
+				}
+				p.endpoints[strings.ToLower(lookupHandler(endpoint).Name())] = true
+			}
+		}
+		for endpoint, b := range config.Behaviors {
+			h := lookupHandler(endpoint)
+			if h == nil {
+				return fmt.Errorf("profile '%s': unknown endpoint '%s' in behaviors", name, endpoint)
+			}
+			if err := b.validate(); err != nil {
+				return fmt.Errorf("profile '%s': endpoint '%s': %v", name, endpoint, err)
+			}
+			p.behaviors.set(h.Name(), b)
+		}
+		profiles[name] = p
+	}
+
+	return nil
+}
+
+// lookupProfile returns the profile with the given name (the default profile for an empty name), or nil
+func lookupProfile(name string) *Profile {
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	return profiles[name]
+}
+
+// profileNames returns the sorted names of all profiles
+func profileNames() []string {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the handler for an endpoint if it is part of the profile's catalog
+func (p *Profile) lookup(endpoint string) Handler {
+	h := lookupHandler(endpoint)
+	if h == nil || (p.endpoints != nil && !p.endpoints[strings.ToLower(h.Name())]) {
+		return nil
+	}
+	return h
+}
+
+// endpointNames returns the sorted names of the endpoints in the profile's catalog
+func (p *Profile) endpointNames() []string {
+	var names []string
+	for _, name := range registeredEndpoints() {
+		if p.endpoints == nil || p.endpoints[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// endpointBase returns the name of an endpoint without its _<version> suffix
+func endpointBase(name string) string {
+	if i := strings.LastIndex(name, "_"); i > 0 {
+		if _, err := strconv.Atoi(name[i+1:]); err == nil {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// lookupVersion returns the handler for an endpoint, switched to the requested
+// version when one is given. Versions are registered as <base>_<version>
+// (procesareDate_2); an endpoint without a suffix (getInfo) is version 1.
+func (p *Profile) lookupVersion(endpoint, version string) Handler {
+	if version == "" {
+		return p.lookup(endpoint)
+	}
+
+	base := endpointBase(endpoint)
+	if h := p.lookup(endpoint); h != nil {
+		base = endpointBase(h.Name())
+	}
+	if h := p.lookup(base + "_" + version); h != nil {
+		return h
+	}
+	if version == "1" {
+		if h := p.lookup(base); h != nil && endpointBase(h.Name()) == h.Name() {
+			return h
+		}
+	}
+	return nil
+}
+
+// endpointVersions lists the endpoints of the profile that are versions of the same base endpoint
+func (p *Profile) endpointVersions(endpoint string) []string {
+	base := endpointBase(endpoint)
+	if h := p.lookup(endpoint); h != nil {
+		base = endpointBase(h.Name())
+	}
+
+	var names []string
+	for _, name := range p.endpointNames() {
+		if strings.EqualFold(endpointBase(name), base) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newMux creates the request router for a listener bound to the profile
+func (p *Profile) newMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRoot)
+	mux.HandleFunc("/api/index.php", p.handleAPI)
+	mux.HandleFunc("/testoscc.php", p.handleAPI) // Add handler for testoscc.php endpoint
+	mux.HandleFunc("/stats", handleStatsPage)
+	mux.HandleFunc("/stats/api", handleStatsAPI)
+	return withAccessLog(withRequestID(mux))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Default publisher configuration
+const (
+	DefaultKafkaTopic        = "dll-captures"
+	DefaultAMQPExchange      = ""
+	DefaultAMQPRoutingKey    = "dll-captures"
+	DefaultPublishQueueSize  = 10000
+	DefaultPublishTimeout    = 10 * time.Second
+	publishBatchFlushTimeout = 500 * time.Millisecond
+)
+
+// Publisher sends capture records to a message broker
+type Publisher interface {
+	// Publish sends a batch of encoded captures
+	Publish(ctx context.Context, messages [][]byte) error
+	// Close releases the broker connection
+	Close() error
+}
+
+// publishingSink is a CaptureSink that streams captures to a Publisher
+// in the background, so a slow or unavailable broker never delays the DLL
+type publishingSink struct {
+	name      string
+	publisher Publisher
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newPublishingSink starts a background worker publishing to p
+func newPublishingSink(name string, p Publisher) *publishingSink {
+	s := &publishingSink{
+		name:      name,
+		publisher: p,
+		queue:     make(chan []byte, DefaultPublishQueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *publishingSink) Write(c Capture) error {
+	message, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.queue <- message:
+		return nil
+	default:
+		return fmt.Errorf("%s publish queue is full, capture dropped", s.name)
+	}
+}
+
+func (s *publishingSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.queue)
+		<-s.done
+	})
+	return s.publisher.Close()
+}
+
+// run publishes queued captures in batches until the queue is closed
+func (s *publishingSink) run() {
+	defer close(s.done)
+
+	var batch [][]byte
+	timer := time.NewTimer(publishBatchFlushTimeout)
+	defer timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultPublishTimeout)
+		defer cancel()
+		if err := s.publisher.Publish(ctx, batch); err != nil {
+			errorLogger.Printf("Failed to publish %d capture(s) to %s: %v", len(batch), s.name, err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case message, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, message)
+			if len(batch) >= 100 {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(publishBatchFlushTimeout)
+		}
+	}
+}
+
+// kafkaPublisher publishes captures to a Kafka topic
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafkaPublisher creates a publisher for a comma-separated list of brokers
+func newKafkaPublisher(brokers, topic string) *kafkaPublisher {
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:                  topic,
+			Balancer:               &kafka.LeastBytes{},
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, messages [][]byte) error {
+	kafkaMessages := make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		kafkaMessages[i] = kafka.Message{Value: message}
+	}
+	return p.writer.WriteMessages(ctx, kafkaMessages...)
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// Delays between attempts to reconnect to the AMQP broker, doubling up to the maximum
+const (
+	amqpReconnectMinDelay = time.Second
+	amqpReconnectMaxDelay = 30 * time.Second
+)
+
+// amqpPublisher publishes captures to a RabbitMQ (AMQP 0-9-1) exchange. When the
+// broker closes the connection, it reconnects in the background, like the Kafka
+// writer does; batches published in the meantime fail and are dropped.
+type amqpPublisher struct {
+	url        string
+	exchange   string
+	routingKey string
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newAMQPPublisher connects to the broker. When publishing to the default
+// exchange, a durable queue named after the routing key is declared so
+// captures are retained until the pipeline consumes them.
+func newAMQPPublisher(url, exchange, routingKey string) (*amqpPublisher, error) {
+	p := &amqpPublisher{url: url, exchange: exchange, routingKey: routingKey, closed: make(chan struct{})}
+	conn, channel, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	p.conn, p.channel = conn, channel
+	go p.reconnect(conn, channel)
+	return p, nil
+}
+
+// dial connects to the broker and opens the channel captures are published on
+func (p *amqpPublisher) dial() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to AMQP broker: %v", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open AMQP channel: %v", err)
+	}
+
+	if p.exchange == "" {
+		if _, err := channel.QueueDeclare(p.routingKey, true, false, false, false, nil); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to declare AMQP queue '%s': %v", p.routingKey, err)
+		}
+	}
+	return conn, channel, nil
+}
+
+// reconnect dials the broker again, with backoff, whenever the connection or
+// the channel is closed, until the publisher is closed
+func (p *amqpPublisher) reconnect(conn *amqp.Connection, channel *amqp.Channel) {
+	for {
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+		var reason *amqp.Error
+		select {
+		case <-p.closed:
+			return
+		case reason = <-connClosed:
+		case reason = <-channelClosed:
+			// A channel closed by the broker is not reopened on the same connection
+			conn.Close()
+		}
+		select {
+		case <-p.closed:
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		p.conn, p.channel = nil, nil
+		p.mu.Unlock()
+		errorLogger.Printf("Lost the connection to the AMQP broker (%v), reconnecting", reason)
+
+		delay := amqpReconnectMinDelay
+		for {
+			select {
+			case <-p.closed:
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			if conn, channel, err = p.dial(); err == nil {
+				break
+			}
+			delay = min(delay*2, amqpReconnectMaxDelay)
+			errorLogger.Printf("Failed to reconnect to the AMQP broker, retrying in %s: %v", delay, err)
+		}
+
+		p.mu.Lock()
+		select {
+		case <-p.closed:
+			p.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		p.conn, p.channel = conn, channel
+		p.mu.Unlock()
+		mainLogger.Printf("Reconnected to the AMQP broker")
+	}
+}
+
+func (p *amqpPublisher) Publish(ctx context.Context, messages [][]byte) error {
+	p.mu.Lock()
+	channel := p.channel
+	p.mu.Unlock()
+	if channel == nil {
+		return errors.New("not connected to the AMQP broker, reconnecting")
+	}
+
+	for _, message := range messages {
+		err := channel.PublishWithContext(ctx, p.exchange, p.routingKey, false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    time.Now(),
+			Body:         message,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *amqpPublisher) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	p.channel.Close()
+	return p.conn.Close()
+}
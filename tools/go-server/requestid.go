@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// Header carrying the request ID, accepted from the client and echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs accepted from clients; anything else is replaced, so it cannot break log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDKey is the request context key of the request ID
+type requestIDKey struct{}
+
+// withRequestID gives every request an ID, taken from its X-Request-ID header or
+// generated, and echoes it in the response header, so backend-side events can be
+// matched to simulator results
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID generates a random (version 4) UUID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requestID returns the ID of a request, or "" outside withRequestID
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLog writes the log lines of one request, prefixed with its request ID
+type requestLog struct {
+	logger *log.Logger
+	id     string
+}
+
+func (l requestLog) Printf(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	if l.id != "" {
+		message = "[" + l.id + "] " + message
+	}
+	l.logger.Output(2, message)
+}
+
+// mainLog returns the main logger for a request
+func mainLog(r *http.Request) requestLog {
+	return requestLog{mainLogger, requestID(r)}
+}
+
+// errorLog returns the error logger for a request
+func errorLog(r *http.Request) requestLog {
+	return requestLog{errorLogger, requestID(r)}
+}
+
+// dataLog returns the data logger for a request
+func dataLog(r *http.Request) requestLog {
+	return requestLog{dataLogger, requestID(r)}
+}
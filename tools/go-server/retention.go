@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default retention configuration
+const DefaultRetentionInterval = time.Hour
+
+// File name patterns managed by the retention job
+var retentionPatterns = []string{
+	"curl_requests_*.log",
+	"error_responses_*.log",
+	"dll_data_*.log",
+	"captures_*.jsonl",
+	"access_*.log",
+}
+
+// RetentionPolicy limits how long and how much capture and log data is kept
+type RetentionPolicy struct {
+	// MaxAge deletes files last modified longer ago (0 keeps files forever)
+	MaxAge time.Duration
+	// MaxSize deletes the oldest files while the total size exceeds it (0 for no limit)
+	MaxSize int64
+}
+
+// parseByteSize parses sizes such as 5GB, 500MB, 64KB or a plain number of bytes
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"TB", 1 << 40},
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			factor = unit.factor
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s' (expected e.g. 5GB, 500MB)", value)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// retentionFile is a file subject to the retention policy
+type retentionFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// enforce deletes files in dir that violate the policy. Files currently being
+// written (in the keep set) are never deleted.
+func (p RetentionPolicy) enforce(dir string, keep map[string]bool) {
+	var files []retentionFile
+	for _, pattern := range retentionPatterns {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil || keep[filepath.Clean(path)] {
+				continue
+			}
+			files = append(files, retentionFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+
+	// Oldest first
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for path := range keep {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+
+	for _, f := range files {
+		expired := p.MaxAge > 0 && time.Since(f.modTime) > p.MaxAge
+		oversized := p.MaxSize > 0 && total > p.MaxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		if err := os.Remove(f.path); err != nil {
+			errorLogger.Printf("Retention: failed to delete %s: %v", f.path, err)
+			continue
+		}
+		total -= f.size
+		reason := "older than the maximum age"
+		if !expired {
+			reason = "total size above the limit"
+		}
+		mainLogger.Printf("Retention: deleted %s (%d bytes, %s)", f.path, f.size, reason)
+	}
+}
+
+// runRetention enforces the policy on dir every interval until ctx is cancelled
+func runRetention(ctx context.Context, dir string, policy RetentionPolicy, interval time.Duration, keep map[string]bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		keepNow := make(map[string]bool, len(keep)+2)
+		for path := range keep {
+			keepNow[path] = true
+		}
+		if captureStore != nil && captureStore.currentFile() != "" {
+			keepNow[filepath.Clean(captureStore.currentFile())] = true
+		}
+		if accessLogs != nil && accessLogs.currentFile() != "" {
+			keepNow[filepath.Clean(accessLogs.currentFile())] = true
+		}
+		policy.enforce(dir, keepNow)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
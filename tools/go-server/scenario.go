@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Header and parameter selecting a scenario for one request
+const (
+	ScenarioHeader = "X-Scenario"
+	scenarioParam  = "scenario"
+)
+
+// Scenario is a named set of endpoint behaviors a caller selects per request, so
+// parallel test runs against one server do not share chaos settings. Behaviors are
+// keyed by endpoint name, with "*" applying to endpoints not listed.
+type Scenario map[string]EndpointBehavior
+
+// Built-in scenarios
+var defaultScenarios = map[string]Scenario{
+	"normal":           {},
+	"slow-backend":     {"*": {LatencyMs: 3000}},
+	"auth-failure":     {"*": {ErrorRate: 1, ErrorStatus: http.StatusUnauthorized}},
+	"server-error":     {"*": {ErrorRate: 1, ErrorStatus: http.StatusInternalServerError}},
+	"unavailable":      {"*": {Disabled: true}},
+	"stall":            {"*": {TrickleDelayMs: 1000, TrickleBytes: 1}},
+	"no-response":      {"*": {BlackHole: true}},
+	"connection-reset": {"*": {Abort: AbortBody}},
+}
+
+// Known scenarios by lower-case name
+var (
+	scenariosMu sync.RWMutex
+	scenarios   = make(map[string]Scenario)
+)
+
+func init() {
+	for name, s := range defaultScenarios {
+		scenarios[name] = s
+	}
+}
+
+// behavior returns the behavior the scenario sets for an endpoint
+func (s Scenario) behavior(endpoint string) EndpointBehavior {
+	for name, b := range s {
+		if strings.EqualFold(name, endpoint) {
+			return b
+		}
+	}
+	return s["*"]
+}
+
+// loadScenarios reads scenarios from a JSON file of the form
+//
+//	{"getinfo-down": {"getInfo": {"disabled": true}, "*": {"latency_ms": 200}}}
+//
+// Scenarios with the name of a built-in scenario replace it.
+func loadScenarios(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read scenarios file: %v", err)
+	}
+
+	var config map[string]Scenario
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse scenarios file %s: %v", path, err)
+	}
+
+	scenariosMu.Lock()
+	defer scenariosMu.Unlock()
+
+	for name, s := range config {
+		for endpoint, b := range s {
+			if endpoint != "*" && lookupHandler(endpoint) == nil {
+				return fmt.Errorf("scenario '%s': unknown endpoint '%s'", name, endpoint)
+			}
+			if err := b.validate(); err != nil {
+				return fmt.Errorf("scenario '%s': endpoint '%s': %v", name, endpoint, err)
+			}
+		}
+		scenarios[strings.ToLower(name)] = s
+	}
+	return nil
+}
+
+// lookupScenario returns a scenario by name
+func lookupScenario(name string) (Scenario, bool) {
+	scenariosMu.RLock()
+	defer scenariosMu.RUnlock()
+
+	s, ok := scenarios[strings.ToLower(name)]
+	return s, ok
+}
+
+// scenarioNames lists the known scenarios
+func scenarioNames() []string {
+	scenariosMu.RLock()
+	defer scenariosMu.RUnlock()
+
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requestScenario returns the scenario selected by the X-Scenario header or the
+// scenario parameter, or "" when the request uses the profile's behavior
+func requestScenario(r *http.Request) string {
+	if name := r.Header.Get(ScenarioHeader); name != "" {
+		return name
+	}
+	return getCaseInsensitiveFormValue(r, scenarioParam)
+}
+
+// requestBehavior returns the behavior for an endpoint: the one of the scenario
+// selected by the request, or else the one configured for the profile
+func requestBehavior(r *http.Request, p *Profile, endpoint string) (EndpointBehavior, string, error) {
+	name := requestScenario(r)
+	if name == "" {
+		return p.behaviors.get(endpoint), "", nil
+	}
+
+	s, ok := lookupScenario(name)
+	if !ok {
+		return EndpointBehavior{}, name, fmt.Errorf("Error: Unknown scenario '%s'. Available scenarios: %s", name, strings.Join(scenarioNames(), ", "))
+	}
+	return s.behavior(endpoint), name, nil
+}
+
+// handleAdminScenarios lists the scenarios with their behaviors
+func handleAdminScenarios(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scenariosMu.RLock()
+	defer scenariosMu.RUnlock()
+
+	writeJSON(w, scenarios)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// scriptHandler is a Handler whose behavior is defined by a JavaScript file.
+//
+// The endpoint name is the file name without the .js extension. The script
+// may define two functions:
+//
+//	// Optional: return a string (or throw) to reject the request with 400 Bad Request
+//	function validate(req) { if (!req.param("id")) return "Error: Missing required parameter 'id'"; }
+//
+//	// Required: produce the response
+//	function respond(req, res) { res.status(200); res.write("Info for ID=" + req.param("id")); }
+//
+// The req object exposes method, url, params (all request parameters) and
+// headers, plus param(name) for a case-insensitive parameter lookup. The res
+// object exposes status(code) and write(text). The global store object gives
+// access to the shared state store (get, set with an optional TTL in seconds,
+// del), and log(message) writes to the main log.
+//
+// The script runs once per request, and validate and respond are called on the
+// same runtime, both in Respond. Every run is interrupted after scriptTimeout.
+type scriptHandler struct {
+	name    string
+	path    string
+	program *goja.Program
+}
+
+// Default time a script may run for one request
+const DefaultScriptTimeout = 5 * time.Second
+
+// scriptTimeout is the time a script may run for one request before it is
+// interrupted, so a script stuck in a loop does not hold the request forever
+var scriptTimeout = DefaultScriptTimeout
+
+// loadScriptHandlers compiles every .js file in dir and registers it as an endpoint
+func loadScriptHandlers(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		h, err := newScriptHandler(path)
+		if err != nil {
+			return err
+		}
+		if lookupHandler(h.name) != nil {
+			return fmt.Errorf("script %s: endpoint '%s' is already registered", path, h.name)
+		}
+		RegisterHandler(h)
+		mainLogger.Printf("Loaded script endpoint '%s' from %s", h.name, path)
+	}
+
+	return nil
+}
+
+// newScriptHandler compiles a script file
+func newScriptHandler(path string) (*scriptHandler, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %v", path, err)
+	}
+
+	program, err := goja.Compile(path, string(source), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script %s: %v", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return &scriptHandler{name: name, path: path, program: program}, nil
+}
+
+func (h *scriptHandler) Name() string {
+	return h.name
+}
+
+// Validate accepts every request: validate runs in Respond, on the runtime
+// respond runs on
+func (h *scriptHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (h *scriptHandler) Respond(r *http.Request) (Response, error) {
+	vm, err := h.newRuntime(r)
+	if err != nil {
+		// A script that timed out fails the request with a 500
+		if isScriptTimeout(err) {
+			return Response{}, err
+		}
+		return Response{Status: http.StatusBadRequest, Body: err.Error()}, nil
+	}
+
+	req := newScriptRequest(r)
+	if validate, ok := goja.AssertFunction(vm.Get("validate")); ok {
+		result, err := h.run(vm, func() (goja.Value, error) {
+			return validate(goja.Undefined(), vm.ToValue(req))
+		})
+		if isScriptTimeout(err) {
+			return Response{}, fmt.Errorf("Error: script %s failed: %s", h.path, scriptErrorMessage(err))
+		}
+		if err != nil {
+			return Response{Status: http.StatusBadRequest, Body: "Error: " + scriptErrorMessage(err)}, nil
+		}
+		if !goja.IsUndefined(result) && !goja.IsNull(result) && result.String() != "" {
+			return Response{Status: http.StatusBadRequest, Body: result.String()}, nil
+		}
+	}
+
+	respond, ok := goja.AssertFunction(vm.Get("respond"))
+	if !ok {
+		return Response{}, fmt.Errorf("Error: script %s does not define a respond function", h.path)
+	}
+
+	res := &scriptResponse{}
+	if _, err := h.run(vm, func() (goja.Value, error) {
+		return respond(goja.Undefined(), vm.ToValue(req), vm.ToValue(res))
+	}); err != nil {
+		return Response{}, fmt.Errorf("Error: script %s failed: %s", h.path, scriptErrorMessage(err))
+	}
+
+	return Response{
+		Status:     res.code,
+		Body:       res.body.String(),
+		Parameters: req.Params,
+	}, nil
+}
+
+// newRuntime creates a runtime with the script globals and runs the script.
+// A runtime is not safe for concurrent use, so each request gets its own.
+func (h *scriptHandler) newRuntime(r *http.Request) (*goja.Runtime, error) {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
+
+	vm.Set("store", scriptStore{})
+	vm.Set("log", func(message string) {
+		mainLog(r).Printf("[script %s] %s", h.name, message)
+	})
+
+	if _, err := h.run(vm, func() (goja.Value, error) { return vm.RunProgram(h.program) }); err != nil {
+		return nil, fmt.Errorf("Error: script %s failed: %w", h.path, scriptError{err})
+	}
+	return vm, nil
+}
+
+// run runs script code, interrupting it after scriptTimeout
+func (h *scriptHandler) run(vm *goja.Runtime, code func() (goja.Value, error)) (goja.Value, error) {
+	timer := time.AfterFunc(scriptTimeout, func() {
+		vm.Interrupt(fmt.Sprintf("timed out after %s", scriptTimeout))
+	})
+	defer timer.Stop()
+	return code()
+}
+
+// isScriptTimeout reports whether a script run was interrupted after scriptTimeout
+func isScriptTimeout(err error) bool {
+	var interrupted *goja.InterruptedError
+	return errors.As(err, &interrupted)
+}
+
+// scriptError wraps an error of a script run, keeping it for isScriptTimeout
+// while its message is the readable one
+type scriptError struct {
+	err error
+}
+
+func (e scriptError) Error() string {
+	return scriptErrorMessage(e.err)
+}
+
+func (e scriptError) Unwrap() error {
+	return e.err
+}
+
+// scriptErrorMessage extracts a readable message from a script error
+func scriptErrorMessage(err error) string {
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		return exception.Value().String()
+	}
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return fmt.Sprint(interrupted.Value())
+	}
+	return err.Error()
+}
+
+// scriptRequest is the req object passed to scripts
+type scriptRequest struct {
+	Method  string
+	URL     string
+	Params  map[string]string
+	Headers map[string]string
+
+	r *http.Request
+}
+
+// newScriptRequest creates the script view of a request
+func newScriptRequest(r *http.Request) *scriptRequest {
+	req := &scriptRequest{
+		Method:  r.Method,
+		URL:     r.URL.String(),
+		Params:  make(map[string]string),
+		Headers: make(map[string]string),
+		r:       r,
+	}
+	for key, values := range r.Form {
+		req.Params[key] = strings.Join(values, ", ")
+	}
+	for name, values := range r.Header {
+		req.Headers[name] = strings.Join(values, ", ")
+	}
+	return req
+}
+
+// Param returns a request parameter, matching its name case-insensitively
+func (req *scriptRequest) Param(name string) string {
+	return getCaseInsensitiveFormValue(req.r, name)
+}
+
+// scriptResponse is the res object passed to scripts
+type scriptResponse struct {
+	code int
+	body strings.Builder
+}
+
+// Status sets the HTTP status code of the response
+func (res *scriptResponse) Status(code int) {
+	res.code = code
+}
+
+// Write appends text to the response body
+func (res *scriptResponse) Write(text string) {
+	res.body.WriteString(text)
+}
+
+// scriptStore is the store object passed to scripts
+type scriptStore struct{}
+
+// Get returns the stored value, or null if the key is not set
+func (scriptStore) Get(key string) (interface{}, error) {
+	value, found, err := stateStore.Get(key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Set stores a value, expiring after ttlSeconds if given
+func (scriptStore) Set(key, value string, ttlSeconds int) error {
+	return stateStore.Set(key, value, time.Duration(ttlSeconds)*time.Second)
+}
+
+// Del removes a key
+func (scriptStore) Del(key string) error {
+	return stateStore.Delete(key)
+}
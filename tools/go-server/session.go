@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Session cookie configuration
+const (
+	SessionCookieName  = "OSCC_SESSION"
+	DefaultSessionTTL  = 30 * time.Minute
+	sessionStorePrefix = "session:"
+)
+
+// Lifetime of issued sessions, set by -session-ttl
+var sessionTTL = DefaultSessionTTL
+
+func init() {
+	RegisterHandler(loginHandler{})
+}
+
+// loginHandler handles the login endpoint, which issues a session cookie. Endpoints
+// with the require_session behavior only answer requests presenting a live session,
+// to test DLL builds that keep a cookie jar across calls.
+type loginHandler struct{}
+
+func (loginHandler) Name() string {
+	return "login"
+}
+
+func (loginHandler) Validate(r *http.Request) error {
+	return nil
+}
+
+func (loginHandler) Respond(r *http.Request) (Response, error) {
+	user := getCaseInsensitiveFormValue(r, "user")
+	if user == "" {
+		user = "anonymous"
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Response{}, fmt.Errorf("Error: Failed to create session: %v", err)
+	}
+	session := hex.EncodeToString(id)
+
+	// Keep the session in the state store, so every instance sharing it accepts the cookie
+	if err := stateStore.Set(sessionStorePrefix+session, user, sessionTTL); err != nil {
+		return Response{}, fmt.Errorf("Error: Failed to save session: %v", err)
+	}
+
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+	}
+	return Response{
+		Body:    fmt.Sprintf("Success: Logged in as %s", user),
+		Headers: map[string]string{"Set-Cookie": cookie.String()},
+		Parameters: map[string]string{
+			"user": user,
+		},
+	}, nil
+}
+
+// checkSession reports whether the request presents a live session cookie
+func checkSession(r *http.Request) (bool, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return false, nil
+	}
+	_, found, err := stateStore.Get(sessionStorePrefix + cookie.Value)
+	return found, err
+}
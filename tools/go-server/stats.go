@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointStats are the request counters of one endpoint
+type EndpointStats struct {
+	Endpoint     string  `json:"endpoint"`
+	Hits         int64   `json:"hits"`
+	Success      int64   `json:"success"`
+	ClientErrors int64   `json:"client_errors"`
+	ServerErrors int64   `json:"server_errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+
+	totalLatencyMs float64
+}
+
+// add counts a capture in the endpoint statistics
+func (e *EndpointStats) add(c Capture) {
+	e.Hits++
+	switch {
+	case c.Status >= 500 || c.Status == 0:
+		// Status 0 is an aborted connection, which the client sees as a server failure
+		e.ServerErrors++
+	case c.Status >= 400:
+		e.ClientErrors++
+	default:
+		e.Success++
+	}
+	e.totalLatencyMs += c.DurationMs
+	e.AvgLatencyMs = e.totalLatencyMs / float64(e.Hits)
+}
+
+// StatsSnapshot is a copy of the server statistics at a point in time
+type StatsSnapshot struct {
+	Since         time.Time       `json:"since"`
+	TotalRequests int64           `json:"total_requests"`
+	Endpoints     []EndpointStats `json:"endpoints"`
+}
+
+// statsSink is a CaptureSink that keeps live request counters per endpoint
+type statsSink struct {
+	mu        sync.Mutex
+	since     time.Time
+	total     int64
+	endpoints map[string]*EndpointStats
+}
+
+// Global live statistics
+var stats = newStatsSink()
+
+// newStatsSink creates empty statistics
+func newStatsSink() *statsSink {
+	return &statsSink{since: time.Now(), endpoints: make(map[string]*EndpointStats)}
+}
+
+func (s *statsSink) Write(c Capture) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := c.Endpoint
+	if name == "" {
+		name = "(none)"
+	}
+	e, ok := s.endpoints[name]
+	if !ok {
+		e = &EndpointStats{Endpoint: name}
+		s.endpoints[name] = e
+	}
+
+	s.total++
+	e.add(c)
+	return nil
+}
+
+func (s *statsSink) Close() error {
+	return nil
+}
+
+// snapshot returns a copy of the current statistics, sorted by endpoint
+func (s *statsSink) snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := StatsSnapshot{Since: s.since, TotalRequests: s.total, Endpoints: []EndpointStats{}}
+	for _, e := range s.endpoints {
+		snap.Endpoints = append(snap.Endpoints, *e)
+	}
+	sort.Slice(snap.Endpoints, func(i, j int) bool { return snap.Endpoints[i].Endpoint < snap.Endpoints[j].Endpoint })
+	return snap
+}
+
+// reset clears the counters of one endpoint, or of every endpoint when endpoint is empty
+func (s *statsSink) reset(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if endpoint == "" {
+		s.since = time.Now()
+		s.total = 0
+		s.endpoints = make(map[string]*EndpointStats)
+		return
+	}
+	for name, e := range s.endpoints {
+		if strings.EqualFold(name, endpoint) {
+			s.total -= e.Hits
+			delete(s.endpoints, name)
+		}
+	}
+}
+
+// endpoint returns the counters of one endpoint (zero when it has not been called)
+func (s *statsSink) endpoint(name string) EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.endpoints {
+		if strings.EqualFold(e.Endpoint, name) {
+			return *e
+		}
+	}
+	return EndpointStats{Endpoint: name}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Windows selectable on the stats page
+var statsWindows = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// Default stats page window and number of recent captures shown
+const (
+	DefaultStatsWindow      = "15m"
+	DefaultStatsRecentLimit = 20
+	DefaultStatsTopClients  = 10
+)
+
+// statsBucket holds the counters of the requests received in one minute
+type statsBucket struct {
+	endpoints map[string]*EndpointStats
+	clients   map[string]int64
+}
+
+// windowedStats is a CaptureSink keeping per-minute counters for the last 24 hours,
+// so statistics can be reported over a sliding window
+type windowedStats struct {
+	mu      sync.Mutex
+	buckets map[int64]*statsBucket
+}
+
+// Global windowed statistics
+var windowStats = newWindowedStats()
+
+// newWindowedStats creates empty windowed statistics
+func newWindowedStats() *windowedStats {
+	return &windowedStats{buckets: make(map[int64]*statsBucket)}
+}
+
+func (s *windowedStats) Write(c Capture) error {
+	minute := c.Timestamp.Unix() / 60
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[minute]
+	if !ok {
+		b = &statsBucket{endpoints: make(map[string]*EndpointStats), clients: make(map[string]int64)}
+		s.buckets[minute] = b
+
+		// Drop buckets older than the largest window
+		for m := range s.buckets {
+			if m <= minute-24*60 {
+				delete(s.buckets, m)
+			}
+		}
+	}
+
+	name := c.Endpoint
+	if name == "" {
+		name = "(none)"
+	}
+	e, ok := b.endpoints[name]
+	if !ok {
+		e = &EndpointStats{Endpoint: name}
+		b.endpoints[name] = e
+	}
+	e.add(c)
+	b.clients[clientHost(c.ClientIP)]++
+	return nil
+}
+
+func (s *windowedStats) Close() error {
+	return nil
+}
+
+// clientHost strips the port from a client address
+func clientHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// WindowEndpointStats are the counters of one endpoint over a window
+type WindowEndpointStats struct {
+	EndpointStats
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// ClientStats counts the requests of one client
+type ClientStats struct {
+	ClientIP string `json:"client_ip"`
+	Requests int64  `json:"requests"`
+}
+
+// WindowSnapshot summarizes the requests received over a window
+type WindowSnapshot struct {
+	Window         string                `json:"window"`
+	Since          time.Time             `json:"since"`
+	TotalRequests  int64                 `json:"total_requests"`
+	ErrorRate      float64               `json:"error_rate"`
+	Endpoints      []WindowEndpointStats `json:"endpoints"`
+	TopClients     []ClientStats         `json:"top_clients"`
+	RecentCaptures []Capture             `json:"recent_captures"`
+}
+
+// snapshot aggregates the buckets of the last window
+func (s *windowedStats) snapshot(window string, d time.Duration) WindowSnapshot {
+	since := time.Now().Add(-d)
+	first := since.Unix() / 60
+
+	s.mu.Lock()
+	endpoints := make(map[string]*EndpointStats)
+	clients := make(map[string]int64)
+	for minute, b := range s.buckets {
+		if minute < first {
+			continue
+		}
+		for name, e := range b.endpoints {
+			total, ok := endpoints[name]
+			if !ok {
+				total = &EndpointStats{Endpoint: name}
+				endpoints[name] = total
+			}
+			total.Hits += e.Hits
+			total.Success += e.Success
+			total.ClientErrors += e.ClientErrors
+			total.ServerErrors += e.ServerErrors
+			total.totalLatencyMs += e.totalLatencyMs
+		}
+		for client, n := range b.clients {
+			clients[client] += n
+		}
+	}
+	s.mu.Unlock()
+
+	snap := WindowSnapshot{
+		Window:         window,
+		Since:          since,
+		Endpoints:      []WindowEndpointStats{},
+		TopClients:     []ClientStats{},
+		RecentCaptures: []Capture{},
+	}
+	var errors int64
+	for _, e := range endpoints {
+		e.AvgLatencyMs = e.totalLatencyMs / float64(e.Hits)
+		failed := e.ClientErrors + e.ServerErrors
+		snap.Endpoints = append(snap.Endpoints, WindowEndpointStats{
+			EndpointStats: *e,
+			ErrorRate:     float64(failed) / float64(e.Hits),
+		})
+		snap.TotalRequests += e.Hits
+		errors += failed
+	}
+	sort.Slice(snap.Endpoints, func(i, j int) bool { return snap.Endpoints[i].Endpoint < snap.Endpoints[j].Endpoint })
+	if snap.TotalRequests > 0 {
+		snap.ErrorRate = float64(errors) / float64(snap.TotalRequests)
+	}
+
+	for client, n := range clients {
+		snap.TopClients = append(snap.TopClients, ClientStats{ClientIP: client, Requests: n})
+	}
+	sort.Slice(snap.TopClients, func(i, j int) bool {
+		if snap.TopClients[i].Requests != snap.TopClients[j].Requests {
+			return snap.TopClients[i].Requests > snap.TopClients[j].Requests
+		}
+		return snap.TopClients[i].ClientIP < snap.TopClients[j].ClientIP
+	})
+	if len(snap.TopClients) > DefaultStatsTopClients {
+		snap.TopClients = snap.TopClients[:DefaultStatsTopClients]
+	}
+
+	for _, c := range recentCaptures.recent(DefaultStatsRecentLimit, "") {
+		if c.Timestamp.After(since) {
+			snap.RecentCaptures = append(snap.RecentCaptures, c)
+		}
+	}
+	return snap
+}
+
+// statsWindow returns the window selected by the 'window' query parameter,
+// writing a 400 response if it is not one of the supported windows
+func statsWindow(w http.ResponseWriter, r *http.Request) (string, time.Duration, bool) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = DefaultStatsWindow
+	}
+	d, ok := statsWindows[window]
+	if !ok {
+		http.Error(w, "Invalid window (valid windows: 1m, 5m, 15m, 1h, 24h)", http.StatusBadRequest)
+	}
+	return window, d, ok
+}
+
+// handleStatsAPI returns the statistics over the selected window as JSON
+func handleStatsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window, d, ok := statsWindow(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, windowStats.snapshot(window, d))
+}
+
+// handleStatsPage serves the stats dashboard
+func handleStatsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl := template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>CustomDLL Test Server - Stats</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            margin: 0;
+            padding: 20px;
+            line-height: 1.6;
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+        }
+        h1, h2 {
+            color: #333;
+        }
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            margin-bottom: 20px;
+        }
+        th, td {
+            border: 1px solid #ddd;
+            padding: 6px 8px;
+            text-align: left;
+        }
+        th {
+            background-color: #f2f2f2;
+        }
+        .summary span {
+            margin-right: 20px;
+        }
+        .failed {
+            color: red;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>CustomDLL Test Server - Stats</h1>
+        <p>
+            <label for="window">Window:</label>
+            <select id="window" onchange="loadStats()">
+                <option value="1m">Last minute</option>
+                <option value="5m">Last 5 minutes</option>
+                <option value="15m" selected>Last 15 minutes</option>
+                <option value="1h">Last hour</option>
+                <option value="24h">Last 24 hours</option>
+            </select>
+        </p>
+        <p class="summary" id="summary"></p>
+
+        <h2>Endpoints</h2>
+        <table>
+            <thead>
+                <tr><th>Endpoint</th><th>Requests</th><th>2xx/3xx</th><th>4xx</th><th>5xx</th><th>Error rate</th><th>Avg latency (ms)</th></tr>
+            </thead>
+            <tbody id="endpoints"></tbody>
+        </table>
+
+        <h2>Top Clients</h2>
+        <table>
+            <thead>
+                <tr><th>Client IP</th><th>Requests</th></tr>
+            </thead>
+            <tbody id="clients"></tbody>
+        </table>
+
+        <h2>Recent Requests</h2>
+        <table>
+            <thead>
+                <tr><th>Time</th><th>Client</th><th>Endpoint</th><th>Status</th><th>Duration (ms)</th></tr>
+            </thead>
+            <tbody id="captures"></tbody>
+        </table>
+    </div>
+
+    <script>
+        function escapeHtml(text) {
+            return String(text).replace(/[&<>"']/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c]));
+        }
+
+        function percent(rate) {
+            return (rate * 100).toFixed(1) + '%';
+        }
+
+        function loadStats() {
+            const selected = document.getElementById('window').value;
+            fetch('/stats/api?window=' + encodeURIComponent(selected))
+            .then(response => response.json())
+            .then(stats => {
+                document.getElementById('summary').innerHTML =
+                    '<span><strong>Requests:</strong> ' + stats.total_requests + '</span>' +
+                    '<span><strong>Error rate:</strong> ' + percent(stats.error_rate) + '</span>' +
+                    '<span><strong>Since:</strong> ' + new Date(stats.since).toLocaleTimeString() + '</span>';
+
+                let html = '';
+                for (const e of stats.endpoints) {
+                    html += '<tr><td>' + escapeHtml(e.endpoint) + '</td><td>' + e.hits + '</td><td>' + e.success + '</td>';
+                    html += '<td>' + e.client_errors + '</td><td>' + e.server_errors + '</td>';
+                    html += '<td' + (e.error_rate > 0 ? ' class="failed"' : '') + '>' + percent(e.error_rate) + '</td>';
+                    html += '<td>' + e.avg_latency_ms.toFixed(2) + '</td></tr>';
+                }
+                document.getElementById('endpoints').innerHTML = html;
+
+                html = '';
+                for (const c of stats.top_clients) {
+                    html += '<tr><td>' + escapeHtml(c.client_ip) + '</td><td>' + c.requests + '</td></tr>';
+                }
+                document.getElementById('clients').innerHTML = html;
+
+                html = '';
+                for (const c of stats.recent_captures) {
+                    html += '<tr><td>' + new Date(c.timestamp).toLocaleTimeString() + '</td><td>' + escapeHtml(c.client_ip) + '</td>';
+                    html += '<td>' + escapeHtml(c.endpoint) + '</td>';
+                    html += '<td' + (c.status >= 400 || c.status === 0 ? ' class="failed"' : '') + '>' + c.status + '</td>';
+                    html += '<td>' + c.duration_ms.toFixed(2) + '</td></tr>';
+                }
+                document.getElementById('captures').innerHTML = html;
+            });
+        }
+
+        loadStats();
+        setInterval(loadStats, 2000);
+    </script>
+</body>
+</html>`))
+	tmpl.Execute(w, nil)
+}
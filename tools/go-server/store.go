@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Default state store configuration
+const (
+	DefaultStoreType   = "memory"
+	DefaultRedisAddr   = "localhost:6379"
+	DefaultRedisPrefix = "goserver:"
+)
+
+// redisTimeout bounds every Redis command, so an unreachable server fails the
+// request instead of stalling it
+const redisTimeout = 5 * time.Second
+
+// StateStore holds the state shared between requests (saved CIDs, sessions).
+// When several server instances run behind a load balancer, a shared
+// implementation such as Redis keeps stateful behavior consistent no matter
+// which instance the DLL hits.
+type StateStore interface {
+	// Get returns the value stored under key and whether it was found
+	Get(key string) (string, bool, error)
+	// Set stores value under key; a zero ttl means the value never expires
+	Set(key, value string, ttl time.Duration) error
+	// Delete removes key from the store
+	Delete(key string) error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Global state store
+var stateStore StateStore
+
+// newStateStore creates the state store selected on the command line
+func newStateStore(storeType, redisAddr, redisPassword string, redisDB int, redisPrefix string) (StateStore, error) {
+	switch strings.ToLower(storeType) {
+	case "", "memory":
+		return newMemoryStore(), nil
+	case "redis":
+		return newRedisStore(redisAddr, redisPassword, redisDB, redisPrefix)
+	default:
+		return nil, fmt.Errorf("unknown store type '%s' (valid types: memory, redis)", storeType)
+	}
+}
+
+// memoryEntry is a value held by the memory store
+type memoryEntry struct {
+	value   string
+	expires time.Time
+}
+
+// memoryStore is a StateStore local to this process
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// newMemoryStore creates an empty in-process store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *memoryStore) Get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return "", false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *memoryStore) Set(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// redisStore is a StateStore shared by every instance using the same Redis server
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// newRedisStore connects to Redis and verifies the connection
+func newRedisStore(addr, password string, db int, prefix string) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %v", addr, err)
+	}
+
+	return &redisStore{client: client, prefix: prefix}, nil
+}
+
+func (s *redisStore) Get(key string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value, err := s.client.Get(ctx, s.prefix+key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(key, value string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *redisStore) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,7 @@
+module mock-dll
+
+go 1.24
+
+require github.com/cristiangirlea/OScapeDLCapture/tools/shared v0.0.0
+
+replace github.com/cristiangirlea/OScapeDLCapture/tools/shared => ../shared
@@ -0,0 +1,133 @@
+// Command mock-dll is a reference CustomDLL written in Go. Built with
+// -buildmode=c-shared it exports the same functions as the C++ DLL, speaks the
+// buffer protocol and calls the server configured in config.ini next to it, so
+// the simulator can be developed and tested without the C++ toolchain or the
+// proprietary DLL:
+//
+//	go build -buildmode=c-shared -o CustomDLL.dll .
+package main
+
+/*
+#cgo linux CFLAGS: -D_GNU_SOURCE
+#cgo linux LDFLAGS: -ldl
+
+#include <stdlib.h>
+#include <string.h>
+
+#ifdef _WIN32
+#include <windows.h>
+#define THREAD_LOCAL __declspec(thread)
+#else
+#include <dlfcn.h>
+#define THREAD_LOCAL __thread
+#endif
+
+// Last error message of the calling thread, as in the C++ DLL
+static THREAD_LOCAL char last_error[512];
+
+static void set_last_error(const char* message) {
+	strncpy(last_error, message, sizeof(last_error) - 1);
+	last_error[sizeof(last_error) - 1] = '\0';
+}
+
+static const char* get_last_error(void) {
+	return last_error;
+}
+
+// module_path writes the path of the library holding this code
+static void module_path(char* path, int size) {
+	path[0] = '\0';
+#ifdef _WIN32
+	HMODULE module = NULL;
+	if (GetModuleHandleExA(GET_MODULE_HANDLE_EX_FLAG_FROM_ADDRESS | GET_MODULE_HANDLE_EX_FLAG_UNCHANGED_REFCOUNT,
+		(LPCSTR)&module_path, &module)) {
+		GetModuleFileNameA(module, path, size);
+	}
+#else
+	Dl_info info;
+	if (dladdr((void*)&module_path, &info) && info.dli_fname) {
+		strncpy(path, info.dli_fname, size - 1);
+		path[size - 1] = '\0';
+	}
+#endif
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Size of the buffer receiving the module path
+const maxPath = 4096
+
+func main() {}
+
+//export CustomFunctionExample
+func CustomFunctionExample(dataIn *C.char, dataOut *C.char) (code C.long) {
+	defer func() {
+		if r := recover(); r != nil {
+			setLastError("Unexpected exception: %v", r)
+			code = C.long(dllclient.UnexpectedException)
+		}
+	}()
+
+	if dataIn == nil {
+		setLastError("Invalid input: dataIn is null")
+		return C.long(dllclient.InvalidInput)
+	}
+
+	config := readConfig(configPath())
+	input, err := readInput(config.protocol, unsafe.Pointer(dataIn))
+	if err != nil {
+		setLastError("Invalid input: %v", err)
+		return C.long(dllclient.InvalidInput)
+	}
+	result := process(config, input)
+	if result.code != dllclient.Success {
+		setLastError("%s", result.message)
+		return C.long(result.code)
+	}
+
+	if result.output != nil && dataOut != nil {
+		out := unsafe.Slice((*byte)(unsafe.Pointer(dataOut)), len(result.output))
+		copy(out, result.output)
+	}
+	return C.long(dllclient.Success)
+}
+
+//export GetLastErrorMessage
+func GetLastErrorMessage() *C.char {
+	return C.get_last_error()
+}
+
+// setLastError records the error message of the calling thread
+func setLastError(format string, args ...any) {
+	message := C.CString(fmt.Sprintf(format, args...))
+	defer C.free(unsafe.Pointer(message))
+	C.set_last_error(message)
+}
+
+// configPath returns the path of config.ini next to the library
+func configPath() string {
+	path := make([]byte, maxPath)
+	C.module_path((*C.char)(unsafe.Pointer(&path[0])), C.int(len(path)))
+	return configPathFor(C.GoString((*C.char)(unsafe.Pointer(&path[0]))))
+}
+
+// readInput copies the input buffer, whose size follows from its header
+func readInput(v buffer.Version, data unsafe.Pointer) ([]buffer.Pair, error) {
+	header := C.GoBytes(data, C.int(v.HeaderLen()))
+	count := 0
+	for _, d := range header[v.HeaderLen()-2:] {
+		if d < '0' || d > '9' {
+			return nil, fmt.Errorf("header %q does not start with the number of parameters", header)
+		}
+		count = count*10 + int(d-'0')
+	}
+	return buffer.Decode(v, C.GoBytes(data, C.int(v.Size(count))))
+}
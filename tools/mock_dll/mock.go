@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/dllclient"
+)
+
+// Largest response body read from the server
+const maxResponseSize = 1 << 20
+
+// config holds the settings of config.ini, with the C++ DLL's defaults
+type config struct {
+	baseURL        string
+	timeout        time.Duration
+	connectTimeout time.Duration
+	verifySSL      bool
+	sslCertFile    string
+	// protocol and checksum come from the [mock] section, as the C++ DLL only
+	// speaks buffer protocol version 1 without checksums
+	protocol buffer.Version
+	checksum bool
+}
+
+// configPathFor returns the path of config.ini next to a library
+func configPathFor(libraryPath string) string {
+	if libraryPath == "" {
+		return "config.ini"
+	}
+	return filepath.Join(filepath.Dir(libraryPath), "config.ini")
+}
+
+// readConfig reads config.ini, using the defaults for missing settings or a missing file
+func readConfig(path string) config {
+	c := config{
+		baseURL:        "https://localhost/api/index.php",
+		timeout:        4 * time.Second,
+		connectTimeout: 2 * time.Second,
+		verifySSL:      true,
+		protocol:       buffer.V1,
+	}
+	values := readINI(path)
+
+	if v := values["api.base_url"]; v != "" {
+		c.baseURL = v
+	}
+	if v, err := strconv.Atoi(values["api.timeout"]); err == nil {
+		c.timeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(values["api.connect_timeout"]); err == nil {
+		c.connectTimeout = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.Atoi(values["api.verify_ssl"]); err == nil {
+		c.verifySSL = v != 0
+	}
+	c.sslCertFile = values["api.ssl_cert_file"]
+	if v, err := strconv.Atoi(values["mock.protocol"]); err == nil {
+		if version, err := buffer.ParseVersion(v); err == nil {
+			c.protocol = version
+		}
+	}
+	if v, err := strconv.Atoi(values["mock.checksum"]); err == nil {
+		c.checksum = v != 0
+	}
+	return c
+}
+
+// readINI reads the settings of an INI file as "section.key" values
+func readINI(path string) map[string]string {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+		default:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[section+"."+strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values
+}
+
+// result is the outcome of processing one call
+type result struct {
+	code    dllclient.ErrorCode
+	message string
+	// output is the output buffer to write, nil for none
+	output []byte
+}
+
+// process calls the server with the input parameters as the C++ DLL does: a GET
+// request with every parameter but CFResp in the query string, and with CFResp=yes
+// the response body returned in a CFResp output value
+func process(c config, input []buffer.Pair) result {
+	if c.checksum {
+		if len(input) == 0 || input[len(input)-1].Key != buffer.ChecksumKey {
+			return result{code: dllclient.InvalidInput, message: fmt.Sprintf("Invalid input: missing %s checksum pair", buffer.ChecksumKey)}
+		}
+		encoded, err := buffer.Encode(c.protocol, input)
+		if err != nil {
+			return result{code: dllclient.InvalidInput, message: fmt.Sprintf("Invalid input: %v", err)}
+		}
+		if _, err := buffer.VerifyChecksum(c.protocol, encoded); err != nil {
+			return result{code: dllclient.InvalidInput, message: fmt.Sprintf("Invalid input: %v", err)}
+		}
+		input = input[:len(input)-1]
+	}
+
+	params := make(map[string]string, len(input))
+	for _, p := range input {
+		params[p.Key] = p.Value
+	}
+	returnResponse := params["CFResp"] == "yes"
+
+	client, err := httpClient(c)
+	if err != nil {
+		return result{code: dllclient.CurlInitFailed, message: fmt.Sprintf("Failed to initialize HTTP client: %v", err)}
+	}
+	resp, err := client.Get(requestURL(c.baseURL, params))
+	if err != nil {
+		return result{code: dllclient.CurlRequestFailed, message: fmt.Sprintf("Curl request failed: %v", err)}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return result{code: dllclient.CurlRequestFailed, message: fmt.Sprintf("Curl request failed: %v", err)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result{code: dllclient.HTTPError, message: fmt.Sprintf("HTTP error: received status code %d", resp.StatusCode)}
+	}
+
+	if !returnResponse {
+		return result{code: dllclient.Success}
+	}
+	return result{code: dllclient.Success, output: outputBuffer(c, string(body))}
+}
+
+// requestURL builds the GET URL, with the parameters in key order as the C++ DLL
+// sends them and without CFResp
+func requestURL(baseURL string, params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key != "CFResp" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var query []string
+	for _, key := range keys {
+		query = append(query, key+"="+url.QueryEscape(params[key]))
+	}
+	return baseURL + "?" + strings.Join(query, "&")
+}
+
+// httpClient creates the HTTP client for the configured timeouts and SSL settings
+func httpClient(c config) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !c.verifySSL}
+	if c.verifySSL && c.sslCertFile != "" {
+		pem, err := os.ReadFile(c.sslCertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.sslCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Timeout: c.timeout,
+		Transport: &http.Transport{
+			DialContext:     (&net.Dialer{Timeout: c.connectTimeout}).DialContext,
+			TLSClientConfig: tlsConfig,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// outputBuffer encodes the response as the CFResp output value. Like the C++ DLL,
+// version 1 keeps at most 127 characters of the response, so the value stays
+// NUL-terminated; version 2 keeps a full value.
+func outputBuffer(c config, response string) []byte {
+	limit := buffer.ValueSize - 1
+	if c.protocol == buffer.V2 {
+		limit = buffer.ValueSize
+	}
+	if len(response) > limit {
+		response = response[:limit]
+	}
+
+	pairs := []buffer.Pair{{Key: "CFResp", Value: response}}
+	var data []byte
+	if c.checksum {
+		data, _ = buffer.EncodeWithChecksum(c.protocol, pairs)
+	} else {
+		data, _ = buffer.Encode(c.protocol, pairs)
+	}
+	return data
+}
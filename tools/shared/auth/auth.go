@@ -0,0 +1,215 @@
+// Package auth implements the role-based access control shared by the
+// Go server and the Contact Center simulator.
+//
+// Users authenticate with HTTP basic authentication against a JSON users file:
+//
+//	[
+//	  {"name": "alice", "role": "admin", "salt": "x9f2", "iterations": 600000, "password_pbkdf2": "<hex of PBKDF2-HMAC-SHA256>"},
+//	  {"name": "bob", "role": "operator", "salt": "k3m1", "iterations": 600000, "password_pbkdf2": "..."},
+//	  {"name": "carol", "role": "viewer", "salt": "p0q8", "iterations": 600000, "password_pbkdf2": "..."}
+//	]
+//
+// The hashes are generated with the hashpassword command (cmd/hashpassword).
+//
+// Without a users file access control is disabled and every request is
+// treated as coming from an admin, as before roles were introduced.
+package auth
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Iterations of PBKDF2 recommended for new password hashes
+const DefaultIterations = 600000
+
+// Length of a password hash in bytes
+const hashLength = sha256.Size
+
+// Role is the access level of a user. Each role includes the permissions of the roles below it.
+type Role int
+
+// Roles, from least to most privileged
+const (
+	// Viewer can see results, captures and statistics
+	Viewer Role = iota + 1
+	// Operator can additionally run tests
+	Operator
+	// Admin can additionally change endpoint behavior, configuration and DLLs
+	Admin
+)
+
+// String returns the role name as used in the users file
+func (r Role) String() string {
+	switch r {
+	case Viewer:
+		return "viewer"
+	case Operator:
+		return "operator"
+	case Admin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRole parses a role name
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "viewer":
+		return Viewer, nil
+	case "operator":
+		return Operator, nil
+	case "admin":
+		return Admin, nil
+	default:
+		return 0, fmt.Errorf("unknown role '%s' (valid roles: admin, operator, viewer)", name)
+	}
+}
+
+// User is an authenticated user
+type User struct {
+	Name string
+	Role Role
+}
+
+// userEntry is a user as stored in the users file
+type userEntry struct {
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	Salt           string `json:"salt"`
+	Iterations     int    `json:"iterations"`
+	PasswordPBKDF2 string `json:"password_pbkdf2"`
+	// PasswordSHA256 is the single SHA-256 hash of earlier users files,
+	// only read to explain that it must be regenerated
+	PasswordSHA256 string `json:"password_sha256"`
+}
+
+// Users is the set of users allowed to access a server. A nil *Users disables access control.
+type Users struct {
+	realm string
+	users map[string]userEntry
+	roles map[string]Role
+
+	// verified holds the SHA-256 of the password each user last authenticated
+	// with, so requests of a logged-in browser skip the slow password hash
+	mu       sync.Mutex
+	verified map[string][sha256.Size]byte
+}
+
+// LoadUsers reads a users file. realm is shown by browsers in the login prompt.
+func LoadUsers(path, realm string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+
+	var entries []userEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse users file %s: %v", path, err)
+	}
+
+	u := &Users{realm: realm, users: make(map[string]userEntry), roles: make(map[string]Role),
+		verified: make(map[string][sha256.Size]byte)}
+	for _, entry := range entries {
+		if entry.PasswordPBKDF2 == "" && entry.PasswordSHA256 != "" {
+			return nil, fmt.Errorf("users file %s: user '%s' has a password_sha256, which is no longer accepted: generate a password_pbkdf2 with hashpassword", path, entry.Name)
+		}
+		if entry.Name == "" || entry.PasswordPBKDF2 == "" {
+			return nil, fmt.Errorf("users file %s: every user needs a name and password_pbkdf2", path)
+		}
+		if entry.Iterations < 1 {
+			return nil, fmt.Errorf("users file %s: user '%s': iterations must be positive", path, entry.Name)
+		}
+		role, err := ParseRole(entry.Role)
+		if err != nil {
+			return nil, fmt.Errorf("users file %s: user '%s': %v", path, entry.Name, err)
+		}
+		u.users[entry.Name] = entry
+		u.roles[entry.Name] = role
+	}
+	return u, nil
+}
+
+// HashPassword returns the password_pbkdf2 value for a salt, password and
+// number of iterations: the hex PBKDF2-HMAC-SHA256 of the password
+func HashPassword(salt, password string, iterations int) string {
+	key, err := pbkdf2.Key(sha256.New, password, []byte(salt), iterations, hashLength)
+	if err != nil {
+		// Only an invalid key length or a non-FIPS parameter fails
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// Authenticate checks the basic auth credentials of a request
+func (u *Users) Authenticate(r *http.Request) (User, bool) {
+	if u == nil {
+		return User{Name: "anonymous", Role: Admin}, true
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return User{}, false
+	}
+	entry, found := u.users[name]
+	if !found {
+		// Hash anyway so unknown users take as long as wrong passwords
+		HashPassword("", password, DefaultIterations)
+		return User{}, false
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	u.mu.Lock()
+	last, seen := u.verified[name]
+	u.mu.Unlock()
+	if seen && subtle.ConstantTimeCompare(sum[:], last[:]) == 1 {
+		return User{Name: name, Role: u.roles[name]}, true
+	}
+
+	hash := HashPassword(entry.Salt, password, entry.Iterations)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(strings.ToLower(entry.PasswordPBKDF2))) != 1 {
+		return User{}, false
+	}
+	u.mu.Lock()
+	u.verified[name] = sum
+	u.mu.Unlock()
+	return User{Name: name, Role: u.roles[name]}, true
+}
+
+// userContextKey is the context key of the authenticated user
+type userContextKey struct{}
+
+// Require wraps a handler so that only users with at least the given role can call it.
+// The authenticated user is available to the handler through FromRequest.
+func (u *Users) Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := u.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, u.realm))
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if user.Role < role {
+			http.Error(w, fmt.Sprintf("Forbidden: this action requires the %s role (you are %s)", role, user.Role), http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	}
+}
+
+// FromRequest returns the user authenticated by Require
+func FromRequest(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(userContextKey{}).(User)
+	return user, ok
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeUsers writes a users file and returns its path
+func writeUsers(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash := HashPassword("s4lt", "secret", 1000)
+	users, err := LoadUsers(writeUsers(t, `[{"name": "alice", "role": "operator", "salt": "s4lt", "iterations": 1000, "password_pbkdf2": "`+hash+`"}]`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, user, password string
+		ok                   bool
+	}{
+		{"valid", "alice", "secret", true},
+		{"valid again", "alice", "secret", true},
+		{"wrong password", "alice", "Secret", false},
+		{"unknown user", "bob", "secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.SetBasicAuth(tt.user, tt.password)
+			user, ok := users.Authenticate(r)
+			if ok != tt.ok || ok && (user.Name != "alice" || user.Role != Operator) {
+				t.Errorf("Authenticate = %+v, %v; want ok %v", user, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLoadUsersErrors(t *testing.T) {
+	tests := []struct {
+		name, content, err string
+	}{
+		{"sha256 password", `[{"name": "alice", "role": "admin", "salt": "s", "password_sha256": "ab"}]`, "no longer accepted"},
+		{"no password", `[{"name": "alice", "role": "admin"}]`, "needs a name and password_pbkdf2"},
+		{"no iterations", `[{"name": "alice", "role": "admin", "password_pbkdf2": "ab"}]`, "iterations must be positive"},
+		{"unknown role", `[{"name": "alice", "role": "root", "iterations": 1, "password_pbkdf2": "ab"}]`, "unknown role 'root'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadUsers(writeUsers(t, tt.content), "test")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// Package buffer encodes and decodes the fixed-width key/value buffers that
+// OpenScape Contact Center exchanges with the CustomDLL.
+//
+// Protocol version 1 is the layout OSCC uses:
+//
+//	NN                    number of pairs, two ASCII digits
+//	key[32] value[128]    per pair, NUL-padded
+//
+// The DLL reads keys and values up to their first NUL, so they cannot contain
+// NULs, and a value filling all 128 bytes cannot be told apart from a truncated one.
+//
+// Protocol version 2 is an optional binary-safe layout for DLL builds that
+// support it. Every key and value carries its length, so NUL bytes and full
+// 128-byte values round-trip unchanged:
+//
+//	V2NN                                   magic "V2" and the number of pairs
+//	KK key[32] VVV value[128]              per pair, KK and VVV are ASCII-digit lengths
+//
+// Padding after a key or value is ignored. A buffer that is all NULs holds no
+// pairs (the DLL did not write any output).
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Field sizes shared by both protocol versions
+const (
+	KeySize   = 32
+	ValueSize = 128
+	// MaxPairs is the largest number of pairs a two-digit header can announce
+	MaxPairs = 99
+)
+
+// Protocol version 1 sizes
+const (
+	HeaderSize = 2
+	PairSize   = KeySize + ValueSize
+)
+
+// Protocol version 2 sizes
+const (
+	Magic2          = "V2"
+	Header2Size     = len(Magic2) + 2
+	keyLengthSize   = 2
+	valueLengthSize = 3
+	Pair2Size       = keyLengthSize + KeySize + valueLengthSize + ValueSize
+)
+
+// Version is a buffer protocol version
+type Version int
+
+// Protocol versions
+const (
+	V1 Version = 1
+	V2 Version = 2
+)
+
+// ParseVersion checks a protocol version, treating 0 as the default version 1
+func ParseVersion(v int) (Version, error) {
+	switch v {
+	case 0, 1:
+		return V1, nil
+	case 2:
+		return V2, nil
+	default:
+		return 0, fmt.Errorf("unknown buffer protocol version %d (valid versions: 1, 2)", v)
+	}
+}
+
+// Pair is one key/value entry of a buffer
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// DetectVersion returns the protocol version of a buffer from its header: version 2
+// if it starts with the version 2 magic, version 1 otherwise
+func DetectVersion(buf []byte) Version {
+	if bytes.HasPrefix(buf, []byte(Magic2)) {
+		return V2
+	}
+	return V1
+}
+
+// HeaderLen returns the header size of the protocol version
+func (v Version) HeaderLen() int {
+	if v == V2 {
+		return Header2Size
+	}
+	return HeaderSize
+}
+
+// PairLen returns the size of one pair in the protocol version
+func (v Version) PairLen() int {
+	if v == V2 {
+		return Pair2Size
+	}
+	return PairSize
+}
+
+// Size returns the size of a buffer holding n pairs
+func (v Version) Size(n int) int {
+	return v.HeaderLen() + n*v.PairLen()
+}
+
+// Encode builds a buffer holding the pairs. Version 1 truncates keys and values
+// to their field size, as OSCC does; version 2 rejects them, since a binary-safe
+// value must not be silently cut.
+func Encode(v Version, pairs []Pair) ([]byte, error) {
+	if len(pairs) > MaxPairs {
+		return nil, fmt.Errorf("too many pairs: %d (maximum is %d)", len(pairs), MaxPairs)
+	}
+
+	buf := make([]byte, v.Size(len(pairs)))
+	if v == V2 {
+		copy(buf, fmt.Sprintf("%s%02d", Magic2, len(pairs)))
+	} else {
+		copy(buf, fmt.Sprintf("%02d", len(pairs)))
+	}
+
+	for i, p := range pairs {
+		offset := v.HeaderLen() + i*v.PairLen()
+		if v != V2 {
+			copy(buf[offset:offset+KeySize], p.Key)
+			copy(buf[offset+KeySize:offset+PairSize], p.Value)
+			continue
+		}
+
+		if len(p.Key) > KeySize {
+			return nil, fmt.Errorf("key '%s' is %d bytes long (maximum is %d)", p.Key, len(p.Key), KeySize)
+		}
+		if len(p.Value) > ValueSize {
+			return nil, fmt.Errorf("value of '%s' is %d bytes long (maximum is %d)", p.Key, len(p.Value), ValueSize)
+		}
+		copy(buf[offset:], fmt.Sprintf("%02d", len(p.Key)))
+		offset += keyLengthSize
+		copy(buf[offset:offset+KeySize], p.Key)
+		offset += KeySize
+		copy(buf[offset:], fmt.Sprintf("%03d", len(p.Value)))
+		offset += valueLengthSize
+		copy(buf[offset:offset+ValueSize], p.Value)
+	}
+	return buf, nil
+}
+
+// Kinds of parse errors, matched with errors.Is
+var (
+	ErrBadHeader     = errors.New("bad header")
+	ErrTruncatedPair = errors.New("truncated pair")
+	ErrBadLength     = errors.New("bad length field")
+	ErrDuplicateKey  = errors.New("duplicate key")
+)
+
+// ParseError describes where and why a buffer could not be decoded
+type ParseError struct {
+	// Kind is one of the Err values above
+	Kind error
+	// Pair is the 1-based index of the offending pair (0 for the header)
+	Pair int
+	// Offset is the byte offset of the problem in the buffer
+	Offset int
+	// Detail explains what was found
+	Detail string
+	// Head holds the first bytes of the buffer, for header and size errors
+	Head []byte
+	// ExpectedSize is the buffer size the header calls for (0 if unknown), and
+	// ActualSize the size of the buffer, for header and size errors
+	ExpectedSize int
+	ActualSize   int
+}
+
+// Number of leading bytes kept in a ParseError for diagnostics
+const headBytes = 8
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%v at offset %d: %s", e.Kind, e.Offset, e.Detail)
+	if e.Pair != 0 {
+		msg = fmt.Sprintf("%v in pair %d at offset %d: %s", e.Kind, e.Pair, e.Offset, e.Detail)
+	}
+	if e.Head != nil {
+		msg += fmt.Sprintf(" (first bytes: % X", e.Head)
+		if e.ExpectedSize > 0 {
+			msg += fmt.Sprintf("; expected %d bytes, buffer is %d", e.ExpectedSize, e.ActualSize)
+		}
+		msg += ")"
+	}
+	return msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Kind
+}
+
+// sizeError creates a ParseError about the header or the size of a buffer,
+// recording its first bytes and the size the header calls for
+func sizeError(kind error, buf []byte, pair, offset, expectedSize int, detail string) *ParseError {
+	head := buf[:min(len(buf), headBytes)]
+	return &ParseError{
+		Kind:         kind,
+		Pair:         pair,
+		Offset:       offset,
+		Detail:       detail,
+		Head:         append([]byte{}, head...),
+		ExpectedSize: expectedSize,
+		ActualSize:   len(buf),
+	}
+}
+
+// Decode reads the pairs of a buffer. An all-NUL buffer (nothing written) holds no
+// pairs. On malformed input it returns the pairs decoded before the problem and a
+// *ParseError.
+func Decode(v Version, buf []byte) ([]Pair, error) {
+	count, err := pairCount(v, buf)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	var pairs []Pair
+	seen := make(map[string]bool)
+	for i := 0; i < count; i++ {
+		offset := v.HeaderLen() + i*v.PairLen()
+		if offset+v.PairLen() > len(buf) {
+			return pairs, sizeError(ErrTruncatedPair, buf, i+1, offset, v.Size(count),
+				fmt.Sprintf("header announces %d pairs but the buffer ends after %d bytes of this one", count, max(len(buf)-offset, 0)))
+		}
+
+		var pair Pair
+		if v != V2 {
+			pair = Pair{
+				Key:   trimNUL(buf[offset : offset+KeySize]),
+				Value: trimNUL(buf[offset+KeySize : offset+PairSize]),
+			}
+		} else {
+			start := offset
+			keyLength, err := strconv.Atoi(string(buf[offset : offset+keyLengthSize]))
+			if err != nil || keyLength < 0 || keyLength > KeySize {
+				return pairs, &ParseError{Kind: ErrBadLength, Pair: i + 1, Offset: offset,
+					Detail: fmt.Sprintf("key length %q is not a number from 0 to %d", buf[offset:offset+keyLengthSize], KeySize)}
+			}
+			offset += keyLengthSize
+			key := string(buf[offset : offset+keyLength])
+			offset += KeySize
+			valueLength, err := strconv.Atoi(string(buf[offset : offset+valueLengthSize]))
+			if err != nil || valueLength < 0 || valueLength > ValueSize {
+				return pairs, &ParseError{Kind: ErrBadLength, Pair: i + 1, Offset: offset,
+					Detail: fmt.Sprintf("value length %q is not a number from 0 to %d", buf[offset:offset+valueLengthSize], ValueSize)}
+			}
+			offset += valueLengthSize
+			pair = Pair{Key: key, Value: string(buf[offset : offset+valueLength])}
+			offset = start
+		}
+
+		if seen[pair.Key] {
+			return pairs, &ParseError{Kind: ErrDuplicateKey, Pair: i + 1, Offset: offset,
+				Detail: fmt.Sprintf("key %q appears more than once", pair.Key)}
+		}
+		seen[pair.Key] = true
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// pairCount reads the number of pairs announced by the header
+func pairCount(v Version, buf []byte) (int, error) {
+	if len(buf) < v.HeaderLen() {
+		return 0, sizeError(ErrBadHeader, buf, 0, 0, v.HeaderLen(),
+			fmt.Sprintf("buffer is %d bytes long, shorter than the %d-byte header", len(buf), v.HeaderLen()))
+	}
+	header := buf[:v.HeaderLen()]
+	if bytes.Count(header, []byte{0}) == len(header) {
+		return 0, nil
+	}
+
+	digits := header
+	if v == V2 {
+		if string(header[:len(Magic2)]) != Magic2 {
+			return 0, sizeError(ErrBadHeader, buf, 0, 0, 0, fmt.Sprintf("expected magic %q, found %q", Magic2, header[:len(Magic2)]))
+		}
+		digits = header[len(Magic2):]
+	}
+	for _, d := range digits {
+		if d < '0' || d > '9' {
+			return 0, sizeError(ErrBadHeader, buf, 0, len(header)-len(digits), 0, fmt.Sprintf("pair count %q is not two digits", digits))
+		}
+	}
+	count, _ := strconv.Atoi(string(digits))
+	return count, nil
+}
+
+// trimNUL returns a version 1 field without its NUL padding
+func trimNUL(field []byte) string {
+	return string(bytes.TrimRight(field, "\x00"))
+}
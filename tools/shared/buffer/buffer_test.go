@@ -0,0 +1,152 @@
+package buffer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		pairs   []Pair
+		// want is what decoding returns, when it differs from pairs
+		want []Pair
+	}{
+		{"v1 no pairs", V1, nil, nil},
+		{"v1 pairs", V1, []Pair{{"Endpoint", "getInfo"}, {"CallID", "42"}}, nil},
+		{"v1 truncates long keys and values", V1,
+			[]Pair{{strings.Repeat("k", KeySize+1), strings.Repeat("v", ValueSize+1)}},
+			[]Pair{{strings.Repeat("k", KeySize), strings.Repeat("v", ValueSize)}}},
+		{"v1 strips trailing NULs", V1, []Pair{{"Key", "a\x00\x00"}}, []Pair{{"Key", "a"}}},
+		{"v2 no pairs", V2, nil, nil},
+		{"v2 pairs", V2, []Pair{{"Endpoint", "getInfo"}, {"CallID", "42"}}, nil},
+		{"v2 keeps NULs", V2, []Pair{{"Key", "a\x00b\x00"}}, nil},
+		{"v2 keeps full-size values", V2, []Pair{{strings.Repeat("k", KeySize), strings.Repeat("v", ValueSize)}}, nil},
+		{"v2 empty value", V2, []Pair{{"Key", ""}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := Encode(tt.version, tt.pairs)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if len(buf) != tt.version.Size(len(tt.pairs)) {
+				t.Errorf("buffer is %d bytes, want %d", len(buf), tt.version.Size(len(tt.pairs)))
+			}
+			if got := DetectVersion(buf); got != tt.version {
+				t.Errorf("DetectVersion = %d, want %d", got, tt.version)
+			}
+			got, err := Decode(tt.version, buf)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			want := tt.want
+			if want == nil {
+				want = tt.pairs
+			}
+			if len(want) == 0 {
+				want = nil
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Decode = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		version Version
+		pairs   []Pair
+		err     string
+	}{
+		{"too many pairs", V1, make([]Pair, MaxPairs+1), "too many pairs"},
+		{"v2 long key", V2, []Pair{{strings.Repeat("k", KeySize+1), ""}}, "maximum is 32"},
+		{"v2 long value", V2, []Pair{{"Key", strings.Repeat("v", ValueSize+1)}}, "maximum is 128"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Encode(tt.version, tt.pairs)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Encode error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	pair := func(v Version, pairs ...Pair) []byte {
+		buf, err := Encode(v, pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+	twoPairs := pair(V1, Pair{"A", "1"}, Pair{"B", "2"})
+	duplicate := pair(V1, Pair{"A", "1"}, Pair{"A", "2"})
+	badLength := pair(V2, Pair{"A", "1"})
+	copy(badLength[Header2Size:], "9x")
+
+	tests := []struct {
+		name    string
+		version Version
+		buf     []byte
+		kind    error
+		// pairs is the number of pairs decoded before the error
+		pairs int
+	}{
+		{"short header", V1, []byte("0"), ErrBadHeader, 0},
+		{"non-digit count", V1, []byte("x1"), ErrBadHeader, 0},
+		{"v2 bad magic", V2, []byte("V301"), ErrBadHeader, 0},
+		{"truncated pair", V1, twoPairs[:len(twoPairs)-1], ErrTruncatedPair, 1},
+		{"duplicate key", V1, duplicate, ErrDuplicateKey, 1},
+		{"v2 bad key length", V2, badLength, ErrBadLength, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := Decode(tt.version, tt.buf)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.kind)
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Errorf("Decode error is %T, want *ParseError", err)
+			}
+			if len(pairs) != tt.pairs {
+				t.Errorf("Decode returned %d pairs, want %d", len(pairs), tt.pairs)
+			}
+		})
+	}
+}
+
+func TestDecodeEmptyBuffer(t *testing.T) {
+	for _, v := range []Version{V1, V2} {
+		pairs, err := Decode(v, make([]byte, v.Size(3)))
+		if err != nil || pairs != nil {
+			t.Errorf("Decode(v%d, all NULs) = %q, %v; want no pairs", v, pairs, err)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   int
+		want Version
+		err  bool
+	}{
+		{0, V1, false},
+		{1, V1, false},
+		{2, V2, false},
+		{3, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("ParseVersion(%d) = %d, %v", tt.in, got, err)
+		}
+	}
+}
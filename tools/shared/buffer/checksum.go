@@ -0,0 +1,73 @@
+package buffer
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand/v2"
+)
+
+// ChecksumKey is the key of the reserved trailing pair holding the checksum.
+// Its value is the CRC32 (IEEE) of the pairs before it, exactly as encoded in
+// the buffer, as 8 upper-case hex digits. The header counts the checksum pair,
+// so DLL builds that do not know it see an ordinary parameter.
+const ChecksumKey = "_CRC32"
+
+// ChecksumError reports a buffer whose checksum does not match its pairs
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: buffer says %s, pairs hash to %s", e.Expected, e.Actual)
+}
+
+// EncodeWithChecksum builds a buffer holding the pairs followed by their checksum pair
+func EncodeWithChecksum(v Version, pairs []Pair) ([]byte, error) {
+	payload, err := Encode(v, pairs)
+	if err != nil {
+		return nil, err
+	}
+	sum := checksum(payload[v.HeaderLen():])
+	return Encode(v, append(pairs[:len(pairs):len(pairs)], Pair{Key: ChecksumKey, Value: sum}))
+}
+
+// VerifyChecksum checks the trailing checksum pair of a buffer. It reports whether
+// the buffer has one, and a *ChecksumError if it does not match the pairs before it
+// (or a *ParseError if the buffer cannot be decoded).
+func VerifyChecksum(v Version, buf []byte) (bool, error) {
+	pairs, err := Decode(v, buf)
+	if err != nil {
+		return false, err
+	}
+	count := len(pairs)
+	if count == 0 || pairs[count-1].Key != ChecksumKey {
+		return false, nil
+	}
+
+	expected := pairs[count-1].Value
+	actual := checksum(buf[v.HeaderLen():v.Size(count-1)])
+	if expected != actual {
+		return true, &ChecksumError{Expected: expected, Actual: actual}
+	}
+	return true, nil
+}
+
+// Corrupt flips one random bit in the pairs covered by the checksum, so a DLL
+// verifying checksums must reject the buffer. It returns the offset of the
+// damaged byte, or -1 if the buffer has no checksummed pairs.
+func Corrupt(v Version, buf []byte) int {
+	count, err := pairCount(v, buf)
+	if err != nil || count < 2 || v.Size(count) > len(buf) {
+		return -1
+	}
+	start, end := v.HeaderLen(), v.Size(count-1)
+	offset := start + rand.IntN(end-start)
+	buf[offset] ^= 1 << rand.IntN(8)
+	return offset
+}
+
+// checksum returns the CRC32 of data as 8 upper-case hex digits
+func checksum(data []byte) string {
+	return fmt.Sprintf("%08X", crc32.ChecksumIEEE(data))
+}
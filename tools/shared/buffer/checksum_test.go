@@ -0,0 +1,64 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	pairs := []Pair{{"Endpoint", "getInfo"}, {"CallID", "42"}}
+	for _, v := range []Version{V1, V2} {
+		buf, err := EncodeWithChecksum(v, pairs)
+		if err != nil {
+			t.Fatalf("v%d: EncodeWithChecksum: %v", v, err)
+		}
+		decoded, err := Decode(v, buf)
+		if err != nil {
+			t.Fatalf("v%d: Decode: %v", v, err)
+		}
+		if len(decoded) != len(pairs)+1 || decoded[len(pairs)].Key != ChecksumKey || len(decoded[len(pairs)].Value) != 8 {
+			t.Errorf("v%d: decoded %q, want the pairs and an 8-digit %s pair", v, decoded, ChecksumKey)
+		}
+
+		tests := []struct {
+			name string
+			buf  func() []byte
+			has  bool
+			// mismatch is whether VerifyChecksum reports a *ChecksumError
+			mismatch bool
+		}{
+			{"intact", func() []byte { return buf }, true, false},
+			{"corrupted", func() []byte {
+				b := append([]byte{}, buf...)
+				if Corrupt(v, b) < 0 {
+					t.Fatal("Corrupt found no checksummed pairs")
+				}
+				return b
+			}, true, true},
+			{"no checksum", func() []byte {
+				b, _ := Encode(v, pairs)
+				return b
+			}, false, false},
+		}
+		for _, tt := range tests {
+			has, err := VerifyChecksum(v, tt.buf())
+			var cerr *ChecksumError
+			mismatch := errors.As(err, &cerr)
+			if err != nil && !mismatch {
+				// A flipped bit can make the buffer undecodable instead
+				var perr *ParseError
+				mismatch = tt.mismatch && errors.As(err, &perr)
+			}
+			if (has != tt.has && err == nil) || mismatch != tt.mismatch {
+				t.Errorf("v%d %s: VerifyChecksum = %v, %v", v, tt.name, has, err)
+			}
+		}
+	}
+}
+
+func TestCorruptWithoutPairs(t *testing.T) {
+	buf, _ := Encode(V1, []Pair{{"Only", "one"}})
+	if offset := Corrupt(V1, buf); offset != -1 {
+		t.Errorf("Corrupt of a buffer without checksummed pairs = %d, want -1", offset)
+	}
+}
@@ -0,0 +1,226 @@
+// Command dllgen generates the Go bindings of the CustomDLL from its C header:
+// the names of the exported functions and the return codes. It fails if an export
+// the Go side calls changed its signature, so interface changes cannot go unnoticed.
+//
+// Usage:
+//
+//	dllgen -header include/customdll.h -out exports_gen.go -package dllclient
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Signatures the Go callers depend on, by export name (normalized C declarations)
+var expectedSignatures = map[string]string{
+	"CustomFunctionExample": "long CustomFunctionExample(const char* dataIn, char* dataOut)",
+	"GetLastErrorMessage":   "const char* GetLastErrorMessage(void)",
+}
+
+// Go names of the exports, by export name
+var exportConstants = map[string]string{
+	"CustomFunctionExample": "FunctionName",
+	"GetLastErrorMessage":   "LastErrorFunctionName",
+}
+
+// Name of the enum holding the return codes
+const errorCodeEnum = "CustomDLLErrorCode"
+
+var (
+	blockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lineComment  = regexp.MustCompile(`//[^\n]*`)
+	enumDecl     = regexp.MustCompile(`(?s)enum\s+(\w+)\s*\{(.*?)\}\s*;`)
+	exportDecl   = regexp.MustCompile(`CUSTOMDLL_API\s+([^;(]+?)\s*\b(\w+)\s*\(([^)]*)\)\s*;`)
+	space        = regexp.MustCompile(`\s+`)
+	pointer      = regexp.MustCompile(`\s*\*\s*`)
+)
+
+// enumValue is one member of a C enum, with the comment that describes it
+type enumValue struct {
+	Name    string
+	Value   int
+	Comment string
+}
+
+// export is an exported function declaration
+type export struct {
+	Name      string
+	Signature string
+}
+
+func main() {
+	header := flag.String("header", "", "C header to read")
+	out := flag.String("out", "", "Go file to write")
+	pkg := flag.String("package", "dllclient", "package of the generated file")
+	flag.Parse()
+	if *header == "" || *out == "" {
+		log.Fatalf("Usage: dllgen -header FILE -out FILE [-package NAME]")
+	}
+
+	source, err := os.ReadFile(*header)
+	if err != nil {
+		log.Fatalf("Failed to read header: %v", err)
+	}
+	codes, err := parseEnum(string(source), errorCodeEnum)
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %v", *header, err)
+	}
+	exports, err := parseExports(string(source))
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %v", *header, err)
+	}
+
+	code, err := generate(*pkg, filepath.Base(*header), codes, exports)
+	if err != nil {
+		log.Fatalf("Failed to generate bindings: %v", err)
+	}
+	if err := os.WriteFile(*out, code, 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
+
+// parseEnum reads the members of a C enum, one or more per line. Members without
+// a value follow the previous one, as in C. A comment on the line of a single
+// member describes it.
+func parseEnum(source, name string) ([]enumValue, error) {
+	for _, m := range enumDecl.FindAllStringSubmatch(source, -1) {
+		if m[1] != name {
+			continue
+		}
+
+		var values []enumValue
+		next := 0
+		for _, line := range strings.Split(m[2], "\n") {
+			comment := ""
+			if c := blockComment.FindString(line); c != "" {
+				comment = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(c, "/*"), "*/"))
+			}
+			code := lineComment.ReplaceAllString(blockComment.ReplaceAllString(line, ""), "")
+
+			var members []string
+			for _, member := range strings.Split(code, ",") {
+				if member = strings.TrimSpace(member); member != "" {
+					members = append(members, member)
+				}
+			}
+			if len(members) != 1 {
+				comment = ""
+			}
+
+			for _, member := range members {
+				memberName, valueText, hasValue := strings.Cut(member, "=")
+				memberName = strings.TrimSpace(memberName)
+				if hasValue {
+					v, err := strconv.Atoi(strings.TrimSpace(valueText))
+					if err != nil {
+						return nil, fmt.Errorf("enum %s: value of %s is not a number: %s", name, memberName, valueText)
+					}
+					next = v
+				}
+				values = append(values, enumValue{Name: memberName, Value: next, Comment: comment})
+				next++
+			}
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("enum %s has no members", name)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("enum %s not found", name)
+}
+
+// parseExports reads the exported function declarations and checks the ones the
+// Go side calls
+func parseExports(source string) ([]export, error) {
+	source = lineComment.ReplaceAllString(blockComment.ReplaceAllString(source, ""), "")
+
+	found := make(map[string]export)
+	var exports []export
+	for _, m := range exportDecl.FindAllStringSubmatch(source, -1) {
+		e := export{Name: m[2], Signature: normalize(fmt.Sprintf("%s %s(%s)", m[1], m[2], m[3]))}
+		found[e.Name] = e
+		exports = append(exports, e)
+	}
+
+	for name, expected := range expectedSignatures {
+		e, ok := found[name]
+		if !ok {
+			return nil, fmt.Errorf("export %s not found", name)
+		}
+		if e.Signature != normalize(expected) {
+			return nil, fmt.Errorf("export %s changed its signature to %q (the Go side calls %q); update the callers and dllgen", name, e.Signature, expected)
+		}
+	}
+	return exports, nil
+}
+
+// normalize puts a C declaration in a canonical spacing
+func normalize(decl string) string {
+	decl = space.ReplaceAllString(strings.TrimSpace(decl), " ")
+	decl = pointer.ReplaceAllString(decl, "* ")
+	return strings.ReplaceAll(strings.ReplaceAll(decl, "( ", "("), " )", ")")
+}
+
+// goName converts a C constant name such as INVALID_INPUT to InvalidInput
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(strings.ToLower(name), "_") {
+		switch word {
+		case "":
+		case "http", "dll", "id":
+			b.WriteString(strings.ToUpper(word))
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// generate writes the Go source of the bindings
+func generate(pkg, header string, codes []enumValue, exports []export) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by dllgen from %s. DO NOT EDIT.\n\n", header)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+
+	b.WriteString("// Names of the functions the CustomDLL exports\nconst (\n")
+	for _, e := range exports {
+		if constant, ok := exportConstants[e.Name]; ok {
+			fmt.Fprintf(&b, "\t// %s is the export %s\n\t%s = %q\n", constant, e.Signature, constant, e.Name)
+		}
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// ErrorCode is a return code of CustomFunctionExample. Any non-zero code is a failure.\n")
+	b.WriteString("type ErrorCode int\n\n")
+	b.WriteString("// Return codes of CustomFunctionExample\nconst (\n")
+	for _, c := range codes {
+		if c.Comment != "" {
+			fmt.Fprintf(&b, "\t// %s\n", c.Comment)
+		}
+		fmt.Fprintf(&b, "\t%s ErrorCode = %d\n", goName(c.Name), c.Value)
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// errorCodeNames are the C names of the return codes\nvar errorCodeNames = map[ErrorCode]string{\n")
+	for _, c := range codes {
+		fmt.Fprintf(&b, "\t%s: %q,\n", goName(c.Name), c.Name)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// errorCodeDescriptions describe the return codes\nvar errorCodeDescriptions = map[ErrorCode]string{\n")
+	for _, c := range codes {
+		fmt.Fprintf(&b, "\t%s: %q,\n", goName(c.Name), c.Comment)
+	}
+	b.WriteString("}\n")
+
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,56 @@
+// Command hashpassword prints a user entry of a users file (see package auth),
+// with the password read from the first line of standard input hashed with
+// PBKDF2 and a random salt.
+//
+// Usage:
+//
+//	echo -n 'MyPassword' | hashpassword -name alice -role admin
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/auth"
+)
+
+func main() {
+	name := flag.String("name", "", "user name")
+	role := flag.String("role", "viewer", "role of the user: admin, operator or viewer")
+	iterations := flag.Int("iterations", auth.DefaultIterations, "PBKDF2 iterations")
+	flag.Parse()
+	if *name == "" || *iterations < 1 {
+		log.Fatalf("Usage: hashpassword -name NAME [-role ROLE] [-iterations N] < password")
+	}
+	if _, err := auth.ParseRole(*role); err != nil {
+		log.Fatal(err)
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatalf("No password on standard input: %v", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		log.Fatalf("Failed to generate a salt: %v", err)
+	}
+	saltText := hex.EncodeToString(salt)
+
+	entry, _ := json.Marshal(struct {
+		Name           string `json:"name"`
+		Role           string `json:"role"`
+		Salt           string `json:"salt"`
+		Iterations     int    `json:"iterations"`
+		PasswordPBKDF2 string `json:"password_pbkdf2"`
+	}{*name, *role, saltText, *iterations, auth.HashPassword(saltText, password, *iterations)})
+	fmt.Println(string(entry))
+}
@@ -0,0 +1,289 @@
+// Package config loads the settings shared by the Go server and the Contact
+// Center simulator. Each setting is a command-line flag, and can also come from
+// an environment variable or a JSON settings file. In order of precedence:
+//
+//	-port 9090                    a command-line flag
+//	GOSERVER_PORT=9090            the environment variable of the flag: the prefix of
+//	                              the tool, then the flag name in upper case with - as _
+//	{"port": 9090}                the settings file given with -config (or <PREFIX>_CONFIG)
+//	8080                          the default of the flag
+//
+// Values of the file may be JSON strings, numbers or booleans. An array sets a
+// repeatable flag once per element. Keys that are not flags of the tool are
+// rejected, so a typo in a settings file does not go unnoticed.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults shared by both tools
+const (
+	// DefaultServerPort is the port the Go server listens on
+	DefaultServerPort = 8080
+	// DefaultServerURL is where the simulator expects the Go server when the
+	// DLL's config.ini does not say otherwise
+	DefaultServerURL = "http://localhost:8080"
+)
+
+// Name of the flag giving the settings file
+const configFlag = "config"
+
+// Sources of a setting
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Check validates the value of a setting, as its flag prints it
+type Check func(value string) error
+
+// Setting is the effective value of a flag and where it comes from
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Loader loads the flags of a flag set from the command line, the environment
+// and a settings file, then validates them
+type Loader struct {
+	fs        *flag.FlagSet
+	envPrefix string
+	file      *string
+	checks    map[string][]Check
+	secrets   map[string]bool
+	sources   map[string]string
+}
+
+// New creates a loader for the flags of fs, reading environment variables with
+// envPrefix (such as GOSERVER), and adds the -config flag to fs. Define the
+// flags of fs before calling Parse.
+func New(fs *flag.FlagSet, envPrefix string) *Loader {
+	return &Loader{
+		fs:        fs,
+		envPrefix: envPrefix,
+		file:      fs.String(configFlag, "", fmt.Sprintf("JSON file of settings keyed by flag name (environment variables %s_<FLAG> and flags take precedence)", envPrefix)),
+		checks:    make(map[string][]Check),
+		secrets:   make(map[string]bool),
+		sources:   make(map[string]string),
+	}
+}
+
+// Check adds validations of a flag, run by Parse on its effective value
+func (l *Loader) Check(name string, checks ...Check) {
+	l.checks[name] = append(l.checks[name], checks...)
+}
+
+// Secret hides the values of flags, such as passwords, from Settings
+func (l *Loader) Secret(names ...string) {
+	for _, name := range names {
+		l.secrets[name] = true
+	}
+}
+
+// EnvName returns the environment variable of a flag
+func (l *Loader) EnvName(name string) string {
+	return l.envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Parse parses the command-line arguments, then sets the flags they do not set
+// from the environment, then from the settings file, and validates every flag
+// with checks. Every invalid setting is reported in the error.
+func (l *Loader) Parse(args []string) error {
+	if err := l.fs.Parse(args); err != nil {
+		return err
+	}
+	l.fs.Visit(func(f *flag.Flag) {
+		l.sources[f.Name] = SourceFlag
+	})
+
+	var errs []error
+	path := *l.file
+	if l.sources[configFlag] == "" {
+		if env, ok := os.LookupEnv(l.EnvName(configFlag)); ok {
+			path = env
+			l.sources[configFlag] = SourceEnv
+		}
+	}
+	file := map[string]json.RawMessage{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read settings file: %v", err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse settings file %s: %v", path, err)
+		}
+		for name := range file {
+			if name == configFlag || l.fs.Lookup(name) == nil {
+				errs = append(errs, fmt.Errorf("settings file %s: unknown setting '%s'", path, name))
+			}
+		}
+	}
+
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if l.sources[f.Name] != "" || f.Name == configFlag {
+			return
+		}
+		if value, ok := os.LookupEnv(l.EnvName(f.Name)); ok {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q: %v", l.EnvName(f.Name), value, err))
+			}
+			l.sources[f.Name] = SourceEnv
+			return
+		}
+		if raw, ok := file[f.Name]; ok {
+			values, err := fileValues(raw)
+			for _, value := range values {
+				if err == nil {
+					err = f.Value.Set(value)
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid setting '%s' of %s: %v", f.Name, path, err))
+			}
+			l.sources[f.Name] = SourceFile
+			return
+		}
+		l.sources[f.Name] = SourceDefault
+	})
+
+	for _, name := range l.names() {
+		f := l.fs.Lookup(name)
+		for _, check := range l.checks[name] {
+			if err := check(f.Value.String()); err != nil {
+				errs = append(errs, fmt.Errorf("invalid -%s %q (from %s): %v", name, f.Value.String(), l.sources[name], err))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// names returns the checked flags in order
+func (l *Loader) names() []string {
+	var names []string
+	for name := range l.checks {
+		if l.fs.Lookup(name) != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// fileValues converts a value of the settings file to flag values
+func fileValues(raw json.RawMessage) ([]string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+	values := make([]string, len(list))
+	for i, item := range list {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			values[i] = s
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(item, &v); err != nil {
+			return nil, err
+		}
+		switch v.(type) {
+		case float64, bool:
+			values[i] = string(item)
+		default:
+			return nil, fmt.Errorf("expected a string, number or boolean, found %s", item)
+		}
+	}
+	return values, nil
+}
+
+// Source returns where the value of a flag comes from, after Parse
+func (l *Loader) Source(name string) string {
+	return l.sources[name]
+}
+
+// Settings returns the effective value of every flag and its source, sorted by
+// name, with secret values hidden
+func (l *Loader) Settings() []Setting {
+	var settings []Setting
+	l.fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if l.secrets[f.Name] && value != "" {
+			value = "********"
+		}
+		settings = append(settings, Setting{Name: f.Name, Value: value, Source: l.sources[f.Name]})
+	})
+	return settings
+}
+
+// IntRange accepts integers from min to max
+func IntRange(min, max int) Check {
+	return func(value string) error {
+		var n int
+		if _, err := fmt.Sscan(value, &n); err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		if n < min || n > max {
+			return fmt.Errorf("must be from %d to %d", min, max)
+		}
+		return nil
+	}
+}
+
+// FloatRange accepts numbers from min to max
+func FloatRange(min, max float64) Check {
+	return func(value string) error {
+		var f float64
+		if _, err := fmt.Sscan(value, &f); err != nil {
+			return fmt.Errorf("not a number")
+		}
+		if f < min || f > max {
+			return fmt.Errorf("must be between %g and %g", min, max)
+		}
+		return nil
+	}
+}
+
+// MinDuration accepts durations of at least min
+func MinDuration(min time.Duration) Check {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d < min {
+			return fmt.Errorf("must be at least %s", min)
+		}
+		return nil
+	}
+}
+
+// OneOf accepts the given values, ignoring case
+func OneOf(values ...string) Check {
+	return func(value string) error {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return nil
+			}
+		}
+		var valid []string
+		for _, v := range values {
+			if v != "" {
+				valid = append(valid, v)
+			}
+		}
+		return fmt.Errorf("valid values: %s", strings.Join(valid, ", "))
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLoader returns a loader of a -port, -name and repeatable -tag flag
+func newTestLoader() (*Loader, *int, *string, *[]string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("port", DefaultServerPort, "")
+	name := fs.String("name", "default", "")
+	var tags []string
+	fs.Func("tag", "", func(s string) error {
+		tags = append(tags, s)
+		return nil
+	})
+	return New(fs, "TESTTOOL"), port, name, &tags
+}
+
+func writeSettings(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	file := `{"port": 7070, "name": "file", "tag": ["a", "b"]}`
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantPort   int
+		wantSource string
+		wantName   string
+	}{
+		{"default", nil, nil, DefaultServerPort, SourceDefault, "default"},
+		{"file", []string{"-config", "FILE"}, nil, 7070, SourceFile, "file"},
+		{"env over file", []string{"-config", "FILE"}, map[string]string{"TESTTOOL_PORT": "6060"}, 6060, SourceEnv, "file"},
+		{"flag over env", []string{"-config", "FILE", "-port", "5050"}, map[string]string{"TESTTOOL_PORT": "6060"}, 5050, SourceFlag, "file"},
+		{"config file from env", nil, map[string]string{"TESTTOOL_CONFIG": "FILE"}, 7070, SourceFile, "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSettings(t, file)
+			for key, value := range tt.env {
+				t.Setenv(key, strings.ReplaceAll(value, "FILE", path))
+			}
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.ReplaceAll(arg, "FILE", path)
+			}
+
+			l, port, name, _ := newTestLoader()
+			if err := l.Parse(args); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if *port != tt.wantPort || l.Source("port") != tt.wantSource {
+				t.Errorf("port = %d from %s, want %d from %s", *port, l.Source("port"), tt.wantPort, tt.wantSource)
+			}
+			if *name != tt.wantName {
+				t.Errorf("name = %q, want %q", *name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestFileValues(t *testing.T) {
+	l, port, name, tags := newTestLoader()
+	path := writeSettings(t, `{"port": "9090", "name": true, "tag": ["a", 2]}`)
+	if err := l.Parse([]string{"-config", path}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if *port != 9090 || *name != "true" || strings.Join(*tags, ",") != "a,2" {
+		t.Errorf("port = %d, name = %q, tags = %q", *port, *name, *tags)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		check Check
+		err   string
+	}{
+		{"unknown setting", `{"prot": 1}`, nil, nil, "unknown setting 'prot'"},
+		{"config key in file", `{"config": "other.json"}`, nil, nil, "unknown setting 'config'"},
+		{"object value", `{"name": {"a": 1}}`, nil, nil, "invalid setting 'name'"},
+		{"invalid env", `{}`, map[string]string{"TESTTOOL_PORT": "abc"}, nil, "invalid TESTTOOL_PORT"},
+		{"failed check", `{"port": 70000}`, nil, IntRange(1, 65535), "invalid -port \"70000\" (from file)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			l, _, _, _ := newTestLoader()
+			if tt.check != nil {
+				l.Check("port", tt.check)
+			}
+			err := l.Parse([]string{"-config", writeSettings(t, tt.file)})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSettingsHidesSecrets(t *testing.T) {
+	l, _, _, _ := newTestLoader()
+	l.Secret("name")
+	if err := l.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range l.Settings() {
+		if s.Name == "name" && s.Value != "********" {
+			t.Errorf("secret setting shown as %q", s.Value)
+		}
+	}
+}
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		check Check
+		value string
+		ok    bool
+	}{
+		{"int in range", IntRange(1, 10), "5", true},
+		{"int out of range", IntRange(1, 10), "11", false},
+		{"not an int", IntRange(1, 10), "x", false},
+		{"float in range", FloatRange(0, 1), "0.5", true},
+		{"float out of range", FloatRange(0, 1), "1.5", false},
+		{"duration", MinDuration(1e9), "2s", true},
+		{"short duration", MinDuration(1e9), "500ms", false},
+		{"bad duration", MinDuration(1e9), "soon", false},
+		{"one of, ignoring case", OneOf("json", "text"), "JSON", true},
+		{"not one of", OneOf("json", "text"), "xml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check(tt.value); (err == nil) != tt.ok {
+				t.Errorf("check(%q) = %v, want ok %v", tt.value, err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package dllclient calls the CustomDLL from Go. A Client loads the DLL once and
+// then encodes input buffers, invokes the exported function, fetches the DLL's
+// last error message and decodes output buffers, so tools can call the DLL
+// without handling buffers and function pointers themselves.
+//
+// The DLL is loaded with LoadLibrary on Windows, and a shared library build (.so,
+// .dylib) with dlopen on Linux and macOS, which needs cgo. Elsewhere Load returns
+// an error.
+package dllclient
+
+//go:generate go run ../cmd/dllgen -header ../../../include/customdll.h -out exports_gen.go
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// Options describe how a Client exchanges buffers with the DLL
+type Options struct {
+	// Protocol is the buffer protocol version the DLL build speaks (default version 1)
+	Protocol buffer.Version
+	// Checksum appends a CRC32 pair to input buffers and verifies it on output buffers
+	Checksum bool
+	// OutputPairs is the number of pairs the output buffer has room for (default 1,
+	// plus one for the checksum pair)
+	OutputPairs int
+
+	// How Windows finds the DLL's dependencies; ignored elsewhere, where the
+	// loader follows LD_LIBRARY_PATH or DYLD_LIBRARY_PATH.
+	// LoadFlags are LoadLibraryEx flags (0 for the standard search order of LoadLibrary)
+	LoadFlags uint32
+	// SearchDirs are added with AddDllDirectory. They are searched with the
+	// user_dirs or default_dirs flags, which are the default when SearchDirs is set.
+	SearchDirs []string
+	// DllDirectory is set with SetDllDirectory before the DLL is loaded, taking the
+	// place of the working directory in the standard search order. It applies to
+	// the whole process.
+	DllDirectory string
+}
+
+// Result is the outcome of a call. A non-zero return code is not an error: it is
+// the DLL's own report, explained by LastError.
+type Result struct {
+	ReturnCode int
+	// Errno is the system error code left by the call, if any
+	Errno uintptr
+	// Output holds the pairs of the output buffer, without the checksum pair
+	Output []buffer.Pair
+	// LastError is the DLL's error message for a non-zero return code ("" if the
+	// DLL does not export GetLastErrorMessage)
+	LastError string
+	// InputBuffer and OutputBuffer are the raw buffers exchanged with the DLL
+	InputBuffer  []byte
+	OutputBuffer []byte
+}
+
+// Client calls one loaded DLL
+type Client struct {
+	path    string
+	options Options
+	lib     library
+}
+
+// library is a loaded DLL, implemented per platform
+type library interface {
+	// call invokes the exported function with the input and output buffers
+	call(input, output []byte) (int, uintptr)
+	// lastError returns the DLL's last error message, and false if the DLL has no
+	// GetLastErrorMessage function
+	lastError() (string, bool)
+	hasLastError() bool
+	close() error
+}
+
+// Extension returns the file extension of libraries on this platform
+func Extension() string {
+	switch runtime.GOOS {
+	case "windows":
+		return ".dll"
+	case "darwin":
+		return ".dylib"
+	default:
+		return ".so"
+	}
+}
+
+// Load loads the DLL at path
+func Load(path string, options Options) (*Client, error) {
+	if options.Protocol == 0 {
+		options.Protocol = buffer.V1
+	}
+	if _, err := buffer.ParseVersion(int(options.Protocol)); err != nil {
+		return nil, err
+	}
+	if options.OutputPairs <= 0 {
+		options.OutputPairs = 1
+	}
+
+	lib, err := openLibrary(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{path: path, options: options, lib: lib}, nil
+}
+
+// Path returns the path the DLL was loaded from
+func (c *Client) Path() string {
+	return c.path
+}
+
+// HasLastError reports whether the DLL exports GetLastErrorMessage
+func (c *Client) HasLastError() bool {
+	return c.lib.hasLastError()
+}
+
+// LastError returns the DLL's last error message, and false if the DLL does not
+// export GetLastErrorMessage
+func (c *Client) LastError() (string, bool) {
+	return c.lib.lastError()
+}
+
+// Invoke calls the DLL function with raw buffers, for callers that build or
+// inspect buffers themselves. It returns the DLL's return code and the system
+// error code. If ctx ends first, Invoke returns its error; the DLL call itself
+// cannot be interrupted and finishes in the background.
+func (c *Client) Invoke(ctx context.Context, input, output []byte) (int, uintptr, error) {
+	if len(input) == 0 || len(output) == 0 {
+		return 0, 0, fmt.Errorf("input and output buffers must not be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	type outcome struct {
+		ret   int
+		errno uintptr
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		ret, errno := c.lib.call(input, output)
+		done <- outcome{ret, errno}
+	}()
+
+	select {
+	case o := <-done:
+		return o.ret, o.errno, nil
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	}
+}
+
+// Call encodes the parameters, calls the DLL and decodes its output. It returns an
+// error if the parameters cannot be encoded, ctx ends, or the output buffer is
+// malformed (a *buffer.ParseError) or fails its checksum (a *buffer.ChecksumError);
+// in the last two cases the result is returned too.
+func (c *Client) Call(ctx context.Context, params []buffer.Pair) (Result, error) {
+	v := c.options.Protocol
+	var input []byte
+	var err error
+	if c.options.Checksum {
+		input, err = buffer.EncodeWithChecksum(v, params)
+	} else {
+		input, err = buffer.Encode(v, params)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("cannot encode the parameters: %w", err)
+	}
+
+	outputPairs := c.options.OutputPairs
+	if c.options.Checksum {
+		outputPairs++
+	}
+	output := make([]byte, v.Size(outputPairs))
+
+	ret, errno, err := c.Invoke(ctx, input, output)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{ReturnCode: ret, Errno: errno, InputBuffer: input, OutputBuffer: output}
+	if ret != 0 {
+		result.LastError, _ = c.lib.lastError()
+	}
+
+	pairs, err := buffer.Decode(v, output)
+	if c.options.Checksum && err == nil && len(pairs) > 0 {
+		present, checksumErr := buffer.VerifyChecksum(v, output)
+		if !present {
+			checksumErr = fmt.Errorf("output buffer has no %s checksum pair", buffer.ChecksumKey)
+		}
+		err = checksumErr
+		if present {
+			pairs = pairs[:len(pairs)-1]
+		}
+	}
+	result.Output = pairs
+	return result, err
+}
+
+// Close unloads the DLL
+func (c *Client) Close() error {
+	return c.lib.close()
+}
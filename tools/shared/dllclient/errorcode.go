@@ -0,0 +1,19 @@
+package dllclient
+
+import "fmt"
+
+// String returns the C name of the return code, such as INVALID_INPUT
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return "UNKNOWN_ERROR"
+}
+
+// Description describes the return code
+func (c ErrorCode) Description() string {
+	if description, ok := errorCodeDescriptions[c]; ok {
+		return description
+	}
+	return fmt.Sprintf("Unknown return code %d", int(c))
+}
@@ -0,0 +1,54 @@
+// Code generated by dllgen from customdll.h. DO NOT EDIT.
+
+package dllclient
+
+// Names of the functions the CustomDLL exports
+const (
+	// FunctionName is the export long CustomFunctionExample(const char* dataIn, char* dataOut)
+	FunctionName = "CustomFunctionExample"
+	// LastErrorFunctionName is the export const char* GetLastErrorMessage(void)
+	LastErrorFunctionName = "GetLastErrorMessage"
+)
+
+// ErrorCode is a return code of CustomFunctionExample. Any non-zero code is a failure.
+type ErrorCode int
+
+// Return codes of CustomFunctionExample
+const (
+	// Success
+	Success ErrorCode = 0
+	// Invalid input parameters
+	InvalidInput ErrorCode = 1
+	// Too many parameters
+	TooManyParameters ErrorCode = 2
+	// CURL initialization failed
+	CurlInitFailed ErrorCode = 3
+	// CURL request failed
+	CurlRequestFailed ErrorCode = 4
+	// HTTP error
+	HTTPError ErrorCode = 5
+	// Unexpected exception
+	UnexpectedException ErrorCode = 6
+)
+
+// errorCodeNames are the C names of the return codes
+var errorCodeNames = map[ErrorCode]string{
+	Success:             "SUCCESS",
+	InvalidInput:        "INVALID_INPUT",
+	TooManyParameters:   "TOO_MANY_PARAMETERS",
+	CurlInitFailed:      "CURL_INIT_FAILED",
+	CurlRequestFailed:   "CURL_REQUEST_FAILED",
+	HTTPError:           "HTTP_ERROR",
+	UnexpectedException: "UNEXPECTED_EXCEPTION",
+}
+
+// errorCodeDescriptions describe the return codes
+var errorCodeDescriptions = map[ErrorCode]string{
+	Success:             "Success",
+	InvalidInput:        "Invalid input parameters",
+	TooManyParameters:   "Too many parameters",
+	CurlInitFailed:      "CURL initialization failed",
+	CurlRequestFailed:   "CURL request failed",
+	HTTPError:           "HTTP error",
+	UnexpectedException: "Unexpected exception",
+}
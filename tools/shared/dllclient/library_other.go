@@ -0,0 +1,14 @@
+//go:build !windows && !((linux || darwin) && cgo)
+
+package dllclient
+
+import "fmt"
+
+// openLibrary fails: libraries can only be loaded on Windows, and on Linux and
+// macOS in builds with cgo
+func openLibrary(path string, options Options) (library, error) {
+	return nil, fmt.Errorf("failed to load library %s: this build cannot load libraries (Windows, or Linux and macOS with cgo, are needed)", path)
+}
+
+// FlushStdio does nothing, as no library can be loaded
+func FlushStdio() {}
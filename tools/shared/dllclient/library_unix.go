@@ -0,0 +1,106 @@
+//go:build (linux || darwin) && cgo
+
+package dllclient
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef long (*custom_function)(const char*, char*);
+typedef const char* (*last_error_function)(void);
+
+static long call_function(void* f, char* input, char* output) {
+	return ((custom_function)f)(input, output);
+}
+
+static const char* call_last_error(void* f) {
+	return ((last_error_function)f)();
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// unixLibrary is a shared library loaded with dlopen
+type unixLibrary struct {
+	handle            unsafe.Pointer
+	function          unsafe.Pointer
+	lastErrorFunction unsafe.Pointer
+}
+
+// openLibrary loads a shared library and looks up its functions
+func openLibrary(path string, options Options) (library, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	handle := C.dlopen(cpath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("failed to load library: %s", C.GoString(C.dlerror()))
+	}
+	lib := &unixLibrary{handle: handle}
+
+	function, err := lookup(handle, FunctionName)
+	if err != nil {
+		C.dlclose(handle)
+		return nil, fmt.Errorf("failed to get function pointer: %v", err)
+	}
+	lib.function = function
+
+	// Older builds do not have GetLastErrorMessage
+	lib.lastErrorFunction, _ = lookup(handle, LastErrorFunctionName)
+	return lib, nil
+}
+
+// lookup finds an exported symbol of the library
+func lookup(handle unsafe.Pointer, name string) (unsafe.Pointer, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	C.dlerror()
+	symbol := C.dlsym(handle, cname)
+	if symbol == nil {
+		return nil, errors.New(C.GoString(C.dlerror()))
+	}
+	return symbol, nil
+}
+
+func (l *unixLibrary) call(input, output []byte) (int, uintptr) {
+	ret, err := C.call_function(l.function,
+		(*C.char)(unsafe.Pointer(&input[0])),
+		(*C.char)(unsafe.Pointer(&output[0])))
+	var errno syscall.Errno
+	errors.As(err, &errno)
+	return int(ret), uintptr(errno)
+}
+
+func (l *unixLibrary) hasLastError() bool {
+	return l.lastErrorFunction != nil
+}
+
+func (l *unixLibrary) lastError() (string, bool) {
+	if l.lastErrorFunction == nil {
+		return "", false
+	}
+	return C.GoString(C.call_last_error(l.lastErrorFunction)), true
+}
+
+func (l *unixLibrary) close() error {
+	if C.dlclose(l.handle) != 0 {
+		return errors.New(C.GoString(C.dlerror()))
+	}
+	return nil
+}
+
+// FlushStdio flushes the C standard output streams of the process, so what the
+// library printed reaches the process's standard handles
+func FlushStdio() {
+	C.fflush(nil)
+}
@@ -0,0 +1,157 @@
+package dllclient
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procLoadLibraryExW     = kernel32.NewProc("LoadLibraryExW")
+	procAddDllDirectory    = kernel32.NewProc("AddDllDirectory")
+	procRemoveDllDirectory = kernel32.NewProc("RemoveDllDirectory")
+	procSetDllDirectoryW   = kernel32.NewProc("SetDllDirectoryW")
+)
+
+// windowsLibrary is a DLL loaded with LoadLibrary or LoadLibraryEx
+type windowsLibrary struct {
+	handle            syscall.Handle
+	function          uintptr
+	lastErrorFunction uintptr
+	// directories added with AddDllDirectory, removed when the DLL is unloaded
+	directories []uintptr
+}
+
+// openLibrary loads a DLL and looks up its functions
+func openLibrary(path string, options Options) (library, error) {
+	lib := &windowsLibrary{}
+	if options.DllDirectory != "" {
+		dir, err := syscall.UTF16PtrFromString(options.DllDirectory)
+		if err != nil {
+			return nil, err
+		}
+		if ret, _, err := procSetDllDirectoryW.Call(uintptr(unsafe.Pointer(dir))); ret == 0 {
+			return nil, fmt.Errorf("failed to set the DLL directory %s: %w", options.DllDirectory, err)
+		}
+	}
+	for _, d := range options.SearchDirs {
+		dir, err := syscall.UTF16PtrFromString(d)
+		if err != nil {
+			lib.removeDirectories()
+			return nil, err
+		}
+		cookie, _, err := procAddDllDirectory.Call(uintptr(unsafe.Pointer(dir)))
+		if cookie == 0 {
+			lib.removeDirectories()
+			return nil, fmt.Errorf("failed to add the DLL search directory %s: %w", d, err)
+		}
+		lib.directories = append(lib.directories, cookie)
+	}
+
+	flags := options.LoadFlags
+	if flags == 0 && len(options.SearchDirs) > 0 {
+		flags = LoadLibrarySearchDLLLoadDir | LoadLibrarySearchDefaultDirs
+	}
+	var err error
+	if flags == 0 {
+		lib.handle, err = syscall.LoadLibrary(path)
+	} else {
+		lib.handle, err = loadLibraryEx(path, flags)
+	}
+	if err != nil {
+		lib.removeDirectories()
+		return nil, fmt.Errorf("failed to load DLL: %w", err)
+	}
+	handle := lib.handle
+
+	lib.function, err = syscall.GetProcAddress(handle, FunctionName)
+	if err != nil {
+		syscall.FreeLibrary(handle)
+		lib.removeDirectories()
+		return nil, fmt.Errorf("failed to get function pointer: %v", err)
+	}
+
+	// Older DLLs do not have GetLastErrorMessage
+	lib.lastErrorFunction, _ = syscall.GetProcAddress(handle, LastErrorFunctionName)
+	return lib, nil
+}
+
+// loadLibraryEx loads a DLL with LoadLibraryExW
+func loadLibraryEx(path string, flags uint32) (syscall.Handle, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	handle, _, err := procLoadLibraryExW.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(flags))
+	if handle == 0 {
+		return 0, err
+	}
+	return syscall.Handle(handle), nil
+}
+
+// removeDirectories removes the search directories the DLL added
+func (l *windowsLibrary) removeDirectories() {
+	for _, cookie := range l.directories {
+		procRemoveDllDirectory.Call(cookie)
+	}
+	l.directories = nil
+}
+
+func (l *windowsLibrary) call(input, output []byte) (int, uintptr) {
+	ret, _, errno := syscall.Syscall(l.function, 2,
+		uintptr(unsafe.Pointer(&input[0])),
+		uintptr(unsafe.Pointer(&output[0])),
+		0)
+	return int(ret), uintptr(errno)
+}
+
+func (l *windowsLibrary) hasLastError() bool {
+	return l.lastErrorFunction != 0
+}
+
+func (l *windowsLibrary) lastError() (string, bool) {
+	if l.lastErrorFunction == 0 {
+		return "", false
+	}
+
+	// The function returns a pointer to a NUL-terminated string owned by the DLL
+	ptr, _, _ := syscall.Syscall(l.lastErrorFunction, 0, 0, 0, 0)
+	if ptr == 0 {
+		return "", true
+	}
+	start := *(*unsafe.Pointer)(unsafe.Pointer(&ptr))
+	var message []byte
+	for i := 0; ; i++ {
+		b := *(*byte)(unsafe.Add(start, i))
+		if b == 0 {
+			break
+		}
+		message = append(message, b)
+	}
+	return string(message), true
+}
+
+func (l *windowsLibrary) close() error {
+	defer l.removeDirectories()
+	return syscall.FreeLibrary(l.handle)
+}
+
+// C runtimes whose standard output streams FlushStdio flushes
+var crtDLLs = []string{"ucrtbase.dll", "msvcrt.dll"}
+
+// FlushStdio flushes the C standard output streams of the process, so what the
+// DLL printed reaches the process's standard handles. Only the shared C runtimes
+// are flushed: a DLL linked with the static runtime keeps its own buffers.
+func FlushStdio() {
+	for _, name := range crtDLLs {
+		crt, err := syscall.LoadLibrary(name)
+		if err != nil {
+			continue
+		}
+		if fflush, err := syscall.GetProcAddress(crt, "fflush"); err == nil {
+			syscall.SyscallN(fflush, 0)
+		}
+		syscall.FreeLibrary(crt)
+	}
+}
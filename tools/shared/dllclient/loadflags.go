@@ -0,0 +1,49 @@
+package dllclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LoadLibraryEx flags controlling where Windows looks for the DLL's dependencies
+const (
+	LoadWithAlteredSearchPath       = 0x00000008
+	LoadLibrarySearchDLLLoadDir     = 0x00000100
+	LoadLibrarySearchApplicationDir = 0x00000200
+	LoadLibrarySearchUserDirs       = 0x00000400
+	LoadLibrarySearchSystem32       = 0x00000800
+	LoadLibrarySearchDefaultDirs    = 0x00001000
+)
+
+// loadFlagNames are the load flags by the names used in configuration
+var loadFlagNames = map[string]uint32{
+	"altered_search_path": LoadWithAlteredSearchPath,
+	"dll_load_dir":        LoadLibrarySearchDLLLoadDir,
+	"application_dir":     LoadLibrarySearchApplicationDir,
+	"user_dirs":           LoadLibrarySearchUserDirs,
+	"system32":            LoadLibrarySearchSystem32,
+	"default_dirs":        LoadLibrarySearchDefaultDirs,
+}
+
+// ParseLoadFlags combines load flags given by name (dll_load_dir, application_dir,
+// user_dirs, system32, default_dirs and altered_search_path), case-insensitively
+// and with or without the LOAD_LIBRARY_SEARCH_ prefix
+func ParseLoadFlags(names []string) (uint32, error) {
+	var flags uint32
+	for _, name := range names {
+		key := strings.ToLower(name)
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "load_library_search_"), "load_with_")
+		flag, ok := loadFlagNames[key]
+		if !ok {
+			valid := make([]string, 0, len(loadFlagNames))
+			for n := range loadFlagNames {
+				valid = append(valid, n)
+			}
+			sort.Strings(valid)
+			return 0, fmt.Errorf("unknown load flag '%s' (valid flags: %s)", name, strings.Join(valid, ", "))
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
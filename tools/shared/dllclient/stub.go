@@ -0,0 +1,111 @@
+package dllclient
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cristiangirlea/OScapeDLCapture/tools/shared/buffer"
+)
+
+// StubResponsePrefix starts the CFResp values written by the stub
+const StubResponsePrefix = "STUB "
+
+// NewStub returns a Client that answers calls itself instead of calling a DLL, for
+// platforms where the DLL cannot be loaded. It checks the input buffer like the
+// DLL (failing with InvalidInput and a last error message), and with CFResp=yes
+// returns the query the DLL would have sent, prefixed with StubResponsePrefix.
+// The buffer protocol version and checksum follow the input buffer.
+func NewStub(path string) *Client {
+	return &Client{path: path, options: Options{Protocol: buffer.V1, OutputPairs: 1}, lib: &stubLibrary{}}
+}
+
+// IsStub reports whether the client is a stub that calls no DLL
+func (c *Client) IsStub() bool {
+	_, ok := c.lib.(*stubLibrary)
+	return ok
+}
+
+// stubLibrary answers calls without a DLL
+type stubLibrary struct {
+	mu      sync.Mutex
+	message string
+}
+
+func (l *stubLibrary) call(input, output []byte) (int, uintptr) {
+	v := buffer.DetectVersion(input)
+	pairs, err := buffer.Decode(v, input)
+	if err != nil {
+		return l.fail(InvalidInput, "Invalid input: %v", err)
+	}
+
+	checksum := len(pairs) > 0 && pairs[len(pairs)-1].Key == buffer.ChecksumKey
+	if checksum {
+		if _, err := buffer.VerifyChecksum(v, input); err != nil {
+			return l.fail(InvalidInput, "Invalid input: %v", err)
+		}
+		pairs = pairs[:len(pairs)-1]
+	}
+
+	params := make(map[string]string, len(pairs))
+	var keys []string
+	for _, p := range pairs {
+		params[p.Key] = p.Value
+		if p.Key != "CFResp" {
+			keys = append(keys, p.Key)
+		}
+	}
+	if params["CFResp"] != "yes" {
+		return int(Success), 0
+	}
+
+	sort.Strings(keys)
+	var query []string
+	for _, key := range keys {
+		query = append(query, key+"="+url.QueryEscape(params[key]))
+	}
+	response := StubResponsePrefix + strings.Join(query, "&")
+	if len(response) > buffer.ValueSize-1 {
+		response = response[:buffer.ValueSize-1]
+	}
+
+	out := []buffer.Pair{{Key: "CFResp", Value: response}}
+	var data []byte
+	if checksum {
+		data, err = buffer.EncodeWithChecksum(v, out)
+	} else {
+		data, err = buffer.Encode(v, out)
+	}
+	if err != nil {
+		return l.fail(UnexpectedException, "Cannot encode the response: %v", err)
+	}
+	if len(data) > len(output) {
+		return l.fail(UnexpectedException, "Output buffer too small for the response (%d bytes needed, %d available)", len(data), len(output))
+	}
+	copy(output, data)
+	return int(Success), 0
+}
+
+// fail records the error message and returns the code
+func (l *stubLibrary) fail(code ErrorCode, format string, args ...any) (int, uintptr) {
+	l.mu.Lock()
+	l.message = fmt.Sprintf(format, args...)
+	l.mu.Unlock()
+	return int(code), 0
+}
+
+func (l *stubLibrary) hasLastError() bool {
+	return true
+}
+
+func (l *stubLibrary) lastError() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.message, true
+}
+
+func (l *stubLibrary) close() error {
+	return nil
+}
@@ -0,0 +1,3 @@
+module github.com/cristiangirlea/OScapeDLCapture/tools/shared
+
+go 1.24